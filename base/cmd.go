@@ -15,4 +15,5 @@ const (
 	CmdAsking        = 0x0800
 	CmdFast          = 0x1000
 	CmdPropagate     = 0x2000 // 当这个命令被master传过来的要传给下游的，就需要有这个属性，所以写命令几乎都有这个属性
+	CmdTx            = 0x4000 // 事务控制命令，MULTI 之后也立即执行，不放进事务的队列
 )
@@ -1,6 +1,8 @@
 package base
 
 import (
+	"time"
+
 	"github.com/hdt3213/rdb/core"
 )
 
@@ -41,6 +43,7 @@ type DB interface {
 	FreshNormal()
 	SaveRDB(rdb *core.Encoder) error
 	Flush()
+	ActiveExpireCycle(timeLimit time.Duration) bool
 }
 
 // SDB 面向命令的DB模型
@@ -50,7 +53,13 @@ type SDB interface {
 	RangeKV(ch <-chan struct{}) chan DBKV
 	PutData(key string, val interface{}) int
 	GetData(key string) (interface{}, bool)
+	GetDataForWrite(key string) (interface{}, bool)
 	RemoveData(keys ...string) int
+	RandomKey() (string, bool)
+	Scan(cursor uint64, count int) ([]string, uint64)
+	SetExpire(key string, when time.Time)
+	GetExpire(key string) (time.Time, bool)
+	Persist(key string) int
 	NotifyMoving(i int)
 	Flush()
 	MoveData()
@@ -62,7 +71,7 @@ type SDB interface {
 type DBKV struct {
 	//Index int
 	DictKV
-	TTL int64
+	TTL int64 // 剩余的存活时间，单位毫秒，0表示不会过期
 }
 
 type DictKV struct {
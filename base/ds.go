@@ -1,5 +1,7 @@
 package base
 
+import "strconv"
+
 type CmpFunc func(interface{}) bool
 
 type LList interface {
@@ -24,16 +26,25 @@ type RList interface {
 	RemoveFirst(cmp func(interface{}) bool) interface{}
 	Range(ch <-chan struct{}) chan interface{}
 	LRange(from, to int64) []interface{}
+	Walk(fromTail bool, fn func(pos int64, val interface{}) bool)
+	Index(pos int64) (interface{}, bool)
+	Set(pos int64, val interface{}) bool
+	PopHead() interface{}
+	PopTail() interface{}
+	Trim(from, to int64)
 	Clear()
 }
 
 type Dict interface {
 	Get(key string) (val interface{}, exists bool)
 	Put(key string, val interface{}) int
+	Del(key string) int
 	RangeKey(ch <-chan struct{}) chan string
 	RangeKV(ch <-chan struct{}) chan DictKV
 	GetAllKeys() []string
 	RandomKey(num int) []string
+	PickRandomKey() (string, bool)
+	Scan(cursor uint64, fn func(key string, val interface{})) uint64
 	UnLock()
 	Lock()
 	Len() int
@@ -41,28 +52,214 @@ type Dict interface {
 }
 
 type Set interface {
-	Get(key string) (val interface{}, exists bool)
-	Put(key string, val interface{}) int
-	RangeKey(ch <-chan struct{}) chan string
-	RangeKV(ch <-chan struct{}) chan DictKV
+	Add(member string) int
+	Remove(member string) int
+	Has(member string) bool
+	Members() []string
+	RandomMembers(num int) []string
+	RandomDistinctMembers(num int) []string
+	Range(ch <-chan struct{}) chan string
+	Scan(cursor uint64, fn func(member string)) uint64
 	Len() int
 	Clear()
 }
 
 type ZSet interface {
-	Get(key string) (val interface{}, exists bool)
-	Put(key string, val interface{}) int
-	RangeKey(ch <-chan struct{}) chan string
-	Len() int
+	Add(member string, score float64) int
+	Remove(member string) int
+	Score(member string) (float64, bool)
+	Rank(member string, reverse bool) (int64, bool)
+	RangeByRank(start, stop int64, reverse bool) []ZEntry
+	RangeByScore(min, max ScoreBorder, offset, count int64, reverse bool) []ZEntry
+	RangeByLex(min, max LexBorder, offset, count int64, reverse bool) []ZEntry
+	Count(min, max ScoreBorder) int64
+	LexCount(min, max LexBorder) int64
+	RemoveRangeByScore(min, max ScoreBorder) int64
+	RemoveRangeByLex(min, max LexBorder) int64
+	RemoveRangeByRank(start, stop int64) int64
+	RandomMembers(num int64) []ZEntry
+	RandomDistinctMembers(num int64) []ZEntry
+	Range(ch <-chan struct{}) chan ZEntry
+	Scan(cursor uint64, fn func(entry ZEntry)) uint64
+	Len() int64
 	Clear()
 }
 
+// ZEntry zset中的一个成员及其分数
+type ZEntry struct {
+	Member string
+	Score  float64
+}
+
+// ScoreBorder zset按分数查找时的区间边界，Exclude 为true时表示开区间，比如 (1.5
+type ScoreBorder struct {
+	Value   float64
+	Exclude bool
+}
+
+// LexBorder zset按字典序查找时的区间边界
+// Inf < 0 表示 "-"，即负无穷，Inf > 0 表示 "+"，即正无穷，此时 Value, Exclude 无意义
+type LexBorder struct {
+	Value   string
+	Exclude bool
+	Inf     int
+}
+
 type RString string
 
+// RBytes 可以原地修改的字符串，对应redis的raw编码
+// setbit, bitfield, append, setrange 只改动字符串的一部分，用它存储就不用每次复制整个字符串，
+// bgsave 期间 db 中的值不能被修改，由 GetDataForWrite 通过 Clone 复制一份再改
+type RBytes struct {
+	Buf []byte
+}
+
+func (b *RBytes) String() string {
+	return string(b.Buf)
+}
+
+func (b *RBytes) Clone() interface{} {
+	return &RBytes{Buf: append([]byte(nil), b.Buf...)}
+}
+
+// RInt 能用int64无损表示的字符串，以整数编码存储，incr 等命令不用每次都重新解析
+type RInt int64
+
+func (i RInt) String() string {
+	return strconv.FormatInt(int64(i), 10)
+}
+
+// SharedIntegers 共享的小整数的数量，和redis一样是 0~9999
+const SharedIntegers = 10000
+
+// sharedInts 预先装箱好的小整数，存入db时直接复用，不用每次都分配内存
+var sharedInts = func() []interface{} {
+	ret := make([]interface{}, SharedIntegers)
+	for i := range ret {
+		ret[i] = RInt(i)
+	}
+	return ret
+}()
+
+// NewInt 返回整数编码的字符串值，小整数使用共享的对象
+func NewInt(n int64) interface{} {
+	if n >= 0 && n < SharedIntegers {
+		return sharedInts[n]
+	}
+	return RInt(n)
+}
+
+// NewString 把字符串转换成db中存储的值，能用int64无损表示的以 RInt 存储，其余的以 RString 存储
+// "01", "+1" 这种转换回字符串后和原来不一样的，不能用整数编码
+func NewString(val string) interface{} {
+	if len(val) == 0 || len(val) > 20 {
+		return RString(val)
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != val {
+		return RString(val)
+	}
+	return NewInt(n)
+}
+
+// IsSharedInt 判断值是不是共享的小整数
+func IsSharedInt(val interface{}) bool {
+	n, ok := val.(RInt)
+	return ok && n >= 0 && n < SharedIntegers
+}
+
+// StreamID stream 中消息的ID，格式为 ms-seq，ms 是毫秒时间戳，seq 是同一毫秒内的序号
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare 比较两个ID的大小，小于、等于、大于分别返回 -1, 0, 1
+func (id StreamID) Compare(o StreamID) int {
+	switch {
+	case id.Ms < o.Ms || (id.Ms == o.Ms && id.Seq < o.Seq):
+		return -1
+	case id == o:
+		return 0
+	}
+	return 1
+}
+
+// StreamEntry stream 中的一条消息，Fields 是 field value 交替排列的
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+type Stream interface {
+	Add(id StreamID, fields []string) bool
+	Delete(id StreamID) int
+	Range(start, end StreamID, count int64, reverse bool) []StreamEntry
+	TrimByLen(maxLen int64, approx bool, limit int64) int64
+	TrimByMinID(minID StreamID, approx bool, limit int64) int64
+	NextID(ms uint64) (StreamID, bool)
+	FirstID() StreamID
+	LastID() StreamID
+	EntriesAdded() uint64
+	MaxDeletedID() StreamID
+	SetID(last StreamID, entriesAdded uint64, maxDeleted StreamID)
+	CreateGroup(name string, lastID StreamID, entriesRead int64) bool
+	DestroyGroup(name string) int
+	Group(name string) (StreamGroup, bool)
+	Groups() []StreamGroup
+	ReadGroup(group, consumer string, count int64, noAck bool, now int64) []StreamEntry
+	Lag(group string) (int64, bool)
+	Len() int64
+	Clear()
+}
+
+// StreamNACK 已经投递给消费者，但是还没有被 xack 确认的消息，DeliveryTime 是毫秒时间戳
+type StreamNACK struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  int64
+	DeliveryCount int64
+}
+
+// StreamConsumer 消费者的信息，时间都是毫秒时间戳，ActiveTime 为-1表示从来没有成功读取过消息
+type StreamConsumer struct {
+	Name       string
+	SeenTime   int64
+	ActiveTime int64
+	Pending    int64
+}
+
+// StreamGroup 消费者组，EntriesRead 为-1表示已读的消息数未知
+type StreamGroup interface {
+	Name() string
+	LastID() StreamID
+	EntriesRead() int64
+	SetLastID(id StreamID, entriesRead int64)
+	TouchConsumer(name string, now int64) bool
+	DeleteConsumer(name string) (int64, bool)
+	Consumers() []StreamConsumer
+	PendingLen() int64
+	NACK(id StreamID) (StreamNACK, bool)
+	Pending(start, end StreamID, count int64, consumer string, filter func(StreamNACK) bool) []StreamNACK
+	Ack(id StreamID) int
+	Claim(id StreamID, consumer string, deliveryTime, deliveryCount, now int64)
+}
+
 //type RList LList
 type RHash Dict
 type RSet Set
 type RZSet ZSet
+type RStream Stream
+
+// Cloner 可以被复制的值
+// 在bgsave期间，db中的值正在被存盘，写命令不能原地修改它们，只能复制一份到 bgDB 中再修改
+type Cloner interface {
+	Clone() interface{}
+}
 
 // Null 当需要删除某个key，但是由于bgsave等命令不能删除的时候，在bgDB中对该key置位为Null
 // 注意！该值永远不可能存在于 db 中，只能存在于 bgDB 中！！！
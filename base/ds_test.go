@@ -0,0 +1,58 @@
+package base
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestNewString(t *testing.T) {
+	tests := []struct {
+		val  string
+		want interface{}
+	}{
+		{"0", RInt(0)},
+		{"9999", RInt(9999)},
+		{"-1", RInt(-1)},
+		{"10000", RInt(10000)},
+		{strconv.FormatInt(math.MaxInt64, 10), RInt(math.MaxInt64)},
+		{strconv.FormatInt(math.MinInt64, 10), RInt(math.MinInt64)},
+		// 转换回字符串后和原来不一样的不能用整数编码
+		{"9223372036854775808", RString("9223372036854775808")},
+		{"01", RString("01")},
+		{"+1", RString("+1")},
+		{"-0", RString("-0")},
+		{" 1", RString(" 1")},
+		{"1.0", RString("1.0")},
+		{"", RString("")},
+		{"abc", RString("abc")},
+	}
+	for _, tt := range tests {
+		if get := NewString(tt.val); get != tt.want {
+			t.Errorf("%q: want %T %v, get %T %v", tt.val, tt.want, tt.want, get, get)
+		}
+	}
+}
+
+func TestNewInt_Shared(t *testing.T) {
+	for _, n := range []int64{0, 1, SharedIntegers - 1} {
+		if !IsSharedInt(NewInt(n)) {
+			t.Errorf("%v should be shared", n)
+		}
+		if NewInt(n).(RInt).String() != strconv.FormatInt(n, 10) {
+			t.Errorf("%v: wrong string %v", n, NewInt(n))
+		}
+	}
+	for _, n := range []int64{-1, SharedIntegers, math.MaxInt64} {
+		if IsSharedInt(NewInt(n)) {
+			t.Errorf("%v should not be shared", n)
+		}
+	}
+	if IsSharedInt(RString("1")) {
+		t.Errorf("RString should not be shared")
+	}
+	// 共享的小整数存入db时不分配内存
+	if n := testing.AllocsPerRun(100, func() { _ = NewInt(1234) }); n != 0 {
+		t.Errorf("want no allocation for shared ints, get %v", n)
+	}
+}
@@ -14,3 +14,20 @@ var (
 
 	NeedSave = make(chan int)
 )
+
+// OnKeyExpired key因为过期被删除时调用，由上层设置，比如向slave传播 del
+// 过期删除发生在主协程执行命令的过程中，要在命令执行完之前就处理好，所以不用channel
+var OnKeyExpired = func(dbIndex int, key string) {}
+
+// OnKeyModified key被写命令修改、删除、或者改了过期时间时调用，由上层设置，用于 WATCH
+// 只在 SDB 的写接口中调用，bgsave之后把 bgDB 搬回 db 不算修改
+var OnKeyModified = func(dbIndex int, key string) {}
+
+// IsSlave 自己是否是slave，由上层设置
+// slave 不会自己删除过期的key，要等 master 传播 del，在这之前只把过期的key当作不存在
+var IsSlave = func() bool { return false }
+
+// FromMaster 自己是slave时，主协程是否正在执行 master 传播过来的命令，由上层设置
+// master 上没过期的key才会被 master 的命令访问到，所以这时不把逻辑过期的key当作不存在，
+// 否则 master 对这个key的写命令会在 slave 上新建一个值，却沿用原来已经过期的过期时间
+var FromMaster = func() bool { return false }
@@ -0,0 +1,562 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// 位图命令，把字符串当成字节数组操作，和redis一样，第0位是第0个字节的最高位
+// 写入时都存成 base.RBytes，原地修改，不用每次复制整个字符串
+
+// maxBitOffset 位偏移的最大值，字符串最大 512MB
+const maxBitOffset = maxStringSize*8 - 1
+
+var bitOffsetErrReply = redis.ErrReply("ERR bit offset is not an integer or out of range")
+
+// parseBitOffset 解析位偏移，hash 为true时支持 #N 的形式，表示第N个 bitsNum 宽度的整数
+func parseBitOffset(arg string, hash bool, bitsNum int) (int64, base.Reply) {
+	mul := int64(1)
+	if hash && strings.HasPrefix(arg, "#") {
+		arg, mul = arg[1:], int64(bitsNum)
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 || n > maxBitOffset/mul {
+		return 0, bitOffsetErrReply
+	}
+	n *= mul
+	if n+int64(bitsNum)-1 > maxBitOffset {
+		return 0, bitOffsetErrReply
+	}
+	return n, nil
+}
+
+// getBit 获取第offset位，超出长度的部分视为0
+func getBit(buf []byte, offset int64) int {
+	if offset>>3 >= int64(len(buf)) {
+		return 0
+	}
+	return int(buf[offset>>3]>>(7-uint(offset&7))) & 1
+}
+
+// setBit 设置第offset位，调用者要保证buf足够长
+func setBit(buf []byte, offset int64, on int) {
+	mask := byte(1) << (7 - uint(offset&7))
+	if on != 0 {
+		buf[offset>>3] |= mask
+	} else {
+		buf[offset>>3] &^= mask
+	}
+}
+
+// growBytes 把buf补0扩展到至少size字节
+func growBytes(buf []byte, size int64) []byte {
+	if int64(len(buf)) >= size {
+		return buf
+	}
+	return append(buf, make([]byte, size-int64(len(buf)))...)
+}
+
+// SetBit setbit key offset value，返回原来的值
+func SetBit(c *tcp.RegisConn, args []string) base.Reply {
+	offset, errReply := parseBitOffset(args[2], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	if args[3] != "0" && args[3] != "1" {
+		return redis.ErrReply("ERR bit is not an integer or out of range")
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, _, errReply := getRBytesForWrite(db, args[1])
+	if errReply != nil {
+		return errReply
+	}
+	val.Buf = growBytes(val.Buf, offset>>3+1)
+	old := getBit(val.Buf, offset)
+	setBit(val.Buf, offset, int(args[3][0]-'0'))
+	db.PutData(args[1], val)
+	notifyKeyspaceEvent(notifyString, "setbit", args[1], c.DBIndex)
+	return redis.IntReply(old)
+}
+
+func GetBit(c *tcp.RegisConn, args []string) base.Reply {
+	offset, errReply := parseBitOffset(args[2], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	buf, _, errReply := getStringBytes(tcp.Server.DB.GetSDB(c.DBIndex), args[1])
+	if errReply != nil {
+		return errReply
+	}
+	return redis.IntReply(getBit(buf, offset))
+}
+
+// parseBitRange 解析 start end [BYTE|BIT]，返回位的闭区间，区间为空时返回false
+// size 是字符串的字节数，BYTE 模式下下标是字节，BIT 模式下下标是位
+func parseBitRange(opts []string, size int64) (int64, int64, bool, base.Reply) {
+	start, err1 := strconv.ParseInt(opts[0], 10, 64)
+	end, err2 := strconv.ParseInt(opts[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false, redis.IntErrReply
+	}
+	isBit := false
+	if len(opts) == 3 {
+		switch strings.ToLower(opts[2]) {
+		case "byte":
+		case "bit":
+			isBit = true
+		default:
+			return 0, 0, false, redis.ErrReply("ERR syntax error")
+		}
+	}
+	total := size
+	if isBit {
+		total = size * 8
+	}
+	if start < 0 && end < 0 && start > end {
+		return 0, 0, false, nil
+	}
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	if start > end {
+		return 0, 0, false, nil
+	}
+	if !isBit {
+		start, end = start*8, end*8+7
+	}
+	return start, end, true, nil
+}
+
+// BitCount bitcount key [start end [BYTE|BIT]]
+func BitCount(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args) != 2 && len(args) != 4 && len(args) != 5 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	buf, _, errReply := getStringBytes(tcp.Server.DB.GetSDB(c.DBIndex), args[1])
+	if errReply != nil {
+		return errReply
+	}
+	start, end := int64(0), int64(len(buf))*8-1
+	if len(args) > 2 {
+		var ok bool
+		start, end, ok, errReply = parseBitRange(args[2:], int64(len(buf)))
+		if errReply != nil {
+			return errReply
+		}
+		if !ok {
+			return redis.IntReply(0)
+		}
+	}
+	count := 0
+	for i := start; i <= end; {
+		// 整个字节都在区间内时直接按字节统计
+		if i&7 == 0 && i+7 <= end {
+			count += bits.OnesCount8(buf[i>>3])
+			i += 8
+			continue
+		}
+		count += getBit(buf, i)
+		i++
+	}
+	return redis.IntReply(count)
+}
+
+// BitPos bitpos key bit [start [end [BYTE|BIT]]]
+// 查找0时，如果没有指定end，字符串右边视为补了无限个0
+func BitPos(c *tcp.RegisConn, args []string) base.Reply {
+	if args[2] != "0" && args[2] != "1" {
+		return redis.ErrReply("ERR The bit argument must be 1 or 0.")
+	}
+	if len(args) > 6 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	bit := int(args[2][0] - '0')
+	buf, ok, errReply := getStringBytes(tcp.Server.DB.GetSDB(c.DBIndex), args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		if bit == 1 {
+			return redis.IntReply(-1)
+		}
+		return redis.IntReply(0)
+	}
+	opts := args[3:]
+	endGiven := len(opts) >= 2
+	switch len(opts) {
+	case 0:
+		opts = []string{"0", "-1"}
+	case 1:
+		opts = []string{opts[0], "-1"}
+	}
+	start, end, ok, errReply := parseBitRange(opts, int64(len(buf)))
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		return redis.IntReply(-1)
+	}
+
+	// 全是另一种值的字节可以整个跳过
+	skip := byte(0)
+	if bit == 0 {
+		skip = 0xff
+	}
+	for i := start; i <= end; {
+		if i&7 == 0 && i+7 <= end && buf[i>>3] == skip {
+			i += 8
+			continue
+		}
+		if getBit(buf, i) == bit {
+			return redis.Int64Reply(i)
+		}
+		i++
+	}
+	if bit == 0 && !endGiven {
+		return redis.Int64Reply(end + 1)
+	}
+	return redis.IntReply(-1)
+}
+
+// BitOp bitop AND|OR|XOR|NOT destkey key [key ...]
+// 长度不同时，短的字符串视为补0，结果的长度等于最长的字符串
+func BitOp(c *tcp.RegisConn, args []string) base.Reply {
+	op := strings.ToLower(args[1])
+	if op != "and" && op != "or" && op != "xor" && op != "not" {
+		return redis.ErrReply("ERR syntax error")
+	}
+	if op == "not" && len(args) != 4 {
+		return redis.ErrReply("ERR BITOP NOT must be called with a single source key.")
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	srcs := make([][]byte, 0, len(args)-3)
+	maxLen := 0
+	for _, key := range args[3:] {
+		val, _, errReply := getStringBytes(db, key)
+		if errReply != nil {
+			return errReply
+		}
+		srcs = append(srcs, val)
+		if len(val) > maxLen {
+			maxLen = len(val)
+		}
+	}
+
+	dest := args[2]
+	if maxLen == 0 {
+		if db.RemoveData(dest) > 0 {
+			notifyKeyspaceEvent(notifyGeneric, "del", dest, c.DBIndex)
+		}
+		return redis.IntReply(0)
+	}
+	res := make([]byte, maxLen)
+	for i := 0; i < maxLen; i++ {
+		var b byte
+		for j, src := range srcs {
+			var v byte
+			if i < len(src) {
+				v = src[i]
+			}
+			switch {
+			case op == "not":
+				b = ^v
+			case j == 0:
+				b = v
+			case op == "and":
+				b &= v
+			case op == "or":
+				b |= v
+			case op == "xor":
+				b ^= v
+			}
+		}
+		res[i] = b
+	}
+	setKey(db, dest, &base.RBytes{Buf: res})
+	notifyKeyspaceEvent(notifyString, "set", dest, c.DBIndex)
+	return redis.IntReply(maxLen)
+}
+
+const (
+	bitfieldGet = iota
+	bitfieldSet
+	bitfieldIncrBy
+)
+
+const (
+	overflowWrap = iota
+	overflowSat
+	overflowFail
+)
+
+// bitfieldOp bitfield 中的一个子命令
+type bitfieldOp struct {
+	op       int
+	signed   bool
+	bits     int
+	offset   int64
+	value    int64 // SET 的值或者 INCRBY 的增量
+	overflow int
+}
+
+// parseBitfieldType 解析 i1~i64, u1~u63
+func parseBitfieldType(arg string) (bool, int, base.Reply) {
+	errReply := redis.ErrReply("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	if len(arg) < 2 || (arg[0] != 'i' && arg[0] != 'I' && arg[0] != 'u' && arg[0] != 'U') {
+		return false, 0, errReply
+	}
+	signed := arg[0] == 'i' || arg[0] == 'I'
+	n, err := strconv.Atoi(arg[1:])
+	if err != nil || n < 1 || (signed && n > 64) || (!signed && n > 63) {
+		return false, 0, errReply
+	}
+	return signed, n, nil
+}
+
+// getUnsignedBits 读取从offset开始，bitsNum位宽的无符号整数
+func getUnsignedBits(buf []byte, offset int64, bitsNum int) uint64 {
+	var v uint64
+	for i := 0; i < bitsNum; i++ {
+		v = v<<1 | uint64(getBit(buf, offset+int64(i)))
+	}
+	return v
+}
+
+// getSignedBits 读取有符号整数，最高位是符号位
+func getSignedBits(buf []byte, offset int64, bitsNum int) int64 {
+	v := getUnsignedBits(buf, offset, bitsNum)
+	if bitsNum < 64 && v&(1<<(bitsNum-1)) != 0 {
+		v |= math.MaxUint64 << bitsNum
+	}
+	return int64(v)
+}
+
+// setBits 把v的低bitsNum位写入从offset开始的位置
+func setBits(buf []byte, offset int64, bitsNum int, v uint64) {
+	for i := 0; i < bitsNum; i++ {
+		setBit(buf, offset+int64(i), int(v>>(bitsNum-1-i))&1)
+	}
+}
+
+// checkUnsignedOverflow 检查 value+incr 是否溢出，溢出时按 overflow 的方式返回结果
+// 返回的bool表示是否溢出，FAIL 模式下溢出时结果无意义
+func checkUnsignedOverflow(value uint64, incr int64, bitsNum int, overflow int) (uint64, bool) {
+	max := uint64(1)<<bitsNum - 1
+	maxIncr := int64(max - value)
+	minIncr := -int64(value)
+	wrap := (value + uint64(incr)) & max
+	if value > max || (incr > 0 && incr > maxIncr) {
+		if overflow == overflowSat {
+			return max, true
+		}
+		return wrap, true
+	}
+	if incr < 0 && incr < minIncr {
+		if overflow == overflowSat {
+			return 0, true
+		}
+		return wrap, true
+	}
+	return value + uint64(incr), false
+}
+
+// checkSignedOverflow 同 checkUnsignedOverflow，用于有符号整数
+func checkSignedOverflow(value, incr int64, bitsNum int, overflow int) (int64, bool) {
+	max := int64(math.MaxInt64)
+	if bitsNum < 64 {
+		max = int64(1)<<(bitsNum-1) - 1
+	}
+	min := -max - 1
+	maxIncr := max - value
+	minIncr := min - value
+
+	wrap := uint64(value) + uint64(incr)
+	if bitsNum < 64 {
+		mask := uint64(math.MaxUint64) << bitsNum
+		if wrap&(1<<(bitsNum-1)) != 0 {
+			wrap |= mask
+		} else {
+			wrap &^= mask
+		}
+	}
+	if value > max || (bitsNum != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		if overflow == overflowSat {
+			return max, true
+		}
+		return int64(wrap), true
+	}
+	if value < min || (bitsNum != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		if overflow == overflowSat {
+			return min, true
+		}
+		return int64(wrap), true
+	}
+	return value + incr, false
+}
+
+// bitfieldGeneric bitfield/bitfield_ro key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL]
+// 先解析完所有子命令再执行，任何一个有错误时整个命令都不执行
+func bitfieldGeneric(c *tcp.RegisConn, args []string, readOnly bool) base.Reply {
+	ops := make([]bitfieldOp, 0)
+	overflow := overflowWrap
+	hasWrite := false
+	var maxByte int64
+	for i := 2; i < len(args); i++ {
+		sub := strings.ToLower(args[i])
+		left := len(args) - i - 1
+		if sub == "overflow" && left >= 1 {
+			switch strings.ToLower(args[i+1]) {
+			case "wrap":
+				overflow = overflowWrap
+			case "sat":
+				overflow = overflowSat
+			case "fail":
+				overflow = overflowFail
+			default:
+				return redis.ErrReply("ERR Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		}
+		op := bitfieldOp{overflow: overflow}
+		switch {
+		case sub == "get" && left >= 2:
+			op.op = bitfieldGet
+		case sub == "set" && left >= 3:
+			op.op = bitfieldSet
+		case sub == "incrby" && left >= 3:
+			op.op = bitfieldIncrBy
+		default:
+			return redis.ErrReply("ERR syntax error")
+		}
+		if readOnly && op.op != bitfieldGet {
+			return redis.ErrReply("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+		var errReply base.Reply
+		op.signed, op.bits, errReply = parseBitfieldType(args[i+1])
+		if errReply != nil {
+			return errReply
+		}
+		op.offset, errReply = parseBitOffset(args[i+2], true, op.bits)
+		if errReply != nil {
+			return errReply
+		}
+		i += 2
+		if op.op != bitfieldGet {
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redis.IntErrReply
+			}
+			op.value = n
+			hasWrite = true
+			if end := (op.offset + int64(op.bits) + 7) / 8; end > maxByte {
+				maxByte = end
+			}
+			i++
+		}
+		ops = append(ops, op)
+	}
+
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	var val *base.RBytes
+	var buf []byte
+	var errReply base.Reply
+	if hasWrite {
+		val, _, errReply = getRBytesForWrite(db, args[1])
+		if errReply != nil {
+			return errReply
+		}
+		val.Buf = growBytes(val.Buf, maxByte)
+		buf = val.Buf
+	} else {
+		buf, _, errReply = getStringBytes(db, args[1])
+		if errReply != nil {
+			return errReply
+		}
+		c.Rewrite()
+	}
+
+	ret := make([]interface{}, 0, len(ops))
+	for _, op := range ops {
+		if op.signed {
+			old := getSignedBits(buf, op.offset, op.bits)
+			switch op.op {
+			case bitfieldGet:
+				ret = append(ret, int(old))
+				continue
+			case bitfieldSet:
+				v, over := checkSignedOverflow(op.value, 0, op.bits, op.overflow)
+				if over && op.overflow == overflowFail {
+					ret = append(ret, nil)
+					continue
+				}
+				setBits(buf, op.offset, op.bits, uint64(v))
+				ret = append(ret, int(old))
+			case bitfieldIncrBy:
+				v, over := checkSignedOverflow(old, op.value, op.bits, op.overflow)
+				if over && op.overflow == overflowFail {
+					ret = append(ret, nil)
+					continue
+				}
+				setBits(buf, op.offset, op.bits, uint64(v))
+				ret = append(ret, int(v))
+			}
+			continue
+		}
+
+		old := getUnsignedBits(buf, op.offset, op.bits)
+		switch op.op {
+		case bitfieldGet:
+			ret = append(ret, int(old))
+		case bitfieldSet:
+			v, over := checkUnsignedOverflow(uint64(op.value), 0, op.bits, op.overflow)
+			if over && op.overflow == overflowFail {
+				ret = append(ret, nil)
+				continue
+			}
+			setBits(buf, op.offset, op.bits, v)
+			ret = append(ret, int(old))
+		case bitfieldIncrBy:
+			v, over := checkUnsignedOverflow(old, op.value, op.bits, op.overflow)
+			if over && op.overflow == overflowFail {
+				ret = append(ret, nil)
+				continue
+			}
+			setBits(buf, op.offset, op.bits, v)
+			ret = append(ret, int(v))
+		}
+	}
+	if hasWrite {
+		db.PutData(args[1], val)
+		notifyKeyspaceEvent(notifyString, "setbit", args[1], c.DBIndex)
+	}
+	if len(ret) == 0 {
+		return redis.EmptyArrayReply
+	}
+	return redis.ArrayReply(ret)
+}
+
+func BitField(c *tcp.RegisConn, args []string) base.Reply {
+	return bitfieldGeneric(c, args, false)
+}
+
+func BitFieldRO(c *tcp.RegisConn, args []string) base.Reply {
+	return bitfieldGeneric(c, args, true)
+}
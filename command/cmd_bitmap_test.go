@@ -0,0 +1,142 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"math"
+	"testing"
+)
+
+func TestSetBit_InPlace(t *testing.T) {
+	c := newTestConn()
+	c.DBIndex = 9
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	call(c, "set", "bm", "a")
+
+	reply, _ := call(c, "setbit", "bm", "6", "1")
+	checkReply(t, redis.IntReply(0), reply)
+	v, _ := db.GetData("bm")
+	val, ok := v.(*base.RBytes)
+	if !ok || string(val.Buf) != "c" {
+		t.Fatalf("setbit should store raw bytes, get %T %v", v, v)
+	}
+	// 之后的修改直接改原来的值
+	call(c, "setbit", "bm", "15", "1")
+	if v, _ := db.GetData("bm"); v != val || string(val.Buf) != "c\x01" {
+		t.Fatalf("setbit should modify in place, get %v", v)
+	}
+
+	// bgsave 期间存盘的值不能被修改
+	db.SetStatus(base.WorldFrozen)
+	defer db.SetStatus(base.WorldNormal)
+	call(c, "setbit", "bm", "15", "0")
+	call(c, "bitfield", "bm", "set", "u8", "#2", "255")
+	if string(val.Buf) != "c\x01" {
+		t.Errorf("value being saved was modified: %q", val.Buf)
+	}
+	reply, _ = call(c, "get", "bm")
+	checkReply(t, redis.BulkStrReply("c\x00\xff"), reply)
+}
+
+func TestBitField_Overflow(t *testing.T) {
+	c := newTestConn()
+	tests := []struct {
+		args []string
+		want []interface{}
+	}{
+		{[]string{"incrby", "u2", "100", "1", "overflow", "sat", "incrby", "u2", "102", "1"}, []interface{}{1, 1}},
+		{[]string{"incrby", "u2", "100", "1", "overflow", "sat", "incrby", "u2", "102", "1"}, []interface{}{2, 2}},
+		{[]string{"incrby", "u2", "100", "1", "overflow", "sat", "incrby", "u2", "102", "1"}, []interface{}{3, 3}},
+		// WRAP 回绕，SAT 停在最大值
+		{[]string{"incrby", "u2", "100", "1", "overflow", "sat", "incrby", "u2", "102", "1"}, []interface{}{0, 3}},
+		{[]string{"overflow", "fail", "incrby", "u2", "102", "1", "get", "u2", "102"}, []interface{}{nil, 3}},
+		{[]string{"set", "i8", "0", "127", "incrby", "i8", "0", "1"}, []interface{}{0, -128}},
+		{[]string{"overflow", "sat", "incrby", "i8", "0", "-1000", "incrby", "i8", "0", "1000"}, []interface{}{-128, 127}},
+		{[]string{"overflow", "fail", "set", "i8", "0", "128", "set", "u8", "8", "256", "get", "i8", "0"}, []interface{}{nil, nil, 127}},
+	}
+	for _, tt := range tests {
+		reply, _ := call(c, append([]string{"bitfield", "bf"}, tt.args...)...)
+		checkReply(t, redis.ArrayReply(tt.want), reply)
+	}
+}
+
+func TestBitField_I64(t *testing.T) {
+	c := newTestConn()
+	max, min := math.MaxInt64, math.MinInt64
+	tests := []struct {
+		args []string
+		want []interface{}
+	}{
+		{[]string{"set", "i64", "0", "9223372036854775807", "get", "i64", "0"}, []interface{}{0, max}},
+		{[]string{"incrby", "i64", "0", "1"}, []interface{}{min}},
+		{[]string{"overflow", "sat", "incrby", "i64", "0", "-1", "incrby", "i64", "0", "-9223372036854775808"}, []interface{}{min, min}},
+		{[]string{"overflow", "fail", "incrby", "i64", "0", "-1", "get", "i64", "0"}, []interface{}{nil, min}},
+		{[]string{"overflow", "sat", "incrby", "i64", "0", "9223372036854775807", "incrby", "i64", "0", "1"}, []interface{}{-1, 0}},
+		{[]string{"set", "i64", "#1", "-9223372036854775808", "get", "u63", "64"}, []interface{}{0, 1 << 62}},
+	}
+	for _, tt := range tests {
+		reply, _ := call(c, append([]string{"bitfield", "bf64"}, tt.args...)...)
+		checkReply(t, redis.ArrayReply(tt.want), reply)
+	}
+	reply, _ := call(c, "bitfield", "bf64", "get", "u64", "0")
+	checkReply(t, redis.ErrReply("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."), reply)
+}
+
+func TestBitPos(t *testing.T) {
+	c := newTestConn()
+	call(c, "set", "bp", "\x00\xff\xf0")
+	call(c, "set", "bp1", "\xff\xff\xff")
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"bp", "1"}, 8},
+		{[]string{"bp", "1", "2"}, 16},
+		{[]string{"bp", "1", "2", "-1", "byte"}, 16},
+		{[]string{"bp", "1", "7", "15", "bit"}, 8},
+		{[]string{"bp", "1", "7", "-3", "bit"}, 8},
+		{[]string{"bp", "0", "1"}, 20},
+		// 找0时没有指定end，右边视为补0
+		{[]string{"bp1", "0"}, 24},
+		{[]string{"bp1", "0", "1"}, 24},
+		{[]string{"bp1", "0", "1", "-1"}, -1},
+		{[]string{"bp1", "0", "0", "-1", "bit"}, -1},
+		{[]string{"nokey", "0"}, 0},
+		{[]string{"nokey", "1"}, -1},
+	}
+	for _, tt := range tests {
+		reply, _ := call(c, append([]string{"bitpos"}, tt.args...)...)
+		checkReply(t, redis.IntReply(tt.want), reply)
+	}
+}
+
+func TestBitCount(t *testing.T) {
+	c := newTestConn()
+	call(c, "set", "bc", "foobar")
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, 26},
+		{[]string{"0", "0"}, 4},
+		{[]string{"1", "1"}, 6},
+		{[]string{"1", "1", "byte"}, 6},
+		{[]string{"5", "30", "bit"}, 17},
+		{[]string{"-2", "-1"}, 7},
+		{[]string{"-1", "-2"}, 0},
+		{[]string{"0", "100"}, 26},
+	}
+	for _, tt := range tests {
+		reply, _ := call(c, append([]string{"bitcount", "bc"}, tt.args...)...)
+		checkReply(t, redis.IntReply(tt.want), reply)
+	}
+}
+
+func TestSetBit_RDB(t *testing.T) {
+	c := newTestConn()
+	call(c, "setbit", "bmrdb", "9", "1")
+	reloadRDB(t)
+	reply, _ := call(c, "get", "bmrdb")
+	checkReply(t, redis.BulkStrReply("\x00\x40"), reply)
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"math"
+	"strconv"
+	"time"
+)
+
+// 阻塞命令的公共部分，阻塞客户端的登记见 tcp.RegisConn.Block
+
+// parseTimeout 解析阻塞命令的超时时间，单位是秒，可以是小数，0表示永不超时
+func parseTimeout(s string) (time.Duration, base.Reply) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, redis.ErrReply("ERR timeout is not a float or out of range")
+	}
+	if f < 0 {
+		return 0, redis.ErrReply("ERR timeout is negative")
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// ServeClientsBlockedOnKeys 主协程每执行完一条命令后调用，
+// 按阻塞的先后顺序，重新执行阻塞在ready key上的客户端的命令，并回复它们
+// 被唤醒的命令又可能往别的key写入数据（比如 BLMOVE），所以要一直处理到没有ready key为止
+func ServeClientsBlockedOnKeys() {
+	for keys := tcp.Server.TakeReadyKeys(); len(keys) > 0; keys = tcp.Server.TakeReadyKeys() {
+		for _, rk := range keys {
+			db := tcp.Server.DB.GetSDB(rk.DBIndex)
+			for _, c := range tcp.Server.BlockedClients(rk.DBIndex, rk.Key) {
+				// 数据已经被前面的客户端取完了
+				if _, ok := db.GetData(rk.Key); !ok {
+					break
+				}
+				query := c.BlockedQuery()
+				c.Unblock()
+				cmdInfo, _ := GetCmdInfo(query[0])
+				reply := cmdInfo.Call(c, query)
+				if !c.IsBlocked() {
+					c.CmdDone(&tcp.Command{Conn: c, Query: query, Reply: reply})
+				}
+			}
+		}
+	}
+}
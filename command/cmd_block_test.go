@@ -0,0 +1,87 @@
+package command
+
+import (
+	"code/regis/redis"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitBlocked 等到服务器上阻塞的客户端数量变成n
+func waitBlocked(t *testing.T, c *testClient, n int) {
+	t.Helper()
+	want := fmt.Sprintf("blocked_clients:%v\r\n", n)
+	for i := 0; i < 100; i++ {
+		c.send("info")
+		if info, _ := c.recv(time.Second); strings.Contains(info, want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("want %v blocked clients", n)
+}
+
+func TestBlock_Served(t *testing.T) {
+	addr := startServer(t)
+	a, b, c := dial(t, addr), dial(t, addr), dial(t, addr)
+	a.send("blpop", "blk1", "blk2", "0")
+	waitBlocked(t, c, 1)
+	b.send("brpop", "blk2", "0")
+	waitBlocked(t, c, 2)
+	if reply, ok := a.recv(50 * time.Millisecond); ok {
+		t.Fatalf("blocked client should not get reply, get %q", reply)
+	}
+
+	// 先阻塞的客户端先被服务，数据被取完后其他客户端继续阻塞
+	c.do(redis.IntReply(1), "rpush", "blk2", "x")
+	if reply, _ := a.recv(time.Second); reply != string(redis.StringsReply([]string{"blk2", "x"}).Bytes()) {
+		t.Errorf("want blk2 x, get %q", reply)
+	}
+	if reply, ok := b.recv(50 * time.Millisecond); ok {
+		t.Fatalf("b should still be blocked, get %q", reply)
+	}
+	c.do(redis.IntReply(2), "rpush", "blk2", "y", "z")
+	if reply, _ := b.recv(time.Second); reply != string(redis.StringsReply([]string{"blk2", "z"}).Bytes()) {
+		t.Errorf("want blk2 z, get %q", reply)
+	}
+	waitBlocked(t, c, 0)
+	c.do(redis.IntReply(1), "llen", "blk2")
+
+	// 被唤醒的客户端继续执行之后的命令
+	a.do(redis.BulkStrReply("y"), "lpop", "blk2")
+}
+
+func TestBlock_Timeout(t *testing.T) {
+	addr := startServer(t)
+	a, c := dial(t, addr), dial(t, addr)
+	start := time.Now()
+	a.send("blpop", "blkt", "0.1")
+	reply, ok := a.recv(time.Second)
+	if !ok || reply != string(redis.NilArrayReply.Bytes()) {
+		t.Fatalf("want nil array on timeout, get %q", reply)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("timeout too early %v", d)
+	}
+	waitBlocked(t, c, 0)
+
+	// 超时的客户端不能再取走数据
+	c.do(redis.IntReply(1), "rpush", "blkt", "x")
+	c.do(redis.IntReply(1), "llen", "blkt")
+	a.do(redis.BulkStrReply("x"), "lpop", "blkt")
+}
+
+func TestBlock_Disconnect(t *testing.T) {
+	addr := startServer(t)
+	a, c := dial(t, addr), dial(t, addr)
+	a.send("blpop", "blkd", "0")
+	waitBlocked(t, c, 1)
+	_ = a.conn.Close()
+	waitBlocked(t, c, 0)
+
+	// 断开的客户端不能取走数据
+	c.do(redis.IntReply(1), "rpush", "blkd", "x")
+	c.do(redis.IntReply(1), "llen", "blkd")
+	c.do(redis.IntReply(1), "del", "blkd")
+}
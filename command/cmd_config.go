@@ -0,0 +1,86 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/conf"
+	"code/regis/lib/utils"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"fmt"
+	"strings"
+)
+
+// configSetters CONFIG SET 能修改的配置项，其他配置只能在启动时从配置文件读
+var configSetters = map[string]func(value string) error{
+	"notify-keyspace-events": setNotifyKeyspaceEvents,
+}
+
+// Config config GET parameter [parameter ...]
+// config SET parameter value [parameter value ...]
+func Config(c *tcp.RegisConn, args []string) base.Reply {
+	sub := strings.ToLower(args[1])
+	switch {
+	case sub == "help" && len(args) == 2:
+		return redis.StringsReply([]string{
+			"CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"GET <pattern>",
+			"    Return parameters matching the glob-like <pattern> and their values.",
+			"SET <directive> <value>",
+			"    Set the configuration <directive> to <value>.",
+			"HELP",
+			"    Print this help.",
+		})
+	case sub == "get" && len(args) >= 3:
+		return configGet(args[2:])
+	case sub == "set" && len(args) >= 4 && len(args)%2 == 0:
+		return configSet(args[2:])
+	}
+	return redis.ErrReply(fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%v'. Try CONFIG HELP.", args[1]))
+}
+
+func configGet(patterns []string) base.Reply {
+	return redis.StringsReply(conf.Conf.Get(func(name string) bool {
+		for _, pattern := range patterns {
+			if utils.GlobMatch(pattern, name, true) {
+				return true
+			}
+		}
+		return false
+	}))
+}
+
+// configSet 多个配置项要么都改成功，要么一个都不改，某一项的值不合法时把前面改过的恢复回去
+func configSet(args []string) base.Reply {
+	names := make(map[string]struct{}, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(args[i])
+		if _, ok := configSetters[name]; !ok {
+			if len(conf.Conf.Get(func(n string) bool { return n == name })) == 0 {
+				return redis.ErrReply(fmt.Sprintf("ERR Unknown option or number of arguments for CONFIG SET - '%v'", args[i]))
+			}
+			return configSetErr(args[i], "can't set immutable config")
+		}
+		if _, ok := names[name]; ok {
+			return configSetErr(args[i], "duplicate parameter")
+		}
+		names[name] = struct{}{}
+	}
+
+	olds := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(args[i])
+		old := conf.Conf.Get(func(n string) bool { return n == name })[1]
+		if err := configSetters[name](args[i+1]); err != nil {
+			for j := range olds {
+				_ = configSetters[strings.ToLower(args[j*2])](olds[j])
+			}
+			return configSetErr(args[i], err.Error())
+		}
+		olds = append(olds, old)
+	}
+	return redis.OkReply
+}
+
+func configSetErr(name, msg string) base.Reply {
+	return redis.ErrReply(fmt.Sprintf("ERR CONFIG SET failed (possibly related to argument '%v') - %v", name, msg))
+}
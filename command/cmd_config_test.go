@@ -0,0 +1,69 @@
+package command
+
+import (
+	"code/regis/redis"
+	"testing"
+)
+
+func TestConfig_NotifyKeyspaceEvents(t *testing.T) {
+	c := newTestConn()
+	defer func() { _ = setNotifyKeyspaceEvents("") }()
+	tests := []struct {
+		value string
+		want  string
+	}{
+		// 原样返回用户设置的值，不做规范化
+		{"KEA", "KEA"},
+		{"Elg", "Elg"},
+		{"AK", "AK"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		reply, _ := call(c, "config", "set", "notify-keyspace-events", tt.value)
+		checkReply(t, redis.OkReply, reply)
+		reply, _ = call(c, "config", "get", "notify-keyspace-events")
+		checkReply(t, redis.StringsReply([]string{"notify-keyspace-events", tt.want}), reply)
+	}
+
+	// 不合法的值报错，原来的配置不变
+	call(c, "config", "set", "NOTIFY-KEYSPACE-EVENTS", "Ez")
+	reply, _ := call(c, "config", "set", "notify-keyspace-events", "Kq")
+	checkReply(t, redis.ErrReply("ERR CONFIG SET failed (possibly related to argument 'notify-keyspace-events') - Invalid event class character. Use 'Ag$lshzxeKEtmdn'."), reply)
+	reply, _ = call(c, "config", "get", "notify-*")
+	checkReply(t, redis.StringsReply([]string{"notify-keyspace-events", "Ez"}), reply)
+	if notifyFlags != notifyKeyevent|notifyZSet {
+		t.Errorf("flags changed by invalid value: %b", notifyFlags)
+	}
+}
+
+func TestConfig_Errors(t *testing.T) {
+	c := newTestConn()
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"set", "port", "1"}, "ERR CONFIG SET failed (possibly related to argument 'port') - can't set immutable config"},
+		{[]string{"set", "nosuchconf", "1"}, "ERR Unknown option or number of arguments for CONFIG SET - 'nosuchconf'"},
+		{[]string{"set", "notify-keyspace-events", "E", "Notify-keyspace-events", "K"}, "ERR CONFIG SET failed (possibly related to argument 'Notify-keyspace-events') - duplicate parameter"},
+		{[]string{"set", "notify-keyspace-events"}, "ERR Unknown subcommand or wrong number of arguments for 'set'. Try CONFIG HELP."},
+		{[]string{"get"}, "ERR Unknown subcommand or wrong number of arguments for 'get'. Try CONFIG HELP."},
+		{[]string{"rewrite"}, "ERR Unknown subcommand or wrong number of arguments for 'rewrite'. Try CONFIG HELP."},
+	}
+	for _, tt := range tests {
+		reply, _ := call(c, append([]string{"config"}, tt.args...)...)
+		checkReply(t, redis.ErrReply(tt.want), reply)
+	}
+	reply, _ := call(c, "config", "get", "notify-keyspace-events")
+	checkReply(t, redis.StringsReply([]string{"notify-keyspace-events", ""}), reply)
+
+	reply, _ = call(c, "config", "get", "nosuch*")
+	checkReply(t, redis.StringsReply([]string{}), reply)
+	reply, _ = call(c, "config", "get", "port", "databases")
+	if n := arrayLen(reply); n != 4 {
+		t.Errorf("want 2 configs, get %v", n)
+	}
+	reply, _ = call(c, "config", "help")
+	if n := arrayLen(reply); n != 7 {
+		t.Errorf("want help lines, get %v", n)
+	}
+}
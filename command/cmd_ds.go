@@ -2,7 +2,10 @@ package command
 
 import (
 	"code/regis/base"
+	log "code/regis/lib"
+	"code/regis/redis"
 	"code/regis/tcp"
+	"fmt"
 	"strings"
 )
 
@@ -64,6 +67,15 @@ func (cmd *cmdInfo) HasAttr(attr ...int) bool {
 	return false
 }
 
+// AllowedInPubSub 客户端处于订阅状态时，只能执行这些命令
+func (cmd *cmdInfo) AllowedInPubSub() bool {
+	switch cmd.name {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ping", "quit", "reset":
+		return true
+	}
+	return false
+}
+
 func (cmd *cmdInfo) Level(level int) bool {
 	return cmd.level == level
 }
@@ -71,3 +83,78 @@ func (cmd *cmdInfo) Level(level int) bool {
 func (cmd *cmdInfo) Exec(c *tcp.RegisConn, args []string) base.Reply {
 	return cmd.exec(c, args)
 }
+
+// isMasterConn 自己是slave时，c 是否是 master 的连接，master 的命令全部由 tcp.Client 转发过来
+func isMasterConn(c *tcp.RegisConn) bool {
+	return tcp.Server.Master != nil && c.RemoteAddr() == tcp.Client.LocalAddr()
+}
+
+// Call 执行命令，并将命令传播给slave，命令被 tcp.RegisConn.Rewrite 改写过的话，传播改写后的命令
+func (cmd *cmdInfo) Call(c *tcp.RegisConn, args []string) base.Reply {
+	// EXEC 中会嵌套调用，执行完恢复原来的值
+	defer func(old bool) { executingMaster = old }(executingMaster)
+	executingMaster = isMasterConn(c)
+	reply := cmd.exec(c, args)
+	queries := c.PropagateQuery(args)
+	if cmd.HasAttr(base.CmdPropagate) {
+		for _, query := range queries {
+			// EXEC 中的命令传播给slave时要包在 MULTI/EXEC 中，第一个要传播的命令之前先传播 MULTI
+			if c.ExecutingMulti() && !c.MultiPropagated() {
+				tcp.ReplicationFeedSlaves(redis.CmdSReply("multi").Bytes(), c.DBIndex)
+				c.SetMultiPropagated()
+			}
+			tcp.ReplicationFeedSlaves(redis.CmdSReply(query...).Bytes(), c.DBIndex)
+		}
+	}
+	return reply
+}
+
+// ExecCommand 主协程执行客户端发来的一条命令，先检查命令能不能执行，事务中的命令只放进队列
+func ExecCommand(c *tcp.RegisConn, query []string) base.Reply {
+	// 空命令，忽略
+	if len(query) == 0 {
+		return redis.NilReply
+	}
+
+	cmdInfo, ok := GetCmdInfo(query[0])
+
+	// 未知命令，报错
+	if !ok {
+		log.Error("command not found %v", query)
+		c.FlagExecAbort()
+		return redis.UnknownCmdErrReply(query[0])
+	}
+
+	// 命令参数数量不对，报错
+	if !cmdInfo.Validate(query) {
+		c.FlagExecAbort()
+		return redis.ArgNumErrReply(query[0])
+	}
+
+	// 如果自己是slave，只接收master的write命令
+	// 而master的write命令又全部由 tcp.Client 来转发
+	// 所以，当自己是slave时，写命令只接收 tcp.Client 的
+	if tcp.Server.Master != nil &&
+		cmdInfo.HasAttr(base.CmdWrite) &&
+		!isMasterConn(c) {
+		log.Error("I'm slave, %v call me write! 😡 I only accept %v write!😤",
+			c.RemoteAddr(), tcp.Client.LocalAddr())
+		c.FlagExecAbort()
+		return redis.ErrReply("ERR not write when slave")
+	}
+
+	// 订阅状态下只能执行 SUBSCRIBE 这类命令
+	if c.InPubSub() && !cmdInfo.AllowedInPubSub() {
+		c.FlagExecAbort()
+		return redis.ErrReply(fmt.Sprintf("ERR Can't execute '%v': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context",
+			strings.ToLower(query[0])))
+	}
+
+	// 事务中除了 MULTI, EXEC 这类事务控制命令以外，都先放进队列，EXEC 时再一起执行
+	if c.InMulti() && !cmdInfo.HasAttr(base.CmdTx) {
+		c.QueueMulti(query)
+		return redis.StrReply("QUEUED")
+	}
+
+	return cmdInfo.Call(c, query)
+}
@@ -0,0 +1,202 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 过期相关的命令
+// 过期时间存在 sdb 的 expire 字典中，读key的时候惰性删除过期的key，见 SingleDB.GetData
+
+// keyExpired key因为过期被删除时调用，向slave传播del，slave自己不会主动删除过期的key
+func keyExpired(dbIndex int, key string) {
+	tcp.Server.StatExpiredKeys++
+	tcp.ReplicationFeedSlaves(redis.CmdSReply("del", key).Bytes(), dbIndex)
+	notifyKeyspaceEvent(notifyExpired, "expired", key, dbIndex)
+}
+
+func isSlave() bool {
+	return tcp.Server.Master != nil
+}
+
+// executingMaster 主协程正在执行 master 传播过来的命令，见 cmdInfo.Call
+var executingMaster bool
+
+func fromMaster() bool {
+	return executingMaster
+}
+
+const (
+	expireNX = 1 << iota
+	expireXX
+	expireGT
+	expireLT
+)
+
+// parseExpireFlags 解析 NX|XX|GT|LT
+func parseExpireFlags(opts []string) (int, base.Reply) {
+	flags := 0
+	for _, opt := range opts {
+		switch strings.ToLower(opt) {
+		case "nx":
+			flags |= expireNX
+		case "xx":
+			flags |= expireXX
+		case "gt":
+			flags |= expireGT
+		case "lt":
+			flags |= expireLT
+		default:
+			return 0, redis.ErrReply("ERR Unsupported option " + opt)
+		}
+	}
+	if flags&expireNX != 0 && flags&(expireXX|expireGT|expireLT) != 0 {
+		return 0, redis.ErrReply("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if flags&expireGT != 0 && flags&expireLT != 0 {
+		return 0, redis.ErrReply("ERR GT and LT options at the same time are not compatible")
+	}
+	return flags, nil
+}
+
+// expireAtMs 把命令参数中的时间转换成unix毫秒时间戳，溢出时返回 invalid expire time 错误
+// unit 是参数的单位，absolute 为true表示参数是unix时间戳
+func expireAtMs(cmd string, n int64, unit time.Duration, absolute bool) (int64, base.Reply) {
+	invalid := redis.ErrReply("ERR invalid expire time in '" + strings.ToLower(cmd) + "' command")
+	ms := n
+	if unit == time.Second {
+		if n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			return 0, invalid
+		}
+		ms = n * 1000
+	}
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if ms > math.MaxInt64-now {
+			return 0, invalid
+		}
+		ms += now
+	}
+	return ms, nil
+}
+
+// expireGeneric expire/pexpire/expireat/pexpireat key time [NX|XX|GT|LT]
+// 传播给slave时统一改写成 pexpireat，避免slave上重放时时间有偏差
+func expireGeneric(c *tcp.RegisConn, args []string, unit time.Duration, absolute bool) base.Reply {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	flags, errReply := parseExpireFlags(args[3:])
+	if errReply != nil {
+		return errReply
+	}
+	ms, errReply := expireAtMs(args[0], n, unit, absolute)
+	if errReply != nil {
+		return errReply
+	}
+
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	key := args[1]
+	if _, ok := db.GetData(key); !ok {
+		c.Rewrite()
+		return redis.IntReply(0)
+	}
+	// 没有过期时间的key视为过期时间无限大
+	cur, hasTTL := db.GetExpire(key)
+	if (flags&expireNX != 0 && hasTTL) ||
+		(flags&expireXX != 0 && !hasTTL) ||
+		(flags&expireGT != 0 && (!hasTTL || ms <= cur.UnixMilli())) ||
+		(flags&expireLT != 0 && hasTTL && ms >= cur.UnixMilli()) {
+		c.Rewrite()
+		return redis.IntReply(0)
+	}
+
+	if ms <= time.Now().UnixMilli() {
+		db.RemoveData(key)
+		c.Rewrite([]string{"del", key})
+		notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+		return redis.IntReply(1)
+	}
+	db.SetExpire(key, time.UnixMilli(ms))
+	c.Rewrite([]string{"pexpireat", key, strconv.FormatInt(ms, 10)})
+	notifyKeyspaceEvent(notifyGeneric, "expire", key, c.DBIndex)
+	return redis.IntReply(1)
+}
+
+func Expire(c *tcp.RegisConn, args []string) base.Reply {
+	return expireGeneric(c, args, time.Second, false)
+}
+
+func PExpire(c *tcp.RegisConn, args []string) base.Reply {
+	return expireGeneric(c, args, time.Millisecond, false)
+}
+
+func ExpireAt(c *tcp.RegisConn, args []string) base.Reply {
+	return expireGeneric(c, args, time.Second, true)
+}
+
+func PExpireAt(c *tcp.RegisConn, args []string) base.Reply {
+	return expireGeneric(c, args, time.Millisecond, true)
+}
+
+// ttlGeneric ttl/pttl/expiretime/pexpiretime key
+// key不存在时返回-2，没有过期时间时返回-1
+func ttlGeneric(c *tcp.RegisConn, args []string, unit time.Duration, absolute bool) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	if _, ok := db.GetData(args[1]); !ok {
+		return redis.IntReply(-2)
+	}
+	when, ok := db.GetExpire(args[1])
+	if !ok {
+		return redis.IntReply(-1)
+	}
+	if absolute {
+		if unit == time.Second {
+			return redis.Int64Reply(when.Unix())
+		}
+		return redis.Int64Reply(when.UnixMilli())
+	}
+	ttl := time.Until(when).Milliseconds()
+	if ttl < 0 {
+		ttl = 0
+	}
+	if unit == time.Second {
+		return redis.Int64Reply((ttl + 500) / 1000)
+	}
+	return redis.Int64Reply(ttl)
+}
+
+func TTL(c *tcp.RegisConn, args []string) base.Reply {
+	return ttlGeneric(c, args, time.Second, false)
+}
+
+func PTTL(c *tcp.RegisConn, args []string) base.Reply {
+	return ttlGeneric(c, args, time.Millisecond, false)
+}
+
+func ExpireTime(c *tcp.RegisConn, args []string) base.Reply {
+	return ttlGeneric(c, args, time.Second, true)
+}
+
+func PExpireTime(c *tcp.RegisConn, args []string) base.Reply {
+	return ttlGeneric(c, args, time.Millisecond, true)
+}
+
+// Persist persist key
+func Persist(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	if _, ok := db.GetData(args[1]); !ok {
+		return redis.IntReply(0)
+	}
+	ret := db.Persist(args[1])
+	if ret > 0 {
+		notifyKeyspaceEvent(notifyGeneric, "persist", args[1], c.DBIndex)
+	}
+	return redis.IntReply(ret)
+}
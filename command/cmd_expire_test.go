@@ -0,0 +1,95 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiredKeys_Info(t *testing.T) {
+	c := newTestConn()
+	// 独占一个db，主动删除的采样不会被其他测试留下的key稀释
+	c.DBIndex = 14
+	tcp.Server.DB.GetSDB(c.DBIndex).Flush()
+	before := tcp.Server.StatExpiredKeys
+	// px 1 可能在 set 执行时就已经过期，key根本不会写入
+	call(c, "set", "exk1", "v", "px", "20")
+	call(c, "set", "exk2", "v", "px", "20")
+	call(c, "set", "exk3", "v", "ex", "100")
+	time.Sleep(30 * time.Millisecond)
+
+	// 惰性删除和主动删除都计入 expired_keys
+	reply, _ := call(c, "get", "exk1")
+	checkReply(t, redis.NilReply, reply)
+	for i := 0; i < 100 && tcp.Server.StatExpiredKeys < before+2; i++ {
+		tcp.Server.DB.ActiveExpireCycle(time.Second)
+	}
+	// 其他测试留下的过期key也可能被主动删除
+	if n := tcp.Server.StatExpiredKeys; n < before+2 {
+		t.Fatalf("want at least %v expired keys, get %v", before+2, n)
+	}
+	reply, _ = call(c, "exists", "exk1", "exk2", "exk3")
+	checkReply(t, redis.IntReply(1), reply)
+	reply, _ = call(c, "info")
+	if want := fmt.Sprintf("expired_keys:%v\r\n", tcp.Server.StatExpiredKeys); !strings.Contains(string(reply.Bytes()), want) {
+		t.Errorf("want %q in info", want)
+	}
+}
+
+// masterNetConn 模拟 slave 连到 master 的连接，tcp.Client 的本地地址就是 master 的命令在 slave 上的来源地址
+type masterNetConn struct {
+	testNetConn
+}
+
+var masterAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 6380}
+
+func (c *masterNetConn) LocalAddr() net.Addr {
+	return masterAddr
+}
+
+func (c *masterNetConn) RemoteAddr() net.Addr {
+	return masterAddr
+}
+
+func TestExpire_SlaveFromMaster(t *testing.T) {
+	c, master := newTestConn(), newTestConn()
+	master.Conn = &masterNetConn{}
+	c.DBIndex, master.DBIndex = 13, 13
+	call(c, "del", "slk1", "slk2")
+	call(c, "rpush", "slk1", "a")
+	call(c, "set", "slk2", "1")
+	call(c, "pexpire", "slk1", "20")
+	call(c, "pexpire", "slk2", "20")
+	time.Sleep(30 * time.Millisecond)
+
+	oldMaster, oldClient := tcp.Server.Master, tcp.Client
+	tcp.Server.Master = &tcp.RegisClient{}
+	tcp.Client = &tcp.RegisClient{Conn: &masterNetConn{}}
+	defer func() { tcp.Server.Master, tcp.Client = oldMaster, oldClient }()
+	exec := func(c *tcp.RegisConn, args ...string) base.Reply {
+		cmd, _ := GetCmdInfo(args[0])
+		return cmd.Call(c, args)
+	}
+
+	// 普通客户端看到的是过期的key
+	checkReply(t, redis.IntReply(0), exec(c, "exists", "slk1", "slk2"))
+	// master 上key还没过期，命令在已有的值上执行，过期时间不变，之后由 master 传播 del 删除
+	checkReply(t, redis.IntReply(2), exec(master, "rpush", "slk1", "b"))
+	checkReply(t, redis.IntReply(2), exec(master, "incr", "slk2"))
+	checkReply(t, redis.IntReply(0), exec(c, "exists", "slk1", "slk2"))
+	checkReply(t, redis.IntReply(2), exec(master, "del", "slk1", "slk2"))
+
+	// master 新建的key不会带着原来的过期时间
+	call(c, "set", "slk1", "x", "px", "20")
+	time.Sleep(30 * time.Millisecond)
+	checkReply(t, redis.IntReply(1), exec(master, "del", "slk1"))
+	checkReply(t, redis.IntReply(1), exec(master, "rpush", "slk1", "c"))
+	checkReply(t, redis.StringsReply([]string{"c"}), exec(c, "lrange", "slk1", "0", "-1"))
+	checkReply(t, redis.IntReply(-1), exec(c, "ttl", "slk1"))
+	exec(master, "del", "slk1")
+}
@@ -0,0 +1,444 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/lib/utils"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// geo 命令，数据存在有序集合中，分数是经纬度编码后的52位 geohash，见 utils.GeoEncode
+
+// parseGeoUnit 解析距离单位，返回1个单位是多少米
+func parseGeoUnit(unit string) (float64, base.Reply) {
+	switch strings.ToLower(unit) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, redis.ErrReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+// parseLonLat 解析经纬度，超出范围时返回错误
+func parseLonLat(lonStr, latStr string) (float64, float64, base.Reply) {
+	lon, ok1 := parseScore(lonStr)
+	lat, ok2 := parseScore(latStr)
+	if !ok1 || !ok2 {
+		return 0, 0, redis.FloatErrReply
+	}
+	if lon < utils.GeoLongMin || lon > utils.GeoLongMax || lat < utils.GeoLatMin || lat > utils.GeoLatMax {
+		return 0, 0, redis.ErrReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lon, lat))
+	}
+	return lon, lat, nil
+}
+
+func formatGeoCoord(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatGeoDist(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
+
+// GeoAdd geoadd key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+// 和redis一样，转换成 zadd 执行，传播给slave的也是 zadd
+func GeoAdd(c *tcp.RegisConn, args []string) base.Reply {
+	zArgs := []string{"zadd", args[1]}
+	var nx, xx bool
+	i := 2
+loop:
+	for ; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ch":
+		default:
+			break loop
+		}
+		zArgs = append(zArgs, args[i])
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 || (nx && xx) {
+		return redis.ErrReply("ERR syntax error")
+	}
+	for j := 0; j < len(triples); j += 3 {
+		lon, lat, errReply := parseLonLat(triples[j], triples[j+1])
+		if errReply != nil {
+			return errReply
+		}
+		bits, _ := utils.GeoEncode(lon, lat)
+		zArgs = append(zArgs, strconv.FormatUint(bits, 10), triples[j+2])
+	}
+	reply := ZAdd(c, zArgs)
+	c.Rewrite(zArgs)
+	return reply
+}
+
+// GeoPos geopos key [member ...]，成员不存在时对应的位置返回nil
+func GeoPos(c *tcp.RegisConn, args []string) base.Reply {
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 2 {
+		return redis.EmptyArrayReply
+	}
+	ret := make([]base.Reply, 0, len(args)-2)
+	for _, member := range args[2:] {
+		var score float64
+		ok := false
+		if zset != nil {
+			score, ok = zset.Score(member)
+		}
+		if !ok {
+			ret = append(ret, redis.NilArrayReply)
+			continue
+		}
+		lon, lat := utils.GeoDecode(uint64(score))
+		ret = append(ret, redis.StringsReply([]string{formatGeoCoord(lon), formatGeoCoord(lat)}))
+	}
+	return redis.MultiReply(ret)
+}
+
+// GeoDist geodist key member1 member2 [M|KM|FT|MI]
+func GeoDist(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args) > 5 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	conversion := 1.0
+	if len(args) == 5 {
+		var errReply base.Reply
+		conversion, errReply = parseGeoUnit(args[4])
+		if errReply != nil {
+			return errReply
+		}
+	}
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.NilReply
+	}
+	score1, ok1 := zset.Score(args[2])
+	score2, ok2 := zset.Score(args[3])
+	if !ok1 || !ok2 {
+		return redis.NilReply
+	}
+	lon1, lat1 := utils.GeoDecode(uint64(score1))
+	lon2, lat2 := utils.GeoDecode(uint64(score2))
+	return redis.BulkStrReply(formatGeoDist(utils.GeoDistance(lon1, lat1, lon2, lat2) / conversion))
+}
+
+// GeoHash geohash key [member ...]，返回标准的11位 geohash 字符串
+func GeoHash(c *tcp.RegisConn, args []string) base.Reply {
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 2 {
+		return redis.EmptyArrayReply
+	}
+	ret := make([]interface{}, 0, len(args)-2)
+	for _, member := range args[2:] {
+		var score float64
+		ok := false
+		if zset != nil {
+			score, ok = zset.Score(member)
+		}
+		if !ok {
+			ret = append(ret, nil)
+			continue
+		}
+		ret = append(ret, utils.GeoHashString(uint64(score)))
+	}
+	return redis.ArrayReply(ret)
+}
+
+const (
+	geoSortNone = iota
+	geoSortAsc
+	geoSortDesc
+)
+
+// geoSearchSpec geosearch 的选项
+type geoSearchSpec struct {
+	fromMember string
+	hasMember  bool
+	hasLonLat  bool
+	byRadius   bool
+	byBox      bool
+	shape      utils.GeoShape
+	conversion float64 // 1个单位是多少米
+	sort       int
+	count      int64
+	any        bool
+	withCoord  bool
+	withDist   bool
+	withHash   bool
+	storeDist  bool
+}
+
+// geoPoint 搜索到的点
+type geoPoint struct {
+	member   string
+	dist     float64 // 单位是米
+	score    uint64
+	lon, lat float64
+}
+
+// parseGeoSearchSpec 解析 geosearch 和 geosearchstore 的选项，store 为true时是 geosearchstore
+func parseGeoSearchSpec(cmd string, opts []string, store bool) (*geoSearchSpec, base.Reply) {
+	spec := &geoSearchSpec{}
+	syntaxErr := redis.ErrReply("ERR syntax error")
+	for i := 0; i < len(opts); i++ {
+		left := len(opts) - i - 1
+		switch strings.ToLower(opts[i]) {
+		case "frommember":
+			if left < 1 || spec.hasMember {
+				return nil, syntaxErr
+			}
+			spec.fromMember, spec.hasMember = opts[i+1], true
+			i++
+		case "fromlonlat":
+			if left < 2 || spec.hasLonLat {
+				return nil, syntaxErr
+			}
+			lon, lat, errReply := parseLonLat(opts[i+1], opts[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			spec.shape.Lon, spec.shape.Lat, spec.hasLonLat = lon, lat, true
+			i += 2
+		case "byradius":
+			if left < 2 || spec.byRadius {
+				return nil, syntaxErr
+			}
+			radius, ok := parseScore(opts[i+1])
+			if !ok {
+				return nil, redis.ErrReply("ERR need numeric radius")
+			}
+			if radius < 0 {
+				return nil, redis.ErrReply("ERR radius cannot be negative")
+			}
+			conversion, errReply := parseGeoUnit(opts[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			spec.shape.Radius, spec.conversion, spec.byRadius = radius*conversion, conversion, true
+			i += 2
+		case "bybox":
+			if left < 3 || spec.byBox {
+				return nil, syntaxErr
+			}
+			width, ok := parseScore(opts[i+1])
+			if !ok {
+				return nil, redis.ErrReply("ERR need numeric width")
+			}
+			height, ok := parseScore(opts[i+2])
+			if !ok {
+				return nil, redis.ErrReply("ERR need numeric height")
+			}
+			if width < 0 || height < 0 {
+				return nil, redis.ErrReply("ERR height or width cannot be negative")
+			}
+			conversion, errReply := parseGeoUnit(opts[i+3])
+			if errReply != nil {
+				return nil, errReply
+			}
+			spec.shape.Box = true
+			spec.shape.Width, spec.shape.Height = width*conversion, height*conversion
+			spec.conversion, spec.byBox = conversion, true
+			i += 3
+		case "asc":
+			spec.sort = geoSortAsc
+		case "desc":
+			spec.sort = geoSortDesc
+		case "count":
+			if left < 1 {
+				return nil, syntaxErr
+			}
+			n, err := strconv.ParseInt(opts[i+1], 10, 64)
+			if err != nil {
+				return nil, redis.IntErrReply
+			}
+			if n <= 0 {
+				return nil, redis.ErrReply("ERR COUNT must be > 0")
+			}
+			spec.count = n
+			i++
+			if left >= 2 && strings.ToLower(opts[i+1]) == "any" {
+				spec.any = true
+				i++
+			}
+		case "withcoord":
+			spec.withCoord = true
+		case "withdist":
+			spec.withDist = true
+		case "withhash":
+			spec.withHash = true
+		case "storedist":
+			if !store {
+				return nil, syntaxErr
+			}
+			spec.storeDist = true
+		default:
+			return nil, syntaxErr
+		}
+	}
+
+	if spec.hasMember == spec.hasLonLat {
+		return nil, redis.ErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmd)
+	}
+	if spec.byRadius == spec.byBox {
+		return nil, redis.ErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmd)
+	}
+	if spec.any && spec.count == 0 {
+		return nil, redis.ErrReply("ERR the ANY argument requires COUNT argument")
+	}
+	if store && (spec.withCoord || spec.withDist || spec.withHash) {
+		return nil, redis.ErrReply("ERR STORE option in " + cmd + " is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	// 指定了 COUNT 又没有 ANY 时，返回的是最近的count个点
+	if spec.count > 0 && spec.sort == geoSortNone && !spec.any {
+		spec.sort = geoSortAsc
+	}
+	return spec, nil
+}
+
+// geoMembersInShape 找出有序集合中在搜索范围内的点，limit > 0 时找到limit个就停止
+func geoMembersInShape(zset base.RZSet, shape *utils.GeoShape, limit int64) []geoPoint {
+	ret := make([]geoPoint, 0)
+	// 精度很低的时候，周围的区域可能会重复
+	visited := make(map[utils.GeoHashBits]struct{})
+	for _, area := range utils.GeoSearchAreas(shape) {
+		if area.IsZero() {
+			continue
+		}
+		if _, ok := visited[area]; ok {
+			continue
+		}
+		visited[area] = struct{}{}
+
+		min, max := area.ScoreRange()
+		entries := zset.RangeByScore(base.ScoreBorder{Value: float64(min)},
+			base.ScoreBorder{Value: float64(max), Exclude: true}, 0, -1, false)
+		for _, entry := range entries {
+			score := uint64(entry.Score)
+			lon, lat := utils.GeoDecode(score)
+			dist, ok := shape.Contains(lon, lat)
+			if !ok {
+				continue
+			}
+			ret = append(ret, geoPoint{member: entry.Member, dist: dist, score: score, lon: lon, lat: lat})
+			if limit > 0 && int64(len(ret)) >= limit {
+				return ret
+			}
+		}
+	}
+	return ret
+}
+
+// geoSearchGeneric geosearch/geosearchstore 的实现，destKey 为空时不存储结果
+func geoSearchGeneric(c *tcp.RegisConn, srcKey, destKey string, opts []string, cmd string) base.Reply {
+	store := destKey != ""
+	spec, errReply := parseGeoSearchSpec(cmd, opts, store)
+	if errReply != nil {
+		return errReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	zset, errReply := getRZSet(db, srcKey, false)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		if store {
+			return storeZSet(c, db, destKey, nil, "geosearchstore")
+		}
+		return redis.EmptyArrayReply
+	}
+	if spec.hasMember {
+		score, ok := zset.Score(spec.fromMember)
+		if !ok {
+			return redis.ErrReply("ERR could not decode requested zset member")
+		}
+		spec.shape.Lon, spec.shape.Lat = utils.GeoDecode(uint64(score))
+	}
+
+	var limit int64
+	if spec.any {
+		limit = spec.count
+	}
+	points := geoMembersInShape(zset, &spec.shape, limit)
+	switch spec.sort {
+	case geoSortAsc:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].dist < points[j].dist })
+	case geoSortDesc:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].dist > points[j].dist })
+	}
+	if spec.count > 0 && int64(len(points)) > spec.count {
+		points = points[:spec.count]
+	}
+
+	if store {
+		entries := make([]base.ZEntry, len(points))
+		for i, p := range points {
+			entries[i].Member = p.member
+			if spec.storeDist {
+				entries[i].Score = p.dist / spec.conversion
+			} else {
+				entries[i].Score = float64(p.score)
+			}
+		}
+		return storeZSet(c, db, destKey, entries, "geosearchstore")
+	}
+
+	if len(points) == 0 {
+		return redis.EmptyArrayReply
+	}
+	if !spec.withCoord && !spec.withDist && !spec.withHash {
+		members := make([]string, len(points))
+		for i, p := range points {
+			members[i] = p.member
+		}
+		return redis.StringsReply(members)
+	}
+	ret := make([]base.Reply, 0, len(points))
+	for _, p := range points {
+		item := []base.Reply{redis.BulkStrReply(p.member)}
+		if spec.withDist {
+			item = append(item, redis.BulkStrReply(formatGeoDist(p.dist/spec.conversion)))
+		}
+		if spec.withHash {
+			item = append(item, redis.Int64Reply(int64(p.score)))
+		}
+		if spec.withCoord {
+			item = append(item, redis.StringsReply([]string{formatGeoCoord(p.lon), formatGeoCoord(p.lat)}))
+		}
+		ret = append(ret, redis.MultiReply(item))
+	}
+	return redis.MultiReply(ret)
+}
+
+// GeoSearch geosearch key FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius M|KM|FT|MI|BYBOX width height M|KM|FT|MI [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func GeoSearch(c *tcp.RegisConn, args []string) base.Reply {
+	return geoSearchGeneric(c, args[1], "", args[2:], strings.ToLower(args[0]))
+}
+
+// GeoSearchStore geosearchstore destination source FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius M|KM|FT|MI|BYBOX width height M|KM|FT|MI [ASC|DESC] [COUNT count [ANY]] [STOREDIST]
+func GeoSearchStore(c *tcp.RegisConn, args []string) base.Reply {
+	return geoSearchGeneric(c, args[2], args[1], args[3:], strings.ToLower(args[0]))
+}
@@ -0,0 +1,365 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/ds"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// base.RHash 操作
+// field 的值统一以 []byte 存储，与 SaveRDB 中的类型断言保持一致
+
+// getRHash 获取key对应的哈希表，key不存在时返回nil，类型不对时返回 redis.TypeErrReply
+// forWrite 为true时，返回的哈希表可以被原地修改
+func getRHash(db base.SDB, key string, forWrite bool) (base.RHash, base.Reply) {
+	var v interface{}
+	var ok bool
+	if forWrite {
+		v, ok = db.GetDataForWrite(key)
+	} else {
+		v, ok = db.GetData(key)
+	}
+	if !ok {
+		return nil, nil
+	}
+	val, ok := v.(base.RHash)
+	if !ok {
+		return nil, redis.TypeErrReply
+	}
+	return val, nil
+}
+
+// putRHash 写回修改后的哈希表并发出event通知，为空时删除key并发出del通知
+func putRHash(c *tcp.RegisConn, db base.SDB, key string, val base.RHash, event string) {
+	notifyKeyspaceEvent(notifyHash, event, key, c.DBIndex)
+	if val.Len() == 0 {
+		db.RemoveData(key)
+		notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+		return
+	}
+	db.PutData(key, val)
+}
+
+// hashGet 获取field对应的值
+func hashGet(hash base.RHash, field string) ([]byte, bool) {
+	if hash == nil {
+		return nil, false
+	}
+	v, ok := hash.Get(field)
+	if !ok {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+// hashSet 将 field value 对写入key对应的哈希表，返回新增的field数量
+func hashSet(c *tcp.RegisConn, key string, pairs []string) (int, base.Reply) {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	hash, errReply := getRHash(db, key, true)
+	if errReply != nil {
+		return 0, errReply
+	}
+	if hash == nil {
+		hash = ds.NewRHash()
+	}
+	added := 0
+	for i := 0; i+1 < len(pairs); i += 2 {
+		added += hash.Put(pairs[i], []byte(pairs[i+1]))
+	}
+	db.PutData(key, hash)
+	notifyKeyspaceEvent(notifyHash, "hset", key, c.DBIndex)
+	return added, nil
+}
+
+// HSet hset key field value [field value ...]
+func HSet(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args)%2 != 0 {
+		return redis.ArgNumErrReply(args[0])
+	}
+	added, errReply := hashSet(c, args[1], args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	return redis.IntReply(added)
+}
+
+// HMSet hmset key field value [field value ...]
+func HMSet(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args)%2 != 0 {
+		return redis.ArgNumErrReply(args[0])
+	}
+	if _, errReply := hashSet(c, args[1], args[2:]); errReply != nil {
+		return errReply
+	}
+	return redis.OkReply
+}
+
+// HSetNX hsetnx key field value
+func HSetNX(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	hash, errReply := getRHash(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if _, ok := hashGet(hash, args[2]); ok {
+		return redis.IntReply(0)
+	}
+	if hash == nil {
+		hash = ds.NewRHash()
+	}
+	hash.Put(args[2], []byte(args[3]))
+	db.PutData(args[1], hash)
+	notifyKeyspaceEvent(notifyHash, "hset", args[1], c.DBIndex)
+	return redis.IntReply(1)
+}
+
+func HGet(c *tcp.RegisConn, args []string) base.Reply {
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	v, ok := hashGet(hash, args[2])
+	if !ok {
+		return redis.NilReply
+	}
+	return redis.BulkReply(v)
+}
+
+func HMGet(c *tcp.RegisConn, args []string) base.Reply {
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	ret := make([]interface{}, 0, len(args)-2)
+	for i := 2; i < len(args); i++ {
+		if v, ok := hashGet(hash, args[i]); ok {
+			ret = append(ret, string(v))
+		} else {
+			ret = append(ret, nil)
+		}
+	}
+	return redis.ArrayReply(ret)
+}
+
+func HDel(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	hash, errReply := getRHash(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return redis.IntReply(0)
+	}
+	removed := 0
+	for i := 2; i < len(args); i++ {
+		removed += hash.Del(args[i])
+	}
+	if removed > 0 {
+		putRHash(c, db, args[1], hash, "hdel")
+	}
+	return redis.IntReply(removed)
+}
+
+func HExists(c *tcp.RegisConn, args []string) base.Reply {
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if _, ok := hashGet(hash, args[2]); !ok {
+		return redis.IntReply(0)
+	}
+	return redis.IntReply(1)
+}
+
+func HLen(c *tcp.RegisConn, args []string) base.Reply {
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return redis.IntReply(0)
+	}
+	return redis.IntReply(hash.Len())
+}
+
+func HStrLen(c *tcp.RegisConn, args []string) base.Reply {
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	v, _ := hashGet(hash, args[2])
+	return redis.IntReply(len(v))
+}
+
+// hashEntries 按 field, value 的顺序返回哈希表的内容，withFields/withValues 控制返回哪一部分
+func hashEntries(hash base.RHash, withFields, withValues bool) []string {
+	ret := make([]string, 0)
+	if hash == nil {
+		return ret
+	}
+	ch := make(chan struct{})
+	defer close(ch)
+	for kv := range hash.RangeKV(ch) {
+		if withFields {
+			ret = append(ret, kv.Key)
+		}
+		if withValues {
+			ret = append(ret, string(kv.Val.([]byte)))
+		}
+	}
+	return ret
+}
+
+func HKeys(c *tcp.RegisConn, args []string) base.Reply {
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	return redis.StringsReply(hashEntries(hash, true, false))
+}
+
+func HVals(c *tcp.RegisConn, args []string) base.Reply {
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	return redis.StringsReply(hashEntries(hash, false, true))
+}
+
+func HGetAll(c *tcp.RegisConn, args []string) base.Reply {
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	return redis.StringsReply(hashEntries(hash, true, true))
+}
+
+// HIncrBy hincrby key field increment
+func HIncrBy(c *tcp.RegisConn, args []string) base.Reply {
+	incr, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	hash, errReply := getRHash(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	var cur int64
+	if v, ok := hashGet(hash, args[2]); ok {
+		cur, err = strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return redis.ErrReply("ERR hash value is not an integer")
+		}
+	}
+	if (incr > 0 && cur > math.MaxInt64-incr) || (incr < 0 && cur < math.MinInt64-incr) {
+		return redis.ErrReply("ERR increment or decrement would overflow")
+	}
+	cur += incr
+	if hash == nil {
+		hash = ds.NewRHash()
+	}
+	hash.Put(args[2], []byte(strconv.FormatInt(cur, 10)))
+	db.PutData(args[1], hash)
+	notifyKeyspaceEvent(notifyHash, "hincrby", args[1], c.DBIndex)
+	return redis.Int64Reply(cur)
+}
+
+// HIncrByFloat hincrbyfloat key field increment
+// 浮点数运算在不同机器上结果可能不同，所以传播给slave时改写成 hset key field value
+func HIncrByFloat(c *tcp.RegisConn, args []string) base.Reply {
+	incr, err := strconv.ParseFloat(args[3], 64)
+	if err != nil || math.IsNaN(incr) || math.IsInf(incr, 0) {
+		return redis.FloatErrReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	hash, errReply := getRHash(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	var cur float64
+	if v, ok := hashGet(hash, args[2]); ok {
+		cur, err = strconv.ParseFloat(string(v), 64)
+		if err != nil || math.IsNaN(cur) || math.IsInf(cur, 0) {
+			return redis.ErrReply("ERR hash value is not a float")
+		}
+	}
+	cur += incr
+	if math.IsNaN(cur) || math.IsInf(cur, 0) {
+		return redis.ErrReply("ERR increment would produce NaN or Infinity")
+	}
+	if hash == nil {
+		hash = ds.NewRHash()
+	}
+	val := strconv.FormatFloat(cur, 'f', -1, 64)
+	hash.Put(args[2], []byte(val))
+	db.PutData(args[1], hash)
+	notifyKeyspaceEvent(notifyHash, "hincrbyfloat", args[1], c.DBIndex)
+	c.Rewrite([]string{"hset", args[1], args[2], val})
+	return redis.BulkStrReply(val)
+}
+
+// HRandField hrandfield key [count [WITHVALUES]]
+// count为正数时返回不重复的field，为负数时field可以重复，数量为count的绝对值
+func HRandField(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args) > 4 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	var count int64 = 1
+	if len(args) >= 3 {
+		n, errReply := parseRandCount(args[2])
+		if errReply != nil {
+			return errReply
+		}
+		count = n
+	}
+	withValues := false
+	if len(args) == 4 {
+		if strings.ToLower(args[3]) != "withvalues" {
+			return redis.ErrReply("ERR syntax error")
+		}
+		withValues = true
+	}
+
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		if len(args) >= 3 {
+			return redis.EmptyArrayReply
+		}
+		return redis.NilReply
+	}
+	if len(args) == 2 {
+		field, _ := hash.PickRandomKey()
+		return redis.BulkStrReply(field)
+	}
+
+	var fields []string
+	if count >= 0 {
+		if count > int64(hash.Len()) {
+			count = int64(hash.Len())
+		}
+		fields = hash.RandomKey(int(count))
+	} else {
+		fields = make([]string, 0, -count)
+		for i := int64(0); i < -count; i++ {
+			field, _ := hash.PickRandomKey()
+			fields = append(fields, field)
+		}
+	}
+	if !withValues {
+		return redis.StringsReply(fields)
+	}
+	ret := make([]string, 0, len(fields)*2)
+	for _, f := range fields {
+		v, _ := hashGet(hash, f)
+		ret = append(ret, f, string(v))
+	}
+	return redis.StringsReply(ret)
+}
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"code/regis/redis"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHRandField_Count(t *testing.T) {
+	c := newTestConn()
+	call(c, "hset", "hrand", "a", "1", "b", "2", "c", "3")
+
+	reply, _ := call(c, "hrandfield", "hrand", "4")
+	if n := arrayLen(reply); n != 3 {
+		t.Errorf("want 3 fields, get %v", n)
+	}
+	// 负数count可以重复，withvalues 时每个field后面跟着它的值
+	reply, _ = call(c, "hrandfield", "hrand", "-20", "withvalues")
+	values := map[string]string{"a": "1", "b": "2", "c": "3"}
+	// *40 $1 field $1 value ...
+	lines := strings.Split(strings.TrimSuffix(string(reply.Bytes()), "\r\n"), "\r\n")
+	if len(lines) != 81 {
+		t.Fatalf("want 40 elements, get %q", reply.Bytes())
+	}
+	for i := 2; i < len(lines); i += 4 {
+		if values[lines[i]] != lines[i+2] {
+			t.Errorf("field %v with value %v", lines[i], lines[i+2])
+		}
+	}
+
+	reply, _ = call(c, "hrandfield", "hrand", strconv.Itoa(-randMaxCount))
+	if n := arrayLen(reply); n != randMaxCount {
+		t.Errorf("want %v fields, get %v", randMaxCount, n)
+	}
+	reply, _ = call(c, "hrandfield", "hrand", strconv.Itoa(-randMaxCount-1), "withvalues")
+	checkReply(t, redis.ErrReply("ERR value is out of range"), reply)
+}
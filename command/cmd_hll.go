@@ -0,0 +1,113 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/ds"
+	"code/regis/redis"
+	"code/regis/tcp"
+)
+
+// HyperLogLog 命令，值以redis格式的字符串存储，见 ds.HyperLogLog
+
+// getHLL 获取key对应的 HyperLogLog，key不存在时返回nil
+// 不是字符串时返回 redis.TypeErrReply，字符串的格式不对时返回对应的错误
+func getHLL(db base.SDB, key string) (*ds.HyperLogLog, base.Reply) {
+	val, ok, errReply := getRString(db, key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if !ok {
+		return nil, nil
+	}
+	h, err := ds.ParseHLL([]byte(val))
+	if err != nil {
+		return nil, redis.ErrReply(err.Error())
+	}
+	return h, nil
+}
+
+// PFAdd pfadd key [element ...]，有寄存器被更新或者新建了key时返回1
+func PFAdd(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	h, errReply := getHLL(db, args[1])
+	if errReply != nil {
+		return errReply
+	}
+	updated := false
+	if h == nil {
+		h, updated = ds.NewHLL(), true
+	}
+	for _, elem := range args[2:] {
+		if h.Add([]byte(elem)) {
+			updated = true
+		}
+	}
+	if !updated {
+		c.Rewrite()
+		return redis.IntReply(0)
+	}
+	db.PutData(args[1], base.RString(h.Bytes()))
+	notifyKeyspaceEvent(notifyString, "pfadd", args[1], c.DBIndex)
+	return redis.IntReply(1)
+}
+
+// PFCount pfcount key [key ...]
+// 只有一个key时，估算的基数会缓存在字符串的头部，多个key时合并之后再估算，不缓存
+// 和redis一样是只读命令，slave 上也能执行；缓存失效时重新估算会改写key，只有这时才传播给slave
+func PFCount(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	if len(args) == 2 {
+		h, errReply := getHLL(db, args[1])
+		if errReply != nil {
+			return errReply
+		}
+		if h == nil {
+			c.Rewrite()
+			return redis.IntReply(0)
+		}
+		if h.CacheValid() {
+			c.Rewrite()
+			return redis.Int64Reply(int64(h.Count()))
+		}
+		n := h.Count()
+		db.PutData(args[1], base.RString(h.Bytes()))
+		return redis.Int64Reply(int64(n))
+	}
+	c.Rewrite()
+
+	merged := ds.NewHLL()
+	for _, key := range args[1:] {
+		h, errReply := getHLL(db, key)
+		if errReply != nil {
+			return errReply
+		}
+		if h != nil {
+			merged.Merge(h)
+		}
+	}
+	return redis.Int64Reply(int64(merged.Count()))
+}
+
+// PFMerge pfmerge destkey [sourcekey ...]，destkey 已经存在时也参与合并
+func PFMerge(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	h, errReply := getHLL(db, args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		h = ds.NewHLL()
+	}
+	for _, key := range args[2:] {
+		src, errReply := getHLL(db, key)
+		if errReply != nil {
+			return errReply
+		}
+		if src != nil {
+			h.Merge(src)
+		}
+	}
+	db.PutData(args[1], base.RString(h.Bytes()))
+	notifyKeyspaceEvent(notifyString, "pfadd", args[1], c.DBIndex)
+	return redis.OkReply
+}
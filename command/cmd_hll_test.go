@@ -0,0 +1,34 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"testing"
+)
+
+func TestPFCount_Cache(t *testing.T) {
+	// 只读命令在 slave 上也能执行
+	if cmd, _ := GetCmdInfo("pfcount"); cmd.HasAttr(base.CmdWrite) || !cmd.HasAttr(base.CmdPropagate) {
+		t.Errorf("pfcount should be a read-only command that propagates cache updates")
+	}
+	c, w := newTestConn(), newTestConn()
+	call(c, "pfadd", "pfc", "a", "b", "c")
+
+	// 缓存失效时更新缓存，修改了key，要传播
+	call(w, "watch", "pfc")
+	reply, propagated := call(c, "pfcount", "pfc")
+	checkReply(t, redis.IntReply(3), reply)
+	if len(propagated) != 1 || !w.DirtyCAS() {
+		t.Errorf("cache update should be propagated and touch the key, get %v", propagated)
+	}
+	call(w, "unwatch")
+
+	// 缓存有效时只读
+	call(w, "watch", "pfc")
+	reply, propagated = call(c, "pfcount", "pfc")
+	checkReply(t, redis.IntReply(3), reply)
+	if len(propagated) != 0 || w.DirtyCAS() {
+		t.Errorf("cached count should not be propagated, get %v", propagated)
+	}
+	call(w, "unwatch")
+}
@@ -0,0 +1,550 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/ds"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// base.RList 操作
+// list中的元素统一以 string 存储
+
+// getRList 获取key对应的列表，key不存在时返回nil，类型不对时返回 redis.TypeErrReply
+// forWrite 为true时，返回的列表可以被原地修改
+func getRList(db base.SDB, key string, forWrite bool) (base.RList, base.Reply) {
+	var v interface{}
+	var ok bool
+	if forWrite {
+		v, ok = db.GetDataForWrite(key)
+	} else {
+		v, ok = db.GetData(key)
+	}
+	if !ok {
+		return nil, nil
+	}
+	val, ok := v.(base.RList)
+	if !ok {
+		return nil, redis.TypeErrReply
+	}
+	return val, nil
+}
+
+// putRList 写回修改后的列表并发出event通知，为空时删除key并发出del通知
+func putRList(c *tcp.RegisConn, db base.SDB, key string, val base.RList, event string) {
+	notifyKeyspaceEvent(notifyList, event, key, c.DBIndex)
+	if val.Len() == 0 {
+		db.RemoveData(key)
+		notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+		return
+	}
+	db.PutData(key, val)
+}
+
+// listEvent 根据从哪一端操作，返回 lpush/rpush 或者 lpop/rpop 这样的事件名
+func listEvent(head bool, op string) string {
+	if head {
+		return "l" + op
+	}
+	return "r" + op
+}
+
+// listStrings 将list中取出的元素转为 []string
+func listStrings(vals []interface{}) []string {
+	ret := make([]string, len(vals))
+	for i := range vals {
+		ret[i] = vals[i].(string)
+	}
+	return ret
+}
+
+// listPush lpush/rpush/lpushx/rpushx 的公共实现，mustExist 为true时key不存在就什么都不做
+func listPush(c *tcp.RegisConn, args []string, head, mustExist bool) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, errReply := getRList(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		if mustExist {
+			return redis.IntReply(0)
+		}
+		val = ds.NewRList()
+	}
+	for i := 2; i < len(args); i++ {
+		if head {
+			val.PushHead(args[i])
+		} else {
+			val.PushTail(args[i])
+		}
+	}
+	db.PutData(args[1], val)
+	notifyKeyspaceEvent(notifyList, listEvent(head, "push"), args[1], c.DBIndex)
+	tcp.Server.SignalKeyAsReady(c.DBIndex, args[1])
+	return redis.Int64Reply(val.Len())
+}
+
+func LPush(c *tcp.RegisConn, args []string) base.Reply {
+	return listPush(c, args, true, false)
+}
+
+func RPush(c *tcp.RegisConn, args []string) base.Reply {
+	return listPush(c, args, false, false)
+}
+
+func LPushX(c *tcp.RegisConn, args []string) base.Reply {
+	return listPush(c, args, true, true)
+}
+
+func RPushX(c *tcp.RegisConn, args []string) base.Reply {
+	return listPush(c, args, false, true)
+}
+
+// listPop lpop/rpop key [count]
+func listPop(c *tcp.RegisConn, args []string, head bool) base.Reply {
+	if len(args) > 3 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	var count int64 = 1
+	if len(args) == 3 {
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || n < 0 {
+			return redis.ErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, errReply := getRList(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		c.Rewrite()
+		if len(args) == 3 {
+			return redis.NilArrayReply
+		}
+		return redis.NilReply
+	}
+
+	ret := make([]string, 0)
+	for ; count > 0 && val.Len() > 0; count-- {
+		if head {
+			ret = append(ret, val.PopHead().(string))
+		} else {
+			ret = append(ret, val.PopTail().(string))
+		}
+	}
+	// count 为0时什么都没弹出，不用通知也不用传播
+	if len(ret) == 0 {
+		c.Rewrite()
+	} else {
+		putRList(c, db, args[1], val, listEvent(head, "pop"))
+	}
+	if len(args) == 3 {
+		return redis.StringsReply(ret)
+	}
+	return redis.BulkReply([]byte(ret[0]))
+}
+
+func LPop(c *tcp.RegisConn, args []string) base.Reply {
+	return listPop(c, args, true)
+}
+
+func RPop(c *tcp.RegisConn, args []string) base.Reply {
+	return listPop(c, args, false)
+}
+
+func LLen(c *tcp.RegisConn, args []string) base.Reply {
+	val, errReply := getRList(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.IntReply(0)
+	}
+	return redis.Int64Reply(val.Len())
+}
+
+func LRange(c *tcp.RegisConn, args []string) base.Reply {
+	start, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	end, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	val, errReply := getRList(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.EmptyArrayReply
+	}
+	return redis.StringsReply(listStrings(val.LRange(start, end)))
+}
+
+// LIndex lindex key index
+func LIndex(c *tcp.RegisConn, args []string) base.Reply {
+	index, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	val, errReply := getRList(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.NilReply
+	}
+	v, ok := val.Index(index)
+	if !ok {
+		return redis.NilReply
+	}
+	return redis.BulkReply([]byte(v.(string)))
+}
+
+// LSet lset key index element
+func LSet(c *tcp.RegisConn, args []string) base.Reply {
+	index, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, errReply := getRList(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.ErrReply("ERR no such key")
+	}
+	if !val.Set(index, args[3]) {
+		return redis.ErrReply("ERR index out of range")
+	}
+	db.PutData(args[1], val)
+	notifyKeyspaceEvent(notifyList, "lset", args[1], c.DBIndex)
+	return redis.OkReply
+}
+
+// LInsert linsert key BEFORE|AFTER pivot element
+func LInsert(c *tcp.RegisConn, args []string) base.Reply {
+	where := strings.ToLower(args[2])
+	if where != "before" && where != "after" {
+		return redis.ErrReply("ERR syntax error")
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, errReply := getRList(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.IntReply(0)
+	}
+	var ret int64
+	if where == "before" {
+		ret = val.InsertBefore(args[3], args[4])
+	} else {
+		ret = val.InsertAfter(args[3], args[4])
+	}
+	if ret > 0 {
+		db.PutData(args[1], val)
+		notifyKeyspaceEvent(notifyList, "linsert", args[1], c.DBIndex)
+	}
+	return redis.Int64Reply(ret)
+}
+
+// LRem lrem key count element
+func LRem(c *tcp.RegisConn, args []string) base.Reply {
+	count, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, errReply := getRList(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.IntReply(0)
+	}
+	removed := val.DelEntry(args[3], count)
+	if removed > 0 {
+		putRList(c, db, args[1], val, "lrem")
+	}
+	return redis.Int64Reply(removed)
+}
+
+// LTrim ltrim key start stop
+func LTrim(c *tcp.RegisConn, args []string) base.Reply {
+	start, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	stop, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, errReply := getRList(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.OkReply
+	}
+	val.Trim(start, stop)
+	putRList(c, db, args[1], val, "ltrim")
+	return redis.OkReply
+}
+
+// LPos lpos key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+// rank 为负数时从尾部开始查找，count 为0表示返回所有匹配的下标，maxlen 为0表示不限比较次数
+func LPos(c *tcp.RegisConn, args []string) base.Reply {
+	var rank, count, maxLen int64 = 1, -1, 0
+	for i := 3; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return redis.ErrReply("ERR syntax error")
+		}
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil {
+			return redis.IntErrReply
+		}
+		switch strings.ToLower(args[i]) {
+		case "rank":
+			if n == 0 {
+				return redis.ErrReply("ERR RANK can't be zero: use 1 to start from the first match, " +
+					"2 from the second ... or use negative to start from the end of the list")
+			}
+			// 和redis一样 rank 的范围是 [-LONG_MAX, LONG_MAX]，否则 -rank 会溢出
+			if n == math.MinInt64 {
+				return redis.ErrReply(fmt.Sprintf("ERR value is out of range, value must between %v and %v",
+					-math.MaxInt64, math.MaxInt64))
+			}
+			rank = n
+		case "count":
+			if n < 0 {
+				return redis.ErrReply("ERR COUNT can't be negative")
+			}
+			count = n
+		case "maxlen":
+			if n < 0 {
+				return redis.ErrReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return redis.ErrReply("ERR syntax error")
+		}
+	}
+
+	val, errReply := getRList(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		if count >= 0 {
+			return redis.EmptyArrayReply
+		}
+		return redis.NilReply
+	}
+
+	fromTail := rank < 0
+	if fromTail {
+		rank = -rank
+	}
+	// 直接在链表上找，最多比较 MAXLEN 个元素，不用先把整个列表复制出来
+	ret := make([]interface{}, 0)
+	var checked int64
+	val.Walk(fromTail, func(pos int64, elem interface{}) bool {
+		if maxLen > 0 && checked >= maxLen {
+			return false
+		}
+		checked++
+		if elem.(string) != args[2] {
+			return true
+		}
+		if rank > 1 {
+			rank--
+			return true
+		}
+		ret = append(ret, int(pos))
+		// 没有指定COUNT时只要第一个，COUNT为0时要全部
+		return count == 0 || (count > 0 && int64(len(ret)) < count)
+	})
+
+	if count < 0 {
+		if len(ret) == 0 {
+			return redis.NilReply
+		}
+		return redis.IntReply(ret[0].(int))
+	}
+	if len(ret) == 0 {
+		return redis.EmptyArrayReply
+	}
+	return redis.ArrayReply(ret)
+}
+
+// listMove 从src的一端弹出元素，推入dst的一端，src不存在时返回nil
+// fromHead/toHead 为true表示 LEFT，否则为 RIGHT
+func listMove(c *tcp.RegisConn, src, dst string, fromHead, toHead bool) (interface{}, base.Reply) {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	srcList, errReply := getRList(db, src, true)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if srcList == nil {
+		return nil, nil
+	}
+	dstList := srcList
+	if src != dst {
+		dstList, errReply = getRList(db, dst, true)
+		if errReply != nil {
+			return nil, errReply
+		}
+		if dstList == nil {
+			dstList = ds.NewRList()
+		}
+	}
+
+	var v interface{}
+	if fromHead {
+		v = srcList.PopHead()
+	} else {
+		v = srcList.PopTail()
+	}
+	if toHead {
+		dstList.PushHead(v)
+	} else {
+		dstList.PushTail(v)
+	}
+	db.PutData(dst, dstList)
+	notifyKeyspaceEvent(notifyList, listEvent(toHead, "push"), dst, c.DBIndex)
+	putRList(c, db, src, srcList, listEvent(fromHead, "pop"))
+	tcp.Server.SignalKeyAsReady(c.DBIndex, dst)
+	return v, nil
+}
+
+// parseListWhere 解析 LEFT|RIGHT，LEFT 返回true
+func parseListWhere(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "left":
+		return true, true
+	case "right":
+		return false, true
+	}
+	return false, false
+}
+
+// LMove lmove source destination LEFT|RIGHT LEFT|RIGHT
+func LMove(c *tcp.RegisConn, args []string) base.Reply {
+	fromHead, ok1 := parseListWhere(args[3])
+	toHead, ok2 := parseListWhere(args[4])
+	if !ok1 || !ok2 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	v, errReply := listMove(c, args[1], args[2], fromHead, toHead)
+	if errReply != nil {
+		return errReply
+	}
+	if v == nil {
+		return redis.NilReply
+	}
+	return redis.BulkReply([]byte(v.(string)))
+}
+
+// RPopLPush rpoplpush source destination
+func RPopLPush(c *tcp.RegisConn, args []string) base.Reply {
+	v, errReply := listMove(c, args[1], args[2], false, true)
+	if errReply != nil {
+		return errReply
+	}
+	if v == nil {
+		return redis.NilReply
+	}
+	return redis.BulkReply([]byte(v.(string)))
+}
+
+// bListPop blpop/brpop key [key ...] timeout
+// 按顺序从第一个非空的列表中弹出元素，都为空时阻塞，传播给slave时改写成 lpop/rpop
+func bListPop(c *tcp.RegisConn, args []string, head bool) base.Reply {
+	timeout, errReply := parseTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys := args[1 : len(args)-1]
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	for _, key := range keys {
+		val, errReply := getRList(db, key, false)
+		if errReply != nil {
+			return errReply
+		}
+		if val == nil {
+			continue
+		}
+		val, _ = getRList(db, key, true)
+		var v interface{}
+		if head {
+			v = val.PopHead()
+			c.Rewrite([]string{"lpop", key})
+		} else {
+			v = val.PopTail()
+			c.Rewrite([]string{"rpop", key})
+		}
+		putRList(c, db, key, val, listEvent(head, "pop"))
+		return redis.StringsReply([]string{key, v.(string)})
+	}
+	c.Rewrite()
+	c.Block(args, keys, timeout, redis.NilArrayReply)
+	return nil
+}
+
+func BLPop(c *tcp.RegisConn, args []string) base.Reply {
+	return bListPop(c, args, true)
+}
+
+func BRPop(c *tcp.RegisConn, args []string) base.Reply {
+	return bListPop(c, args, false)
+}
+
+// bListMove blmove/brpoplpush 的公共实现，source为空时阻塞，传播给slave时改写成 lmove
+func bListMove(c *tcp.RegisConn, args []string, src, dst string, fromHead, toHead bool, timeoutArg string) base.Reply {
+	timeout, errReply := parseTimeout(timeoutArg)
+	if errReply != nil {
+		return errReply
+	}
+	v, errReply := listMove(c, src, dst, fromHead, toHead)
+	if errReply != nil {
+		return errReply
+	}
+	if v == nil {
+		c.Rewrite()
+		c.Block(args, []string{src}, timeout, redis.NilReply)
+		return nil
+	}
+	where := func(head bool) string {
+		if head {
+			return "LEFT"
+		}
+		return "RIGHT"
+	}
+	c.Rewrite([]string{"lmove", src, dst, where(fromHead), where(toHead)})
+	return redis.BulkReply([]byte(v.(string)))
+}
+
+// BLMove blmove source destination LEFT|RIGHT LEFT|RIGHT timeout
+func BLMove(c *tcp.RegisConn, args []string) base.Reply {
+	fromHead, ok1 := parseListWhere(args[3])
+	toHead, ok2 := parseListWhere(args[4])
+	if !ok1 || !ok2 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	return bListMove(c, args, args[1], args[2], fromHead, toHead, args[5])
+}
+
+// BRPopLPush brpoplpush source destination timeout
+func BRPopLPush(c *tcp.RegisConn, args []string) base.Reply {
+	return bListMove(c, args, args[1], args[2], false, true, args[3])
+}
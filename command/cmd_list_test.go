@@ -0,0 +1,75 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"testing"
+)
+
+func TestLPop_CountZero(t *testing.T) {
+	c := newTestConn()
+	call(c, "rpush", "lpop0", "a", "b")
+	reply, propagated := call(c, "lpop", "lpop0", "0")
+	checkReply(t, redis.EmptyArrayReply, reply)
+	if len(propagated) != 0 {
+		t.Errorf("want no propagation, get %v", propagated)
+	}
+	reply, propagated = call(c, "rpop", "lpop0", "1")
+	checkReply(t, redis.StringsReply([]string{"b"}), reply)
+	if len(propagated) != 1 {
+		t.Errorf("want propagation, get %v", propagated)
+	}
+}
+
+func TestLPos_RankRange(t *testing.T) {
+	c := newTestConn()
+	call(c, "del", "lposr")
+	call(c, "rpush", "lposr", "a", "b", "a")
+	reply, _ := call(c, "lpos", "lposr", "a", "rank", "-9223372036854775808")
+	checkReply(t, redis.ErrReply("ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807"), reply)
+	reply, _ = call(c, "lpos", "lposr", "a", "rank", "-9223372036854775807")
+	checkReply(t, redis.NilReply, reply)
+	reply, _ = call(c, "lpos", "lposr", "a", "rank", "-1")
+	checkReply(t, redis.IntReply(2), reply)
+}
+
+func TestLPos(t *testing.T) {
+	c := newTestConn()
+	call(c, "del", "lpos")
+	call(c, "rpush", "lpos", "a", "b", "c", "1", "2", "3", "c", "c")
+	tests := []struct {
+		args []string
+		want base.Reply
+	}{
+		{[]string{"c"}, redis.IntReply(2)},
+		{[]string{"x"}, redis.NilReply},
+		{[]string{"c", "rank", "2"}, redis.IntReply(6)},
+		{[]string{"c", "rank", "-1"}, redis.IntReply(7)},
+		{[]string{"c", "rank", "-3"}, redis.IntReply(2)},
+		{[]string{"c", "rank", "4"}, redis.NilReply},
+		{[]string{"c", "count", "2"}, redis.ArrayReply([]interface{}{2, 6})},
+		{[]string{"c", "count", "0"}, redis.ArrayReply([]interface{}{2, 6, 7})},
+		{[]string{"c", "count", "0", "rank", "-1"}, redis.ArrayReply([]interface{}{7, 6, 2})},
+		{[]string{"c", "count", "0", "rank", "2"}, redis.ArrayReply([]interface{}{6, 7})},
+		{[]string{"x", "count", "0"}, redis.EmptyArrayReply},
+		// MAXLEN 限制最多比较的元素个数
+		{[]string{"c", "maxlen", "2"}, redis.NilReply},
+		{[]string{"c", "maxlen", "3"}, redis.IntReply(2)},
+		{[]string{"c", "count", "0", "maxlen", "7"}, redis.ArrayReply([]interface{}{2, 6})},
+		{[]string{"c", "count", "0", "maxlen", "2", "rank", "-1"}, redis.ArrayReply([]interface{}{7, 6})},
+		{[]string{"c", "maxlen", "0"}, redis.IntReply(2)},
+		{[]string{"c", "rank", "0"}, redis.ErrReply("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")},
+		{[]string{"c", "count", "-1"}, redis.ErrReply("ERR COUNT can't be negative")},
+		{[]string{"c", "maxlen", "-1"}, redis.ErrReply("ERR MAXLEN can't be negative")},
+		{[]string{"c", "count"}, redis.ErrReply("ERR syntax error")},
+		{[]string{"c", "foo", "1"}, redis.ErrReply("ERR syntax error")},
+	}
+	for _, tt := range tests {
+		reply, _ := call(c, append([]string{"lpos", "lpos"}, tt.args...)...)
+		checkReply(t, tt.want, reply)
+	}
+	reply, _ := call(c, "lpos", "nokey", "c")
+	checkReply(t, redis.NilReply, reply)
+	reply, _ = call(c, "lpos", "nokey", "c", "count", "1")
+	checkReply(t, redis.EmptyArrayReply, reply)
+}
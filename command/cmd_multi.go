@@ -0,0 +1,87 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+)
+
+// 事务相关的命令，客户端的事务状态见 tcp/multi.go
+// 命令入队的逻辑在主协程的 Executor 中，入队前检查出错时调用 tcp.RegisConn.FlagExecAbort
+
+// keyModified key被修改时调用，让watch它的客户端的 EXEC 失败
+func keyModified(dbIndex int, key string) {
+	tcp.Server.TouchWatchedKey(dbIndex, key)
+}
+
+func Multi(c *tcp.RegisConn, args []string) base.Reply {
+	if c.InMulti() {
+		return redis.ErrReply("ERR MULTI calls can not be nested")
+	}
+	c.StartMulti()
+	return redis.OkReply
+}
+
+func Discard(c *tcp.RegisConn, args []string) base.Reply {
+	if !c.InMulti() {
+		return redis.ErrReply("ERR DISCARD without MULTI")
+	}
+	c.DiscardMulti()
+	return redis.OkReply
+}
+
+// Exec 依次执行事务队列中的命令，返回每个命令的回复
+// 入队时有命令出错返回 EXECABORT，watch的key被修改过或者过期了返回 nil，两种情况都不执行任何命令
+// 传播给slave时，事务中要传播的命令包在 MULTI/EXEC 中，见 cmdInfo.Call
+func Exec(c *tcp.RegisConn, args []string) base.Reply {
+	if !c.InMulti() {
+		return redis.ErrReply("ERR EXEC without MULTI")
+	}
+	defer c.DiscardMulti()
+	if c.ExecAborted() {
+		return redis.ErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	c.ExpireWatchedKeys()
+	if c.DirtyCAS() {
+		return redis.NilArrayReply
+	}
+	// 执行前就取消watch，事务自己修改watch的key不影响
+	c.UnWatchAll()
+	queue := c.MultiQueue()
+	replies := make([]base.Reply, 0, len(queue))
+	for _, query := range queue {
+		cmdInfo, _ := GetCmdInfo(query[0])
+		reply := cmdInfo.Call(c, query)
+		// 阻塞命令在事务中当作立即超时
+		if timeoutReply := c.TakeTimeoutReply(); timeoutReply != nil {
+			reply = timeoutReply
+		}
+		if reply == nil {
+			reply = redis.NilReply
+		}
+		replies = append(replies, reply)
+	}
+	if c.MultiPropagated() {
+		tcp.ReplicationFeedSlaves(redis.CmdSReply("exec").Bytes(), c.DBIndex)
+	}
+	return arrayOrEmpty(replies)
+}
+
+// Watch watch key [key ...]
+// watch 前先删掉已经过期的key，这样 watch 时就已经过期的key，EXEC 时不算被修改
+func Watch(c *tcp.RegisConn, args []string) base.Reply {
+	if c.InMulti() {
+		return redis.ErrReply("ERR WATCH inside MULTI is not allowed")
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	for _, key := range args[1:] {
+		db.GetData(key)
+		c.Watch(key)
+	}
+	return redis.OkReply
+}
+
+func UnWatch(c *tcp.RegisConn, args []string) base.Reply {
+	c.UnWatchAll()
+	return redis.OkReply
+}
@@ -0,0 +1,105 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/ds"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// execAll 和 Executor 一样执行命令，事务中的命令会入队，返回每条命令的回复
+func execAll(c *tcp.RegisConn, queries ...[]string) []base.Reply {
+	ret := make([]base.Reply, 0, len(queries))
+	for _, q := range queries {
+		ret = append(ret, ExecCommand(c, q))
+	}
+	return ret
+}
+
+func TestMulti_ExecAbort(t *testing.T) {
+	c := newTestConn()
+	replies := execAll(c,
+		[]string{"multi"},
+		[]string{"set", "abortk", "1"},
+		[]string{"nosuchcmd"},
+		[]string{"get"},
+		[]string{"exec"},
+		[]string{"exec"},
+	)
+	want := []base.Reply{
+		redis.OkReply,
+		redis.StrReply("QUEUED"),
+		redis.UnknownCmdErrReply("nosuchcmd"),
+		redis.ArgNumErrReply("get"),
+		redis.ErrReply("EXECABORT Transaction discarded because of previous errors."),
+		redis.ErrReply("ERR EXEC without MULTI"),
+	}
+	for i := range want {
+		checkReply(t, want[i], replies[i])
+	}
+	// 入队成功的命令也不执行
+	checkReply(t, redis.NilReply, ExecCommand(c, []string{"get", "abortk"}))
+}
+
+func TestWatch_ModifiedByOther(t *testing.T) {
+	a, b := newTestConn(), newTestConn()
+	ExecCommand(a, []string{"watch", "watchk"})
+	ExecCommand(b, []string{"set", "watchk", "b"})
+	replies := execAll(a, []string{"multi"}, []string{"set", "watchk", "a"}, []string{"exec"})
+	checkReply(t, redis.NilArrayReply, replies[2])
+	checkReply(t, redis.BulkStrReply("b"), ExecCommand(a, []string{"get", "watchk"}))
+
+	// EXEC 之后不再watch，没有被修改时正常执行
+	ExecCommand(b, []string{"set", "watchk", "b"})
+	ExecCommand(a, []string{"watch", "watchk"})
+	replies = execAll(a, []string{"multi"}, []string{"set", "watchk", "a"}, []string{"exec"})
+	checkReply(t, redis.MultiReply([]base.Reply{redis.OkReply}), replies[2])
+	checkReply(t, redis.BulkStrReply("a"), ExecCommand(a, []string{"get", "watchk"}))
+}
+
+func TestWatch_Expired(t *testing.T) {
+	c := newTestConn()
+	ExecCommand(c, []string{"set", "watche", "v", "px", "50"})
+	ExecCommand(c, []string{"watch", "watche"})
+	time.Sleep(60 * time.Millisecond)
+	// 没有访问过期的key，EXEC 时也要发现它过期了
+	replies := execAll(c, []string{"multi"}, []string{"ping"}, []string{"exec"})
+	checkReply(t, redis.NilArrayReply, replies[2])
+
+	// watch 时就已经过期的key不算被修改
+	ExecCommand(c, []string{"set", "watche", "v", "px", "20"})
+	time.Sleep(30 * time.Millisecond)
+	ExecCommand(c, []string{"watch", "watche"})
+	replies = execAll(c, []string{"multi"}, []string{"ping"}, []string{"exec"})
+	checkReply(t, redis.MultiReply([]base.Reply{redis.StrReply("PONG")}), replies[2])
+}
+
+func TestMulti_Propagate(t *testing.T) {
+	backlog := ds.NewRingBuffer(1 << 16)
+	backlog.Active = true
+	tcp.Server.ReplBacklog = backlog
+	defer func() { tcp.Server.ReplBacklog = nil }()
+
+	c := newTestConn()
+	start := backlog.WritePtr
+	execAll(c, []string{"multi"}, []string{"get", "propk"}, []string{"set", "propk", "1"}, []string{"incr", "propk"}, []string{"exec"})
+	buf, _ := backlog.Read(start)
+	want := string(redis.CmdSReply("multi").Bytes()) +
+		string(redis.CmdSReply("set", "propk", "1").Bytes()) +
+		string(redis.CmdSReply("incr", "propk").Bytes()) +
+		string(redis.CmdSReply("exec").Bytes())
+	// 前面可能有切换db的 select
+	if !strings.HasSuffix(string(buf), want) {
+		t.Errorf("want %q, get %q", want, buf)
+	}
+
+	// 没有要传播的命令时，也不传播 MULTI/EXEC
+	start = backlog.WritePtr
+	execAll(c, []string{"multi"}, []string{"get", "propk"}, []string{"exec"})
+	if buf, _ := backlog.Read(start); len(buf) != 0 {
+		t.Errorf("read only transaction should not propagate, get %q", buf)
+	}
+}
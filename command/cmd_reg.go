@@ -2,16 +2,77 @@ package command
 
 import (
 	"code/regis/base"
+	"code/regis/conf"
+	log "code/regis/lib"
 )
 
 func sdbInit() {
 	// string
 	RegCmdInfo("set", Set, -3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("setnx", SetNX, 3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("setex", SetEX, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("psetex", PSetEX, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
 	RegCmdInfo("get", Get, 2, base.CmdReadOnly)
+	RegCmdInfo("getset", GetSet, 3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("getdel", GetDel, 2, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("getex", GetEX, -2, base.CmdPropagate|base.CmdWrite)
 	RegCmdInfo("mset", MSet, -3, base.CmdPropagate|base.CmdWrite)
 	RegCmdInfo("mget", MGet, -2, base.CmdReadOnly)
+	RegCmdInfo("msetnx", MSetNX, -3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("incr", Incr, 2, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("decr", Decr, 2, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("incrby", IncrBy, 3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("decrby", DecrBy, 3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("incrbyfloat", IncrByFloat, 3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("append", Append, 3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("strlen", StrLen, 2, base.CmdReadOnly)
+	RegCmdInfo("getrange", GetRange, 4, base.CmdReadOnly)
+	RegCmdInfo("setrange", SetRange, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("lcs", LCS, -3, base.CmdReadOnly)
 	RegCmdInfo("del", Del, -2, base.CmdPropagate|base.CmdWrite)
 	RegCmdInfo("dbsize", DBSize, 1, base.CmdReadOnly)
+	RegCmdInfo("object", Object, -2, base.CmdReadOnly)
+
+	// keyspace
+	RegCmdInfo("unlink", Unlink, -2, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("exists", Exists, -2, base.CmdReadOnly)
+	RegCmdInfo("touch", Touch, -2, base.CmdReadOnly)
+	RegCmdInfo("type", Type, 2, base.CmdReadOnly)
+	RegCmdInfo("randomkey", RandomKey, 1, base.CmdReadOnly|base.CmdRandom)
+	RegCmdInfo("rename", Rename, 3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("renamenx", RenameNX, 3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("copy", Copy, -3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("keys", Keys, 2, base.CmdReadOnly)
+	RegCmdInfo("scan", Scan, -2, base.CmdReadOnly|base.CmdRandom)
+
+	// bitmap
+	RegCmdInfo("setbit", SetBit, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("getbit", GetBit, 3, base.CmdReadOnly)
+	RegCmdInfo("bitcount", BitCount, -2, base.CmdReadOnly)
+	RegCmdInfo("bitpos", BitPos, -3, base.CmdReadOnly)
+	RegCmdInfo("bitop", BitOp, -4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("bitfield", BitField, -2, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("bitfield_ro", BitFieldRO, -2, base.CmdReadOnly)
+
+	// hyperloglog
+	RegCmdInfo("pfadd", PFAdd, -2, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("pfcount", PFCount, -2, base.CmdReadOnly|base.CmdPropagate)
+	RegCmdInfo("pfmerge", PFMerge, -2, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+
+	// expire
+	RegCmdInfo("expire", Expire, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("pexpire", PExpire, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("expireat", ExpireAt, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("pexpireat", PExpireAt, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("ttl", TTL, 2, base.CmdReadOnly)
+	RegCmdInfo("pttl", PTTL, 2, base.CmdReadOnly)
+	RegCmdInfo("expiretime", ExpireTime, 2, base.CmdReadOnly)
+	RegCmdInfo("pexpiretime", PExpireTime, 2, base.CmdReadOnly)
+	RegCmdInfo("persist", Persist, 2, base.CmdPropagate|base.CmdWrite)
+
+	// sort
+	RegCmdInfo("sort", Sort, -2, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("sort_ro", SortRO, -2, base.CmdReadOnly)
 
 	// list
 	RegCmdInfo("lpush", LPush, -3, base.CmdPropagate|base.CmdWrite)
@@ -19,6 +80,112 @@ func sdbInit() {
 	RegCmdInfo("lpushx", LPushX, -3, base.CmdPropagate|base.CmdWrite)
 	RegCmdInfo("rpushx", RPushX, -3, base.CmdPropagate|base.CmdWrite)
 	RegCmdInfo("lrange", LRange, 4, base.CmdReadOnly)
+	RegCmdInfo("lpop", LPop, -2, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("rpop", RPop, -2, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("llen", LLen, 2, base.CmdReadOnly)
+	RegCmdInfo("lindex", LIndex, 3, base.CmdReadOnly)
+	RegCmdInfo("lset", LSet, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("linsert", LInsert, 5, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("lrem", LRem, 4, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("ltrim", LTrim, 4, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("lpos", LPos, -3, base.CmdReadOnly)
+	RegCmdInfo("rpoplpush", RPopLPush, 3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("lmove", LMove, 5, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("blpop", BLPop, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("brpop", BRPop, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("blmove", BLMove, 6, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("brpoplpush", BRPopLPush, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+
+	// set
+	RegCmdInfo("sadd", SAdd, -3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("srem", SRem, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("smembers", SMembers, 2, base.CmdReadOnly)
+	RegCmdInfo("sismember", SIsMember, 3, base.CmdReadOnly)
+	RegCmdInfo("smismember", SMIsMember, -3, base.CmdReadOnly)
+	RegCmdInfo("scard", SCard, 2, base.CmdReadOnly)
+	RegCmdInfo("spop", SPop, -2, base.CmdPropagate|base.CmdWrite|base.CmdRandom)
+	RegCmdInfo("srandmember", SRandMember, -2, base.CmdReadOnly|base.CmdRandom)
+	RegCmdInfo("smove", SMove, 4, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("sinter", SInter, -2, base.CmdReadOnly)
+	RegCmdInfo("sunion", SUnion, -2, base.CmdReadOnly)
+	RegCmdInfo("sdiff", SDiff, -2, base.CmdReadOnly)
+	RegCmdInfo("sinterstore", SInterStore, -3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("sunionstore", SUnionStore, -3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("sdiffstore", SDiffStore, -3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("sintercard", SInterCard, -3, base.CmdReadOnly)
+	RegCmdInfo("sscan", SScan, -3, base.CmdReadOnly|base.CmdRandom)
+
+	// zset
+	RegCmdInfo("zadd", ZAdd, -4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("zincrby", ZIncrBy, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("zrem", ZRem, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("zscore", ZScore, 3, base.CmdReadOnly)
+	RegCmdInfo("zmscore", ZMScore, -3, base.CmdReadOnly)
+	RegCmdInfo("zcard", ZCard, 2, base.CmdReadOnly)
+	RegCmdInfo("zrank", ZRank, -3, base.CmdReadOnly)
+	RegCmdInfo("zrevrank", ZRevRank, -3, base.CmdReadOnly)
+	RegCmdInfo("zrange", ZRange, -4, base.CmdReadOnly)
+	RegCmdInfo("zrevrange", ZRevRange, -4, base.CmdReadOnly)
+	RegCmdInfo("zrangebyscore", ZRangeByScore, -4, base.CmdReadOnly)
+	RegCmdInfo("zrevrangebyscore", ZRevRangeByScore, -4, base.CmdReadOnly)
+	RegCmdInfo("zrangebylex", ZRangeByLex, -4, base.CmdReadOnly)
+	RegCmdInfo("zrevrangebylex", ZRevRangeByLex, -4, base.CmdReadOnly)
+	RegCmdInfo("zcount", ZCount, 4, base.CmdReadOnly)
+	RegCmdInfo("zlexcount", ZLexCount, 4, base.CmdReadOnly)
+	RegCmdInfo("zremrangebyscore", ZRemRangeByScore, 4, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("zremrangebyrank", ZRemRangeByRank, 4, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("zremrangebylex", ZRemRangeByLex, 4, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("zpopmin", ZPopMin, -2, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("zpopmax", ZPopMax, -2, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("zrandmember", ZRandMember, -2, base.CmdReadOnly|base.CmdRandom)
+	RegCmdInfo("zrangestore", ZRangeStore, -5, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("zunionstore", ZUnionStore, -4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("zinterstore", ZInterStore, -4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("zdiffstore", ZDiffStore, -4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("zscan", ZScan, -3, base.CmdReadOnly|base.CmdRandom)
+
+	// geo
+	RegCmdInfo("geoadd", GeoAdd, -5, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("geopos", GeoPos, -2, base.CmdReadOnly)
+	RegCmdInfo("geodist", GeoDist, -4, base.CmdReadOnly)
+	RegCmdInfo("geohash", GeoHash, -2, base.CmdReadOnly)
+	RegCmdInfo("geosearch", GeoSearch, -7, base.CmdReadOnly)
+	RegCmdInfo("geosearchstore", GeoSearchStore, -8, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+
+	// hash
+	RegCmdInfo("hset", HSet, -4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("hmset", HMSet, -4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("hsetnx", HSetNX, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("hget", HGet, 3, base.CmdReadOnly)
+	RegCmdInfo("hmget", HMGet, -3, base.CmdReadOnly)
+	RegCmdInfo("hdel", HDel, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("hexists", HExists, 3, base.CmdReadOnly)
+	RegCmdInfo("hlen", HLen, 2, base.CmdReadOnly)
+	RegCmdInfo("hstrlen", HStrLen, 3, base.CmdReadOnly)
+	RegCmdInfo("hkeys", HKeys, 2, base.CmdReadOnly)
+	RegCmdInfo("hvals", HVals, 2, base.CmdReadOnly)
+	RegCmdInfo("hgetall", HGetAll, 2, base.CmdReadOnly)
+	RegCmdInfo("hincrby", HIncrBy, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("hincrbyfloat", HIncrByFloat, 4, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("hrandfield", HRandField, -2, base.CmdReadOnly|base.CmdRandom)
+	RegCmdInfo("hscan", HScan, -3, base.CmdReadOnly|base.CmdRandom)
+
+	// stream
+	RegCmdInfo("xadd", XAdd, -5, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("xrange", XRange, -4, base.CmdReadOnly)
+	RegCmdInfo("xrevrange", XRevRange, -4, base.CmdReadOnly)
+	RegCmdInfo("xlen", XLen, 2, base.CmdReadOnly)
+	RegCmdInfo("xdel", XDel, -3, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("xtrim", XTrim, -4, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("xsetid", XSetID, -3, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("xread", XRead, -4, base.CmdReadOnly)
+	RegCmdInfo("xreadgroup", XReadGroup, -7, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("xgroup", XGroup, -2, base.CmdPropagate|base.CmdWrite|base.CmdDenyOom)
+	RegCmdInfo("xack", XAck, -4, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("xpending", XPending, -3, base.CmdReadOnly)
+	RegCmdInfo("xclaim", XClaim, -6, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("xautoclaim", XAutoClaim, -6, base.CmdPropagate|base.CmdWrite)
+	RegCmdInfo("xinfo", XInfo, -2, base.CmdReadOnly)
 }
 
 func mdbInit() {
@@ -27,16 +194,29 @@ func mdbInit() {
 
 func serverInit() {
 	RegCmdInfo("ping", Ping, -1, base.CmdPropagate|base.CmdAdmin)
+	RegCmdInfo("quit", Quit, -1, base.CmdTx|base.CmdFast)
+	RegCmdInfo("reset", Reset, 1, base.CmdTx|base.CmdFast)
 	RegCmdInfo("select", Select, 2, base.CmdLoading)
 	RegCmdInfo("save", Save, 1, base.CmdAdmin)
 	RegCmdInfo("bgsave", BGSave, 1, base.CmdAdmin)
 	RegCmdInfo("publish", Publish, 3, base.CmdPubSub)
 	RegCmdInfo("subscribe", Subscribe, -2, base.CmdPubSub)
-	RegCmdInfo("unsubscribe", UnSubscribe, -2, base.CmdPubSub)
+	RegCmdInfo("unsubscribe", UnSubscribe, -1, base.CmdPubSub)
+	RegCmdInfo("psubscribe", PSubscribe, -2, base.CmdPubSub)
+	RegCmdInfo("punsubscribe", PUnSubscribe, -1, base.CmdPubSub)
+	RegCmdInfo("pubsub", PubSub, -2, base.CmdPubSub|base.CmdRandom)
+
+	// 事务
+	RegCmdInfo("multi", Multi, 1, base.CmdTx)
+	RegCmdInfo("exec", Exec, 1, base.CmdTx)
+	RegCmdInfo("discard", Discard, 1, base.CmdTx)
+	RegCmdInfo("watch", Watch, -2, base.CmdTx)
+	RegCmdInfo("unwatch", UnWatch, 1, base.CmdFast)
 
 	// 主从
 	RegCmdInfo("replicaof", ReplicaOf, 3, base.CmdAdmin)
 	RegCmdInfo("info", Info, -1, base.CmdAdmin)
+	RegCmdInfo("config", Config, -2, base.CmdAdmin)
 	RegCmdInfo("flushall", FlushALl, 1, base.CmdPropagate|base.CmdWrite|base.CmdAdmin)
 	RegCmdInfo("replconf", ReplConf, -3, base.CmdAdmin)
 	RegCmdInfo("psync", PSync, 3, base.CmdAdmin)
@@ -46,6 +226,13 @@ func serverInit() {
 }
 
 func ServerInit() {
+	base.OnKeyExpired = keyExpired
+	base.OnKeyModified = keyModified
+	base.IsSlave = isSlave
+	base.FromMaster = fromMaster
+	if err := setNotifyKeyspaceEvents(conf.Conf.NotifyKeyspaceEvents); err != nil {
+		log.Error("notify-keyspace-events %v", err)
+	}
 	sdbInit()
 	mdbInit()
 	serverInit()
@@ -0,0 +1,210 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/lib/utils"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"strconv"
+	"strings"
+)
+
+// keys 和 scan 系列命令
+// scan 的游标是无状态的，遍历开始前就存在、并且一直没有被删除的key一定会被返回，见 ds.Dict.Scan 和 SingleDB.Scan
+
+const (
+	scanDefaultCount = 10
+	// scanMaxCount COUNT 的上限，COUNT 只是一个提示，太大的值按上限处理，避免 count*10 溢出
+	scanMaxCount = 1 << 20
+	// keysBatch keys 命令每次从 sdb 中取出的key数量
+	keysBatch = 1024
+)
+
+type scanArgs struct {
+	cursor uint64
+	match  string
+	count  int
+	// typ 只有 scan 支持，为空表示不按类型过滤
+	typ string
+}
+
+// parseScanArgs 解析 cursor [MATCH pattern] [COUNT count] [TYPE type]，args 从游标开始
+func parseScanArgs(args []string, allowType bool) (*scanArgs, base.Reply) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return nil, redis.ErrReply("ERR invalid cursor")
+	}
+	ret := &scanArgs{cursor: cursor, count: scanDefaultCount}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, redis.ErrReply("ERR syntax error")
+		}
+		switch opt := strings.ToLower(args[i]); {
+		case opt == "match":
+			ret.match = args[i+1]
+		case opt == "count":
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, redis.IntErrReply
+			}
+			if n < 1 {
+				return nil, redis.ErrReply("ERR syntax error")
+			}
+			if n > scanMaxCount {
+				n = scanMaxCount
+			}
+			ret.count = int(n)
+		case opt == "type" && allowType:
+			ret.typ = strings.ToLower(args[i+1])
+		default:
+			return nil, redis.ErrReply("ERR syntax error")
+		}
+	}
+	return ret, nil
+}
+
+func (sa *scanArgs) matched(s string) bool {
+	return sa.match == "" || utils.GlobMatch(sa.match, s, false)
+}
+
+// scanElements 反复调用scan直到凑够count个元素或者遍历结束，返回下一次的游标
+// 和redis一样最多遍历 count*10 次，避免大部分桶为空时阻塞太久
+func (sa *scanArgs) scanElements(collected func() int, scan func(cursor uint64) uint64) uint64 {
+	cursor := sa.cursor
+	for maxIterations := sa.count * 10; maxIterations > 0; maxIterations-- {
+		cursor = scan(cursor)
+		if cursor == 0 || collected() >= sa.count {
+			break
+		}
+	}
+	return cursor
+}
+
+func scanReply(cursor uint64, elements []string) base.Reply {
+	return redis.MultiReply([]base.Reply{
+		redis.BulkStrReply(strconv.FormatUint(cursor, 10)),
+		redis.StringsReply(elements),
+	})
+}
+
+// Keys keys pattern 会遍历整个库，只用于调试
+func Keys(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	// bgsave期间同一个key可能在多次 Scan 中都被返回，需要去重
+	seen := make(map[string]struct{})
+	ret := make([]string, 0)
+	var cursor uint64
+	for {
+		var keys []string
+		keys, cursor = db.Scan(cursor, keysBatch)
+		for _, key := range keys {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			if utils.GlobMatch(args[1], key, false) {
+				ret = append(ret, key)
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	return redis.StringsReply(ret)
+}
+
+// Scan scan cursor [MATCH pattern] [COUNT count] [TYPE type]
+func Scan(c *tcp.RegisConn, args []string) base.Reply {
+	sa, errReply := parseScanArgs(args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	keys, cursor := db.Scan(sa.cursor, sa.count)
+	ret := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !sa.matched(key) {
+			continue
+		}
+		if sa.typ != "" {
+			val, ok := db.GetData(key)
+			if !ok || typeName(val) != sa.typ {
+				continue
+			}
+		}
+		ret = append(ret, key)
+	}
+	return scanReply(cursor, ret)
+}
+
+// HScan hscan key cursor [MATCH pattern] [COUNT count]
+func HScan(c *tcp.RegisConn, args []string) base.Reply {
+	sa, errReply := parseScanArgs(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	hash, errReply := getRHash(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return scanReply(0, nil)
+	}
+	ret := make([]string, 0)
+	cursor := sa.scanElements(func() int { return len(ret) / 2 }, func(cursor uint64) uint64 {
+		return hash.Scan(cursor, func(key string, val interface{}) {
+			if sa.matched(key) {
+				ret = append(ret, key, string(val.([]byte)))
+			}
+		})
+	})
+	return scanReply(cursor, ret)
+}
+
+// SScan sscan key cursor [MATCH pattern] [COUNT count]
+func SScan(c *tcp.RegisConn, args []string) base.Reply {
+	sa, errReply := parseScanArgs(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	set, errReply := getRSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return scanReply(0, nil)
+	}
+	ret := make([]string, 0)
+	cursor := sa.scanElements(func() int { return len(ret) }, func(cursor uint64) uint64 {
+		return set.Scan(cursor, func(member string) {
+			if sa.matched(member) {
+				ret = append(ret, member)
+			}
+		})
+	})
+	return scanReply(cursor, ret)
+}
+
+// ZScan zscan key cursor [MATCH pattern] [COUNT count]
+func ZScan(c *tcp.RegisConn, args []string) base.Reply {
+	sa, errReply := parseScanArgs(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	zs, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if zs == nil {
+		return scanReply(0, nil)
+	}
+	ret := make([]string, 0)
+	cursor := sa.scanElements(func() int { return len(ret) / 2 }, func(cursor uint64) uint64 {
+		return zs.Scan(cursor, func(entry base.ZEntry) {
+			if sa.matched(entry.Member) {
+				ret = append(ret, entry.Member, utils.FormatFloat(entry.Score))
+			}
+		})
+	})
+	return scanReply(cursor, ret)
+}
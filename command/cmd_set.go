@@ -0,0 +1,437 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/ds"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"strconv"
+	"strings"
+)
+
+// base.RSet 操作
+
+// randMaxCount srandmember, hrandfield, zrandmember 的count为负数时最多返回的元素个数
+// 负数count允许重复，返回的元素个数和集合大小无关，不加限制时一条命令就能耗尽内存
+const randMaxCount = 1 << 20
+
+// parseRandCount 解析 srandmember, hrandfield, zrandmember 的count参数
+func parseRandCount(arg string) (int64, base.Reply) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, redis.IntErrReply
+	}
+	if n < -randMaxCount {
+		return 0, redis.ErrReply("ERR value is out of range")
+	}
+	return n, nil
+}
+
+// getRSet 获取key对应的集合，key不存在时返回nil，类型不对时返回 redis.TypeErrReply
+// forWrite 为true时，返回的集合可以被原地修改
+func getRSet(db base.SDB, key string, forWrite bool) (base.RSet, base.Reply) {
+	var v interface{}
+	var ok bool
+	if forWrite {
+		v, ok = db.GetDataForWrite(key)
+	} else {
+		v, ok = db.GetData(key)
+	}
+	if !ok {
+		return nil, nil
+	}
+	val, ok := v.(base.RSet)
+	if !ok {
+		return nil, redis.TypeErrReply
+	}
+	return val, nil
+}
+
+// putRSet 写回修改后的集合并发出event通知，集合为空时删除key并发出del通知
+func putRSet(c *tcp.RegisConn, db base.SDB, key string, val base.RSet, event string) {
+	notifyKeyspaceEvent(notifySet, event, key, c.DBIndex)
+	if val.Len() == 0 {
+		db.RemoveData(key)
+		notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+		return
+	}
+	db.PutData(key, val)
+}
+
+func SAdd(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, errReply := getRSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		val = ds.NewRSet()
+	}
+	added := 0
+	for i := 2; i < len(args); i++ {
+		added += val.Add(args[i])
+	}
+	db.PutData(args[1], val)
+	if added > 0 {
+		notifyKeyspaceEvent(notifySet, "sadd", args[1], c.DBIndex)
+	}
+	return redis.IntReply(added)
+}
+
+func SRem(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, errReply := getRSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.IntReply(0)
+	}
+	removed := 0
+	for i := 2; i < len(args); i++ {
+		removed += val.Remove(args[i])
+	}
+	if removed > 0 {
+		putRSet(c, db, args[1], val, "srem")
+	}
+	return redis.IntReply(removed)
+}
+
+func SMembers(c *tcp.RegisConn, args []string) base.Reply {
+	val, errReply := getRSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.EmptyArrayReply
+	}
+	return redis.StringsReply(val.Members())
+}
+
+func SIsMember(c *tcp.RegisConn, args []string) base.Reply {
+	val, errReply := getRSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil || !val.Has(args[2]) {
+		return redis.IntReply(0)
+	}
+	return redis.IntReply(1)
+}
+
+func SMIsMember(c *tcp.RegisConn, args []string) base.Reply {
+	val, errReply := getRSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	ret := make([]interface{}, 0, len(args)-2)
+	for i := 2; i < len(args); i++ {
+		if val != nil && val.Has(args[i]) {
+			ret = append(ret, 1)
+		} else {
+			ret = append(ret, 0)
+		}
+	}
+	return redis.ArrayReply(ret)
+}
+
+func SCard(c *tcp.RegisConn, args []string) base.Reply {
+	val, errReply := getRSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return redis.IntReply(0)
+	}
+	return redis.IntReply(val.Len())
+}
+
+// SPop spop key [count]
+// 弹出的成员是随机的，所以传播给slave时改写成 srem key member...
+func SPop(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args) > 3 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	count := 1
+	if len(args) == 3 {
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || n < 0 {
+			return redis.ErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(n)
+	}
+
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, errReply := getRSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		c.Rewrite()
+		if len(args) == 3 {
+			return redis.EmptyArrayReply
+		}
+		return redis.NilReply
+	}
+
+	members := val.RandomDistinctMembers(count)
+	for _, m := range members {
+		val.Remove(m)
+	}
+	if len(members) == 0 {
+		c.Rewrite()
+	} else {
+		putRSet(c, db, args[1], val, "spop")
+		c.Rewrite(append([]string{"srem", args[1]}, members...))
+	}
+	if len(args) == 3 {
+		return redis.StringsReply(members)
+	}
+	return redis.BulkStrReply(members[0])
+}
+
+// SRandMember srandmember key [count]
+// count为正数时返回不重复的成员，为负数时成员可以重复，数量为count的绝对值
+func SRandMember(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args) > 3 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	var count int64 = 1
+	if len(args) == 3 {
+		n, errReply := parseRandCount(args[2])
+		if errReply != nil {
+			return errReply
+		}
+		count = n
+	}
+
+	val, errReply := getRSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		if len(args) == 3 {
+			return redis.EmptyArrayReply
+		}
+		return redis.NilReply
+	}
+
+	if len(args) == 2 {
+		return redis.BulkStrReply(val.RandomDistinctMembers(1)[0])
+	}
+	if count >= 0 {
+		return redis.StringsReply(val.RandomDistinctMembers(int(count)))
+	}
+	return redis.StringsReply(val.RandomMembers(int(-count)))
+}
+
+// SMove smove source destination member
+func SMove(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	src, errReply := getRSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	dst, errReply := getRSet(db, args[2], true)
+	if errReply != nil {
+		return errReply
+	}
+	if src == nil || !src.Has(args[3]) {
+		return redis.IntReply(0)
+	}
+	if args[1] == args[2] {
+		return redis.IntReply(1)
+	}
+
+	src.Remove(args[3])
+	putRSet(c, db, args[1], src, "srem")
+
+	if dst == nil {
+		dst = ds.NewRSet()
+	}
+	dst.Add(args[3])
+	db.PutData(args[2], dst)
+	notifyKeyspaceEvent(notifySet, "sadd", args[2], c.DBIndex)
+	return redis.IntReply(1)
+}
+
+// getRSets 获取多个key对应的集合，不存在的key视为空集合，在结果中为nil
+func getRSets(db base.SDB, keys []string) ([]base.RSet, base.Reply) {
+	sets := make([]base.RSet, len(keys))
+	for i := range keys {
+		val, errReply := getRSet(db, keys[i], false)
+		if errReply != nil {
+			return nil, errReply
+		}
+		sets[i] = val
+	}
+	return sets, nil
+}
+
+// setInter 求交集，limit > 0 时找到limit个成员就返回
+func setInter(sets []base.RSet, limit int) []string {
+	// 从最小的集合开始遍历，任意一个集合为空，交集就为空
+	smallest := 0
+	for i := range sets {
+		if sets[i] == nil {
+			return nil
+		}
+		if sets[i].Len() < sets[smallest].Len() {
+			smallest = i
+		}
+	}
+	ret := make([]string, 0)
+	for _, m := range sets[smallest].Members() {
+		in := true
+		for i := range sets {
+			if i != smallest && !sets[i].Has(m) {
+				in = false
+				break
+			}
+		}
+		if !in {
+			continue
+		}
+		ret = append(ret, m)
+		if limit > 0 && len(ret) >= limit {
+			break
+		}
+	}
+	return ret
+}
+
+// setUnion 求并集
+func setUnion(sets []base.RSet) []string {
+	ret := ds.NewSet()
+	for i := range sets {
+		if sets[i] == nil {
+			continue
+		}
+		for _, m := range sets[i].Members() {
+			ret.Add(m)
+		}
+	}
+	return ret.Members()
+}
+
+// setDiff 求第一个集合与其余集合的差集
+func setDiff(sets []base.RSet) []string {
+	if sets[0] == nil {
+		return nil
+	}
+	ret := make([]string, 0)
+	for _, m := range sets[0].Members() {
+		in := false
+		for i := 1; i < len(sets); i++ {
+			if sets[i] != nil && sets[i].Has(m) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// storeSet 将结果写入destination并发出event通知，结果为空时删除destination，返回结果的大小
+func storeSet(c *tcp.RegisConn, db base.SDB, key string, members []string, event string) base.Reply {
+	if len(members) == 0 {
+		if db.RemoveData(key) > 0 {
+			notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+		}
+		return redis.IntReply(0)
+	}
+	setKey(db, key, ds.NewRSet(members...))
+	notifyKeyspaceEvent(notifySet, event, key, c.DBIndex)
+	return redis.IntReply(len(members))
+}
+
+func SInter(c *tcp.RegisConn, args []string) base.Reply {
+	sets, errReply := getRSets(tcp.Server.DB.GetSDB(c.DBIndex), args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	return redis.StringsReply(setInter(sets, 0))
+}
+
+func SUnion(c *tcp.RegisConn, args []string) base.Reply {
+	sets, errReply := getRSets(tcp.Server.DB.GetSDB(c.DBIndex), args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	return redis.StringsReply(setUnion(sets))
+}
+
+func SDiff(c *tcp.RegisConn, args []string) base.Reply {
+	sets, errReply := getRSets(tcp.Server.DB.GetSDB(c.DBIndex), args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	return redis.StringsReply(setDiff(sets))
+}
+
+// SInterStore sinterstore destination key [key ...]
+func SInterStore(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	sets, errReply := getRSets(db, args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	return storeSet(c, db, args[1], setInter(sets, 0), "sinterstore")
+}
+
+// SUnionStore sunionstore destination key [key ...]
+func SUnionStore(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	sets, errReply := getRSets(db, args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	return storeSet(c, db, args[1], setUnion(sets), "sunionstore")
+}
+
+// SDiffStore sdiffstore destination key [key ...]
+func SDiffStore(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	sets, errReply := getRSets(db, args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	return storeSet(c, db, args[1], setDiff(sets), "sdiffstore")
+}
+
+// SInterCard sintercard numkeys key [key ...] [LIMIT limit]
+func SInterCard(c *tcp.RegisConn, args []string) base.Reply {
+	numKeys, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	if numKeys <= 0 {
+		return redis.ErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-2) {
+		return redis.ErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	var limit int64 = 0
+	rest := args[2+numKeys:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToLower(rest[0]) != "limit" {
+			return redis.ErrReply("ERR syntax error")
+		}
+		limit, err = strconv.ParseInt(rest[1], 10, 64)
+		if err != nil {
+			return redis.IntErrReply
+		}
+		if limit < 0 {
+			return redis.ErrReply("ERR LIMIT can't be negative")
+		}
+	}
+
+	sets, errReply := getRSets(tcp.Server.DB.GetSDB(c.DBIndex), args[2:2+numKeys])
+	if errReply != nil {
+		return errReply
+	}
+	return redis.IntReply(len(setInter(sets, int(limit))))
+}
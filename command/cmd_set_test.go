@@ -0,0 +1,133 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseRandCount(t *testing.T) {
+	if n, errReply := parseRandCount(strconv.Itoa(-randMaxCount)); errReply != nil || n != -randMaxCount {
+		t.Errorf("want %v, get %v %v", -randMaxCount, n, errReply)
+	}
+	if n, errReply := parseRandCount("9223372036854775807"); errReply != nil || n != 9223372036854775807 {
+		t.Errorf("positive count should not be limited, get %v %v", n, errReply)
+	}
+	for _, arg := range []string{strconv.Itoa(-randMaxCount - 1), "-9223372036854775808"} {
+		_, errReply := parseRandCount(arg)
+		checkReply(t, redis.ErrReply("ERR value is out of range"), errReply)
+	}
+	_, errReply := parseRandCount("1.5")
+	checkReply(t, redis.IntErrReply, errReply)
+}
+
+func TestSRandMember_Count(t *testing.T) {
+	c := newTestConn()
+	call(c, "sadd", "srand", "a", "b", "c")
+
+	reply, _ := call(c, "srandmember", "srand", "9223372036854775807")
+	if n := arrayLen(reply); n != 3 {
+		t.Errorf("want 3 members, get %v", n)
+	}
+	reply, _ = call(c, "srandmember", "srand", strconv.Itoa(-randMaxCount))
+	if n := arrayLen(reply); n != randMaxCount {
+		t.Errorf("want %v members, get %v", randMaxCount, n)
+	}
+	reply, _ = call(c, "srandmember", "srand", strconv.Itoa(-randMaxCount-1))
+	checkReply(t, redis.ErrReply("ERR value is out of range"), reply)
+}
+
+func TestSetAlgebra(t *testing.T) {
+	c := newTestConn()
+	call(c, "sadd", "sa1", "a", "b", "c", "d")
+	call(c, "sadd", "sa2", "b", "c", "e")
+	call(c, "sadd", "sa3", "c", "d", "f")
+	call(c, "set", "sastr", "x")
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"sinter", "sa1", "sa2"}, []string{"b", "c"}},
+		{[]string{"sinter", "sa1", "sa2", "sa3"}, []string{"c"}},
+		{[]string{"sinter", "sa1", "nokey"}, []string{}},
+		{[]string{"sunion", "sa2", "sa3", "nokey"}, []string{"b", "c", "d", "e", "f"}},
+		{[]string{"sdiff", "sa1", "sa2"}, []string{"a", "d"}},
+		{[]string{"sdiff", "sa1", "sa2", "sa3"}, []string{"a"}},
+		{[]string{"sdiff", "nokey", "sa1"}, []string{}},
+	}
+	for _, tt := range tests {
+		reply, _ := call(c, tt.args...)
+		if get := replyStrings(reply); strings.Join(get, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%v: want %v, get %v", tt.args, tt.want, get)
+		}
+	}
+	for _, cmd := range []string{"sinter", "sunion", "sdiff"} {
+		reply, _ := call(c, cmd, "sa1", "sastr")
+		checkReply(t, redis.TypeErrReply, reply)
+	}
+}
+
+func TestSetAlgebra_Store(t *testing.T) {
+	c := newTestConn()
+	c.DBIndex = 7
+	call(c, "sadd", "sb1", "a", "b", "c")
+	call(c, "sadd", "sb2", "b", "c", "d")
+	reply, _ := call(c, "sinterstore", "sbdst", "sb1", "sb2")
+	checkReply(t, redis.IntReply(2), reply)
+	reply, _ = call(c, "smembers", "sbdst")
+	if get := replyStrings(reply); strings.Join(get, ",") != "b,c" {
+		t.Errorf("want b c, get %v", get)
+	}
+	// 目标key可以是源key之一
+	reply, _ = call(c, "sunionstore", "sb1", "sb1", "sb2")
+	checkReply(t, redis.IntReply(4), reply)
+	reply, _ = call(c, "sdiffstore", "sbdst", "sb1", "sb2")
+	checkReply(t, redis.IntReply(1), reply)
+	reply, _ = call(c, "smembers", "sbdst")
+	checkReply(t, redis.StringsReply([]string{"a"}), reply)
+
+	// bgsave 期间存盘的值不变，读到的是新写入的值
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	saving, _ := db.GetData("sbdst")
+	db.SetStatus(base.WorldFrozen)
+	defer db.SetStatus(base.WorldNormal)
+	reply, _ = call(c, "sinterstore", "sbdst", "sb1", "sb2")
+	checkReply(t, redis.IntReply(3), reply)
+	if !saving.(base.RSet).Has("a") || saving.(base.RSet).Len() != 1 {
+		t.Errorf("value being saved was modified: %v", saving.(base.RSet).Members())
+	}
+	reply, _ = call(c, "scard", "sbdst")
+	checkReply(t, redis.IntReply(3), reply)
+	// 结果为空时删除目标key
+	reply, _ = call(c, "sdiffstore", "sbdst", "sb2", "sb1")
+	checkReply(t, redis.IntReply(0), reply)
+	reply, _ = call(c, "exists", "sbdst")
+	checkReply(t, redis.IntReply(0), reply)
+}
+
+func TestSInterCard(t *testing.T) {
+	c := newTestConn()
+	call(c, "sadd", "sc1", "a", "b", "c", "d")
+	call(c, "sadd", "sc2", "a", "b", "c", "e")
+	tests := []struct {
+		args []string
+		want base.Reply
+	}{
+		{[]string{"2", "sc1", "sc2"}, redis.IntReply(3)},
+		{[]string{"2", "sc1", "sc2", "limit", "2"}, redis.IntReply(2)},
+		{[]string{"2", "sc1", "sc2", "LIMIT", "0"}, redis.IntReply(3)},
+		{[]string{"1", "sc1"}, redis.IntReply(4)},
+		{[]string{"2", "sc1", "nokey"}, redis.IntReply(0)},
+		{[]string{"0", "sc1"}, redis.ErrReply("ERR numkeys should be greater than 0")},
+		{[]string{"3", "sc1", "sc2"}, redis.ErrReply("ERR Number of keys can't be greater than number of args")},
+		{[]string{"2", "sc1", "sc2", "limit", "-1"}, redis.ErrReply("ERR LIMIT can't be negative")},
+		{[]string{"1", "sc1", "sc2"}, redis.ErrReply("ERR syntax error")},
+	}
+	for _, tt := range tests {
+		reply, _ := call(c, append([]string{"sintercard"}, tt.args...)...)
+		checkReply(t, tt.want, reply)
+	}
+}
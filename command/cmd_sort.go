@@ -0,0 +1,296 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/ds"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sort 命令
+// SORT key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC|DESC] [ALPHA] [STORE destination]
+
+// sortSpec sort 命令的选项
+type sortSpec struct {
+	by      string // 为空表示按元素本身排序
+	noSort  bool   // BY 的pattern中没有*时，不排序
+	limit   bool
+	offset  int64
+	count   int64
+	gets    []string
+	desc    bool
+	alpha   bool
+	storeTo string
+	store   bool
+}
+
+// sortItem 待排序的元素
+type sortItem struct {
+	elem   string
+	score  float64
+	cmpStr string
+	cmpNil bool // 按外部key排序，且外部key不存在
+}
+
+// parseSortSpec 解析sort命令的选项，readOnly 为true时不允许 STORE
+func parseSortSpec(opts []string, readOnly bool) (*sortSpec, base.Reply) {
+	spec := &sortSpec{}
+	for i := 0; i < len(opts); i++ {
+		left := len(opts) - i - 1
+		switch strings.ToLower(opts[i]) {
+		case "asc":
+			spec.desc = false
+		case "desc":
+			spec.desc = true
+		case "alpha":
+			spec.alpha = true
+		case "limit":
+			if left < 2 {
+				return nil, redis.ErrReply("ERR syntax error")
+			}
+			offset, err1 := strconv.ParseInt(opts[i+1], 10, 64)
+			count, err2 := strconv.ParseInt(opts[i+2], 10, 64)
+			if err1 != nil || err2 != nil {
+				return nil, redis.IntErrReply
+			}
+			spec.limit, spec.offset, spec.count = true, offset, count
+			i += 2
+		case "by":
+			if left < 1 {
+				return nil, redis.ErrReply("ERR syntax error")
+			}
+			spec.by = opts[i+1]
+			spec.noSort = !strings.Contains(spec.by, "*")
+			i++
+		case "get":
+			if left < 1 {
+				return nil, redis.ErrReply("ERR syntax error")
+			}
+			spec.gets = append(spec.gets, opts[i+1])
+			i++
+		case "store":
+			if readOnly || left < 1 {
+				return nil, redis.ErrReply("ERR syntax error")
+			}
+			spec.store, spec.storeTo = true, opts[i+1]
+			i++
+		default:
+			return nil, redis.ErrReply("ERR syntax error")
+		}
+	}
+	return spec, nil
+}
+
+// sortLookup 按pattern查找外部key的值，pattern中的第一个*替换成elem，
+// 形如 obj_*->field 时取哈希表中field的值，pattern为 # 时直接返回elem，找不到时返回false
+func sortLookup(db base.SDB, pattern, elem string) (string, bool) {
+	if pattern == "#" {
+		return elem, true
+	}
+	p := strings.Index(pattern, "*")
+	if p < 0 {
+		return "", false
+	}
+	field := ""
+	keyPattern := pattern
+	if f := strings.LastIndex(pattern, "->"); f > p && f+2 < len(pattern) {
+		keyPattern, field = pattern[:f], pattern[f+2:]
+	}
+	key := keyPattern[:p] + elem + keyPattern[p+1:]
+
+	v, ok := db.GetData(key)
+	if !ok {
+		return "", false
+	}
+	switch val := v.(type) {
+	case base.RString:
+		if field != "" {
+			return "", false
+		}
+		return string(val), true
+	case base.RInt:
+		if field != "" {
+			return "", false
+		}
+		return val.String(), true
+	case *base.RBytes:
+		if field != "" {
+			return "", false
+		}
+		return val.String(), true
+	case base.RHash:
+		if field == "" {
+			return "", false
+		}
+		fv, ok := val.Get(field)
+		if !ok {
+			return "", false
+		}
+		return string(fv.([]byte)), true
+	}
+	return "", false
+}
+
+// sortElements 取出key中所有待排序的元素，支持 list, set, zset，key不存在时返回空
+func sortElements(db base.SDB, key string) ([]string, bool, base.Reply) {
+	v, ok := db.GetData(key)
+	if !ok {
+		return []string{}, false, nil
+	}
+	switch val := v.(type) {
+	case base.RList:
+		return listStrings(val.LRange(0, -1)), false, nil
+	case base.RSet:
+		return val.Members(), true, nil
+	case base.RZSet:
+		entries := val.RangeByRank(0, val.Len()-1, false)
+		ret := make([]string, len(entries))
+		for i := range entries {
+			ret[i] = entries[i].Member
+		}
+		return ret, false, nil
+	}
+	return nil, false, redis.TypeErrReply
+}
+
+func sortGeneric(c *tcp.RegisConn, args []string, readOnly bool) base.Reply {
+	spec, errReply := parseSortSpec(args[2:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	elems, isSet, errReply := sortElements(db, args[1])
+	if errReply != nil {
+		return errReply
+	}
+
+	// 集合是无序的，不排序时结果不确定，STORE 的结果要传播给slave，所以按字典序排一下
+	if spec.noSort && isSet && spec.store {
+		spec.noSort, spec.alpha = false, true
+	}
+
+	items := make([]sortItem, len(elems))
+	for i := range elems {
+		items[i].elem = elems[i]
+		if spec.noSort {
+			continue
+		}
+		val, found := elems[i], true
+		if spec.by != "" {
+			val, found = sortLookup(db, spec.by, elems[i])
+		}
+		if spec.alpha {
+			items[i].cmpStr, items[i].cmpNil = val, !found
+			continue
+		}
+		if !found {
+			continue
+		}
+		score, err := strconv.ParseFloat(val, 64)
+		if err != nil || math.IsNaN(score) {
+			return redis.ErrReply("ERR One or more scores can't be converted into double")
+		}
+		items[i].score = score
+	}
+
+	if !spec.noSort {
+		sort.SliceStable(items, func(i, j int) bool {
+			a, b := &items[i], &items[j]
+			cmp := 0
+			if spec.alpha {
+				switch {
+				case a.cmpNil && b.cmpNil:
+				case a.cmpNil:
+					cmp = -1
+				case b.cmpNil:
+					cmp = 1
+				default:
+					cmp = strings.Compare(a.cmpStr, b.cmpStr)
+				}
+			} else if a.score < b.score {
+				cmp = -1
+			} else if a.score > b.score {
+				cmp = 1
+			}
+			// 分数相同时按元素本身排，保证结果是确定的
+			if cmp == 0 {
+				cmp = strings.Compare(a.elem, b.elem)
+			}
+			if spec.desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+	}
+
+	if spec.limit {
+		start, count := spec.offset, spec.count
+		if start < 0 {
+			start = 0
+		}
+		if start > int64(len(items)) {
+			start = int64(len(items))
+		}
+		if count < 0 || start+count > int64(len(items)) {
+			count = int64(len(items)) - start
+		}
+		items = items[start : start+count]
+	}
+
+	// 结果中nil表示 GET 的外部key不存在
+	ret := make([]interface{}, 0, len(items)*(len(spec.gets)+1))
+	for i := range items {
+		if len(spec.gets) == 0 {
+			ret = append(ret, items[i].elem)
+			continue
+		}
+		for _, pattern := range spec.gets {
+			if v, ok := sortLookup(db, pattern, items[i].elem); ok {
+				ret = append(ret, v)
+			} else {
+				ret = append(ret, nil)
+			}
+		}
+	}
+
+	if !spec.store {
+		c.Rewrite()
+		if len(ret) == 0 {
+			return redis.EmptyArrayReply
+		}
+		return redis.ArrayReply(ret)
+	}
+
+	if len(ret) == 0 {
+		if db.RemoveData(spec.storeTo) > 0 {
+			notifyKeyspaceEvent(notifyGeneric, "del", spec.storeTo, c.DBIndex)
+		}
+		return redis.IntReply(0)
+	}
+	list := ds.NewRList()
+	for i := range ret {
+		if ret[i] == nil {
+			list.PushTail("")
+		} else {
+			list.PushTail(ret[i].(string))
+		}
+	}
+	setKey(db, spec.storeTo, list)
+	notifyKeyspaceEvent(notifyList, "sortstore", spec.storeTo, c.DBIndex)
+	tcp.Server.SignalKeyAsReady(c.DBIndex, spec.storeTo)
+	return redis.Int64Reply(list.Len())
+}
+
+// Sort sort key [BY pattern] [LIMIT offset count] [GET pattern ...] [ASC|DESC] [ALPHA] [STORE destination]
+func Sort(c *tcp.RegisConn, args []string) base.Reply {
+	return sortGeneric(c, args, false)
+}
+
+// SortRO sort_ro key [BY pattern] [LIMIT offset count] [GET pattern ...] [ASC|DESC] [ALPHA]
+func SortRO(c *tcp.RegisConn, args []string) base.Reply {
+	return sortGeneric(c, args, true)
+}
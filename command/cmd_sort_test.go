@@ -0,0 +1,117 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"testing"
+	"time"
+)
+
+func TestSort(t *testing.T) {
+	c := newTestConn()
+	call(c, "del", "sortl", "sorta")
+	call(c, "rpush", "sortl", "3", "1", "2", "10")
+	call(c, "rpush", "sorta", "b", "a", "C", "c")
+	call(c, "mset", "sw_1", "30", "sw_2", "20", "sw_3", "10", "sw_10", "5")
+	call(c, "hset", "so_1", "name", "one")
+	call(c, "hset", "so_2", "name", "two")
+	tests := []struct {
+		args []string
+		want []interface{}
+	}{
+		{[]string{"sortl"}, []interface{}{"1", "2", "3", "10"}},
+		{[]string{"sortl", "desc"}, []interface{}{"10", "3", "2", "1"}},
+		{[]string{"sortl", "alpha"}, []interface{}{"1", "10", "2", "3"}},
+		{[]string{"sortl", "limit", "1", "2"}, []interface{}{"2", "3"}},
+		{[]string{"sortl", "limit", "2", "-1", "desc"}, []interface{}{"2", "1"}},
+		{[]string{"sortl", "limit", "10", "1"}, []interface{}{}},
+		{[]string{"sorta", "alpha"}, []interface{}{"C", "a", "b", "c"}},
+		{[]string{"sortl", "by", "sw_*"}, []interface{}{"10", "3", "2", "1"}},
+		// pattern中没有*时不排序
+		{[]string{"sortl", "by", "nosort"}, []interface{}{"3", "1", "2", "10"}},
+		{[]string{"sortl", "by", "sw_*", "get", "#", "get", "sw_*"}, []interface{}{"10", "5", "3", "10", "2", "20", "1", "30"}},
+		{[]string{"sortl", "get", "so_*->name", "limit", "0", "3"}, []interface{}{"one", "two", nil}},
+		{[]string{"sortl", "get", "so_*", "limit", "0", "1"}, []interface{}{nil}},
+		{[]string{"nokey"}, []interface{}{}},
+	}
+	for _, tt := range tests {
+		var want base.Reply = redis.ArrayReply(tt.want)
+		if len(tt.want) == 0 {
+			want = redis.EmptyArrayReply
+		}
+		reply, _ := call(c, append([]string{"sort"}, tt.args...)...)
+		checkReply(t, want, reply)
+		reply, _ = call(c, append([]string{"sort_ro"}, tt.args...)...)
+		checkReply(t, want, reply)
+	}
+
+	reply, _ := call(c, "sort", "sorta")
+	checkReply(t, redis.ErrReply("ERR One or more scores can't be converted into double"), reply)
+	reply, _ = call(c, "sort_ro", "sortl", "store", "sortdst")
+	checkReply(t, redis.ErrReply("ERR syntax error"), reply)
+	reply, _ = call(c, "sort", "sortl", "limit", "1")
+	checkReply(t, redis.ErrReply("ERR syntax error"), reply)
+	reply, _ = call(c, "sort", "sw_1")
+	checkReply(t, redis.TypeErrReply, reply)
+}
+
+func TestSort_Set(t *testing.T) {
+	c := newTestConn()
+	call(c, "sadd", "sorts", "b", "c", "a")
+	call(c, "zadd", "sortz", "1", "b", "2", "a", "3", "c")
+	reply, _ := call(c, "sort", "sorts", "alpha")
+	checkReply(t, redis.StringsReply([]string{"a", "b", "c"}), reply)
+	// 不排序时zset按分数的顺序
+	reply, _ = call(c, "sort", "sortz", "by", "nosort")
+	checkReply(t, redis.StringsReply([]string{"b", "a", "c"}), reply)
+	// 集合不排序时STORE的结果不确定，按字典序排
+	reply, _ = call(c, "sort", "sorts", "by", "nosort", "store", "sortsdst")
+	checkReply(t, redis.IntReply(3), reply)
+	reply, _ = call(c, "lrange", "sortsdst", "0", "-1")
+	checkReply(t, redis.StringsReply([]string{"a", "b", "c"}), reply)
+}
+
+func TestSort_Store(t *testing.T) {
+	c := newTestConn()
+	call(c, "del", "sortst")
+	call(c, "rpush", "sortst", "2", "3", "1")
+	reply, propagated := call(c, "sort", "sortst")
+	checkReply(t, redis.StringsReply([]string{"1", "2", "3"}), reply)
+	if len(propagated) != 0 {
+		t.Errorf("sort without store should not be propagated, get %v", propagated)
+	}
+
+	reply, propagated = call(c, "sort", "sortst", "desc", "get", "#", "get", "nokey_*", "store", "sortstdst")
+	checkReply(t, redis.IntReply(6), reply)
+	if len(propagated) != 1 {
+		t.Errorf("sort with store should be propagated, get %v", propagated)
+	}
+	reply, _ = call(c, "lrange", "sortstdst", "0", "-1")
+	checkReply(t, redis.StringsReply([]string{"3", "", "2", "", "1", ""}), reply)
+
+	// 结果为空时删除目标key
+	reply, _ = call(c, "sort", "nokey", "store", "sortstdst")
+	checkReply(t, redis.IntReply(0), reply)
+	reply, _ = call(c, "exists", "sortstdst")
+	checkReply(t, redis.IntReply(0), reply)
+
+	// sort_ro 可以在slave上执行
+	ro, _ := GetCmdInfo("sort_ro")
+	rw, _ := GetCmdInfo("sort")
+	if ro.HasAttr(base.CmdWrite) || !rw.HasAttr(base.CmdWrite) {
+		t.Errorf("only sort should be a write command")
+	}
+}
+
+func TestSort_StoreWakesBlocked(t *testing.T) {
+	addr := startServer(t)
+	a, c := dial(t, addr), dial(t, addr)
+	a.send("blpop", "sortblk", "0")
+	waitBlocked(t, c, 1)
+	c.do(redis.IntReply(2), "rpush", "sortsrc", "2", "1")
+	c.do(redis.IntReply(2), "sort", "sortsrc", "store", "sortblk")
+	if reply, _ := a.recv(time.Second); reply != string(redis.StringsReply([]string{"sortblk", "1"}).Bytes()) {
+		t.Errorf("want sortblk 1, get %q", reply)
+	}
+	c.do(redis.IntReply(2), "del", "sortblk", "sortsrc")
+}
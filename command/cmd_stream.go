@@ -0,0 +1,627 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/ds"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stream 命令，数据结构见 ds.Stream
+
+var (
+	streamIDErrReply = redis.ErrReply("ERR Invalid stream ID specified as stream command argument")
+	streamMaxID      = base.StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+// getRStream 获取key对应的stream，key不存在时返回nil，不是stream时返回 redis.TypeErrReply
+func getRStream(db base.SDB, key string, forWrite bool) (base.RStream, base.Reply) {
+	var v interface{}
+	var ok bool
+	if forWrite {
+		v, ok = db.GetDataForWrite(key)
+	} else {
+		v, ok = db.GetData(key)
+	}
+	if !ok {
+		return nil, nil
+	}
+	val, ok := v.(base.RStream)
+	if !ok {
+		return nil, redis.TypeErrReply
+	}
+	return val, nil
+}
+
+// streamDecrID 返回比id小的上一个ID，id是 0-0 时返回false
+func streamDecrID(id base.StreamID) (base.StreamID, bool) {
+	if id.Seq > 0 {
+		return base.StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return base.StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// parseStreamID 解析命令参数中的ID，只有 ms 时 seq 取 missingSeq
+func parseStreamID(s string, missingSeq uint64) (base.StreamID, base.Reply) {
+	id, ok := ds.ParseStreamID(s, missingSeq)
+	if !ok {
+		return id, streamIDErrReply
+	}
+	return id, nil
+}
+
+// parseStreamRangeID 解析 xrange 的区间边界，支持 - + 和以 ( 开头的开区间
+// 只有 ms 时，start 的 seq 取0，end 的 seq 取最大值
+func parseStreamRangeID(s string, isStart bool) (base.StreamID, base.Reply) {
+	missingSeq := uint64(0)
+	if !isStart {
+		missingSeq = math.MaxUint64
+	}
+	if !strings.HasPrefix(s, "(") {
+		switch s {
+		case "-":
+			return base.StreamID{}, nil
+		case "+":
+			return streamMaxID, nil
+		}
+		return parseStreamID(s, missingSeq)
+	}
+	id, errReply := parseStreamID(s[1:], missingSeq)
+	if errReply != nil {
+		return id, errReply
+	}
+	var ok bool
+	if isStart {
+		if id, ok = ds.NextStreamID(id); !ok {
+			return id, redis.ErrReply("ERR invalid start ID for the interval")
+		}
+	} else if id, ok = streamDecrID(id); !ok {
+		return id, redis.ErrReply("ERR invalid end ID for the interval")
+	}
+	return id, nil
+}
+
+// streamEntriesReply 回复消息列表，每条消息是 [id, [field, value, ...]]，Fields 为nil的是已经被删除的消息
+func streamEntriesReply(entries []base.StreamEntry) base.Reply {
+	if len(entries) == 0 {
+		return redis.EmptyArrayReply
+	}
+	ret := make([]base.Reply, len(entries))
+	for i, e := range entries {
+		var fields base.Reply = redis.NilArrayReply
+		if e.Fields != nil {
+			fields = redis.StringsReply(e.Fields)
+		}
+		ret[i] = redis.MultiReply([]base.Reply{redis.BulkStrReply(e.ID.String()), fields})
+	}
+	return redis.MultiReply(ret)
+}
+
+// streamTrimSpec xadd, xtrim 的裁剪参数，MAXLEN|MINID [=|~] threshold [LIMIT count]
+type streamTrimSpec struct {
+	// strategy 为空表示不裁剪
+	strategy string
+	approx   bool
+	maxLen   int64
+	minID    base.StreamID
+	// limit < 0 表示没有指定
+	limit int64
+}
+
+// parseStreamTrim 从 args[i] 开始解析裁剪参数
+// isXAdd 为true时遇到不认识的参数就停下，返回它的下标，它就是 xadd 的ID；否则返回语法错误
+func parseStreamTrim(args []string, i int, isXAdd bool) (*streamTrimSpec, bool, int, base.Reply) {
+	spec := &streamTrimSpec{limit: -1}
+	noMkStream := false
+	for ; i < len(args); i++ {
+		opt := strings.ToLower(args[i])
+		more := len(args) - 1 - i
+		switch {
+		case isXAdd && opt == "nomkstream":
+			noMkStream = true
+		case (opt == "maxlen" || opt == "minid") && more >= 1:
+			if spec.strategy != "" && spec.strategy != opt {
+				return nil, false, 0, redis.ErrReply("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+			}
+			spec.strategy = opt
+			spec.approx = false
+			if (args[i+1] == "~" || args[i+1] == "=") && more >= 2 {
+				spec.approx = args[i+1] == "~"
+				i++
+			}
+			i++
+			if opt == "maxlen" {
+				n, err := strconv.ParseInt(args[i], 10, 64)
+				if err != nil {
+					return nil, false, 0, redis.IntErrReply
+				}
+				if n < 0 {
+					return nil, false, 0, redis.ErrReply("ERR The MAXLEN argument must be >= 0.")
+				}
+				spec.maxLen = n
+			} else {
+				id, errReply := parseStreamID(args[i], 0)
+				if errReply != nil {
+					return nil, false, 0, errReply
+				}
+				spec.minID = id
+			}
+		case opt == "limit" && more >= 1:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, false, 0, redis.IntErrReply
+			}
+			if n < 0 {
+				return nil, false, 0, redis.ErrReply("ERR The LIMIT argument must be >= 0.")
+			}
+			spec.limit = n
+			i++
+		case isXAdd:
+			return spec, noMkStream, i, spec.check()
+		default:
+			return nil, false, 0, redis.ErrReply("ERR syntax error")
+		}
+	}
+	if isXAdd {
+		return nil, false, 0, redis.ArgNumErrReply("xadd")
+	}
+	return spec, noMkStream, i, spec.check()
+}
+
+// check LIMIT 只能和 ~ 一起使用，没有指定时使用默认值
+func (spec *streamTrimSpec) check() base.Reply {
+	if spec.limit >= 0 && !spec.approx {
+		return redis.ErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	}
+	if spec.approx && spec.limit < 0 {
+		spec.limit = ds.StreamDefaultTrimLimit
+	}
+	return nil
+}
+
+// trim 按裁剪参数裁剪stream，返回删除的数量
+func (spec *streamTrimSpec) trim(s base.RStream) int64 {
+	switch spec.strategy {
+	case "maxlen":
+		return s.TrimByLen(spec.maxLen, spec.approx, spec.limit)
+	case "minid":
+		return s.TrimByMinID(spec.minID, spec.approx, spec.limit)
+	}
+	return 0
+}
+
+// XAdd xadd key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+// 传播给slave时，ID改写成实际生成的ID，裁剪改写成精确的 MAXLEN，保证slave上的结果和master一样
+func XAdd(c *tcp.RegisConn, args []string) base.Reply {
+	spec, noMkStream, i, errReply := parseStreamTrim(args, 2, true)
+	if errReply != nil {
+		return errReply
+	}
+	if n := len(args) - i - 1; n < 2 || n%2 != 0 {
+		return redis.ArgNumErrReply(args[0])
+	}
+	idArg := args[i]
+	autoMs, autoSeq := idArg == "*", false
+	var id base.StreamID
+	if !autoMs {
+		if strings.HasSuffix(idArg, "-*") {
+			idArg, autoSeq = idArg[:len(idArg)-2], true
+		}
+		if id, errReply = parseStreamID(idArg, 0); errReply != nil {
+			return errReply
+		}
+		if !autoSeq && id == (base.StreamID{}) {
+			return redis.ErrReply("ERR The ID specified in XADD must be greater than 0-0")
+		}
+	}
+
+	key := args[1]
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	s, errReply := getRStream(db, key, true)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		if noMkStream {
+			c.Rewrite()
+			return redis.NilReply
+		}
+		s = ds.NewStream()
+	}
+
+	smallerErr := redis.ErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	last := s.LastID()
+	switch {
+	case autoMs:
+		var ok bool
+		if id, ok = s.NextID(uint64(time.Now().UnixMilli())); !ok {
+			return redis.ErrReply("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+	case autoSeq:
+		if id.Ms < last.Ms || (id.Ms == last.Ms && last.Seq == math.MaxUint64) {
+			return smallerErr
+		}
+		if id.Ms == last.Ms {
+			id.Seq = last.Seq + 1
+		}
+	}
+	fields := make([]string, len(args)-i-1)
+	copy(fields, args[i+1:])
+	if !s.Add(id, fields) {
+		return smallerErr
+	}
+
+	query := []string{"xadd", key}
+	trimmed := spec.trim(s) > 0
+	if trimmed {
+		query = append(query, "maxlen", "=", strconv.FormatInt(s.Len(), 10))
+	}
+	query = append(query, id.String())
+	c.Rewrite(append(query, fields...))
+
+	db.PutData(key, s)
+	notifyKeyspaceEvent(notifyStream, "xadd", key, c.DBIndex)
+	if trimmed {
+		notifyKeyspaceEvent(notifyStream, "xtrim", key, c.DBIndex)
+	}
+	tcp.Server.SignalKeyAsReady(c.DBIndex, key)
+	return redis.BulkStrReply(id.String())
+}
+
+// xRange xrange/xrevrange 的公共实现
+func xRange(c *tcp.RegisConn, args []string, reverse bool) base.Reply {
+	startArg, endArg := args[2], args[3]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, errReply := parseStreamRangeID(startArg, true)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseStreamRangeID(endArg, false)
+	if errReply != nil {
+		return errReply
+	}
+	count := int64(-1)
+	for i := 4; i < len(args); i++ {
+		if strings.ToLower(args[i]) != "count" || i+1 >= len(args) {
+			return redis.ErrReply("ERR syntax error")
+		}
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil {
+			return redis.IntErrReply
+		}
+		if n < 0 {
+			n = 0
+		}
+		count = n
+		i++
+	}
+
+	s, errReply := getRStream(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return redis.EmptyArrayReply
+	}
+	if count == 0 {
+		return redis.NilArrayReply
+	}
+	return streamEntriesReply(s.Range(start, end, count, reverse))
+}
+
+// XRange xrange key start end [COUNT count]
+func XRange(c *tcp.RegisConn, args []string) base.Reply {
+	return xRange(c, args, false)
+}
+
+// XRevRange xrevrange key end start [COUNT count]
+func XRevRange(c *tcp.RegisConn, args []string) base.Reply {
+	return xRange(c, args, true)
+}
+
+// XLen xlen key
+func XLen(c *tcp.RegisConn, args []string) base.Reply {
+	s, errReply := getRStream(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return redis.IntReply(0)
+	}
+	return redis.Int64Reply(s.Len())
+}
+
+// XDel xdel key id [id ...]
+func XDel(c *tcp.RegisConn, args []string) base.Reply {
+	ids := make([]base.StreamID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, errReply := parseStreamID(arg, 0)
+		if errReply != nil {
+			return errReply
+		}
+		ids = append(ids, id)
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	s, errReply := getRStream(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	deleted := 0
+	if s != nil {
+		for _, id := range ids {
+			deleted += s.Delete(id)
+		}
+	}
+	if deleted == 0 {
+		c.Rewrite()
+		return redis.IntReply(0)
+	}
+	db.PutData(args[1], s)
+	notifyKeyspaceEvent(notifyStream, "xdel", args[1], c.DBIndex)
+	return redis.IntReply(deleted)
+}
+
+// XTrim xtrim key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func XTrim(c *tcp.RegisConn, args []string) base.Reply {
+	spec, _, _, errReply := parseStreamTrim(args, 2, false)
+	if errReply != nil {
+		return errReply
+	}
+	if spec.strategy == "" {
+		return redis.ErrReply("ERR syntax error, XTRIM must be called with a trimming strategy")
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	s, errReply := getRStream(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		c.Rewrite()
+		return redis.IntReply(0)
+	}
+	deleted := spec.trim(s)
+	if deleted == 0 {
+		c.Rewrite()
+		return redis.IntReply(0)
+	}
+	db.PutData(args[1], s)
+	notifyKeyspaceEvent(notifyStream, "xtrim", args[1], c.DBIndex)
+	c.Rewrite([]string{"xtrim", args[1], "maxlen", "=", strconv.FormatInt(s.Len(), 10)})
+	return redis.Int64Reply(deleted)
+}
+
+// XSetID xsetid key last-id [ENTRIESADDED entries-added] [MAXDELETEDID max-deleted-id]
+// 除了直接使用，从rdb恢复 stream 时也用它来恢复元信息
+func XSetID(c *tcp.RegisConn, args []string) base.Reply {
+	id, errReply := parseStreamID(args[2], 0)
+	if errReply != nil {
+		return errReply
+	}
+	entriesAdded, maxDeleted := int64(-1), base.StreamID{}
+	hasMaxDeleted := false
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToLower(args[i])
+		switch {
+		case opt == "entriesadded" && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redis.IntErrReply
+			}
+			if n < 0 {
+				return redis.ErrReply("ERR entries_added must be positive")
+			}
+			entriesAdded = n
+		case opt == "maxdeletedid" && i+1 < len(args):
+			if maxDeleted, errReply = parseStreamID(args[i+1], 0); errReply != nil {
+				return errReply
+			}
+			if id.Compare(maxDeleted) < 0 {
+				return redis.ErrReply("ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+			}
+			hasMaxDeleted = true
+		default:
+			return redis.ErrReply("ERR syntax error")
+		}
+		i++
+	}
+
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	s, errReply := getRStream(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return redis.ErrReply("ERR no such key")
+	}
+	if top := s.Range(base.StreamID{}, streamMaxID, 1, true); len(top) > 0 && id.Compare(top[0].ID) < 0 {
+		return redis.ErrReply("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	if entriesAdded >= 0 && entriesAdded < s.Len() {
+		return redis.ErrReply("ERR The entries_added specified in XSETID is smaller than the target stream length")
+	}
+	added := s.EntriesAdded()
+	if entriesAdded >= 0 {
+		added = uint64(entriesAdded)
+	}
+	if !hasMaxDeleted {
+		maxDeleted = s.MaxDeletedID()
+	}
+	s.SetID(id, added, maxDeleted)
+	db.PutData(args[1], s)
+	notifyKeyspaceEvent(notifyStream, "xsetid", args[1], c.DBIndex)
+	return redis.OkReply
+}
+
+// XRead xread [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// 所有stream都没有新消息时，指定了 BLOCK 就阻塞，阻塞前把 $ 换成当时的 lastID，被唤醒后重新执行时只读这之后的消息
+func XRead(c *tcp.RegisConn, args []string) base.Reply {
+	return xRead(c, args, false)
+}
+
+// xReadArgs xread, xreadgroup 解析后的参数
+type xReadArgs struct {
+	count    int64
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	group    string
+	consumer string
+	// idIdx args 中第一个ID的下标
+	idIdx  int
+	keys   []string
+	idArgs []string
+}
+
+// parseXRead 解析 xread, xreadgroup 的参数，isGroup 为true时可以使用 GROUP, NOACK
+func parseXRead(args []string, isGroup bool) (*xReadArgs, base.Reply) {
+	ret := &xReadArgs{count: -1}
+	streamsIdx := 0
+	for i := 1; i < len(args) && streamsIdx == 0; i++ {
+		opt := strings.ToLower(args[i])
+		more := len(args) - 1 - i
+		switch {
+		case opt == "count" && more >= 1:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, redis.IntErrReply
+			}
+			if n > 0 {
+				ret.count = n
+			}
+			i++
+		case opt == "block" && more >= 1:
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, redis.ErrReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, redis.ErrReply("ERR timeout is negative")
+			}
+			ret.block, ret.timeout = true, time.Duration(ms)*time.Millisecond
+			i++
+		case opt == "streams" && more >= 1:
+			streamsIdx = i + 1
+		case opt == "group" && more >= 2 && isGroup:
+			ret.group, ret.consumer = args[i+1], args[i+2]
+			i += 2
+		case opt == "noack" && isGroup:
+			ret.noAck = true
+		default:
+			return nil, redis.ErrReply("ERR syntax error")
+		}
+	}
+	if streamsIdx == 0 {
+		return nil, redis.ErrReply("ERR syntax error")
+	}
+	if (len(args)-streamsIdx)%2 != 0 {
+		return nil, redis.ErrReply(fmt.Sprintf("ERR Unbalanced '%v' list of streams: for each stream key an ID or '%v' must be specified.",
+			strings.ToLower(args[0]), map[bool]string{false: "$", true: ">"}[isGroup]))
+	}
+	if isGroup && ret.group == "" {
+		return nil, redis.ErrReply("ERR Missing GROUP option for XREADGROUP")
+	}
+	n := (len(args) - streamsIdx) / 2
+	ret.idIdx = streamsIdx + n
+	ret.keys, ret.idArgs = args[streamsIdx:ret.idIdx], args[ret.idIdx:]
+	return ret, nil
+}
+
+// xRead xread, xreadgroup 的公共实现
+func xRead(c *tcp.RegisConn, args []string, isGroup bool) base.Reply {
+	xa, errReply := parseXRead(args, isGroup)
+	if errReply != nil {
+		return errReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	streams := make([]base.RStream, len(xa.keys))
+	ids := make([]base.StreamID, len(xa.keys))
+	for i, key := range xa.keys {
+		s, errReply := getRStream(db, key, isGroup)
+		if errReply != nil {
+			return errReply
+		}
+		streams[i] = s
+		if isGroup {
+			if s == nil {
+				return noGroupErrReply(key, xa.group, true)
+			}
+			if _, ok := s.Group(xa.group); !ok {
+				return noGroupErrReply(key, xa.group, true)
+			}
+		}
+		switch xa.idArgs[i] {
+		case "$":
+			if isGroup {
+				return redis.ErrReply("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+			}
+			if s != nil {
+				ids[i] = s.LastID()
+			}
+		case ">":
+			if !isGroup {
+				return redis.ErrReply("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+			}
+		default:
+			if ids[i], errReply = parseStreamID(xa.idArgs[i], 0); errReply != nil {
+				return errReply
+			}
+		}
+	}
+
+	ret := make([]base.Reply, 0)
+	readNew := true
+	if isGroup {
+		c.Rewrite()
+	}
+	for i, s := range streams {
+		var entries []base.StreamEntry
+		switch {
+		case isGroup && xa.idArgs[i] != ">":
+			// 读取消费者的历史消息时，就算没有消息也要回复
+			readNew = false
+			entries = xReadGroupHistory(c, xa, xa.keys[i], s, ids[i])
+			ret = append(ret, redis.MultiReply([]base.Reply{
+				redis.BulkStrReply(xa.keys[i]),
+				streamEntriesReply(entries),
+			}))
+			continue
+		case isGroup:
+			entries = xReadGroupNew(c, xa, xa.keys[i], s)
+		case s != nil && s.LastID().Compare(ids[i]) > 0:
+			start, _ := ds.NextStreamID(ids[i])
+			entries = s.Range(start, streamMaxID, xa.count, false)
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		ret = append(ret, redis.MultiReply([]base.Reply{
+			redis.BulkStrReply(xa.keys[i]),
+			streamEntriesReply(entries),
+		}))
+	}
+	if len(ret) > 0 {
+		return redis.MultiReply(ret)
+	}
+	if !xa.block || !readNew {
+		return redis.NilArrayReply
+	}
+	query := make([]string, len(args))
+	copy(query, args)
+	if !isGroup {
+		for i := range ids {
+			query[xa.idIdx+i] = ids[i].String()
+		}
+	}
+	c.Block(query, xa.keys, xa.timeout, redis.NilArrayReply)
+	return nil
+}
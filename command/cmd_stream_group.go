@@ -0,0 +1,797 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/ds"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stream 消费者组命令，消费者组见 ds.StreamGroup
+// 和redis一样，xreadgroup, xclaim, xautoclaim 对消费者组的修改传播给slave时，
+// 改写成 xclaim ... FORCE JUSTID 和 xgroup setid，保证slave上的待确认列表和master一样
+
+// noGroupErrReply key或者消费者组不存在
+func noGroupErrReply(key, group string, inXReadGroup bool) base.Reply {
+	if inXReadGroup {
+		return redis.ErrReply(fmt.Sprintf("NOGROUP No such key '%v' or consumer group '%v' in XREADGROUP with GROUP option", key, group))
+	}
+	return redis.ErrReply(fmt.Sprintf("NOGROUP No such key '%v' or consumer group '%v'", key, group))
+}
+
+// getStreamGroup 获取key中的消费者组，key或者组不存在时返回 noGroupErrReply
+func getStreamGroup(db base.SDB, key, group string) (base.RStream, base.StreamGroup, base.Reply) {
+	s, errReply := getRStream(db, key, true)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if s == nil {
+		return nil, nil, noGroupErrReply(key, group, false)
+	}
+	g, ok := s.Group(group)
+	if !ok {
+		return nil, nil, noGroupErrReply(key, group, false)
+	}
+	return s, g, nil
+}
+
+// touchConsumer 更新消费者最后一次出现的时间，新建了消费者时传播 xgroup createconsumer 并返回true
+func touchConsumer(c *tcp.RegisConn, key string, g base.StreamGroup, consumer string, now int64) bool {
+	if !g.TouchConsumer(consumer, now) {
+		return false
+	}
+	c.Rewrite([]string{"xgroup", "createconsumer", key, g.Name(), consumer})
+	notifyKeyspaceEvent(notifyStream, "xgroup-createconsumer", key, c.DBIndex)
+	return true
+}
+
+// propagateClaim 传播一条消息的认领结果
+func propagateClaim(c *tcp.RegisConn, key, group string, n base.StreamNACK) {
+	c.Rewrite([]string{"xclaim", key, group, n.Consumer, "0", n.ID.String(),
+		"time", strconv.FormatInt(n.DeliveryTime, 10),
+		"retrycount", strconv.FormatInt(n.DeliveryCount, 10),
+		"force", "justid"})
+}
+
+// propagateGroupLastID 传播消费者组的 lastID 和 entriesRead
+func propagateGroupLastID(c *tcp.RegisConn, key string, g base.StreamGroup) {
+	c.Rewrite([]string{"xgroup", "setid", key, g.Name(), g.LastID().String(),
+		"entriesread", strconv.FormatInt(g.EntriesRead(), 10)})
+}
+
+// xReadGroupNew xreadgroup 使用 > 读取新消息
+func xReadGroupNew(c *tcp.RegisConn, xa *xReadArgs, key string, s base.RStream) []base.StreamEntry {
+	now := time.Now().UnixMilli()
+	g, _ := s.Group(xa.group)
+	created := touchConsumer(c, key, g, xa.consumer, now)
+	entries := s.ReadGroup(xa.group, xa.consumer, xa.count, xa.noAck, now)
+	if len(entries) == 0 {
+		if created {
+			tcp.Server.DB.GetSDB(c.DBIndex).PutData(key, s)
+		}
+		return entries
+	}
+	if !xa.noAck {
+		for _, e := range entries {
+			n, _ := g.NACK(e.ID)
+			propagateClaim(c, key, xa.group, n)
+		}
+	}
+	propagateGroupLastID(c, key, g)
+	tcp.Server.DB.GetSDB(c.DBIndex).PutData(key, s)
+	return entries
+}
+
+// xReadGroupHistory xreadgroup 读取消费者已经读过、但还没有确认的消息，只返回ID比id大的
+// 已经被删除的消息 Fields 为nil
+func xReadGroupHistory(c *tcp.RegisConn, xa *xReadArgs, key string, s base.RStream, id base.StreamID) []base.StreamEntry {
+	g, _ := s.Group(xa.group)
+	if touchConsumer(c, key, g, xa.consumer, time.Now().UnixMilli()) {
+		tcp.Server.DB.GetSDB(c.DBIndex).PutData(key, s)
+	}
+	start, ok := ds.NextStreamID(id)
+	if !ok {
+		return nil
+	}
+	nacks := g.Pending(start, streamMaxID, xa.count, xa.consumer, nil)
+	ret := make([]base.StreamEntry, len(nacks))
+	for i, n := range nacks {
+		ret[i].ID = n.ID
+		if e := s.Range(n.ID, n.ID, 1, false); len(e) > 0 {
+			ret[i] = e[0]
+		}
+	}
+	return ret
+}
+
+// XReadGroup xreadgroup GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+// id 为 > 时读取新消息，否则读取消费者的历史消息，只有全部都是 > 时才会阻塞
+func XReadGroup(c *tcp.RegisConn, args []string) base.Reply {
+	return xRead(c, args, true)
+}
+
+// xGroupArity xgroup 各子命令的参数个数范围
+var xGroupArity = map[string][2]int{
+	"create":         {5, 8},
+	"setid":          {5, 7},
+	"destroy":        {4, 4},
+	"createconsumer": {5, 5},
+	"delconsumer":    {5, 5},
+}
+
+// XGroup xgroup CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]
+// xgroup SETID key group id|$ [ENTRIESREAD entries-read]
+// xgroup DESTROY key group
+// xgroup CREATECONSUMER|DELCONSUMER key group consumer
+func XGroup(c *tcp.RegisConn, args []string) base.Reply {
+	sub := strings.ToLower(args[1])
+	if sub == "help" && len(args) == 2 {
+		return redis.StringsReply([]string{
+			"XGROUP <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"CREATE <key> <groupname> <id|$> [option]",
+			"    Create a new consumer group. Options are:",
+			"    * MKSTREAM",
+			"      Create the empty stream if it does not exist.",
+			"    * ENTRIESREAD entries_read",
+			"      Set the group's entries_read counter (internal use).",
+			"CREATECONSUMER <key> <groupname> <consumer>",
+			"    Create a new consumer in the specified group.",
+			"DELCONSUMER <key> <groupname> <consumer>",
+			"    Remove the specified consumer.",
+			"DESTROY <key> <groupname>",
+			"    Remove the specified group.",
+			"SETID <key> <groupname> <id|$> [ENTRIESREAD entries_read]",
+			"    Set the current group ID and entries_read counter.",
+			"HELP",
+			"    Print this help.",
+		})
+	}
+	arity, ok := xGroupArity[sub]
+	if !ok || len(args) < arity[0] || len(args) > arity[1] {
+		return redis.ErrReply(fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%v'. Try XGROUP HELP.", args[1]))
+	}
+	key, group := args[2], args[3]
+
+	mkStream, entriesRead := false, int64(-1)
+	if sub == "create" || sub == "setid" {
+		for i := 5; i < len(args); i++ {
+			opt := strings.ToLower(args[i])
+			switch {
+			case opt == "mkstream" && sub == "create":
+				mkStream = true
+			case opt == "entriesread" && i+1 < len(args):
+				n, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil {
+					return redis.IntErrReply
+				}
+				if n < -1 {
+					return redis.ErrReply("ERR value for ENTRIESREAD must be positive or -1")
+				}
+				entriesRead = n
+				i++
+			default:
+				return redis.ErrReply("ERR syntax error")
+			}
+		}
+	}
+
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	s, errReply := getRStream(db, key, true)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		if !mkStream {
+			return redis.ErrReply("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+		}
+		s = ds.NewStream()
+	}
+	g, ok := s.Group(group)
+	if !ok && sub != "create" && sub != "destroy" {
+		return redis.ErrReply(fmt.Sprintf("NOGROUP No such consumer group '%v' for key name '%v'", group, key))
+	}
+
+	switch sub {
+	case "create", "setid":
+		// $ 表示 stream 当前的 lastID，传播给slave时改写成实际的ID
+		id := s.LastID()
+		if args[4] != "$" {
+			if id, errReply = parseStreamID(args[4], 0); errReply != nil {
+				return errReply
+			}
+		}
+		if sub == "create" {
+			if !s.CreateGroup(group, id, entriesRead) {
+				return redis.ErrReply("BUSYGROUP Consumer Group name already exists")
+			}
+			c.Rewrite([]string{"xgroup", "create", key, group, id.String(), "mkstream",
+				"entriesread", strconv.FormatInt(entriesRead, 10)})
+		} else {
+			g.SetLastID(id, entriesRead)
+			propagateGroupLastID(c, key, g)
+		}
+		db.PutData(key, s)
+		notifyKeyspaceEvent(notifyStream, "xgroup-"+sub, key, c.DBIndex)
+		return redis.OkReply
+	case "destroy":
+		n := s.DestroyGroup(group)
+		if n == 0 {
+			c.Rewrite()
+		} else {
+			db.PutData(key, s)
+			// 唤醒阻塞在这个组上的 xreadgroup，让它们回复 NOGROUP
+			tcp.Server.SignalKeyAsReady(c.DBIndex, key)
+			notifyKeyspaceEvent(notifyStream, "xgroup-destroy", key, c.DBIndex)
+		}
+		return redis.IntReply(n)
+	case "createconsumer":
+		if !g.TouchConsumer(args[4], time.Now().UnixMilli()) {
+			c.Rewrite()
+			return redis.IntReply(0)
+		}
+		db.PutData(key, s)
+		notifyKeyspaceEvent(notifyStream, "xgroup-createconsumer", key, c.DBIndex)
+		return redis.IntReply(1)
+	}
+	// delconsumer
+	pending, ok := g.DeleteConsumer(args[4])
+	if !ok {
+		c.Rewrite()
+		return redis.IntReply(0)
+	}
+	db.PutData(key, s)
+	notifyKeyspaceEvent(notifyStream, "xgroup-delconsumer", key, c.DBIndex)
+	return redis.Int64Reply(pending)
+}
+
+// XAck xack key group id [id ...]，返回确认的消息数
+func XAck(c *tcp.RegisConn, args []string) base.Reply {
+	ids := make([]base.StreamID, 0, len(args)-3)
+	for _, arg := range args[3:] {
+		id, errReply := parseStreamID(arg, 0)
+		if errReply != nil {
+			return errReply
+		}
+		ids = append(ids, id)
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	s, g, errReply := getStreamGroup(db, args[1], args[2])
+	if s == nil {
+		// key或者消费者组不存在时返回0
+		if errReply == redis.TypeErrReply {
+			return errReply
+		}
+		c.Rewrite()
+		return redis.IntReply(0)
+	}
+	acked := 0
+	for _, id := range ids {
+		acked += g.Ack(id)
+	}
+	if acked == 0 {
+		c.Rewrite()
+	} else {
+		db.PutData(args[1], s)
+	}
+	return redis.IntReply(acked)
+}
+
+// XPending xpending key group [[IDLE min-idle-time] start end count [consumer]]
+// 只有 key group 时返回概要：待确认消息数，最小ID，最大ID，每个消费者的待确认消息数
+func XPending(c *tcp.RegisConn, args []string) base.Reply {
+	extended := len(args) > 3
+	minIdle := int64(0)
+	var start, end base.StreamID
+	count := int64(0)
+	consumer := ""
+	if extended {
+		i := 3
+		if strings.ToLower(args[i]) == "idle" && len(args) > i+1 {
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redis.IntErrReply
+			}
+			minIdle = n
+			i += 2
+		}
+		if n := len(args) - i; n != 3 && n != 4 {
+			return redis.ErrReply("ERR syntax error")
+		}
+		var errReply base.Reply
+		if start, errReply = parseStreamRangeID(args[i], true); errReply != nil {
+			return errReply
+		}
+		if end, errReply = parseStreamRangeID(args[i+1], false); errReply != nil {
+			return errReply
+		}
+		n, err := strconv.ParseInt(args[i+2], 10, 64)
+		if err != nil {
+			return redis.IntErrReply
+		}
+		if n > 0 {
+			count = n
+		}
+		if len(args) > i+3 {
+			consumer = args[i+3]
+		}
+	}
+
+	_, g, errReply := getStreamGroup(tcp.Server.DB.GetSDB(c.DBIndex), args[1], args[2])
+	if errReply != nil {
+		return errReply
+	}
+	if !extended {
+		nacks := g.Pending(base.StreamID{}, streamMaxID, -1, "", nil)
+		if len(nacks) == 0 {
+			return redis.MultiReply([]base.Reply{redis.IntReply(0), redis.NilReply, redis.NilReply, redis.NilArrayReply})
+		}
+		consumers := make([]base.Reply, 0)
+		for _, cs := range g.Consumers() {
+			if cs.Pending > 0 {
+				consumers = append(consumers, redis.StringsReply([]string{cs.Name, strconv.FormatInt(cs.Pending, 10)}))
+			}
+		}
+		return redis.MultiReply([]base.Reply{
+			redis.IntReply(len(nacks)),
+			redis.BulkStrReply(nacks[0].ID.String()),
+			redis.BulkStrReply(nacks[len(nacks)-1].ID.String()),
+			redis.MultiReply(consumers),
+		})
+	}
+	if count == 0 {
+		return redis.EmptyArrayReply
+	}
+	now := time.Now().UnixMilli()
+	var filter func(base.StreamNACK) bool
+	if minIdle > 0 {
+		filter = func(n base.StreamNACK) bool {
+			return now-n.DeliveryTime >= minIdle
+		}
+	}
+	nacks := g.Pending(start, end, count, consumer, filter)
+	if len(nacks) == 0 {
+		return redis.EmptyArrayReply
+	}
+	ret := make([]base.Reply, len(nacks))
+	for i, n := range nacks {
+		ret[i] = redis.MultiReply([]base.Reply{
+			redis.BulkStrReply(n.ID.String()),
+			redis.BulkStrReply(n.Consumer),
+			redis.Int64Reply(now - n.DeliveryTime),
+			redis.Int64Reply(n.DeliveryCount),
+		})
+	}
+	return redis.MultiReply(ret)
+}
+
+// streamClaimReply xclaim, xautoclaim 回复认领到的消息，justID 为true时只回复ID
+func streamClaimReply(s base.RStream, ids []base.StreamID, justID bool) base.Reply {
+	if justID {
+		ret := make([]string, len(ids))
+		for i, id := range ids {
+			ret[i] = id.String()
+		}
+		return redis.StringsReply(ret)
+	}
+	entries := make([]base.StreamEntry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, s.Range(id, id, 1, false)...)
+	}
+	return streamEntriesReply(entries)
+}
+
+// streamEntryExists 消息是否还在 stream 中
+func streamEntryExists(s base.RStream, id base.StreamID) bool {
+	return len(s.Range(id, id, 1, false)) > 0
+}
+
+// XClaim xclaim key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+// 空闲时间不小于 min-idle-time 的待确认消息转移给consumer，已经被删除的消息直接从待确认列表中删掉
+func XClaim(c *tcp.RegisConn, args []string) base.Reply {
+	minIdle, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil {
+		return redis.ErrReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+	i := 5
+	ids := make([]base.StreamID, 0)
+	for ; i < len(args); i++ {
+		id, ok := ds.ParseStreamID(args[i], 0)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+	// 第一个ID必须是合法的
+	if len(ids) == 0 {
+		return streamIDErrReply
+	}
+
+	now := time.Now().UnixMilli()
+	deliveryTime, retryCount := int64(-1), int64(-1)
+	force, justID := false, false
+	var lastID *base.StreamID
+	for ; i < len(args); i++ {
+		opt := strings.ToLower(args[i])
+		more := len(args) - 1 - i
+		switch {
+		case opt == "force":
+			force = true
+		case opt == "justid":
+			justID = true
+		case opt == "idle" && more >= 1:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redis.ErrReply("ERR Invalid IDLE option argument for XCLAIM")
+			}
+			deliveryTime = now - n
+			i++
+		case opt == "time" && more >= 1:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redis.ErrReply("ERR Invalid TIME option argument for XCLAIM")
+			}
+			deliveryTime = n
+			i++
+		case opt == "retrycount" && more >= 1:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redis.ErrReply("ERR Invalid RETRYCOUNT option argument for XCLAIM")
+			}
+			retryCount = n
+			i++
+		case opt == "lastid" && more >= 1:
+			id, errReply := parseStreamID(args[i+1], 0)
+			if errReply != nil {
+				return errReply
+			}
+			lastID = &id
+			i++
+		default:
+			return redis.ErrReply(fmt.Sprintf("ERR Unrecognized XCLAIM option '%v'", args[i]))
+		}
+	}
+	// 投递时间不能在未来
+	if deliveryTime < 0 || deliveryTime > now {
+		deliveryTime = now
+	}
+
+	key, group, consumer := args[1], args[2], args[3]
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	s, g, errReply := getStreamGroup(db, key, group)
+	if errReply != nil {
+		return errReply
+	}
+	c.Rewrite()
+	modified := false
+	if lastID != nil && lastID.Compare(g.LastID()) > 0 {
+		g.SetLastID(*lastID, g.EntriesRead())
+		propagateGroupLastID(c, key, g)
+		modified = true
+	}
+	if touchConsumer(c, key, g, consumer, now) {
+		modified = true
+	}
+
+	claimed := make([]base.StreamID, 0, len(ids))
+	for _, id := range ids {
+		n, ok := g.NACK(id)
+		exists := streamEntryExists(s, id)
+		if !ok {
+			// FORCE 时，消息还在 stream 中就新建一条待确认消息
+			if !force || !exists {
+				continue
+			}
+			n = base.StreamNACK{ID: id, DeliveryCount: 1}
+		} else if minIdle > 0 && now-n.DeliveryTime < minIdle {
+			continue
+		}
+		modified = true
+		if !exists {
+			g.Ack(id)
+			c.Rewrite([]string{"xack", key, group, id.String()})
+			continue
+		}
+		count := n.DeliveryCount
+		if retryCount >= 0 {
+			count = retryCount
+		} else if !justID {
+			count++
+		}
+		g.Claim(id, consumer, deliveryTime, count, now)
+		n, _ = g.NACK(id)
+		propagateClaim(c, key, group, n)
+		claimed = append(claimed, id)
+	}
+	if modified {
+		db.PutData(key, s)
+	}
+	return streamClaimReply(s, claimed, justID)
+}
+
+// XAutoClaim xautoclaim key group consumer min-idle-time start [COUNT count] [JUSTID]
+// 从start开始扫描待确认列表，认领最多count条空闲时间不小于 min-idle-time 的消息，最多扫描 count*10 条
+// 回复 [下一次扫描的起点, 认领到的消息, 已经被删除的消息ID]，起点为 0-0 表示扫描完了
+func XAutoClaim(c *tcp.RegisConn, args []string) base.Reply {
+	minIdle, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil {
+		return redis.ErrReply("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+	start, errReply := parseStreamRangeID(args[5], true)
+	if errReply != nil {
+		return errReply
+	}
+	count, justID := int64(100), false
+	for i := 6; i < len(args); i++ {
+		opt := strings.ToLower(args[i])
+		switch {
+		case opt == "count" && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redis.IntErrReply
+			}
+			if n < 1 || n > math.MaxInt64/10 {
+				return redis.ErrReply("ERR COUNT must be > 0")
+			}
+			count = n
+			i++
+		case opt == "justid":
+			justID = true
+		default:
+			return redis.ErrReply("ERR syntax error")
+		}
+	}
+
+	key, group, consumer := args[1], args[2], args[3]
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	s, g, errReply := getStreamGroup(db, key, group)
+	if errReply != nil {
+		return errReply
+	}
+	c.Rewrite()
+	now := time.Now().UnixMilli()
+	modified := touchConsumer(c, key, g, consumer, now)
+
+	attempts := count * 10
+	nacks := g.Pending(start, streamMaxID, attempts+1, "", nil)
+	claimed := make([]base.StreamID, 0)
+	deleted := make([]string, 0)
+	next := base.StreamID{}
+	for i, n := range nacks {
+		if attempts == 0 || count == 0 {
+			next = n.ID
+			break
+		}
+		attempts--
+		if !streamEntryExists(s, n.ID) {
+			modified = true
+			g.Ack(n.ID)
+			c.Rewrite([]string{"xack", key, group, n.ID.String()})
+			deleted = append(deleted, n.ID.String())
+			continue
+		}
+		if minIdle > 0 && now-n.DeliveryTime < minIdle {
+			continue
+		}
+		deliveryCount := n.DeliveryCount
+		if !justID {
+			deliveryCount++
+		}
+		modified = true
+		g.Claim(n.ID, consumer, now, deliveryCount, now)
+		n, _ = g.NACK(n.ID)
+		propagateClaim(c, key, group, n)
+		claimed = append(claimed, n.ID)
+		count--
+		if count == 0 && i+1 < len(nacks) {
+			next = nacks[i+1].ID
+			break
+		}
+	}
+	if modified {
+		db.PutData(key, s)
+	}
+	return redis.MultiReply([]base.Reply{
+		redis.BulkStrReply(next.String()),
+		streamClaimReply(s, claimed, justID),
+		redis.StringsReply(deleted),
+	})
+}
+
+// streamEntryReply 回复单条消息，消息不存在时回复nil
+func streamEntryReply(entries []base.StreamEntry) base.Reply {
+	if len(entries) == 0 {
+		return redis.NilReply
+	}
+	return redis.MultiReply([]base.Reply{
+		redis.BulkStrReply(entries[0].ID.String()),
+		redis.StringsReply(entries[0].Fields),
+	})
+}
+
+// streamGroupEntriesRead 回复消费者组的 entries-read 和 lag，未知时回复nil
+func streamGroupEntriesRead(s base.RStream, g base.StreamGroup) (base.Reply, base.Reply) {
+	var read, lag base.Reply = redis.NilReply, redis.NilReply
+	if n := g.EntriesRead(); n >= 0 {
+		read = redis.Int64Reply(n)
+	}
+	if n, ok := s.Lag(g.Name()); ok {
+		lag = redis.Int64Reply(n)
+	}
+	return read, lag
+}
+
+// xInfoStreamFull xinfo stream key FULL [COUNT count]，count 为0表示不限
+func xInfoStreamFull(s base.RStream, count int64) base.Reply {
+	if count == 0 {
+		count = -1
+	}
+	groups := make([]base.Reply, 0)
+	for _, g := range s.Groups() {
+		pending := make([]base.Reply, 0)
+		for _, n := range g.Pending(base.StreamID{}, streamMaxID, count, "", nil) {
+			pending = append(pending, redis.MultiReply([]base.Reply{
+				redis.BulkStrReply(n.ID.String()),
+				redis.BulkStrReply(n.Consumer),
+				redis.Int64Reply(n.DeliveryTime),
+				redis.Int64Reply(n.DeliveryCount),
+			}))
+		}
+		consumers := make([]base.Reply, 0)
+		for _, cs := range g.Consumers() {
+			cPending := make([]base.Reply, 0)
+			for _, n := range g.Pending(base.StreamID{}, streamMaxID, count, cs.Name, nil) {
+				cPending = append(cPending, redis.MultiReply([]base.Reply{
+					redis.BulkStrReply(n.ID.String()),
+					redis.Int64Reply(n.DeliveryTime),
+					redis.Int64Reply(n.DeliveryCount),
+				}))
+			}
+			consumers = append(consumers, redis.MultiReply([]base.Reply{
+				redis.BulkStrReply("name"), redis.BulkStrReply(cs.Name),
+				redis.BulkStrReply("seen-time"), redis.Int64Reply(cs.SeenTime),
+				redis.BulkStrReply("active-time"), redis.Int64Reply(cs.ActiveTime),
+				redis.BulkStrReply("pel-count"), redis.Int64Reply(cs.Pending),
+				redis.BulkStrReply("pending"), arrayOrEmpty(cPending),
+			}))
+		}
+		read, lag := streamGroupEntriesRead(s, g)
+		groups = append(groups, redis.MultiReply([]base.Reply{
+			redis.BulkStrReply("name"), redis.BulkStrReply(g.Name()),
+			redis.BulkStrReply("last-delivered-id"), redis.BulkStrReply(g.LastID().String()),
+			redis.BulkStrReply("entries-read"), read,
+			redis.BulkStrReply("lag"), lag,
+			redis.BulkStrReply("pel-count"), redis.Int64Reply(g.PendingLen()),
+			redis.BulkStrReply("pending"), arrayOrEmpty(pending),
+			redis.BulkStrReply("consumers"), arrayOrEmpty(consumers),
+		}))
+	}
+	return redis.MultiReply([]base.Reply{
+		redis.BulkStrReply("length"), redis.Int64Reply(s.Len()),
+		redis.BulkStrReply("last-generated-id"), redis.BulkStrReply(s.LastID().String()),
+		redis.BulkStrReply("max-deleted-entry-id"), redis.BulkStrReply(s.MaxDeletedID().String()),
+		redis.BulkStrReply("entries-added"), redis.Int64Reply(int64(s.EntriesAdded())),
+		redis.BulkStrReply("recorded-first-entry-id"), redis.BulkStrReply(s.FirstID().String()),
+		redis.BulkStrReply("entries"), streamEntriesReply(s.Range(base.StreamID{}, streamMaxID, count, false)),
+		redis.BulkStrReply("groups"), arrayOrEmpty(groups),
+	})
+}
+
+// arrayOrEmpty redis.MultiReply 在没有元素时回复的是nil，这里回复空数组
+func arrayOrEmpty(replies []base.Reply) base.Reply {
+	if len(replies) == 0 {
+		return redis.EmptyArrayReply
+	}
+	return redis.MultiReply(replies)
+}
+
+// XInfo xinfo STREAM key [FULL [COUNT count]]
+// xinfo GROUPS key
+// xinfo CONSUMERS key group
+func XInfo(c *tcp.RegisConn, args []string) base.Reply {
+	sub := strings.ToLower(args[1])
+	if sub == "help" && len(args) == 2 {
+		return redis.StringsReply([]string{
+			"XINFO <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"CONSUMERS <key> <groupname>",
+			"    Show consumers of <groupname>.",
+			"GROUPS <key>",
+			"    Show the stream consumer groups.",
+			"STREAM <key> [FULL [COUNT <count>]",
+			"    Show information about the stream.",
+			"HELP",
+			"    Print this help.",
+		})
+	}
+	if (sub != "stream" || len(args) < 3) && (sub != "groups" || len(args) != 3) && (sub != "consumers" || len(args) != 4) {
+		return redis.ErrReply(fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%v'. Try XINFO HELP.", args[1]))
+	}
+	key := args[2]
+	s, errReply := getRStream(tcp.Server.DB.GetSDB(c.DBIndex), key, false)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return redis.ErrReply("ERR no such key")
+	}
+
+	switch sub {
+	case "groups":
+		ret := make([]base.Reply, 0)
+		for _, g := range s.Groups() {
+			read, lag := streamGroupEntriesRead(s, g)
+			ret = append(ret, redis.MultiReply([]base.Reply{
+				redis.BulkStrReply("name"), redis.BulkStrReply(g.Name()),
+				redis.BulkStrReply("consumers"), redis.IntReply(len(g.Consumers())),
+				redis.BulkStrReply("pending"), redis.Int64Reply(g.PendingLen()),
+				redis.BulkStrReply("last-delivered-id"), redis.BulkStrReply(g.LastID().String()),
+				redis.BulkStrReply("entries-read"), read,
+				redis.BulkStrReply("lag"), lag,
+			}))
+		}
+		return arrayOrEmpty(ret)
+	case "consumers":
+		g, ok := s.Group(args[3])
+		if !ok {
+			return redis.ErrReply(fmt.Sprintf("NOGROUP No such consumer group '%v' for key name '%v'", args[3], key))
+		}
+		now := time.Now().UnixMilli()
+		ret := make([]base.Reply, 0)
+		for _, cs := range g.Consumers() {
+			inactive := int64(-1)
+			if cs.ActiveTime >= 0 {
+				inactive = now - cs.ActiveTime
+			}
+			ret = append(ret, redis.MultiReply([]base.Reply{
+				redis.BulkStrReply("name"), redis.BulkStrReply(cs.Name),
+				redis.BulkStrReply("pending"), redis.Int64Reply(cs.Pending),
+				redis.BulkStrReply("idle"), redis.Int64Reply(now - cs.SeenTime),
+				redis.BulkStrReply("inactive"), redis.Int64Reply(inactive),
+			}))
+		}
+		return arrayOrEmpty(ret)
+	}
+
+	// stream
+	if len(args) > 3 {
+		if strings.ToLower(args[3]) != "full" || (len(args) != 4 && len(args) != 6) {
+			return redis.ErrReply("ERR syntax error")
+		}
+		count := int64(10)
+		if len(args) == 6 {
+			if strings.ToLower(args[4]) != "count" {
+				return redis.ErrReply("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[5], 10, 64)
+			if err != nil {
+				return redis.IntErrReply
+			}
+			if n < 0 {
+				n = 0
+			}
+			count = n
+		}
+		return xInfoStreamFull(s, count)
+	}
+	return redis.MultiReply([]base.Reply{
+		redis.BulkStrReply("length"), redis.Int64Reply(s.Len()),
+		redis.BulkStrReply("last-generated-id"), redis.BulkStrReply(s.LastID().String()),
+		redis.BulkStrReply("max-deleted-entry-id"), redis.BulkStrReply(s.MaxDeletedID().String()),
+		redis.BulkStrReply("entries-added"), redis.Int64Reply(int64(s.EntriesAdded())),
+		redis.BulkStrReply("recorded-first-entry-id"), redis.BulkStrReply(s.FirstID().String()),
+		redis.BulkStrReply("groups"), redis.IntReply(len(s.Groups())),
+		redis.BulkStrReply("first-entry"), streamEntryReply(s.Range(base.StreamID{}, streamMaxID, 1, false)),
+		redis.BulkStrReply("last-entry"), streamEntryReply(s.Range(base.StreamID{}, streamMaxID, 1, true)),
+	})
+}
@@ -0,0 +1,126 @@
+package command
+
+import (
+	"code/regis/conf"
+	"code/regis/file"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// reloadRDB 把db存成rdb再清空，按 LoadRDB 的命令还原，和重启时一样
+func reloadRDB(t *testing.T) {
+	t.Helper()
+	conf.Conf.RDBName = filepath.Join(t.TempDir(), "dump.rdb")
+	if err := file.SaveRDB(tcp.Server.DB.SaveRDB); err != nil {
+		t.Fatalf("save rdb %v", err)
+	}
+	tcp.Server.DB.Flush()
+	c := newTestConn()
+	for _, q := range file.LoadRDB(conf.Conf.RDBName) {
+		args := make([]string, len(q))
+		for i := range q {
+			args[i] = fmt.Sprint(q[i])
+		}
+		if reply, _ := call(c, args...); reply.Bytes()[0] == '-' {
+			t.Errorf("%v: %q", args, reply.Bytes())
+		}
+	}
+}
+
+func TestStream_RDBEmptyStream(t *testing.T) {
+	c := newTestConn()
+	call(c, "xgroup", "create", "rdbs1", "g1", "$", "mkstream")
+	call(c, "xadd", "rdbs2", "5-1", "f", "v")
+	call(c, "xdel", "rdbs2", "5-1")
+	call(c, "xgroup", "create", "rdbs2", "g2", "$")
+
+	reloadRDB(t)
+
+	reply, _ := call(c, "xinfo", "groups", "rdbs1")
+	if n := arrayLen(reply); n != 1 {
+		t.Errorf("want 1 group, get %q", reply.Bytes())
+	}
+	reply, _ = call(c, "xinfo", "groups", "rdbs2")
+	if n := arrayLen(reply); n != 1 {
+		t.Errorf("want 1 group, get %q", reply.Bytes())
+	}
+	reply, _ = call(c, "xadd", "rdbs2", "5-1", "f", "v")
+	checkReply(t, redis.ErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item"), reply)
+}
+
+// 第一个元素和 stream 的存盘魔数相同的list，重新加载之后还是list
+func TestStream_RDBListLikeDump(t *testing.T) {
+	c := newTestConn()
+	call(c, "rpush", "rdbl1", "\x00regis-stream", "0-0", "0", "0-0", "0", "0")
+	call(c, "rpush", "rdbl2", "\x00regis-list", "a")
+
+	reloadRDB(t)
+
+	reply, _ := call(c, "lrange", "rdbl1", "0", "-1")
+	checkReply(t, redis.StringsReply([]string{"\x00regis-stream", "0-0", "0", "0-0", "0", "0"}), reply)
+	reply, _ = call(c, "lrange", "rdbl2", "0", "-1")
+	checkReply(t, redis.StringsReply([]string{"\x00regis-list", "a"}), reply)
+}
+
+func TestXGroupDestroy_WakeBlocked(t *testing.T) {
+	c, reader := newTestConn(), newTestConn()
+	call(c, "xgroup", "create", "destroys", "g", "$", "mkstream")
+	if reply, _ := call(reader, "xreadgroup", "group", "g", "alice", "block", "0", "streams", "destroys", ">"); reply != nil {
+		t.Fatalf("want blocked, get %q", reply.Bytes())
+	}
+	tcp.Server.TakeReadyKeys()
+	call(c, "xgroup", "destroy", "destroys", "g")
+
+	// 和 ServeClientsBlockedOnKeys 一样重新执行阻塞的命令
+	keys := tcp.Server.TakeReadyKeys()
+	if len(keys) != 1 || keys[0].Key != "destroys" {
+		t.Fatalf("want destroys ready, get %v", keys)
+	}
+	query := reader.BlockedQuery()
+	reader.Unblock()
+	reply, _ := call(reader, query...)
+	checkReply(t, redis.ErrReply("NOGROUP No such key 'destroys' or consumer group 'g' in XREADGROUP with GROUP option"), reply)
+}
+
+func TestStreamGroup_Watch(t *testing.T) {
+	c, w := newTestConn(), newTestConn()
+	call(c, "xadd", "watchs", "1-1", "f", "v")
+	call(c, "xadd", "watchs", "1-2", "f", "v")
+	call(c, "xgroup", "create", "watchs", "g", "0")
+
+	// 修改了消费者组的命令都要让 watch 这个key的事务失败
+	queries := [][]string{
+		{"xgroup", "createconsumer", "watchs", "g", "bob"},
+		{"xreadgroup", "group", "g", "alice", "count", "1", "streams", "watchs", ">"},
+		{"xclaim", "watchs", "g", "bob", "0", "1-1"},
+		{"xautoclaim", "watchs", "g", "alice", "0", "0"},
+		{"xack", "watchs", "g", "1-1"},
+		{"xgroup", "delconsumer", "watchs", "g", "bob"},
+		{"xgroup", "destroy", "watchs", "g"},
+	}
+	for _, q := range queries {
+		call(w, "watch", "watchs")
+		call(c, q...)
+		if !w.DirtyCAS() {
+			t.Errorf("%v should touch watched key", q)
+		}
+		call(w, "unwatch")
+	}
+}
+
+func TestXGroup_DelConsumerNotExist(t *testing.T) {
+	c, w := newTestConn(), newTestConn()
+	call(c, "xgroup", "create", "delcs", "g", "$", "mkstream")
+	call(w, "watch", "delcs")
+	reply, propagated := call(c, "xgroup", "delconsumer", "delcs", "g", "nobody")
+	checkReply(t, redis.IntReply(0), reply)
+	if len(propagated) != 0 {
+		t.Errorf("want no propagation, get %v", propagated)
+	}
+	if w.DirtyCAS() {
+		t.Errorf("watched key should not be touched")
+	}
+}
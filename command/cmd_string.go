@@ -0,0 +1,673 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/lib/utils"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// base.RString 操作
+
+// 字符串值有三种编码：base.RString, 整数编码的 base.RInt，写入时统一用 base.NewString 转换，
+// 以及 setbit 这类原地修改部分内容的命令使用的 *base.RBytes
+
+// getRString 获取key对应的字符串，整数编码的值会被转换成字符串
+// key不存在时返回false，类型不对时返回 redis.TypeErrReply
+func getRString(db base.SDB, key string) (base.RString, bool, base.Reply) {
+	v, ok := db.GetData(key)
+	if !ok {
+		return "", false, nil
+	}
+	switch val := v.(type) {
+	case base.RString:
+		return val, true, nil
+	case base.RInt:
+		return base.RString(val.String()), true, nil
+	case *base.RBytes:
+		return base.RString(val.Buf), true, nil
+	}
+	return "", false, redis.TypeErrReply
+}
+
+// getStringBytes 获取key对应字符串的字节，base.RBytes 直接返回底层的字节数组，不复制，调用者不能修改
+func getStringBytes(db base.SDB, key string) ([]byte, bool, base.Reply) {
+	v, ok := db.GetData(key)
+	if !ok {
+		return nil, false, nil
+	}
+	switch val := v.(type) {
+	case *base.RBytes:
+		return val.Buf, true, nil
+	case base.RString:
+		return []byte(val), true, nil
+	case base.RInt:
+		return []byte(val.String()), true, nil
+	}
+	return nil, false, redis.TypeErrReply
+}
+
+// getRBytesForWrite 获取key对应的可以原地修改的字符串，key不存在时返回一个空的 base.RBytes
+// 其他编码的字符串会被转换成 base.RBytes，修改后要用 PutData 写回，以便转换后的值存入db并通知watch的客户端
+func getRBytesForWrite(db base.SDB, key string) (*base.RBytes, bool, base.Reply) {
+	v, ok := db.GetDataForWrite(key)
+	if !ok {
+		return &base.RBytes{}, false, nil
+	}
+	switch val := v.(type) {
+	case *base.RBytes:
+		return val, true, nil
+	case base.RString:
+		return &base.RBytes{Buf: []byte(val)}, true, nil
+	case base.RInt:
+		return &base.RBytes{Buf: []byte(val.String())}, true, nil
+	}
+	return nil, false, redis.TypeErrReply
+}
+
+const (
+	setNX = 1 << iota
+	setXX
+	setGet
+	setKeepTTL
+	setPersist
+	setExpire
+)
+
+// parseSetOpts 解析 set 和 getex 的选项，返回选项和过期时间的unix毫秒时间戳
+// isGetEx 为true时只接受 EX|PX|EXAT|PXAT|PERSIST
+func parseSetOpts(cmd string, opts []string, isGetEx bool) (int, int64, base.Reply) {
+	flags := 0
+	var ms int64
+	for i := 0; i < len(opts); i++ {
+		opt := strings.ToLower(opts[i])
+		switch {
+		case opt == "nx" && !isGetEx && flags&setXX == 0:
+			flags |= setNX
+		case opt == "xx" && !isGetEx && flags&setNX == 0:
+			flags |= setXX
+		case opt == "get" && !isGetEx:
+			flags |= setGet
+		case opt == "keepttl" && !isGetEx && flags&setExpire == 0:
+			flags |= setKeepTTL
+		case opt == "persist" && isGetEx && flags&setExpire == 0:
+			flags |= setPersist
+		case (opt == "ex" || opt == "px" || opt == "exat" || opt == "pxat") &&
+			flags&(setKeepTTL|setPersist|setExpire) == 0 && i+1 < len(opts):
+			n, err := strconv.ParseInt(opts[i+1], 10, 64)
+			if err != nil {
+				return 0, 0, redis.IntErrReply
+			}
+			if n <= 0 {
+				return 0, 0, redis.ErrReply("ERR invalid expire time in '" + strings.ToLower(cmd) + "' command")
+			}
+			unit := time.Second
+			if opt[0] == 'p' {
+				unit = time.Millisecond
+			}
+			var errReply base.Reply
+			ms, errReply = expireAtMs(cmd, n, unit, strings.HasSuffix(opt, "at"))
+			if errReply != nil {
+				return 0, 0, errReply
+			}
+			flags |= setExpire
+			i++
+		default:
+			return 0, 0, redis.ErrReply("ERR syntax error")
+		}
+	}
+	return flags, ms, nil
+}
+
+// setGeneric set 系列命令的实现，ms 是过期时间的unix毫秒时间戳，flags 中有 setExpire 时才有效
+// 传播给slave时过期时间统一改写成 PXAT，避免slave上重放时时间有偏差
+func setGeneric(c *tcp.RegisConn, key, val string, flags int, ms int64) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	old, hasOld, errReply := getRString(db, key)
+	if errReply != nil && flags&setGet != 0 {
+		return errReply
+	}
+	oldReply := base.Reply(redis.OkReply)
+	if flags&setGet != 0 {
+		oldReply = redis.NilReply
+		if hasOld {
+			oldReply = redis.BulkReply([]byte(old))
+		}
+	}
+
+	_, exists := db.GetData(key)
+	if (flags&setNX != 0 && exists) || (flags&setXX != 0 && !exists) {
+		c.Rewrite()
+		if flags&setGet != 0 {
+			return oldReply
+		}
+		return redis.NilReply
+	}
+
+	switch {
+	case flags&setKeepTTL != 0:
+		db.PutData(key, base.NewString(val))
+		c.Rewrite([]string{"set", key, val, "keepttl"})
+		notifyKeyspaceEvent(notifyString, "set", key, c.DBIndex)
+	case flags&setExpire != 0 && ms <= time.Now().UnixMilli():
+		if db.RemoveData(key) > 0 {
+			notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+		}
+		c.Rewrite([]string{"del", key})
+	case flags&setExpire != 0:
+		setKey(db, key, base.NewString(val))
+		db.SetExpire(key, time.UnixMilli(ms))
+		c.Rewrite([]string{"set", key, val, "pxat", strconv.FormatInt(ms, 10)})
+		notifyKeyspaceEvent(notifyString, "set", key, c.DBIndex)
+		notifyKeyspaceEvent(notifyGeneric, "expire", key, c.DBIndex)
+	default:
+		setKey(db, key, base.NewString(val))
+		c.Rewrite([]string{"set", key, val})
+		notifyKeyspaceEvent(notifyString, "set", key, c.DBIndex)
+	}
+	return oldReply
+}
+
+// Set set key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|KEEPTTL]
+func Set(c *tcp.RegisConn, args []string) base.Reply {
+	flags, ms, errReply := parseSetOpts(args[0], args[3:], false)
+	if errReply != nil {
+		return errReply
+	}
+	return setGeneric(c, args[1], args[2], flags, ms)
+}
+
+// SetNX setnx key value
+func SetNX(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	if _, ok := db.GetData(args[1]); ok {
+		c.Rewrite()
+		return redis.IntReply(0)
+	}
+	setKey(db, args[1], base.NewString(args[2]))
+	notifyKeyspaceEvent(notifyString, "set", args[1], c.DBIndex)
+	return redis.IntReply(1)
+}
+
+// setExGeneric setex/psetex key time value
+func setExGeneric(c *tcp.RegisConn, args []string, unit time.Duration) base.Reply {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	if n <= 0 {
+		return redis.ErrReply("ERR invalid expire time in '" + strings.ToLower(args[0]) + "' command")
+	}
+	ms, errReply := expireAtMs(args[0], n, unit, false)
+	if errReply != nil {
+		return errReply
+	}
+	return setGeneric(c, args[1], args[3], setExpire, ms)
+}
+
+func SetEX(c *tcp.RegisConn, args []string) base.Reply {
+	return setExGeneric(c, args, time.Second)
+}
+
+func PSetEX(c *tcp.RegisConn, args []string) base.Reply {
+	return setExGeneric(c, args, time.Millisecond)
+}
+
+func Get(c *tcp.RegisConn, args []string) base.Reply {
+	val, ok, errReply := getRString(tcp.Server.DB.GetSDB(c.DBIndex), args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		return redis.NilReply
+	}
+	return redis.BulkReply(utils.InterfaceToBytes(val))
+}
+
+// GetSet getset key value，设置新值并返回旧值，key原有的过期时间被清掉
+func GetSet(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	old, ok, errReply := getRString(db, args[1])
+	if errReply != nil {
+		return errReply
+	}
+	setKey(db, args[1], base.NewString(args[2]))
+	notifyKeyspaceEvent(notifyString, "set", args[1], c.DBIndex)
+	if !ok {
+		return redis.NilReply
+	}
+	return redis.BulkReply([]byte(old))
+}
+
+// GetDel getdel key，返回key的值并删除key
+func GetDel(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, ok, errReply := getRString(db, args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		c.Rewrite()
+		return redis.NilReply
+	}
+	db.RemoveData(args[1])
+	c.Rewrite([]string{"del", args[1]})
+	notifyKeyspaceEvent(notifyGeneric, "del", args[1], c.DBIndex)
+	return redis.BulkReply([]byte(val))
+}
+
+// GetEX getex key [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|PERSIST]
+// 不带选项时等同于 get，不传播给slave
+func GetEX(c *tcp.RegisConn, args []string) base.Reply {
+	flags, ms, errReply := parseSetOpts(args[0], args[2:], true)
+	if errReply != nil {
+		return errReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	key := args[1]
+	val, ok, errReply := getRString(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		c.Rewrite()
+		return redis.NilReply
+	}
+
+	switch {
+	case flags&setExpire != 0 && ms <= time.Now().UnixMilli():
+		db.RemoveData(key)
+		c.Rewrite([]string{"del", key})
+		notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+	case flags&setExpire != 0:
+		db.SetExpire(key, time.UnixMilli(ms))
+		c.Rewrite([]string{"pexpireat", key, strconv.FormatInt(ms, 10)})
+		notifyKeyspaceEvent(notifyGeneric, "expire", key, c.DBIndex)
+	case flags&setPersist != 0:
+		if db.Persist(key) > 0 {
+			notifyKeyspaceEvent(notifyGeneric, "persist", key, c.DBIndex)
+		}
+		c.Rewrite([]string{"persist", key})
+	default:
+		c.Rewrite()
+	}
+	return redis.BulkReply([]byte(val))
+}
+
+func MSet(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args)%2 == 0 {
+		return redis.ArgNumErrReply(args[0])
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	for i := 1; i+1 < len(args); i += 2 {
+		setKey(db, args[i], base.NewString(args[i+1]))
+		notifyKeyspaceEvent(notifyString, "set", args[i], c.DBIndex)
+	}
+	return redis.OkReply
+}
+
+// MGet mget key [key ...]，key不存在或者不是字符串时返回nil
+func MGet(c *tcp.RegisConn, args []string) base.Reply {
+	ret := make([]interface{}, 0, len(args)-1)
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	for i := 1; i < len(args); i++ {
+		val, ok, errReply := getRString(db, args[i])
+		if !ok || errReply != nil {
+			ret = append(ret, nil)
+		} else {
+			ret = append(ret, val)
+		}
+	}
+	return redis.ArrayReply(ret)
+}
+
+// MSetNX msetnx key value [key value ...]，只要有一个key已经存在，就什么都不做
+func MSetNX(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args)%2 == 0 {
+		return redis.ArgNumErrReply(args[0])
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := db.GetData(args[i]); ok {
+			c.Rewrite()
+			return redis.IntReply(0)
+		}
+	}
+	for i := 1; i+1 < len(args); i += 2 {
+		setKey(db, args[i], base.NewString(args[i+1]))
+		notifyKeyspaceEvent(notifyString, "set", args[i], c.DBIndex)
+	}
+	return redis.IntReply(1)
+}
+
+// parseStrictInt 和redis的 string2ll 一样只接受规范形式的整数，"+1", "01", " 1", "-0" 都不是整数
+func parseStrictInt(s string) (int64, bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != s {
+		return 0, false
+	}
+	return n, true
+}
+
+// incrDecr 给key的整数值加上incr，key不存在时视为0，过期时间不变
+// 整数编码的值直接取出来运算，不用再解析字符串
+func incrDecr(c *tcp.RegisConn, key string, incr int64) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	var cur int64
+	if v, ok := db.GetData(key); ok {
+		switch val := v.(type) {
+		case base.RInt:
+			cur = int64(val)
+		case base.RString, *base.RBytes:
+			n, ok := parseStrictInt(utils.InterfaceToString(val))
+			if !ok {
+				return redis.IntErrReply
+			}
+			cur = n
+		default:
+			return redis.TypeErrReply
+		}
+	}
+	if (incr > 0 && cur > math.MaxInt64-incr) || (incr < 0 && cur < math.MinInt64-incr) {
+		return redis.ErrReply("ERR increment or decrement would overflow")
+	}
+	cur += incr
+	db.PutData(key, base.NewInt(cur))
+	notifyKeyspaceEvent(notifyString, "incrby", key, c.DBIndex)
+	return redis.Int64Reply(cur)
+}
+
+func Incr(c *tcp.RegisConn, args []string) base.Reply {
+	return incrDecr(c, args[1], 1)
+}
+
+func Decr(c *tcp.RegisConn, args []string) base.Reply {
+	return incrDecr(c, args[1], -1)
+}
+
+func IncrBy(c *tcp.RegisConn, args []string) base.Reply {
+	incr, ok := parseStrictInt(args[2])
+	if !ok {
+		return redis.IntErrReply
+	}
+	return incrDecr(c, args[1], incr)
+}
+
+func DecrBy(c *tcp.RegisConn, args []string) base.Reply {
+	decr, ok := parseStrictInt(args[2])
+	if !ok {
+		return redis.IntErrReply
+	}
+	if decr == math.MinInt64 {
+		return redis.ErrReply("ERR decrement would overflow")
+	}
+	return incrDecr(c, args[1], -decr)
+}
+
+// IncrByFloat incrbyfloat key increment
+// 浮点数运算在不同机器上结果可能不同，所以传播给slave时改写成 set key value keepttl
+func IncrByFloat(c *tcp.RegisConn, args []string) base.Reply {
+	incr, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || math.IsNaN(incr) || math.IsInf(incr, 0) {
+		return redis.FloatErrReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, ok, errReply := getRString(db, args[1])
+	if errReply != nil {
+		return errReply
+	}
+	var cur float64
+	if ok {
+		cur, err = strconv.ParseFloat(string(val), 64)
+		if err != nil || math.IsNaN(cur) || math.IsInf(cur, 0) {
+			return redis.ErrReply("ERR value is not a valid float")
+		}
+	}
+	cur += incr
+	if math.IsNaN(cur) || math.IsInf(cur, 0) {
+		return redis.ErrReply("ERR increment would produce NaN or Infinity")
+	}
+	ret := strconv.FormatFloat(cur, 'f', -1, 64)
+	db.PutData(args[1], base.NewString(ret))
+	c.Rewrite([]string{"set", args[1], ret, "keepttl"})
+	notifyKeyspaceEvent(notifyString, "incrbyfloat", args[1], c.DBIndex)
+	return redis.BulkStrReply(ret)
+}
+
+// maxStringSize 字符串的最大长度 512MB
+const maxStringSize = 512 * 1024 * 1024
+
+// Append append key value，返回追加后字符串的长度
+func Append(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, _, errReply := getRBytesForWrite(db, args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if len(val.Buf)+len(args[2]) > maxStringSize {
+		return redis.ErrReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	val.Buf = append(val.Buf, args[2]...)
+	db.PutData(args[1], val)
+	notifyKeyspaceEvent(notifyString, "append", args[1], c.DBIndex)
+	return redis.IntReply(len(val.Buf))
+}
+
+func StrLen(c *tcp.RegisConn, args []string) base.Reply {
+	val, _, errReply := getStringBytes(tcp.Server.DB.GetSDB(c.DBIndex), args[1])
+	if errReply != nil {
+		return errReply
+	}
+	return redis.IntReply(len(val))
+}
+
+// GetRange getrange key start end，start 和 end 都是闭区间，负数表示从末尾开始算
+func GetRange(c *tcp.RegisConn, args []string) base.Reply {
+	start, err1 := strconv.ParseInt(args[2], 10, 64)
+	end, err2 := strconv.ParseInt(args[3], 10, 64)
+	if err1 != nil || err2 != nil {
+		return redis.IntErrReply
+	}
+	val, _, errReply := getRString(tcp.Server.DB.GetSDB(c.DBIndex), args[1])
+	if errReply != nil {
+		return errReply
+	}
+	size := int64(len(val))
+	if start < 0 && end < 0 && start > end {
+		return redis.BulkReply([]byte{})
+	}
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if size == 0 || start > end {
+		return redis.BulkReply([]byte{})
+	}
+	return redis.BulkReply([]byte(val[start : end+1]))
+}
+
+// SetRange setrange key offset value，从offset开始覆盖字符串，长度不够时用0补齐
+func SetRange(c *tcp.RegisConn, args []string) base.Reply {
+	offset, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	if offset < 0 {
+		return redis.ErrReply("ERR offset is out of range")
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	part := args[3]
+	// 不用写入数据时不会创建key
+	if len(part) == 0 {
+		buf, _, errReply := getStringBytes(db, args[1])
+		if errReply != nil {
+			return errReply
+		}
+		c.Rewrite()
+		return redis.IntReply(len(buf))
+	}
+	if offset+int64(len(part)) > maxStringSize {
+		return redis.ErrReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	val, ok, errReply := getRBytesForWrite(db, args[1])
+	if errReply != nil {
+		return errReply
+	}
+	val.Buf = growBytes(val.Buf, offset+int64(len(part)))
+	copy(val.Buf[offset:], part)
+	if ok {
+		db.PutData(args[1], val)
+	} else {
+		setKey(db, args[1], val)
+	}
+	notifyKeyspaceEvent(notifyString, "setrange", args[1], c.DBIndex)
+	return redis.IntReply(len(val.Buf))
+}
+
+// lcsMatch LCS IDX 返回的一段匹配，区间都是闭区间
+type lcsMatch struct {
+	aStart, aEnd int
+	bStart, bEnd int
+}
+
+// LCS lcs key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN]
+// 求两个字符串的最长公共子序列，key不存在时视为空串
+func LCS(c *tcp.RegisConn, args []string) base.Reply {
+	getLen, getIdx, withMatchLen := false, false, false
+	minMatchLen := 0
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "len":
+			getLen = true
+		case "idx":
+			getIdx = true
+		case "withmatchlen":
+			withMatchLen = true
+		case "minmatchlen":
+			if i+1 >= len(args) {
+				return redis.ErrReply("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redis.IntErrReply
+			}
+			if n > 0 && n <= math.MaxInt32 {
+				minMatchLen = int(n)
+			}
+			i++
+		default:
+			return redis.ErrReply("ERR syntax error")
+		}
+	}
+	if getLen && getIdx {
+		return redis.ErrReply("ERR If you want both the length and indexes, please just use IDX.")
+	}
+
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	a, _, errReply := getRString(db, args[1])
+	if errReply != nil {
+		return redis.ErrReply("ERR The specified keys must contain string values")
+	}
+	b, _, errReply := getRString(db, args[2])
+	if errReply != nil {
+		return redis.ErrReply("ERR The specified keys must contain string values")
+	}
+
+	// dp[i][j] 是 a[:i] 和 b[:j] 的最长公共子序列长度
+	// 和redis一样，dp 表占用的内存不能超过 proto-max-bulk-len，这里取字符串的最大长度
+	aLen, bLen := len(a), len(b)
+	if aLen+1 > maxStringSize/4/(bLen+1) {
+		return redis.ErrReply("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	}
+	dp := make([][]uint32, aLen+1)
+	for i := range dp {
+		dp[i] = make([]uint32, bLen+1)
+	}
+	for i := 1; i <= aLen; i++ {
+		for j := 1; j <= bLen; j++ {
+			if a[i-1] == b[j-1] {
+				dp[i][j] = dp[i-1][j-1] + 1
+			} else if dp[i-1][j] > dp[i][j-1] {
+				dp[i][j] = dp[i-1][j]
+			} else {
+				dp[i][j] = dp[i][j-1]
+			}
+		}
+	}
+	lcsLen := int(dp[aLen][bLen])
+	if getLen {
+		return redis.IntReply(lcsLen)
+	}
+
+	// 从末尾往前回溯，连续匹配的部分合并成一段
+	result := make([]byte, lcsLen)
+	var matches []lcsMatch
+	var cur *lcsMatch
+	emit := func() {
+		if cur != nil && cur.aEnd-cur.aStart+1 >= minMatchLen {
+			matches = append(matches, *cur)
+		}
+		cur = nil
+	}
+	idx := lcsLen
+	for i, j := aLen, bLen; i > 0 && j > 0; {
+		if a[i-1] == b[j-1] {
+			idx--
+			result[idx] = a[i-1]
+			if cur != nil && cur.aStart == i && cur.bStart == j {
+				cur.aStart, cur.bStart = i-1, j-1
+			} else {
+				emit()
+				cur = &lcsMatch{aStart: i - 1, aEnd: i - 1, bStart: j - 1, bEnd: j - 1}
+			}
+			i--
+			j--
+			continue
+		}
+		emit()
+		if dp[i-1][j] > dp[i][j-1] {
+			i--
+		} else {
+			j--
+		}
+	}
+	emit()
+
+	if !getIdx {
+		return redis.BulkReply(result)
+	}
+	items := make([]base.Reply, 0, len(matches))
+	for _, m := range matches {
+		item := []base.Reply{
+			redis.MultiReply([]base.Reply{redis.IntReply(m.aStart), redis.IntReply(m.aEnd)}),
+			redis.MultiReply([]base.Reply{redis.IntReply(m.bStart), redis.IntReply(m.bEnd)}),
+		}
+		if withMatchLen {
+			item = append(item, redis.IntReply(m.aEnd-m.aStart+1))
+		}
+		items = append(items, redis.MultiReply(item))
+	}
+	var matchesReply base.Reply = redis.EmptyArrayReply
+	if len(items) > 0 {
+		matchesReply = redis.MultiReply(items)
+	}
+	return redis.MultiReply([]base.Reply{
+		redis.BulkStrReply("matches"), matchesReply,
+		redis.BulkStrReply("len"), redis.IntReply(lcsLen),
+	})
+}
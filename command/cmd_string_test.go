@@ -0,0 +1,153 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"strings"
+	"testing"
+)
+
+func TestLCS(t *testing.T) {
+	c := newTestConn()
+	call(c, "mset", "lcs1", "ohmytext", "lcs2", "mynewtext")
+	reply, _ := call(c, "lcs", "lcs1", "lcs2")
+	checkReply(t, redis.BulkStrReply("mytext"), reply)
+	reply, _ = call(c, "lcs", "lcs1", "lcs2", "len")
+	checkReply(t, redis.IntReply(6), reply)
+
+	// dp 表太大时报错，不能真的去分配
+	big := strings.Repeat("a", 20000)
+	call(c, "mset", "lcs3", big, "lcs4", big)
+	reply, _ = call(c, "lcs", "lcs3", "lcs4", "len")
+	checkReply(t, redis.ErrReply("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len"), reply)
+}
+
+func TestAppend_InPlace(t *testing.T) {
+	c := newTestConn()
+	c.DBIndex = 8
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	reply, _ := call(c, "append", "ap", "12")
+	checkReply(t, redis.IntReply(2), reply)
+	v, _ := db.GetData("ap")
+	val, ok := v.(*base.RBytes)
+	if !ok {
+		t.Fatalf("append should store raw bytes, get %T", v)
+	}
+	for i := 0; i < 100; i++ {
+		call(c, "append", "ap", "x")
+	}
+	call(c, "setrange", "ap", "1", "ab")
+	if v, _ := db.GetData("ap"); v != val || string(val.Buf) != "1ab"+strings.Repeat("x", 99) {
+		t.Fatalf("append and setrange should modify in place, get %v", v)
+	}
+
+	// bgsave 期间存盘的值不能被修改
+	db.SetStatus(base.WorldFrozen)
+	defer db.SetStatus(base.WorldNormal)
+	call(c, "append", "ap", "y")
+	call(c, "setrange", "ap", "0", "z")
+	if string(val.Buf) != "1ab"+strings.Repeat("x", 99) {
+		t.Errorf("value being saved was modified: %q", val.Buf)
+	}
+	reply, _ = call(c, "get", "ap")
+	checkReply(t, redis.BulkStrReply("zab"+strings.Repeat("x", 99)+"y"), reply)
+}
+
+func TestSetRange(t *testing.T) {
+	c := newTestConn()
+	reply, _ := call(c, "setrange", "sr", "3", "ab")
+	checkReply(t, redis.IntReply(5), reply)
+	reply, _ = call(c, "get", "sr")
+	checkReply(t, redis.BulkStrReply("\x00\x00\x00ab"), reply)
+
+	// 不写入数据时不创建key
+	reply, _ = call(c, "setrange", "srnokey", "3", "")
+	checkReply(t, redis.IntReply(0), reply)
+	reply, _ = call(c, "exists", "srnokey")
+	checkReply(t, redis.IntReply(0), reply)
+
+	call(c, "set", "srint", "1234")
+	call(c, "setrange", "srint", "1", "0")
+	reply, _ = call(c, "incr", "srint")
+	checkReply(t, redis.IntReply(1035), reply)
+}
+
+func TestIncr_StrictInt(t *testing.T) {
+	c := newTestConn()
+	for _, v := range []string{"+1", "01", "-0", " 1", "1 ", "1.0", ""} {
+		call(c, "set", "incrs", v)
+		reply, _ := call(c, "incr", "incrs")
+		checkReply(t, redis.IntErrReply, reply)
+		reply, _ = call(c, "incrby", "incrn", v)
+		checkReply(t, redis.IntErrReply, reply)
+		reply, _ = call(c, "decrby", "incrn", v)
+		checkReply(t, redis.IntErrReply, reply)
+	}
+	call(c, "set", "incrs", "-10")
+	reply, _ := call(c, "incrby", "incrs", "-5")
+	checkReply(t, redis.IntReply(-15), reply)
+	call(c, "append", "incrs", "0")
+	reply, _ = call(c, "decr", "incrs")
+	checkReply(t, redis.IntReply(-151), reply)
+}
+
+func TestIntEncoding(t *testing.T) {
+	c := newTestConn()
+	tests := []struct {
+		args     []string
+		key      string
+		encoding string
+		value    string
+	}{
+		{[]string{"set", "ienc", "123"}, "ienc", "int", "123"},
+		{[]string{"set", "ienc", "0123"}, "ienc", "embstr", "0123"},
+		{[]string{"set", "ienc", "-9223372036854775808"}, "ienc", "int", "-9223372036854775808"},
+		{[]string{"set", "ienc", "9223372036854775808"}, "ienc", "embstr", "9223372036854775808"},
+		{[]string{"set", "ienc", strings.Repeat("a", 45)}, "ienc", "raw", strings.Repeat("a", 45)},
+		{[]string{"set", "ienc", "10"}, "ienc", "int", "10"},
+		{[]string{"incrby", "ienc", "-20"}, "ienc", "int", "-10"},
+		{[]string{"append", "ienc", "0"}, "ienc", "raw", "-100"},
+		{[]string{"incr", "ienc"}, "ienc", "int", "-99"},
+		{[]string{"mset", "ienc", "5", "ienc2", "x"}, "ienc", "int", "5"},
+		{[]string{"getset", "ienc", "7"}, "ienc", "int", "7"},
+		{[]string{"incrbyfloat", "ienc", "1.5"}, "ienc", "embstr", "8.5"},
+		{[]string{"incrbyfloat", "ienc", "0.5"}, "ienc", "int", "9"},
+	}
+	for _, tt := range tests {
+		call(c, tt.args...)
+		reply, _ := call(c, "object", "encoding", tt.key)
+		checkReply(t, redis.BulkStrReply(tt.encoding), reply)
+		reply, _ = call(c, "get", tt.key)
+		checkReply(t, redis.BulkStrReply(tt.value), reply)
+	}
+
+	// 共享的小整数和redis一样引用计数为 INT_MAX
+	call(c, "set", "ienc", "100")
+	reply, _ := call(c, "object", "refcount", "ienc")
+	checkReply(t, redis.IntReply(2147483647), reply)
+	call(c, "set", "ienc", "10000")
+	reply, _ = call(c, "object", "refcount", "ienc")
+	checkReply(t, redis.IntReply(1), reply)
+
+	call(c, "set", "ienc", "9223372036854775807")
+	reply, _ = call(c, "incr", "ienc")
+	checkReply(t, redis.ErrReply("ERR increment or decrement would overflow"), reply)
+	reply, _ = call(c, "object", "encoding", "nokey")
+	checkReply(t, redis.NilReply, reply)
+	call(c, "del", "ienc", "ienc2")
+}
+
+func TestIntEncoding_RDB(t *testing.T) {
+	c := newTestConn()
+	call(c, "del", "iencrdb2")
+	call(c, "set", "iencrdb", "-42")
+	call(c, "incrby", "iencrdb2", "123456")
+	reloadRDB(t)
+	reply, _ := call(c, "mget", "iencrdb", "iencrdb2")
+	checkReply(t, redis.StringsReply([]string{"-42", "123456"}), reply)
+	reply, _ = call(c, "object", "encoding", "iencrdb2")
+	checkReply(t, redis.BulkStrReply("int"), reply)
+	reply, _ = call(c, "incr", "iencrdb")
+	checkReply(t, redis.IntReply(-41), reply)
+}
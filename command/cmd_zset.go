@@ -0,0 +1,919 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/ds"
+	"code/regis/lib/utils"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// base.RZSet 操作
+
+const (
+	zRangeByRank = iota
+	zRangeByScore
+	zRangeByLex
+)
+
+// zRangeSpec zrange 系列命令的选项
+type zRangeSpec struct {
+	by         int
+	rev        bool
+	withScores bool
+	limit      bool
+	offset     int64
+	count      int64 // count < 0 表示不限数量
+}
+
+// getRZSet 获取key对应的有序集合，key不存在时返回nil，类型不对时返回 redis.TypeErrReply
+// forWrite 为true时，返回的有序集合可以被原地修改
+func getRZSet(db base.SDB, key string, forWrite bool) (base.RZSet, base.Reply) {
+	var v interface{}
+	var ok bool
+	if forWrite {
+		v, ok = db.GetDataForWrite(key)
+	} else {
+		v, ok = db.GetData(key)
+	}
+	if !ok {
+		return nil, nil
+	}
+	val, ok := v.(base.RZSet)
+	if !ok {
+		return nil, redis.TypeErrReply
+	}
+	return val, nil
+}
+
+// putRZSet 写回修改后的有序集合并发出event通知，为空时删除key并发出del通知
+func putRZSet(c *tcp.RegisConn, db base.SDB, key string, val base.RZSet, event string) {
+	notifyKeyspaceEvent(notifyZSet, event, key, c.DBIndex)
+	if val.Len() == 0 {
+		db.RemoveData(key)
+		notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+		return
+	}
+	db.PutData(key, val)
+}
+
+// parseScore 解析分数，不允许NaN
+func parseScore(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// parseScoreBorder 解析分数区间的边界，比如 1.5, (1.5, -inf, +inf
+func parseScoreBorder(s string) (base.ScoreBorder, bool) {
+	border := base.ScoreBorder{}
+	if strings.HasPrefix(s, "(") {
+		border.Exclude = true
+		s = s[1:]
+	}
+	f, ok := parseScore(s)
+	if !ok {
+		return border, false
+	}
+	border.Value = f
+	return border, true
+}
+
+// parseLexBorder 解析字典序区间的边界，比如 [a, (a, -, +
+func parseLexBorder(s string) (base.LexBorder, bool) {
+	switch {
+	case s == "-":
+		return base.LexBorder{Inf: -1}, true
+	case s == "+":
+		return base.LexBorder{Inf: 1}, true
+	case strings.HasPrefix(s, "["):
+		return base.LexBorder{Value: s[1:]}, true
+	case strings.HasPrefix(s, "("):
+		return base.LexBorder{Value: s[1:], Exclude: true}, true
+	}
+	return base.LexBorder{}, false
+}
+
+// parseZRangeSpec 解析 [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func parseZRangeSpec(opts []string) (*zRangeSpec, base.Reply) {
+	spec := &zRangeSpec{by: zRangeByRank, count: -1}
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToLower(opts[i]) {
+		case "byscore":
+			spec.by = zRangeByScore
+		case "bylex":
+			spec.by = zRangeByLex
+		case "rev":
+			spec.rev = true
+		case "withscores":
+			spec.withScores = true
+		case "limit":
+			if i+2 >= len(opts) {
+				return nil, redis.ErrReply("ERR syntax error")
+			}
+			offset, err := strconv.ParseInt(opts[i+1], 10, 64)
+			if err != nil {
+				return nil, redis.IntErrReply
+			}
+			count, err := strconv.ParseInt(opts[i+2], 10, 64)
+			if err != nil {
+				return nil, redis.IntErrReply
+			}
+			spec.limit = true
+			spec.offset = offset
+			spec.count = count
+			i += 2
+		default:
+			return nil, redis.ErrReply("ERR syntax error")
+		}
+	}
+	if spec.limit && spec.by == zRangeByRank {
+		return nil, redis.ErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.by == zRangeByLex {
+		return nil, redis.ErrReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return spec, nil
+}
+
+// normalizeRank 将可以为负数的 [start, stop] 下标转化为合法的下标，区间为空时返回false
+func normalizeRank(start, stop, length int64) (int64, int64, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return start, stop, true
+}
+
+// zRange 按spec取出区间内的成员，min, max 是命令中的原始参数，REV时命令中先写max再写min
+func zRange(zset base.RZSet, min, max string, spec *zRangeSpec) ([]base.ZEntry, base.Reply) {
+	if spec.rev && spec.by != zRangeByRank {
+		min, max = max, min
+	}
+	switch spec.by {
+	case zRangeByScore:
+		minBorder, ok1 := parseScoreBorder(min)
+		maxBorder, ok2 := parseScoreBorder(max)
+		if !ok1 || !ok2 {
+			return nil, redis.ErrReply("ERR min or max is not a float")
+		}
+		if zset == nil || spec.offset < 0 {
+			return nil, nil
+		}
+		return zset.RangeByScore(minBorder, maxBorder, spec.offset, spec.count, spec.rev), nil
+	case zRangeByLex:
+		minBorder, ok1 := parseLexBorder(min)
+		maxBorder, ok2 := parseLexBorder(max)
+		if !ok1 || !ok2 {
+			return nil, redis.ErrReply("ERR min or max not valid string range item")
+		}
+		if zset == nil || spec.offset < 0 {
+			return nil, nil
+		}
+		return zset.RangeByLex(minBorder, maxBorder, spec.offset, spec.count, spec.rev), nil
+	default:
+		start, err := strconv.ParseInt(min, 10, 64)
+		if err != nil {
+			return nil, redis.IntErrReply
+		}
+		stop, err := strconv.ParseInt(max, 10, 64)
+		if err != nil {
+			return nil, redis.IntErrReply
+		}
+		if zset == nil {
+			return nil, nil
+		}
+		start, stop, ok := normalizeRank(start, stop, zset.Len())
+		if !ok {
+			return nil, nil
+		}
+		return zset.RangeByRank(start, stop, spec.rev), nil
+	}
+}
+
+func zEntriesReply(entries []base.ZEntry, withScores bool) base.Reply {
+	ret := make([]string, 0, len(entries)*2)
+	for i := range entries {
+		ret = append(ret, entries[i].Member)
+		if withScores {
+			ret = append(ret, utils.FormatFloat(entries[i].Score))
+		}
+	}
+	return redis.StringsReply(ret)
+}
+
+// zRangeGeneric zrange 系列命令的公共实现，opts 是 min max 之后的选项
+func zRangeGeneric(c *tcp.RegisConn, key, min, max string, opts []string) base.Reply {
+	spec, errReply := parseZRangeSpec(opts)
+	if errReply != nil {
+		return errReply
+	}
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), key, false)
+	if errReply != nil {
+		return errReply
+	}
+	entries, errReply := zRange(zset, min, max, spec)
+	if errReply != nil {
+		return errReply
+	}
+	return zEntriesReply(entries, spec.withScores)
+}
+
+// ZAdd zadd key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func ZAdd(c *tcp.RegisConn, args []string) base.Reply {
+	var nx, xx, gt, lt, ch, incr bool
+	i := 2
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "gt":
+			gt = true
+		case "lt":
+			lt = true
+		case "ch":
+			ch = true
+		case "incr":
+			incr = true
+		default:
+			break loop
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	if nx && xx {
+		return redis.ErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (gt && nx) || (lt && nx) || (gt && lt) {
+		return redis.ErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) > 2 {
+		return redis.ErrReply("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		score, ok := parseScore(pairs[j*2])
+		if !ok {
+			return redis.FloatErrReply
+		}
+		scores[j] = score
+	}
+
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	zset, errReply := getRZSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		if xx && incr {
+			return redis.NilReply
+		}
+		if xx {
+			return redis.IntReply(0)
+		}
+		zset = ds.NewRZSet()
+	}
+
+	added, updated := 0, 0
+	aborted := false
+	var retScore float64
+	for j := range scores {
+		score, member := scores[j], pairs[j*2+1]
+		cur, exists := zset.Score(member)
+		if !exists {
+			if xx {
+				aborted = true
+				continue
+			}
+			added += zset.Add(member, score)
+			retScore = score
+			continue
+		}
+		if nx {
+			aborted = true
+			continue
+		}
+		if incr {
+			score += cur
+			if math.IsNaN(score) {
+				return redis.ErrReply("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if (gt && score <= cur) || (lt && score >= cur) {
+			aborted = true
+			continue
+		}
+		if score != cur {
+			zset.Add(member, score)
+			updated++
+		}
+		retScore = score
+	}
+	if zset.Len() > 0 {
+		db.PutData(args[1], zset)
+	}
+	if added+updated > 0 {
+		event := "zadd"
+		if incr {
+			event = "zincr"
+		}
+		notifyKeyspaceEvent(notifyZSet, event, args[1], c.DBIndex)
+	}
+
+	if incr {
+		if aborted {
+			return redis.NilReply
+		}
+		return redis.BulkStrReply(utils.FormatFloat(retScore))
+	}
+	if ch {
+		return redis.IntReply(added + updated)
+	}
+	return redis.IntReply(added)
+}
+
+// ZIncrBy zincrby key increment member
+func ZIncrBy(c *tcp.RegisConn, args []string) base.Reply {
+	incr, ok := parseScore(args[2])
+	if !ok {
+		return redis.FloatErrReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	zset, errReply := getRZSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		zset = ds.NewRZSet()
+	}
+	cur, _ := zset.Score(args[3])
+	score := cur + incr
+	if math.IsNaN(score) {
+		return redis.ErrReply("ERR resulting score is not a number (NaN)")
+	}
+	zset.Add(args[3], score)
+	db.PutData(args[1], zset)
+	notifyKeyspaceEvent(notifyZSet, "zincr", args[1], c.DBIndex)
+	return redis.BulkStrReply(utils.FormatFloat(score))
+}
+
+func ZRem(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	zset, errReply := getRZSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.IntReply(0)
+	}
+	removed := 0
+	for i := 2; i < len(args); i++ {
+		removed += zset.Remove(args[i])
+	}
+	if removed > 0 {
+		putRZSet(c, db, args[1], zset, "zrem")
+	}
+	return redis.IntReply(removed)
+}
+
+func ZScore(c *tcp.RegisConn, args []string) base.Reply {
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.NilReply
+	}
+	score, ok := zset.Score(args[2])
+	if !ok {
+		return redis.NilReply
+	}
+	return redis.BulkStrReply(utils.FormatFloat(score))
+}
+
+func ZMScore(c *tcp.RegisConn, args []string) base.Reply {
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	ret := make([]interface{}, 0, len(args)-2)
+	for i := 2; i < len(args); i++ {
+		if zset == nil {
+			ret = append(ret, nil)
+			continue
+		}
+		if score, ok := zset.Score(args[i]); ok {
+			ret = append(ret, utils.FormatFloat(score))
+		} else {
+			ret = append(ret, nil)
+		}
+	}
+	return redis.ArrayReply(ret)
+}
+
+func ZCard(c *tcp.RegisConn, args []string) base.Reply {
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.IntReply(0)
+	}
+	return redis.Int64Reply(zset.Len())
+}
+
+// zRankGeneric zrank key member [WITHSCORE]
+func zRankGeneric(c *tcp.RegisConn, args []string, reverse bool) base.Reply {
+	withScore := false
+	if len(args) == 4 {
+		if strings.ToLower(args[3]) != "withscore" {
+			return redis.ErrReply("ERR syntax error")
+		}
+		withScore = true
+	} else if len(args) > 4 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.NilReply
+	}
+	rank, ok := zset.Rank(args[2], reverse)
+	if !ok {
+		return redis.NilReply
+	}
+	if withScore {
+		score, _ := zset.Score(args[2])
+		return redis.ArrayReply([]interface{}{int(rank), utils.FormatFloat(score)})
+	}
+	return redis.Int64Reply(rank)
+}
+
+func ZRank(c *tcp.RegisConn, args []string) base.Reply {
+	return zRankGeneric(c, args, false)
+}
+
+func ZRevRank(c *tcp.RegisConn, args []string) base.Reply {
+	return zRankGeneric(c, args, true)
+}
+
+// ZRange zrange key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func ZRange(c *tcp.RegisConn, args []string) base.Reply {
+	return zRangeGeneric(c, args[1], args[2], args[3], args[4:])
+}
+
+// ZRevRange zrevrange key start stop [WITHSCORES]
+func ZRevRange(c *tcp.RegisConn, args []string) base.Reply {
+	return zRangeGeneric(c, args[1], args[2], args[3], append([]string{"rev"}, args[4:]...))
+}
+
+// ZRangeByScore zrangebyscore key min max [WITHSCORES] [LIMIT offset count]
+func ZRangeByScore(c *tcp.RegisConn, args []string) base.Reply {
+	return zRangeGeneric(c, args[1], args[2], args[3], append([]string{"byscore"}, args[4:]...))
+}
+
+// ZRevRangeByScore zrevrangebyscore key max min [WITHSCORES] [LIMIT offset count]
+func ZRevRangeByScore(c *tcp.RegisConn, args []string) base.Reply {
+	return zRangeGeneric(c, args[1], args[2], args[3], append([]string{"byscore", "rev"}, args[4:]...))
+}
+
+// ZRangeByLex zrangebylex key min max [LIMIT offset count]
+func ZRangeByLex(c *tcp.RegisConn, args []string) base.Reply {
+	return zRangeGeneric(c, args[1], args[2], args[3], append([]string{"bylex"}, args[4:]...))
+}
+
+// ZRevRangeByLex zrevrangebylex key max min [LIMIT offset count]
+func ZRevRangeByLex(c *tcp.RegisConn, args []string) base.Reply {
+	return zRangeGeneric(c, args[1], args[2], args[3], append([]string{"bylex", "rev"}, args[4:]...))
+}
+
+// ZCount zcount key min max
+func ZCount(c *tcp.RegisConn, args []string) base.Reply {
+	min, ok1 := parseScoreBorder(args[2])
+	max, ok2 := parseScoreBorder(args[3])
+	if !ok1 || !ok2 {
+		return redis.ErrReply("ERR min or max is not a float")
+	}
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.IntReply(0)
+	}
+	return redis.Int64Reply(zset.Count(min, max))
+}
+
+// ZLexCount zlexcount key min max
+func ZLexCount(c *tcp.RegisConn, args []string) base.Reply {
+	min, ok1 := parseLexBorder(args[2])
+	max, ok2 := parseLexBorder(args[3])
+	if !ok1 || !ok2 {
+		return redis.ErrReply("ERR min or max not valid string range item")
+	}
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.IntReply(0)
+	}
+	return redis.Int64Reply(zset.LexCount(min, max))
+}
+
+// ZRemRangeByScore zremrangebyscore key min max
+func ZRemRangeByScore(c *tcp.RegisConn, args []string) base.Reply {
+	min, ok1 := parseScoreBorder(args[2])
+	max, ok2 := parseScoreBorder(args[3])
+	if !ok1 || !ok2 {
+		return redis.ErrReply("ERR min or max is not a float")
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	zset, errReply := getRZSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.IntReply(0)
+	}
+	removed := zset.RemoveRangeByScore(min, max)
+	if removed > 0 {
+		putRZSet(c, db, args[1], zset, "zremrangebyscore")
+	}
+	return redis.Int64Reply(removed)
+}
+
+// ZRemRangeByLex zremrangebylex key min max
+func ZRemRangeByLex(c *tcp.RegisConn, args []string) base.Reply {
+	min, ok1 := parseLexBorder(args[2])
+	max, ok2 := parseLexBorder(args[3])
+	if !ok1 || !ok2 {
+		return redis.ErrReply("ERR min or max not valid string range item")
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	zset, errReply := getRZSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.IntReply(0)
+	}
+	removed := zset.RemoveRangeByLex(min, max)
+	if removed > 0 {
+		putRZSet(c, db, args[1], zset, "zremrangebylex")
+	}
+	return redis.Int64Reply(removed)
+}
+
+// ZRemRangeByRank zremrangebyrank key start stop
+func ZRemRangeByRank(c *tcp.RegisConn, args []string) base.Reply {
+	start, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	stop, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	zset, errReply := getRZSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return redis.IntReply(0)
+	}
+	start, stop, ok := normalizeRank(start, stop, zset.Len())
+	if !ok {
+		return redis.IntReply(0)
+	}
+	removed := zset.RemoveRangeByRank(start, stop)
+	if removed > 0 {
+		putRZSet(c, db, args[1], zset, "zremrangebyrank")
+	}
+	return redis.Int64Reply(removed)
+}
+
+// zPopGeneric zpopmin/zpopmax key [count]
+func zPopGeneric(c *tcp.RegisConn, args []string, max bool) base.Reply {
+	if len(args) > 3 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	var count int64 = 1
+	if len(args) == 3 {
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || n < 0 {
+			return redis.ErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	zset, errReply := getRZSet(db, args[1], true)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil || count == 0 {
+		return redis.EmptyArrayReply
+	}
+	start, stop, _ := normalizeRank(0, count-1, zset.Len())
+	entries := zset.RangeByRank(start, stop, max)
+	if max {
+		zset.RemoveRangeByRank(zset.Len()-stop-1, zset.Len()-1)
+	} else {
+		zset.RemoveRangeByRank(start, stop)
+	}
+	event := "zpopmin"
+	if max {
+		event = "zpopmax"
+	}
+	putRZSet(c, db, args[1], zset, event)
+	return zEntriesReply(entries, true)
+}
+
+func ZPopMin(c *tcp.RegisConn, args []string) base.Reply {
+	return zPopGeneric(c, args, false)
+}
+
+func ZPopMax(c *tcp.RegisConn, args []string) base.Reply {
+	return zPopGeneric(c, args, true)
+}
+
+// ZRandMember zrandmember key [count [WITHSCORES]]
+// count为正数时返回不重复的成员，为负数时成员可以重复，数量为count的绝对值
+func ZRandMember(c *tcp.RegisConn, args []string) base.Reply {
+	if len(args) > 4 {
+		return redis.ErrReply("ERR syntax error")
+	}
+	var count int64 = 1
+	if len(args) >= 3 {
+		n, errReply := parseRandCount(args[2])
+		if errReply != nil {
+			return errReply
+		}
+		count = n
+	}
+	withScores := false
+	if len(args) == 4 {
+		if strings.ToLower(args[3]) != "withscores" {
+			return redis.ErrReply("ERR syntax error")
+		}
+		withScores = true
+	}
+
+	zset, errReply := getRZSet(tcp.Server.DB.GetSDB(c.DBIndex), args[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		if len(args) >= 3 {
+			return redis.EmptyArrayReply
+		}
+		return redis.NilReply
+	}
+	if len(args) == 2 {
+		return redis.BulkStrReply(zset.RandomDistinctMembers(1)[0].Member)
+	}
+	if count >= 0 {
+		return zEntriesReply(zset.RandomDistinctMembers(count), withScores)
+	}
+	return zEntriesReply(zset.RandomMembers(-count), withScores)
+}
+
+// ZRangeStore zrangestore dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+func ZRangeStore(c *tcp.RegisConn, args []string) base.Reply {
+	spec, errReply := parseZRangeSpec(args[5:])
+	if errReply != nil {
+		return errReply
+	}
+	if spec.withScores {
+		return redis.ErrReply("ERR syntax error")
+	}
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	zset, errReply := getRZSet(db, args[2], false)
+	if errReply != nil {
+		return errReply
+	}
+	entries, errReply := zRange(zset, args[3], args[4], spec)
+	if errReply != nil {
+		return errReply
+	}
+	return storeZSet(c, db, args[1], entries, "zrangestore")
+}
+
+// storeZSet 将结果写入destination并发出event通知，结果为空时删除destination，返回结果的大小
+func storeZSet(c *tcp.RegisConn, db base.SDB, key string, entries []base.ZEntry, event string) base.Reply {
+	if len(entries) == 0 {
+		if db.RemoveData(key) > 0 {
+			notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+		}
+		return redis.IntReply(0)
+	}
+	zset := ds.NewRZSet()
+	for i := range entries {
+		zset.Add(entries[i].Member, entries[i].Score)
+	}
+	setKey(db, key, zset)
+	notifyKeyspaceEvent(notifyZSet, event, key, c.DBIndex)
+	return redis.Int64Reply(zset.Len())
+}
+
+const (
+	zAggregateSum = iota
+	zAggregateMin
+	zAggregateMax
+)
+
+// zAggregate 按aggregate合并两个分数，inf + -inf 这类结果为NaN时记为0，与redis一致
+func zAggregate(a, b float64, aggregate int) float64 {
+	switch aggregate {
+	case zAggregateMin:
+		return math.Min(a, b)
+	case zAggregateMax:
+		return math.Max(a, b)
+	}
+	if ret := a + b; !math.IsNaN(ret) {
+		return ret
+	}
+	return 0
+}
+
+// getScoreMap 将key对应的有序集合或集合转为 member -> score，集合的成员分数都视为1，key不存在时返回nil
+func getScoreMap(db base.SDB, key string) (map[string]float64, base.Reply) {
+	v, ok := db.GetData(key)
+	if !ok {
+		return nil, nil
+	}
+	switch val := v.(type) {
+	case base.RZSet:
+		ret := make(map[string]float64, val.Len())
+		for _, entry := range val.RangeByRank(0, val.Len()-1, false) {
+			ret[entry.Member] = entry.Score
+		}
+		return ret, nil
+	case base.RSet:
+		ret := make(map[string]float64, val.Len())
+		for _, m := range val.Members() {
+			ret[m] = 1
+		}
+		return ret, nil
+	}
+	return nil, redis.TypeErrReply
+}
+
+// zStoreGeneric zunionstore/zinterstore/zdiffstore 的公共实现
+// destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func zStoreGeneric(c *tcp.RegisConn, args []string, op string) base.Reply {
+	numKeys, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return redis.IntErrReply
+	}
+	if numKeys <= 0 {
+		return redis.ErrReply("ERR at least 1 input key is needed for '" + strings.ToLower(args[0]) + "' command")
+	}
+	if numKeys > int64(len(args)-3) {
+		return redis.ErrReply("ERR syntax error")
+	}
+	keys := args[3 : 3+numKeys]
+	weights := make([]float64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := zAggregateSum
+
+	opts := args[3+numKeys:]
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToLower(opts[i]) {
+		case "weights":
+			if op == "diff" || int64(len(opts)-i-1) < numKeys {
+				return redis.ErrReply("ERR syntax error")
+			}
+			for j := range weights {
+				w, ok := parseScore(opts[i+1+j])
+				if !ok {
+					return redis.ErrReply("ERR weight value is not a float")
+				}
+				weights[j] = w
+			}
+			i += int(numKeys)
+		case "aggregate":
+			if op == "diff" || i+1 >= len(opts) {
+				return redis.ErrReply("ERR syntax error")
+			}
+			switch strings.ToLower(opts[i+1]) {
+			case "sum":
+				aggregate = zAggregateSum
+			case "min":
+				aggregate = zAggregateMin
+			case "max":
+				aggregate = zAggregateMax
+			default:
+				return redis.ErrReply("ERR syntax error")
+			}
+			i++
+		default:
+			return redis.ErrReply("ERR syntax error")
+		}
+	}
+
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	maps := make([]map[string]float64, numKeys)
+	for i := range keys {
+		m, errReply := getScoreMap(db, keys[i])
+		if errReply != nil {
+			return errReply
+		}
+		maps[i] = m
+	}
+
+	// weighted 分数乘上权重，0 * inf 这类结果为NaN时记为0
+	weighted := func(score, weight float64) float64 {
+		if ret := score * weight; !math.IsNaN(ret) {
+			return ret
+		}
+		return 0
+	}
+
+	result := make(map[string]float64)
+	switch op {
+	case "union":
+		for i := range maps {
+			for member, score := range maps[i] {
+				score = weighted(score, weights[i])
+				if cur, ok := result[member]; ok {
+					score = zAggregate(cur, score, aggregate)
+				}
+				result[member] = score
+			}
+		}
+	case "inter":
+		for member, score := range maps[0] {
+			score = weighted(score, weights[0])
+			in := true
+			for i := 1; i < len(maps); i++ {
+				other, ok := maps[i][member]
+				if !ok {
+					in = false
+					break
+				}
+				score = zAggregate(score, weighted(other, weights[i]), aggregate)
+			}
+			if in {
+				result[member] = score
+			}
+		}
+	case "diff":
+		for member, score := range maps[0] {
+			in := false
+			for i := 1; i < len(maps); i++ {
+				if _, ok := maps[i][member]; ok {
+					in = true
+					break
+				}
+			}
+			if !in {
+				result[member] = score
+			}
+		}
+	}
+
+	entries := make([]base.ZEntry, 0, len(result))
+	for member, score := range result {
+		entries = append(entries, base.ZEntry{Member: member, Score: score})
+	}
+	return storeZSet(c, db, args[1], entries, "z"+op+"store")
+}
+
+func ZUnionStore(c *tcp.RegisConn, args []string) base.Reply {
+	return zStoreGeneric(c, args, "union")
+}
+
+func ZInterStore(c *tcp.RegisConn, args []string) base.Reply {
+	return zStoreGeneric(c, args, "inter")
+}
+
+func ZDiffStore(c *tcp.RegisConn, args []string) base.Reply {
+	return zStoreGeneric(c, args, "diff")
+}
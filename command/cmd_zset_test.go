@@ -0,0 +1,26 @@
+package command
+
+import (
+	"code/regis/redis"
+	"strconv"
+	"testing"
+)
+
+func TestZRandMember_Count(t *testing.T) {
+	c := newTestConn()
+	call(c, "zadd", "zrand", "1", "a", "2", "b", "3", "c")
+
+	// 正数count返回不重复的成员
+	reply, _ := call(c, "zrandmember", "zrand", "2")
+	if n := arrayLen(reply); n != 2 {
+		t.Errorf("want 2 members, get %v", n)
+	}
+	reply, _ = call(c, "zrandmember", "zrand", strconv.Itoa(-randMaxCount), "withscores")
+	if n := arrayLen(reply); n != randMaxCount*2 {
+		t.Errorf("want %v elements, get %v", randMaxCount*2, n)
+	}
+	reply, _ = call(c, "zrandmember", "zrand", strconv.Itoa(-randMaxCount-1))
+	checkReply(t, redis.ErrReply("ERR value is out of range"), reply)
+	reply, _ = call(c, "zrandmember", "zrand", "-0")
+	checkReply(t, redis.EmptyArrayReply, reply)
+}
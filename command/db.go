@@ -2,153 +2,242 @@ package command
 
 import (
 	"code/regis/base"
-	"code/regis/ds"
-	"code/regis/lib/utils"
+	"code/regis/conf"
 	"code/regis/redis"
 	"code/regis/tcp"
+	"fmt"
+	"math"
 	"strconv"
+	"strings"
 )
 
-// base.RString 操作
-
-func Set(c *tcp.RegisConn, args []string) base.Reply {
-	_ = tcp.Server.DB.GetSDB(c.DBIndex).PutData(args[1], base.RString(args[2]))
-	return redis.OkReply
+// setKey 用新值覆盖key，并清掉key原有的过期时间
+// 原地修改容器的写命令，比如 sadd, lpush，直接用 PutData 写回，过期时间不变
+func setKey(db base.SDB, key string, val interface{}) {
+	db.PutData(key, val)
+	db.Persist(key)
 }
 
-func Get(c *tcp.RegisConn, args []string) base.Reply {
-	v, ok := tcp.Server.DB.GetSDB(c.DBIndex).GetData(args[1])
-	if !ok {
-		return redis.NilReply
-	}
-	val, ok := v.(base.RString)
-	if !ok {
-		return redis.TypeErrReply
+func Del(c *tcp.RegisConn, args []string) base.Reply {
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	ret := 0
+	for _, key := range args[1:] {
+		if db.RemoveData(key) > 0 {
+			notifyKeyspaceEvent(notifyGeneric, "del", key, c.DBIndex)
+			ret++
+		}
 	}
-	return redis.BulkReply(utils.InterfaceToBytes(val))
+	return redis.IntReply(ret)
 }
 
-func MSet(c *tcp.RegisConn, args []string) base.Reply {
-	if len(args)%2 == 0 {
-		return redis.ArgNumErrReply(args[0])
-	}
-	db := tcp.Server.DB.GetSDB(c.DBIndex)
-	for i := 1; i+1 < len(args); i += 2 {
-		_ = db.PutData(args[i], base.RString(args[i+1]))
-	}
-	return redis.OkReply
+// Unlink 数据都在内存里，删除没有阻塞的问题，和 del 一样
+func Unlink(c *tcp.RegisConn, args []string) base.Reply {
+	return Del(c, args)
 }
-func MGet(c *tcp.RegisConn, args []string) base.Reply {
-	ret := make([]interface{}, 0, len(args)-1)
+
+// Exists exists key [key ...] 重复的key会被重复计数
+func Exists(c *tcp.RegisConn, args []string) base.Reply {
 	db := tcp.Server.DB.GetSDB(c.DBIndex)
-	for i := 1; i < len(args); i++ {
-		val, ok := db.GetData(args[i])
-		if !ok {
-			ret = append(ret, nil)
-		} else {
-			ret = append(ret, val)
+	n := 0
+	for _, key := range args[1:] {
+		if _, ok := db.GetData(key); ok {
+			n++
 		}
 	}
-	return redis.ArrayReply(ret)
-}
-func Del(c *tcp.RegisConn, args []string) base.Reply {
-	ret := tcp.Server.DB.GetSDB(c.DBIndex).RemoveData(args[1:]...)
-	return redis.IntReply(ret)
+	return redis.IntReply(n)
 }
 
-func DBSize(c *tcp.RegisConn, args []string) base.Reply {
-	return redis.IntReply(tcp.Server.DB.GetSDB(c.DBIndex).Size())
+// Touch 没有维护key的访问时间，只返回存在的key的数量
+func Touch(c *tcp.RegisConn, args []string) base.Reply {
+	return Exists(c, args)
 }
 
-// base.RList 操作
+// typeName 返回 type 命令展示的类型名
+func typeName(val interface{}) string {
+	switch val.(type) {
+	case base.RString, base.RInt, *base.RBytes:
+		return "string"
+	case base.RList:
+		return "list"
+	case base.RSet:
+		return "set"
+	case base.RZSet:
+		return "zset"
+	case base.RHash:
+		return "hash"
+	case base.RStream:
+		return "stream"
+	}
+	return "none"
+}
 
-func LPush(c *tcp.RegisConn, args []string) base.Reply {
-	db := tcp.Server.DB.GetSDB(c.DBIndex)
-	v, ok := db.GetData(args[1])
+func Type(c *tcp.RegisConn, args []string) base.Reply {
+	val, ok := tcp.Server.DB.GetSDB(c.DBIndex).GetData(args[1])
 	if !ok {
-		v = ds.NewRList()
+		return redis.StrReply("none")
 	}
-	val, ok := v.(base.RList)
-	if !ok {
-		return redis.TypeErrReply
-	}
-	for i := 2; i < len(args); i++ {
-		val.PushHead(args[i])
-	}
-	db.PutData(args[1], val)
-	return redis.Int64Reply(val.Len())
+	return redis.StrReply(typeName(val))
 }
 
-func RPush(c *tcp.RegisConn, args []string) base.Reply {
-	db := tcp.Server.DB.GetSDB(c.DBIndex)
-	v, ok := db.GetData(args[1])
+func RandomKey(c *tcp.RegisConn, args []string) base.Reply {
+	key, ok := tcp.Server.DB.GetSDB(c.DBIndex).RandomKey()
 	if !ok {
-		db.PutData(args[1], ds.NewRList(args[2:]...))
-		return redis.IntReply(len(args) - 2)
-	}
-	val, ok := v.(base.RList)
-	if !ok {
-		return redis.TypeErrReply
-	}
-	for i := 2; i < len(args); i++ {
-		val.PushTail(args[i])
+		return redis.NilReply
 	}
-	db.PutData(args[1], val)
-	return redis.Int64Reply(val.Len())
+	return redis.BulkStrReply(key)
 }
 
-func LPushX(c *tcp.RegisConn, args []string) base.Reply {
+// renameGeneric rename/renamenx src dst，过期时间跟着值一起转移
+func renameGeneric(c *tcp.RegisConn, args []string, nx bool) base.Reply {
+	src, dst := args[1], args[2]
 	db := tcp.Server.DB.GetSDB(c.DBIndex)
-	v, ok := db.GetData(args[1])
+	// bgsave期间 db 中的值正在被存盘，值挪到 dst 之后还可能被原地修改，
+	// 所以用 GetDataForWrite 取一份可以修改的复制
+	val, ok := db.GetDataForWrite(src)
 	if !ok {
-		return redis.StrReply("(empty array)")
+		return redis.ErrReply("ERR no such key")
 	}
-	val, ok := v.(base.RList)
-	if !ok {
-		return redis.TypeErrReply
+	if src == dst {
+		if nx {
+			return redis.IntReply(0)
+		}
+		return redis.OkReply
+	}
+	if nx {
+		if _, exists := db.GetData(dst); exists {
+			return redis.IntReply(0)
+		}
+	}
+	when, hasExpire := db.GetExpire(src)
+	db.RemoveData(src)
+	setKey(db, dst, val)
+	if hasExpire {
+		db.SetExpire(dst, when)
 	}
-	for i := 2; i < len(args); i++ {
-		val.PushHead(args[i])
+	notifyKeyspaceEvent(notifyGeneric, "rename_from", src, c.DBIndex)
+	notifyKeyspaceEvent(notifyGeneric, "rename_to", dst, c.DBIndex)
+	tcp.Server.SignalKeyAsReady(c.DBIndex, dst)
+	if nx {
+		return redis.IntReply(1)
 	}
-	db.PutData(args[1], val)
-	return redis.Int64Reply(val.Len())
+	return redis.OkReply
 }
 
-func RPushX(c *tcp.RegisConn, args []string) base.Reply {
-	db := tcp.Server.DB.GetSDB(c.DBIndex)
-	v, ok := db.GetData(args[1])
-	if !ok {
-		return redis.StrReply("(empty array)")
+func Rename(c *tcp.RegisConn, args []string) base.Reply {
+	return renameGeneric(c, args, false)
+}
+
+func RenameNX(c *tcp.RegisConn, args []string) base.Reply {
+	return renameGeneric(c, args, true)
+}
+
+// Copy copy source destination [DB destination-db] [REPLACE]
+// 容器类型和 base.RBytes 通过 base.Cloner 复制一份，其他字符串不会被原地修改，可以直接共用
+func Copy(c *tcp.RegisConn, args []string) base.Reply {
+	src, dst := args[1], args[2]
+	dbIndex, replace := c.DBIndex, false
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); {
+		case opt == "replace":
+			replace = true
+		case opt == "db" && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return redis.IntErrReply
+			}
+			if n < 0 || n >= int64(conf.Conf.Databases) {
+				return redis.ErrReply("ERR DB index is out of range")
+			}
+			dbIndex = int(n)
+			i++
+		default:
+			return redis.ErrReply("ERR syntax error")
+		}
+	}
+	if src == dst && dbIndex == c.DBIndex {
+		return redis.ErrReply("ERR source and destination objects are the same")
 	}
-	val, ok := v.(base.RList)
+	srcDB := tcp.Server.DB.GetSDB(c.DBIndex)
+	val, ok := srcDB.GetData(src)
 	if !ok {
-		return redis.TypeErrReply
+		return redis.IntReply(0)
 	}
-	for i := 2; i < len(args); i++ {
-		val.PushTail(args[i])
+	dstDB := tcp.Server.DB.GetSDB(dbIndex)
+	if _, exists := dstDB.GetData(dst); exists {
+		if !replace {
+			return redis.IntReply(0)
+		}
+	}
+	if cloner, ok := val.(base.Cloner); ok {
+		val = cloner.Clone()
 	}
-	db.PutData(args[1], val)
-	return redis.Int64Reply(val.Len())
+	setKey(dstDB, dst, val)
+	if when, ok := srcDB.GetExpire(src); ok {
+		dstDB.SetExpire(dst, when)
+	}
+	notifyKeyspaceEvent(notifyGeneric, "copy_to", dst, dbIndex)
+	tcp.Server.SignalKeyAsReady(dbIndex, dst)
+	return redis.IntReply(1)
 }
 
-func LRange(c *tcp.RegisConn, args []string) base.Reply {
-	db := tcp.Server.DB.GetSDB(c.DBIndex)
-	v, ok := db.GetData(args[1])
-	if !ok {
-		redis.StrReply("(empty array)")
-	}
-	val, ok := v.(base.RList)
+func DBSize(c *tcp.RegisConn, args []string) base.Reply {
+	return redis.IntReply(tcp.Server.DB.GetSDB(c.DBIndex).Size())
+}
+
+// objectEncoding 返回值在内存中的编码方式
+func objectEncoding(val interface{}) string {
+	switch v := val.(type) {
+	case base.RInt:
+		return "int"
+	case base.RString:
+		// 和redis保持一致，短字符串显示为 embstr
+		if len(v) <= 44 {
+			return "embstr"
+		}
+		return "raw"
+	case *base.RBytes:
+		return "raw"
+	case base.RList:
+		return "linkedlist"
+	case base.RHash, base.RSet:
+		return "hashtable"
+	case base.RZSet:
+		return "skiplist"
+	case base.RStream:
+		return "stream"
+	}
+	return "unknown"
+}
+
+// Object object encoding|refcount key
+func Object(c *tcp.RegisConn, args []string) base.Reply {
+	sub := strings.ToLower(args[1])
+	if sub == "help" && len(args) == 2 {
+		return redis.StringsReply([]string{
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"REFCOUNT <key>",
+			"    Return the number of references of the value associated with the specified",
+			"    <key>.",
+			"HELP",
+			"    Print this help.",
+		})
+	}
+	if len(args) != 3 || (sub != "encoding" && sub != "refcount") {
+		return redis.ErrReply(fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%v'. Try OBJECT HELP.", args[1]))
+	}
+	val, ok := tcp.Server.DB.GetSDB(c.DBIndex).GetData(args[2])
 	if !ok {
-		return redis.TypeErrReply
+		return redis.NilReply
 	}
-	start, err := strconv.ParseInt(args[2], 10, 64)
-	if err != nil {
-		return redis.IntErrReply
+	if sub == "encoding" {
+		return redis.BulkStrReply(objectEncoding(val))
 	}
-	end, err := strconv.ParseInt(args[3], 10, 64)
-	if err != nil {
-		return redis.IntErrReply
+	// 共享的小整数和redis一样返回 INT_MAX
+	if base.IsSharedInt(val) {
+		return redis.IntReply(math.MaxInt32)
 	}
-	ret := val.LRange(start, end)
-	return redis.InterfacesReply(ret)
+	return redis.IntReply(1)
 }
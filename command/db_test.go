@@ -0,0 +1,156 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"testing"
+	"time"
+)
+
+func TestExistsAndType(t *testing.T) {
+	c := newTestConn()
+	call(c, "del", "tystr", "tylist", "tyset", "tyzset", "tyhash", "tystream", "tybits")
+	call(c, "set", "tystr", "v")
+	call(c, "rpush", "tylist", "a")
+	call(c, "sadd", "tyset", "a")
+	call(c, "zadd", "tyzset", "1", "a")
+	call(c, "hset", "tyhash", "f", "v")
+	call(c, "xadd", "tystream", "1-1", "f", "v")
+	call(c, "setbit", "tybits", "1", "1")
+	tests := map[string]string{
+		"tystr": "string", "tylist": "list", "tyset": "set", "tyzset": "zset",
+		"tyhash": "hash", "tystream": "stream", "tybits": "string", "nokey": "none",
+	}
+	for key, want := range tests {
+		reply, _ := call(c, "type", key)
+		checkReply(t, redis.StrReply(want), reply)
+	}
+
+	// 重复的key重复计数
+	reply, _ := call(c, "exists", "tystr", "tystr", "nokey", "tylist")
+	checkReply(t, redis.IntReply(3), reply)
+	reply, _ = call(c, "touch", "tystr", "nokey")
+	checkReply(t, redis.IntReply(1), reply)
+	reply, _ = call(c, "unlink", "tystr", "tylist", "nokey")
+	checkReply(t, redis.IntReply(2), reply)
+	reply, _ = call(c, "exists", "tystr", "tylist")
+	checkReply(t, redis.IntReply(0), reply)
+}
+
+func TestRandomKey(t *testing.T) {
+	c := newTestConn()
+	c.DBIndex = 10
+	reply, _ := call(c, "randomkey")
+	checkReply(t, redis.NilReply, reply)
+	call(c, "set", "rk1", "v")
+	call(c, "set", "rk2", "v", "px", "20")
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		reply, _ = call(c, "randomkey")
+		checkReply(t, redis.BulkStrReply("rk1"), reply)
+	}
+	call(c, "del", "rk1")
+}
+
+func TestRename(t *testing.T) {
+	c := newTestConn()
+	call(c, "del", "rn1", "rn2", "rn3")
+	call(c, "set", "rn1", "v", "ex", "100")
+	reply, _ := call(c, "rename", "rn1", "rn2")
+	checkReply(t, redis.OkReply, reply)
+	// 过期时间跟着值一起转移
+	reply, _ = call(c, "ttl", "rn2")
+	checkReply(t, redis.IntReply(100), reply)
+	reply, _ = call(c, "exists", "rn1")
+	checkReply(t, redis.IntReply(0), reply)
+
+	// 目标key原来的过期时间被清掉
+	call(c, "set", "rn3", "x", "ex", "100")
+	call(c, "set", "rn1", "w")
+	call(c, "rename", "rn1", "rn3")
+	reply, _ = call(c, "ttl", "rn3")
+	checkReply(t, redis.IntReply(-1), reply)
+
+	reply, _ = call(c, "rename", "nokey", "rn1")
+	checkReply(t, redis.ErrReply("ERR no such key"), reply)
+	reply, _ = call(c, "rename", "rn2", "rn2")
+	checkReply(t, redis.OkReply, reply)
+	reply, _ = call(c, "renamenx", "rn2", "rn3")
+	checkReply(t, redis.IntReply(0), reply)
+	reply, _ = call(c, "renamenx", "rn2", "rn1")
+	checkReply(t, redis.IntReply(1), reply)
+	reply, _ = call(c, "mget", "rn1", "rn2", "rn3")
+	checkReply(t, redis.ArrayReply([]interface{}{"v", nil, "w"}), reply)
+}
+
+func TestRename_Frozen(t *testing.T) {
+	c := newTestConn()
+	c.DBIndex = 11
+	db := tcp.Server.DB.GetSDB(c.DBIndex)
+	db.Flush()
+	call(c, "rpush", "rnf1", "a")
+	saving, _ := db.GetData("rnf1")
+
+	// bgsave 期间挪走的值被原地修改，不能影响正在存盘的值
+	db.SetStatus(base.WorldFrozen)
+	defer db.SetStatus(base.WorldNormal)
+	call(c, "rename", "rnf1", "rnf2")
+	call(c, "rpush", "rnf2", "b")
+	if n := saving.(base.RList).Len(); n != 1 {
+		t.Errorf("value being saved was modified, len %v", n)
+	}
+	reply, _ := call(c, "lrange", "rnf2", "0", "-1")
+	checkReply(t, redis.StringsReply([]string{"a", "b"}), reply)
+	reply, _ = call(c, "exists", "rnf1")
+	checkReply(t, redis.IntReply(0), reply)
+}
+
+func TestCopy(t *testing.T) {
+	c, c2 := newTestConn(), newTestConn()
+	c2.DBIndex = 12
+	call(c, "del", "cp1", "cp2", "cps")
+	call(c2, "del", "cp1")
+	call(c, "sadd", "cp1", "a")
+	call(c, "pexpire", "cp1", "100000")
+	call(c, "set", "cps", "v")
+
+	reply, _ := call(c, "copy", "cp1", "cp2")
+	checkReply(t, redis.IntReply(1), reply)
+	// 复制出来的值和原来的值互不影响，过期时间也一起复制
+	call(c, "sadd", "cp2", "b")
+	reply, _ = call(c, "scard", "cp1")
+	checkReply(t, redis.IntReply(1), reply)
+	reply, _ = call(c, "ttl", "cp2")
+	checkReply(t, redis.IntReply(100), reply)
+
+	reply, _ = call(c, "copy", "cps", "cp2")
+	checkReply(t, redis.IntReply(0), reply)
+	reply, _ = call(c, "copy", "cps", "cp2", "replace")
+	checkReply(t, redis.IntReply(1), reply)
+	reply, _ = call(c, "get", "cp2")
+	checkReply(t, redis.BulkStrReply("v"), reply)
+	reply, _ = call(c, "ttl", "cp2")
+	checkReply(t, redis.IntReply(-1), reply)
+
+	reply, _ = call(c, "copy", "cp1", "cp1", "db", "12")
+	checkReply(t, redis.IntReply(1), reply)
+	reply, _ = call(c2, "smembers", "cp1")
+	checkReply(t, redis.StringsReply([]string{"a"}), reply)
+
+	tests := []struct {
+		args []string
+		want base.Reply
+	}{
+		{[]string{"nokey", "cp3"}, redis.IntReply(0)},
+		{[]string{"cp1", "cp1"}, redis.ErrReply("ERR source and destination objects are the same")},
+		{[]string{"cp1", "cp3", "db", "16"}, redis.ErrReply("ERR DB index is out of range")},
+		{[]string{"cp1", "cp3", "db", "x"}, redis.IntErrReply},
+		{[]string{"cp1", "cp3", "db"}, redis.ErrReply("ERR syntax error")},
+		{[]string{"cp1", "cp3", "force"}, redis.ErrReply("ERR syntax error")},
+	}
+	for _, tt := range tests {
+		reply, _ = call(c, append([]string{"copy"}, tt.args...)...)
+		checkReply(t, tt.want, reply)
+	}
+}
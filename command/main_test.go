@@ -0,0 +1,214 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"code/regis/base"
+	"code/regis/conf"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	ServerInit()
+	tcp.Server = tcp.InitServer(conf.Conf)
+	os.Exit(m.Run())
+}
+
+// testNetConn 不连网络，记下写给客户端的内容，用于检查 publish 这类主动推送的消息
+type testNetConn struct {
+	net.Conn
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (c *testNetConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.buf.Write(b)
+}
+
+func (c *testNetConn) Close() error {
+	return nil
+}
+
+func (c *testNetConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+var testConnID int64
+
+// newTestConn 不连网络的客户端，测试里直接调用命令的实现
+func newTestConn() *tcp.RegisConn {
+	return &tcp.RegisConn{
+		ID:            atomic.AddInt64(&testConnID, 1),
+		Conn:          &testNetConn{},
+		PubsubList:    make(map[string]struct{}),
+		PubsubPattern: make(map[string]struct{}),
+	}
+}
+
+// pushed 取出写给客户端的内容
+func pushed(c *tcp.RegisConn) string {
+	nc := c.Conn.(*testNetConn)
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+	ret := nc.buf.String()
+	nc.buf.Reset()
+	return ret
+}
+
+// call 和 Executor 一样先检查参数个数再执行命令，返回回复和要传播给slave的命令
+func call(c *tcp.RegisConn, args ...string) (base.Reply, [][]string) {
+	cmd, ok := GetCmdInfo(args[0])
+	if !ok {
+		return redis.UnknownCmdErrReply(args[0]), nil
+	}
+	if !cmd.Validate(args) {
+		return redis.ArgNumErrReply(args[0]), nil
+	}
+	reply := cmd.exec(c, args)
+	return reply, c.PropagateQuery(args)
+}
+
+// checkReply 按协议编码后比较
+func checkReply(t *testing.T, want, get base.Reply) {
+	t.Helper()
+	if !redis.Equal(want, get) {
+		t.Errorf("want %q, get %q", want.Bytes(), get.Bytes())
+	}
+}
+
+// arrayLen 数组回复的元素个数，不是数组时返回-1
+func arrayLen(r base.Reply) int {
+	rb := r.Bytes()
+	if len(rb) == 0 || rb[0] != '*' {
+		return -1
+	}
+	n, _ := strconv.Atoi(string(rb[1:bytes.IndexByte(rb, '\r')]))
+	return n
+}
+
+// replyStrings 取出数组回复中的字符串，按字典序排列，用于比较顺序不确定的结果
+func replyStrings(r base.Reply) []string {
+	lines := strings.Split(string(r.Bytes()), "\r\n")
+	ret := make([]string, 0)
+	for i := 1; i+1 < len(lines); i += 2 {
+		ret = append(ret, lines[i+1])
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// startServer 在本地端口上接收连接，和 main.Executor 一样在一个协程里执行命令，处理阻塞客户端的超时和断开
+// 测试结束时停止，在这之前测试协程只能通过连接访问db
+func startServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tcp.NewConnection(conn)
+		}
+	}()
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case cmd := <-tcp.Server.GetWorkChan():
+				cmd.Reply = ExecCommand(cmd.Conn, cmd.Query)
+				if !cmd.Conn.IsBlocked() {
+					cmd.Conn.CmdDone(cmd)
+				}
+				ServeClientsBlockedOnKeys()
+			case req := <-tcp.Server.GetUnblockChan():
+				tcp.Server.HandleUnblock(req)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		close(stop)
+		<-stopped
+	})
+	return ln.Addr().String()
+}
+
+// testClient 通过网络连接 startServer 的客户端，按原样读取回复，以便区分空数组和nil这类回复
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *testClient) send(args ...string) {
+	if _, err := c.conn.Write(redis.CmdSReply(args...).Bytes()); err != nil {
+		c.t.Fatalf("send %v %v", args, err)
+	}
+}
+
+// recv 读取一条完整的回复，timeout 内没有读到时返回false
+func (c *testClient) recv(timeout time.Duration) (string, bool) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	var buf bytes.Buffer
+	for n := 1; n > 0; n-- {
+		line, err := c.r.ReadString('\n')
+		buf.WriteString(line)
+		if err != nil {
+			return buf.String(), false
+		}
+		size, _ := strconv.Atoi(line[1 : len(line)-2])
+		switch line[0] {
+		case '*':
+			if size > 0 {
+				n += size
+			}
+		case '$':
+			if size >= 0 {
+				b := make([]byte, size+2)
+				if _, err := io.ReadFull(c.r, b); err != nil {
+					return buf.String(), false
+				}
+				buf.Write(b)
+			}
+		}
+	}
+	return buf.String(), true
+}
+
+// do 发送命令并检查回复
+func (c *testClient) do(want base.Reply, args ...string) {
+	c.t.Helper()
+	c.send(args...)
+	get, ok := c.recv(time.Second)
+	if !ok || get != string(want.Bytes()) {
+		c.t.Errorf("%v: want %q, get %q", args, want.Bytes(), get)
+	}
+}
@@ -0,0 +1,98 @@
+package command
+
+import (
+	"code/regis/conf"
+	"errors"
+	"fmt"
+)
+
+// 键空间通知，写命令修改了key之后，向 __keyspace@<db>__:<key> 发出事件名，
+// 向 __keyevent@<db>__:<event> 发出key名，发哪些由 notify-keyspace-events 配置决定
+
+const (
+	notifyKeyspace = 1 << iota // K
+	notifyKeyevent             // E
+	notifyGeneric              // g
+	notifyString               // $
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZSet                 // z
+	notifyExpired              // x
+	notifyEvicted              // e 没有实现内存淘汰，不会发出这类事件
+	notifyStream               // t
+	notifyKeyMiss              // m 不会发出这类事件
+	notifyModule               // d 没有模块，不会发出这类事件
+	notifyNew                  // n 不会发出这类事件
+
+	// notifyAll 就是 A，不包括 m 和 n
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZSet | notifyExpired | notifyEvicted | notifyStream | notifyModule
+)
+
+type notifyClass struct {
+	c    byte
+	flag int
+}
+
+// notifyTypeClasses A 包含的事件类型
+var notifyTypeClasses = []notifyClass{
+	{'g', notifyGeneric}, {'$', notifyString}, {'l', notifyList}, {'s', notifySet}, {'h', notifyHash},
+	{'z', notifyZSet}, {'x', notifyExpired}, {'e', notifyEvicted}, {'t', notifyStream}, {'d', notifyModule},
+}
+
+// notifyOtherClasses A 不包含的部分
+var notifyOtherClasses = []notifyClass{
+	{'K', notifyKeyspace}, {'E', notifyKeyevent}, {'m', notifyKeyMiss}, {'n', notifyNew},
+}
+
+// notifyFlags 当前生效的 notify-keyspace-events，由 conf.Conf.NotifyKeyspaceEvents 解析而来
+var notifyFlags int
+
+// keyspaceEventsStringToFlags 把 "KEA" 这样的配置解析成flag，有不认识的字符返回false
+func keyspaceEventsStringToFlags(classes string) (int, bool) {
+	flags := 0
+	for i := 0; i < len(classes); i++ {
+		if classes[i] == 'A' {
+			flags |= notifyAll
+			continue
+		}
+		found := false
+		for _, nc := range append(notifyTypeClasses, notifyOtherClasses...) {
+			if nc.c == classes[i] {
+				flags |= nc.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return flags, true
+}
+
+// setNotifyKeyspaceEvents 修改 notify-keyspace-events，启动时和 CONFIG SET 时调用
+// 配置保存用户设置的原始字符串，CONFIG GET 时原样返回
+func setNotifyKeyspaceEvents(classes string) error {
+	flags, ok := keyspaceEventsStringToFlags(classes)
+	if !ok {
+		return errors.New("Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+	}
+	notifyFlags = flags
+	conf.Conf.NotifyKeyspaceEvents = classes
+	return nil
+}
+
+// notifyKeyspaceEvent 在写命令真正修改了key之后调用，typ 是事件类型，event 是事件名，比如 "set"
+func notifyKeyspaceEvent(typ int, event, key string, dbIndex int) {
+	if notifyFlags&typ == 0 {
+		return
+	}
+	if notifyFlags&notifyKeyspace != 0 {
+		publishMessage(fmt.Sprintf("__keyspace@%d__:%s", dbIndex, key), event)
+	}
+	if notifyFlags&notifyKeyevent != 0 {
+		publishMessage(fmt.Sprintf("__keyevent@%d__:%s", dbIndex, event), key)
+	}
+}
@@ -0,0 +1,137 @@
+package command
+
+import (
+	"code/regis/tcp"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyspaceEventsStringToFlags(t *testing.T) {
+	tests := []struct {
+		classes string
+		flags   int
+		ok      bool
+	}{
+		{"", 0, true},
+		{"KEA", notifyKeyspace | notifyKeyevent | notifyAll, true},
+		{"AKE", notifyKeyspace | notifyKeyevent | notifyAll, true},
+		{"Kg$", notifyKeyspace | notifyGeneric | notifyString, true},
+		{"El", notifyKeyevent | notifyList, true},
+		{"Ex", notifyKeyevent | notifyExpired, true},
+		{"KA", notifyKeyspace | notifyAll, true},
+		// A 不包括 m 和 n
+		{"Amn", notifyAll | notifyKeyMiss | notifyNew, true},
+		{"KEz", notifyKeyspace | notifyKeyevent | notifyZSet, true},
+		{"Kq", 0, false},
+		{"kea", 0, false},
+	}
+	for _, tt := range tests {
+		flags, ok := keyspaceEventsStringToFlags(tt.classes)
+		if flags != tt.flags || ok != tt.ok {
+			t.Errorf("%q: want %b %v, get %b %v", tt.classes, tt.flags, tt.ok, flags, ok)
+		}
+	}
+}
+
+// keyEvents 取出订阅者收到的 pmessage，返回 "频道 消息" 的列表
+func keyEvents(sub *tcp.RegisConn) []string {
+	ret := make([]string, 0)
+	lines := strings.Split(pushed(sub), "\r\n")
+	// *4 $8 pmessage $n pattern $n channel $n msg
+	for i := 0; i+8 < len(lines); i += 9 {
+		ret = append(ret, lines[i+6]+" "+lines[i+8])
+	}
+	return ret
+}
+
+func TestNotifyKeyspaceEvent_Commands(t *testing.T) {
+	if err := setNotifyKeyspaceEvents("KEA"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = setNotifyKeyspaceEvents("") }()
+	c, sub := newTestConn(), newTestConn()
+	c.DBIndex = 5
+	call(c, "del", "nset", "nx", "nz")
+	call(sub, "psubscribe", "__keyevent@5__:*")
+	defer sub.UnSubscribeAll()
+	pushed(sub)
+
+	ev := func(event, key string) string {
+		return fmt.Sprintf("__keyevent@5__:%v %v", event, key)
+	}
+	tests := []struct {
+		query []string
+		want  []string
+	}{
+		{[]string{"set", "ns", "1"}, []string{ev("set", "ns")}},
+		{[]string{"incr", "ns"}, []string{ev("incrby", "ns")}},
+		{[]string{"append", "ns", "x"}, []string{ev("append", "ns")}},
+		{[]string{"setbit", "nb", "1", "1"}, []string{ev("setbit", "nb")}},
+		{[]string{"expire", "ns", "100"}, []string{ev("expire", "ns")}},
+		{[]string{"persist", "ns"}, []string{ev("persist", "ns")}},
+		{[]string{"rename", "ns", "ns2"}, []string{ev("rename_from", "ns"), ev("rename_to", "ns2")}},
+		{[]string{"del", "ns2", "nb", "nokey"}, []string{ev("del", "ns2"), ev("del", "nb")}},
+		{[]string{"rpush", "nl", "a"}, []string{ev("rpush", "nl")}},
+		// 弹出最后一个元素时key被删除
+		{[]string{"lpop", "nl"}, []string{ev("lpop", "nl"), ev("del", "nl")}},
+		{[]string{"lpop", "nl"}, []string{}},
+		{[]string{"sadd", "nset", "a"}, []string{ev("sadd", "nset")}},
+		{[]string{"srem", "nset", "b"}, []string{}},
+		{[]string{"hset", "nh", "f", "v"}, []string{ev("hset", "nh")}},
+		{[]string{"hdel", "nh", "f"}, []string{ev("hdel", "nh"), ev("del", "nh")}},
+		{[]string{"zadd", "nz", "1", "a"}, []string{ev("zadd", "nz")}},
+		{[]string{"zincrby", "nz", "1", "a"}, []string{ev("zincr", "nz")}},
+		{[]string{"xadd", "nx", "1-1", "f", "v"}, []string{ev("xadd", "nx")}},
+		{[]string{"get", "nz"}, []string{}},
+	}
+	for _, tt := range tests {
+		call(c, tt.query...)
+		if get := keyEvents(sub); strings.Join(get, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%v: want %v, get %v", tt.query, tt.want, get)
+		}
+	}
+
+	// 过期删除时发出 expired
+	call(c, "set", "ne", "v", "px", "20")
+	pushed(sub)
+	time.Sleep(30 * time.Millisecond)
+	call(c, "get", "ne")
+	if get := keyEvents(sub); len(get) != 1 || get[0] != ev("expired", "ne") {
+		t.Errorf("want expired event, get %v", get)
+	}
+}
+
+// 只发出配置了的类型，K 和 E 分别控制两种频道
+func TestNotifyKeyspaceEvent_Classes(t *testing.T) {
+	defer func() { _ = setNotifyKeyspaceEvents("") }()
+	c, sub := newTestConn(), newTestConn()
+	c.DBIndex = 6
+	call(sub, "psubscribe", "__key*@6__:*")
+	defer sub.UnSubscribeAll()
+	pushed(sub)
+
+	_ = setNotifyKeyspaceEvents("Kl")
+	call(c, "set", "nc", "1")
+	call(c, "lpush", "ncl", "a")
+	get := keyEvents(sub)
+	if len(get) != 1 || get[0] != "__keyspace@6__:ncl lpush" {
+		t.Errorf("want only keyspace lpush, get %v", get)
+	}
+
+	_ = setNotifyKeyspaceEvents("E$")
+	call(c, "set", "nc", "1")
+	call(c, "lpush", "ncl", "a")
+	get = keyEvents(sub)
+	if len(get) != 1 || get[0] != "__keyevent@6__:set nc" {
+		t.Errorf("want only keyevent set, get %v", get)
+	}
+
+	// 没有 K 和 E 时什么都不发
+	_ = setNotifyKeyspaceEvents("A")
+	call(c, "set", "nc", "1")
+	if get = keyEvents(sub); len(get) != 0 {
+		t.Errorf("want no events, get %v", get)
+	}
+}
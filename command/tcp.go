@@ -15,21 +15,47 @@ import (
 )
 
 const (
-	_sub   = "subscribe"
-	_msg   = "message"
-	_unsub = "unsubscribe"
+	_sub    = "subscribe"
+	_msg    = "message"
+	_unsub  = "unsubscribe"
+	_psub   = "psubscribe"
+	_pmsg   = "pmessage"
+	_punsub = "punsubscribe"
 )
 
 func Ping(conn *tcp.RegisConn, args []string) base.Reply {
 	if len(args) >= 3 {
 		return redis.ArgNumErrReply(args[0])
 	}
+	// 订阅状态下 PING 回复的是 pong 消息，这样客户端能和频道消息一起处理
+	if conn.InPubSub() {
+		msg := ""
+		if len(args) == 2 {
+			msg = args[1]
+		}
+		return redis.ArrayReply([]interface{}{"pong", msg})
+	}
 	if len(args) == 2 {
 		return redis.StrReply(args[1])
 	}
 	return redis.StrReply("PONG")
 }
 
+// Quit 回复OK之后关闭连接
+func Quit(conn *tcp.RegisConn, args []string) base.Reply {
+	conn.CloseAfterReply()
+	return redis.OkReply
+}
+
+// Reset 把连接恢复成刚连上时的状态：退出事务、取消 watch、取消所有订阅、回到 0 号db
+func Reset(conn *tcp.RegisConn, args []string) base.Reply {
+	conn.DiscardMulti()
+	conn.UnWatchAll()
+	conn.UnSubscribeAll()
+	conn.DBIndex = 0
+	return redis.StrReply("RESET")
+}
+
 func Select(conn *tcp.RegisConn, args []string) base.Reply {
 	i, err := strconv.ParseInt(args[1], 10, 64)
 	if err != nil {
@@ -70,63 +96,138 @@ func BGSave(conn *tcp.RegisConn, args []string) base.Reply {
 }
 
 func Publish(conn *tcp.RegisConn, args []string) base.Reply {
-	subs, ok := tcp.Server.PubsubDict[args[1]]
-	if !ok {
-		return redis.IntReply(0)
-	}
+	return redis.IntReply(publishMessage(args[1], args[2]))
+}
 
-	reply := redis.ArrayReply([]interface{}{
-		_msg, args[1], args[2],
-	})
+// publishMessage 把消息发给订阅了频道、以及订阅了匹配模式的客户端，返回收到消息的客户端数
+func publishMessage(channel, msg string) int {
+	receivers := 0
+	if subs := tcp.Server.ChannelSubscribers(channel); len(subs) > 0 {
+		reply := redis.ArrayReply([]interface{}{
+			_msg, channel, msg,
+		})
 
-	for k := range subs {
-		subs[k].Reply(reply)
+		for _, c := range subs {
+			c.Reply(reply)
+		}
+		receivers += len(subs)
 	}
 
-	return redis.IntReply(len(subs))
+	// 再发给订阅了匹配模式的客户端，同一个客户端匹配上几个模式就收到几条
+	for pattern, subs := range tcp.Server.PatternSubscribers(channel) {
+		reply := redis.ArrayReply([]interface{}{
+			_pmsg, pattern, channel, msg,
+		})
+		for _, c := range subs {
+			c.Reply(reply)
+		}
+		receivers += len(subs)
+	}
+
+	return receivers
 }
 
+// Subscribe 每个频道回复一条 subscribe 消息，带上当前订阅的频道和模式总数
 func Subscribe(conn *tcp.RegisConn, args []string) base.Reply {
-	ret := make([]interface{}, 0, len(args)*3)
-	for i := 1; i < len(args); i++ {
-		// 获取server的订阅dict
-		subs, ok := tcp.Server.PubsubDict[args[i]]
-		if !ok {
-			subs = make(map[int64]*tcp.RegisConn, 16)
-		}
-		// 将conn加入server的订阅dict
-		subs[conn.ID] = conn
-		tcp.Server.PubsubDict[args[i]] = subs
-
-		// conn自己更新自己的订阅dict
-		conn.PubsubList[args[i]] = struct{}{}
+	ret := make([]base.Reply, 0, len(args)-1)
+	for _, channel := range args[1:] {
+		conn.SubscribeChannel(channel)
+		ret = append(ret, redis.ArrayReply([]interface{}{_sub, channel, conn.SubscriptionCount()}))
+	}
+	return redis.SeqReply(ret)
+}
 
-		ret = append(ret, _sub, args[i], i-1)
+// UnSubscribe 不带参数时取消订阅所有频道，每个频道回复一条 unsubscribe 消息，带上剩下的订阅数
+func UnSubscribe(conn *tcp.RegisConn, args []string) base.Reply {
+	channels := args[1:]
+	if len(channels) == 0 {
+		channels = conn.SubscribedChannels()
 	}
+	return unsubscribeReply(_unsub, channels, conn.UnSubscribeChannel, conn)
+}
 
-	return redis.ArrayReply(ret)
+func PSubscribe(conn *tcp.RegisConn, args []string) base.Reply {
+	ret := make([]base.Reply, 0, len(args)-1)
+	for _, pattern := range args[1:] {
+		conn.SubscribePattern(pattern)
+		ret = append(ret, redis.ArrayReply([]interface{}{_psub, pattern, conn.SubscriptionCount()}))
+	}
+	return redis.SeqReply(ret)
 }
 
-func UnSubscribe(conn *tcp.RegisConn, args []string) base.Reply {
-	if len(args) == 1 {
-		for key := range conn.PubsubList {
-			args = append(args, key)
-		}
+func PUnSubscribe(conn *tcp.RegisConn, args []string) base.Reply {
+	patterns := args[1:]
+	if len(patterns) == 0 {
+		patterns = conn.SubscribedPatterns()
 	}
-	ret := make([]interface{}, 0, len(args)*3)
-	for i := range args[1:] {
-		// 获取server的订阅dict
-		if subs, ok := tcp.Server.PubsubDict[args[i]]; ok {
-			// 将conn从server的订阅list中删除
-			delete(subs, conn.ID)
-		}
+	return unsubscribeReply(_punsub, patterns, conn.UnSubscribePattern, conn)
+}
 
-		// conn自己更新自己的订阅list，取消订阅该频道
-		delete(conn.PubsubList, args[i])
+func unsubscribeReply(kind string, names []string, unsub func(string) bool, conn *tcp.RegisConn) base.Reply {
+	// 一个都没有订阅时也要回复一条，频道为nil
+	if len(names) == 0 {
+		return redis.ArrayReply([]interface{}{kind, nil, conn.SubscriptionCount()})
+	}
+	ret := make([]base.Reply, 0, len(names))
+	for _, name := range names {
+		unsub(name)
+		ret = append(ret, redis.ArrayReply([]interface{}{kind, name, conn.SubscriptionCount()}))
+	}
+	return redis.SeqReply(ret)
+}
 
-		ret = append(ret, _unsub, args[i], i)
+// PubSub pubsub CHANNELS [pattern]
+// pubsub NUMSUB [channel ...]
+// pubsub NUMPAT
+// pubsub SHARDCHANNELS [pattern]
+// pubsub SHARDNUMSUB [channel ...]
+func PubSub(conn *tcp.RegisConn, args []string) base.Reply {
+	sub := strings.ToLower(args[1])
+	switch {
+	case sub == "help" && len(args) == 2:
+		return redis.StringsReply([]string{
+			"PUBSUB <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"CHANNELS [<pattern>]",
+			"    Return the currently active channels matching a <pattern> (default: '*').",
+			"NUMPAT",
+			"    Return number of subscriptions to patterns.",
+			"NUMSUB [<channel> ...]",
+			"    Return the number of subscribers for the specified channels, excluding",
+			"    pattern subscriptions(default: no channels).",
+			"SHARDCHANNELS [<pattern>]",
+			"    Return the currently active shard level channels matching a <pattern> (default: '*').",
+			"SHARDNUMSUB [<shardchannel> ...]",
+			"    Return the number of subscribers for the specified shard level channel(s)",
+			"HELP",
+			"    Print this help.",
+		})
+	case (sub == "channels" || sub == "shardchannels") && len(args) <= 3:
+		// 没有实现 SSUBSCRIBE，分片频道总是空的
+		if sub == "shardchannels" {
+			return redis.EmptyArrayReply
+		}
+		pattern := "*"
+		if len(args) == 3 {
+			pattern = args[2]
+		}
+		return redis.StringsReply(tcp.Server.PubsubChannels(pattern))
+	case sub == "numsub" || sub == "shardnumsub":
+		ret := make([]interface{}, 0, (len(args)-2)*2)
+		for _, channel := range args[2:] {
+			n := 0
+			if sub == "numsub" {
+				n = tcp.Server.NumSub(channel)
+			}
+			ret = append(ret, channel, n)
+		}
+		if len(ret) == 0 {
+			return redis.EmptyArrayReply
+		}
+		return redis.ArrayReply(ret)
+	case sub == "numpat" && len(args) == 2:
+		return redis.IntReply(tcp.Server.NumPat())
 	}
-	return redis.ArrayReply(ret)
+	return redis.ErrReply(fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%v'. Try PUBSUB HELP.", args[1]))
 }
 
 // ReplicaOf 自己是slave，向master要同步
@@ -183,10 +284,12 @@ func UnLock(conn *tcp.RegisConn, args []string) base.Reply {
 
 func Info(conn *tcp.RegisConn, args []string) base.Reply {
 	sInfo := tcp.Server.GetInfo()
-	return redis.StrReply(sInfo)
+	// 多行内容只能用 bulk string 返回，simple string 中不能有换行
+	return redis.BulkStrReply(strings.ReplaceAll(sInfo, "\n", "\r\n"))
 }
 
 func FlushALl(conn *tcp.RegisConn, args []string) base.Reply {
+	tcp.Server.TouchAllWatchedKeys()
 	tcp.Server.DB.Flush()
 	return redis.OkReply
 }
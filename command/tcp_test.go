@@ -0,0 +1,234 @@
+package command
+
+import (
+	"code/regis/base"
+	"code/regis/redis"
+	"code/regis/tcp"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 客户端断开时在自己的协程里取消订阅，同时主协程在发布消息、查询订阅关系
+func TestPubSub_UnsubscribeWhilePublishing(t *testing.T) {
+	publisher := newTestConn()
+	subs := make([]*tcp.RegisConn, 200)
+	for i := range subs {
+		subs[i] = newTestConn()
+		call(subs[i], "subscribe", "racech", fmt.Sprintf("racech%v", i))
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, c := range subs {
+			c.UnSubscribeAll()
+		}
+	}()
+	for i := range subs {
+		call(publisher, "publish", "racech", "msg")
+		call(publisher, "pubsub", "channels")
+		call(publisher, "pubsub", "numsub", fmt.Sprintf("racech%v", i))
+	}
+	<-done
+	reply, _ := call(publisher, "pubsub", "numsub", "racech")
+	checkReply(t, redis.ArrayReply([]interface{}{"racech", 0}), reply)
+}
+
+func TestPubSub_PUnsubscribeWhilePublishing(t *testing.T) {
+	publisher := newTestConn()
+	subs := make([]*tcp.RegisConn, 200)
+	for i := range subs {
+		subs[i] = newTestConn()
+		call(subs[i], "psubscribe", "racep*", fmt.Sprintf("racep%v*", i))
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, c := range subs {
+			c.UnSubscribeAll()
+		}
+	}()
+	for range subs {
+		call(publisher, "publish", "racep1", "msg")
+		call(publisher, "pubsub", "numpat")
+	}
+	<-done
+	reply, _ := call(publisher, "pubsub", "numpat")
+	checkReply(t, redis.IntReply(0), reply)
+}
+
+func TestPSubscribe(t *testing.T) {
+	sub, sub2, publisher := newTestConn(), newTestConn(), newTestConn()
+	defer sub.UnSubscribeAll()
+	defer sub2.UnSubscribeAll()
+	reply, _ := call(sub, "psubscribe", "orders.*", "h?llo", "orders.*")
+	checkReply(t, redis.SeqReply([]base.Reply{
+		redis.ArrayReply([]interface{}{"psubscribe", "orders.*", 1}),
+		redis.ArrayReply([]interface{}{"psubscribe", "h?llo", 2}),
+		redis.ArrayReply([]interface{}{"psubscribe", "orders.*", 2}),
+	}), reply)
+	call(sub2, "psubscribe", "h[ae]llo")
+	call(sub2, "subscribe", "hello")
+
+	tests := []struct {
+		channel string
+		n       int
+		sub     string
+		sub2    string
+	}{
+		{"orders.new", 1, "*4\r\n$8\r\npmessage\r\n$8\r\norders.*\r\n$10\r\norders.new\r\n$3\r\nmsg\r\n", ""},
+		{"orders", 0, "", ""},
+		// 同一个客户端通过频道和模式都能收到时，收到两条
+		{"hello", 3, "*4\r\n$8\r\npmessage\r\n$5\r\nh?llo\r\n$5\r\nhello\r\n$3\r\nmsg\r\n",
+			"*3\r\n$7\r\nmessage\r\n$5\r\nhello\r\n$3\r\nmsg\r\n*4\r\n$8\r\npmessage\r\n$8\r\nh[ae]llo\r\n$5\r\nhello\r\n$3\r\nmsg\r\n"},
+		{"hallo", 2, "*4\r\n$8\r\npmessage\r\n$5\r\nh?llo\r\n$5\r\nhallo\r\n$3\r\nmsg\r\n",
+			"*4\r\n$8\r\npmessage\r\n$8\r\nh[ae]llo\r\n$5\r\nhallo\r\n$3\r\nmsg\r\n"},
+		{"hllo", 0, "", ""},
+	}
+	pushed(sub)
+	pushed(sub2)
+	for _, tt := range tests {
+		reply, _ = call(publisher, "publish", tt.channel, "msg")
+		checkReply(t, redis.IntReply(tt.n), reply)
+		if get := pushed(sub); get != tt.sub {
+			t.Errorf("%v: want %q, get %q", tt.channel, tt.sub, get)
+		}
+		if get := pushed(sub2); get != tt.sub2 {
+			t.Errorf("%v: want %q, get %q", tt.channel, tt.sub2, get)
+		}
+	}
+
+	reply, _ = call(sub, "punsubscribe", "h?llo", "nopattern")
+	checkReply(t, redis.SeqReply([]base.Reply{
+		redis.ArrayReply([]interface{}{"punsubscribe", "h?llo", 1}),
+		redis.ArrayReply([]interface{}{"punsubscribe", "nopattern", 1}),
+	}), reply)
+	reply, _ = call(publisher, "publish", "hallo", "msg")
+	checkReply(t, redis.IntReply(1), reply)
+	reply, _ = call(publisher, "pubsub", "numpat")
+	checkReply(t, redis.IntReply(2), reply)
+
+	// 断开时清理模式订阅
+	sub2.UnSubscribeAll()
+	reply, _ = call(publisher, "publish", "hello", "msg")
+	checkReply(t, redis.IntReply(0), reply)
+	reply, _ = call(sub, "punsubscribe")
+	checkReply(t, redis.SeqReply([]base.Reply{
+		redis.ArrayReply([]interface{}{"punsubscribe", "orders.*", 0}),
+	}), reply)
+	reply, _ = call(publisher, "pubsub", "numpat")
+	checkReply(t, redis.IntReply(0), reply)
+}
+
+func TestPubSub_Introspection(t *testing.T) {
+	a, b, c := newTestConn(), newTestConn(), newTestConn()
+	defer a.UnSubscribeAll()
+	defer b.UnSubscribeAll()
+	call(a, "subscribe", "intro.news", "intro.sport")
+	call(b, "subscribe", "intro.news", "other.intro")
+	call(b, "psubscribe", "intro.*")
+
+	reply, _ := call(c, "pubsub", "channels", "intro.*")
+	if get := replyStrings(reply); strings.Join(get, ",") != "intro.news,intro.sport" {
+		t.Errorf("want intro channels, get %v", get)
+	}
+	reply, _ = call(c, "pubsub", "channels")
+	if get := replyStrings(reply); strings.Join(get, ",") != "intro.news,intro.sport,other.intro" {
+		t.Errorf("want all channels, get %v", get)
+	}
+	reply, _ = call(c, "pubsub", "numsub", "intro.news", "intro.sport", "nochannel")
+	checkReply(t, redis.ArrayReply([]interface{}{"intro.news", 2, "intro.sport", 1, "nochannel", 0}), reply)
+	reply, _ = call(c, "pubsub", "numsub")
+	checkReply(t, redis.EmptyArrayReply, reply)
+	reply, _ = call(c, "pubsub", "numpat")
+	checkReply(t, redis.IntReply(1), reply)
+	reply, _ = call(c, "pubsub", "shardchannels")
+	checkReply(t, redis.EmptyArrayReply, reply)
+	reply, _ = call(c, "pubsub", "shardnumsub", "intro.news")
+	checkReply(t, redis.ArrayReply([]interface{}{"intro.news", 0}), reply)
+
+	// 没有订阅者的频道不再出现
+	call(a, "unsubscribe", "intro.sport")
+	call(b, "unsubscribe")
+	reply, _ = call(c, "pubsub", "channels")
+	checkReply(t, redis.StringsReply([]string{"intro.news"}), reply)
+	a.UnSubscribeAll()
+	reply, _ = call(c, "pubsub", "channels")
+	checkReply(t, redis.EmptyArrayReply, reply)
+	reply, _ = call(c, "pubsub", "numsub", "intro.news")
+	checkReply(t, redis.ArrayReply([]interface{}{"intro.news", 0}), reply)
+
+	reply, _ = call(c, "pubsub", "numpat", "x")
+	checkReply(t, redis.ErrReply("ERR Unknown subcommand or wrong number of arguments for 'numpat'. Try PUBSUB HELP."), reply)
+	reply, _ = call(c, "pubsub", "channels", "a", "b")
+	checkReply(t, redis.ErrReply("ERR Unknown subcommand or wrong number of arguments for 'channels'. Try PUBSUB HELP."), reply)
+}
+
+func TestPubSub_SubscriberMode(t *testing.T) {
+	c := newTestConn()
+	defer c.UnSubscribeAll()
+	checkReply(t, redis.StrReply("PONG"), ExecCommand(c, []string{"ping"}))
+	checkReply(t, redis.SeqReply([]base.Reply{
+		redis.ArrayReply([]interface{}{"subscribe", "smode1", 1}),
+		redis.ArrayReply([]interface{}{"subscribe", "smode2", 2}),
+	}), ExecCommand(c, []string{"subscribe", "smode1", "smode2"}))
+
+	// 订阅状态下只能执行订阅相关的命令，PING 回复 pong 消息
+	checkReply(t, redis.ErrReply("ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context"),
+		ExecCommand(c, []string{"GET", "k"}))
+	checkReply(t, redis.ArrayReply([]interface{}{"pong", ""}), ExecCommand(c, []string{"ping"}))
+	checkReply(t, redis.ArrayReply([]interface{}{"pong", "hi"}), ExecCommand(c, []string{"ping", "hi"}))
+	checkReply(t, redis.SeqReply([]base.Reply{
+		redis.ArrayReply([]interface{}{"psubscribe", "smode*", 3}),
+	}), ExecCommand(c, []string{"psubscribe", "smode*"}))
+
+	checkReply(t, redis.SeqReply([]base.Reply{
+		redis.ArrayReply([]interface{}{"unsubscribe", "smode2", 2}),
+		redis.ArrayReply([]interface{}{"unsubscribe", "nochannel", 2}),
+	}), ExecCommand(c, []string{"unsubscribe", "smode2", "nochannel"}))
+	checkReply(t, redis.SeqReply([]base.Reply{
+		redis.ArrayReply([]interface{}{"unsubscribe", "smode1", 1}),
+	}), ExecCommand(c, []string{"unsubscribe"}))
+	// 还有模式订阅，仍然处于订阅状态
+	if reply := ExecCommand(c, []string{"get", "k"}); reply.Bytes()[0] != '-' {
+		t.Errorf("still in subscriber mode, get %q", reply.Bytes())
+	}
+	checkReply(t, redis.SeqReply([]base.Reply{
+		redis.ArrayReply([]interface{}{"punsubscribe", "smode*", 0}),
+	}), ExecCommand(c, []string{"punsubscribe"}))
+	// 一个都没有订阅时也回复一条
+	checkReply(t, redis.ArrayReply([]interface{}{"unsubscribe", nil, 0}), ExecCommand(c, []string{"unsubscribe"}))
+	checkReply(t, redis.StrReply("PONG"), ExecCommand(c, []string{"ping"}))
+	checkReply(t, redis.OkReply, ExecCommand(c, []string{"set", "smodek", "v"}))
+
+	// RESET 退出订阅状态
+	ExecCommand(c, []string{"subscribe", "smode1"})
+	ExecCommand(c, []string{"psubscribe", "smode*"})
+	checkReply(t, redis.StrReply("RESET"), ExecCommand(c, []string{"reset"}))
+	checkReply(t, redis.BulkStrReply("v"), ExecCommand(c, []string{"get", "smodek"}))
+	checkReply(t, redis.ArrayReply([]interface{}{"smode1", 0}), ExecCommand(c, []string{"pubsub", "numsub", "smode1"}))
+	ExecCommand(c, []string{"del", "smodek"})
+}
+
+func TestPubSub_SubscriberModeConn(t *testing.T) {
+	addr := startServer(t)
+	sub, c := dial(t, addr), dial(t, addr)
+	sub.do(redis.SeqReply([]base.Reply{
+		redis.ArrayReply([]interface{}{"subscribe", "smconn", 1}),
+	}), "subscribe", "smconn")
+	c.do(redis.IntReply(1), "publish", "smconn", "hi")
+	if reply, _ := sub.recv(time.Second); reply != string(redis.ArrayReply([]interface{}{"message", "smconn", "hi"}).Bytes()) {
+		t.Errorf("want message, get %q", reply)
+	}
+	// QUIT 回复之后关闭连接，订阅也随之取消
+	sub.do(redis.OkReply, "quit")
+	for i := 0; i < 100; i++ {
+		c.send("pubsub", "numsub", "smconn")
+		if reply, _ := c.recv(time.Second); reply == string(redis.ArrayReply([]interface{}{"smconn", 0}).Bytes()) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("subscription should be removed after quit")
+}
@@ -26,6 +26,46 @@ type RegisConf struct {
 	Databases       int    `cfg:"databases"`
 	RDBName         string `cfg:"dbfilename"`
 	ReplBacklogSize int64  `cfg:"repl-backlog-size"`
+
+	// NotifyKeyspaceEvents 键空间通知要发出哪些事件，格式同redis，比如 "KEA"，为空表示不通知
+	NotifyKeyspaceEvents string `cfg:"notify-keyspace-events"`
+}
+
+// Get 返回名字满足 match 的配置项，按 name value 交替排列
+func (c *RegisConf) Get(match func(name string) bool) []string {
+	ret := make([]string, 0)
+	t := reflect.TypeOf(c)
+	v := reflect.ValueOf(c)
+	n := t.Elem().NumField()
+	for i := 0; i < n; i++ {
+		field := t.Elem().Field(i)
+		fieldVal := v.Elem().Field(i)
+		key, ok := field.Tag.Lookup("cfg")
+		if !ok {
+			key = field.Name
+		}
+		if !match(key) {
+			continue
+		}
+		value := ""
+		switch field.Type.Kind() {
+		case reflect.String:
+			value = fieldVal.String()
+		case reflect.Int, reflect.Int64, reflect.Int32:
+			value = strconv.FormatInt(fieldVal.Int(), 10)
+		case reflect.Bool:
+			value = "no"
+			if fieldVal.Bool() {
+				value = "yes"
+			}
+		case reflect.Slice:
+			if field.Type.Elem().Kind() == reflect.String {
+				value = strings.Join(fieldVal.Interface().([]string), ",")
+			}
+		}
+		ret = append(ret, key, value)
+	}
+	return ret
 }
 
 func parse(src io.Reader) *RegisConf {
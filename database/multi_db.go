@@ -4,12 +4,18 @@ import (
 	"code/regis/base"
 	"code/regis/conf"
 	log "code/regis/lib"
+	"time"
 
 	"github.com/hdt3213/rdb/core"
 )
 
 const (
 	DefaultSDBNum = 16
+
+	// activeExpireKeysPerLoop 主动过期时，每一轮抽样的key数量
+	activeExpireKeysPerLoop = 20
+	// activeExpireAcceptableStale 一轮抽样中过期key的百分比不超过这个值时，就不再继续处理当前db
+	activeExpireAcceptableStale = 10
 )
 
 type MultiDB struct {
@@ -20,6 +26,9 @@ type MultiDB struct {
 	status base.WorldStatus
 
 	sDB []*SingleDB
+
+	// expireDBIndex 下一次主动过期从哪个db开始
+	expireDBIndex int
 }
 
 func (md *MultiDB) Flush() {
@@ -83,6 +92,31 @@ func (md *MultiDB) SaveRDB(rdb *core.Encoder) error {
 	return nil
 }
 
+// ActiveExpireCycle 主动删除过期的key，由主协程定时调用
+// 对每个db随机抽样，如果抽到的过期key比例高，说明还有很多过期的key，继续抽样，
+// 总耗时超过 timeLimit 就停下，下一次从停下的db继续，返回是否因为超时而停下
+func (md *MultiDB) ActiveExpireCycle(timeLimit time.Duration) bool {
+	start := time.Now()
+	for i := 0; i < len(md.sDB); i++ {
+		sdb := md.sDB[md.expireDBIndex]
+		md.expireDBIndex = (md.expireDBIndex + 1) % len(md.sDB)
+		for iteration := 1; ; iteration++ {
+			sampled, expired := sdb.activeExpire(activeExpireKeysPerLoop)
+			if sampled == 0 {
+				break
+			}
+			// 每16轮看一下时间，time.Now 也是有开销的
+			if iteration%16 == 0 && time.Since(start) > timeLimit {
+				return true
+			}
+			if expired*100 <= sampled*activeExpireAcceptableStale {
+				break
+			}
+		}
+	}
+	return false
+}
+
 func NewMultiDB() *MultiDB {
 	if conf.Conf.Databases == 0 {
 		conf.Conf.Databases = DefaultSDBNum
@@ -91,7 +125,7 @@ func NewMultiDB() *MultiDB {
 		sDB: make([]*SingleDB, conf.Conf.Databases),
 	}
 	for i := 0; i < conf.Conf.Databases; i++ {
-		sdb := newSDB()
+		sdb := newSDB(i)
 		db.sDB[i] = sdb
 	}
 	return db
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"code/regis/base"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMultiDB_ActiveExpireCycle(t *testing.T) {
+	md := NewMultiDB()
+	expired := make(map[int]int)
+	base.OnKeyExpired = func(dbIndex int, key string) { expired[dbIndex]++ }
+	defer func() { base.OnKeyExpired = func(dbIndex int, key string) {} }()
+	for _, i := range []int{0, 3, 15} {
+		sdb := md.GetSDB(i)
+		for j := 0; j < 1000; j++ {
+			sdb.PutData(fmt.Sprintf("k%v", j), base.RString("v"))
+			sdb.SetExpire(fmt.Sprintf("k%v", j), time.Now().Add(-time.Second))
+		}
+		sdb.PutData("live", base.RString("v"))
+		sdb.SetExpire("live", time.Now().Add(time.Hour))
+	}
+
+	// 超时后停下，下一次继续
+	if !md.ActiveExpireCycle(0) {
+		t.Errorf("want time cap reached")
+	}
+	if expired[0] == 0 || expired[0] == 1000 {
+		t.Errorf("want part of db 0 expired, get %v", expired[0])
+	}
+	for i := 0; i < 100 && md.ActiveExpireCycle(time.Second); i++ {
+	}
+	// 过期key比例低于 activeExpireAcceptableStale 时可能剩下少量过期的key
+	for _, i := range []int{0, 3, 15} {
+		if size := md.GetSDB(i).Size(); size > 1000*activeExpireAcceptableStale/100 {
+			t.Errorf("db %v: too many expired keys left %v", i, size)
+		}
+		if _, ok := md.GetSDB(i).GetData("live"); !ok {
+			t.Errorf("db %v: live key should not be removed", i)
+		}
+	}
+}
@@ -4,21 +4,31 @@ import (
 	"code/regis/base"
 	"code/regis/ds"
 	log "code/regis/lib"
+	"code/regis/lib/utils"
+	"math"
+	"math/rand"
 	"time"
 
 	"github.com/hdt3213/rdb/core"
 	"github.com/hdt3213/rdb/encoder"
+	"github.com/hdt3213/rdb/model"
 )
 
 const (
-	dataDictSize   = 1 << 16
-	expireDictSize = 1 << 10
+	// ds.Dict 会按需扩容，初始的桶数不宜太大，否则 scan 时要跳过大量空桶
+	dataDictSize   = 1 << 6
+	expireDictSize = 1 << 4
+
+	// randomKeyTries RandomKey 最多抽样的轮数，每轮从 db 和 bgDB 中各抽 randomKeySample 个key
+	randomKeyTries  = 16
+	randomKeySample = 4
 )
 
 type carrier struct {
 	// 实际存储的数据，key -> Data
 	data *ds.Dict
 	// key的过期时间，key -> time.Time
+	// 在 bgDB 中，值为 base.Null 表示该key的过期时间被删掉了
 	expire *ds.Dict
 }
 
@@ -41,6 +51,9 @@ type SingleDB struct {
 	// 也有一部分luck Key在这期间被删除了，对于这部分以负数计入luckCount中
 	// 对于更改的Key，不算luck Key
 	luckCount int
+
+	// index 该sdb在 MultiDB 中的下标
+	index int
 }
 
 func (sdb *SingleDB) SetStatus(status base.WorldStatus) {
@@ -57,11 +70,20 @@ func (sdb *SingleDB) RangeKV(ch <-chan struct{}) chan base.DBKV {
 		defer func() {
 			close(kvs)
 		}()
+		now := time.Now()
 		for kv := range sdb.db.data.RangeKV(ch) {
+			dbKV := base.DBKV{DictKV: kv}
+			if v, ok := sdb.db.expire.Get(kv.Key); ok {
+				dbKV.TTL = v.(time.Time).Sub(now).Milliseconds()
+				// 已经过期的key不用存
+				if dbKV.TTL <= 0 {
+					continue
+				}
+			}
 			select {
 			case <-ch:
 				return
-			case kvs <- base.DBKV{DictKV: kv}:
+			case kvs <- dbKV:
 			}
 		}
 	}()
@@ -84,17 +106,21 @@ func (sdb *SingleDB) SaveRDB(rdb *core.Encoder) error {
 		//time.Sleep(1 * time.Second)
 		var ttlOp interface{}
 		if kv.TTL > 0 {
-			ttlOp = encoder.WithTTL(uint64(time.Now().Add(time.Duration(kv.TTL*int64(time.Millisecond))).Unix() * 1000))
+			ttlOp = encoder.WithTTL(uint64(time.Now().Add(time.Duration(kv.TTL * int64(time.Millisecond))).UnixMilli()))
 		}
 		switch v := kv.Val.(type) {
 		case base.RString:
 			err = rdb.WriteStringObject(kv.Key, []byte(v), ttlOp)
+		case base.RInt:
+			err = rdb.WriteStringObject(kv.Key, []byte(v.String()), ttlOp)
+		case *base.RBytes:
+			err = rdb.WriteStringObject(kv.Key, v.Buf, ttlOp)
 		case base.RList:
 			ret := make([][]byte, 0, v.Len())
 			for k := range v.Range(ch) {
-				ret = append(ret, k.([]byte))
+				ret = append(ret, utils.InterfaceToBytes(k))
 			}
-			err = rdb.WriteListObject(kv.Key, ret, ttlOp)
+			err = rdb.WriteListObject(kv.Key, ds.EscapeListDump(ret), ttlOp)
 		case base.RHash:
 			ret := make(map[string][]byte, v.Len())
 			for hkv := range v.RangeKV(ch) {
@@ -102,24 +128,20 @@ func (sdb *SingleDB) SaveRDB(rdb *core.Encoder) error {
 			}
 			err = rdb.WriteHashMapObject(kv.Key, ret, ttlOp)
 		case base.RSet:
-			// TODO
-			//	err = rdb.WriteSetObject("set", [][]byte{
-			//		[]byte("123"),
-			//		[]byte("abc"),
-			//		[]byte("la la la"),
-			//	})
+			ret := make([][]byte, 0, v.Len())
+			for member := range v.Range(ch) {
+				ret = append(ret, []byte(member))
+			}
+			err = rdb.WriteSetObject(kv.Key, ret, ttlOp)
 		case base.RZSet:
-			// TODO
-			//err = rdb.WriteZSetObject("list2", []*model.ZSetEntry{
-			//	{
-			//		Score:  1.234,
-			//		Member: "a",
-			//	},
-			//	{
-			//		Score:  2.71828,
-			//		Member: "b",
-			//	},
-			//})
+			ret := make([]*model.ZSetEntry, 0, v.Len())
+			for entry := range v.Range(ch) {
+				ret = append(ret, &model.ZSetEntry{Member: entry.Member, Score: entry.Score})
+			}
+			err = rdb.WriteZSetObject(kv.Key, ret, ttlOp)
+		case *ds.Stream:
+			// rdb库不支持写入stream，所以编码成一个特殊的list，加载时再还原，见 ds.Stream.Dump
+			err = rdb.WriteListObject(kv.Key, v.Dump(), ttlOp)
 		}
 		if err != nil {
 			return err
@@ -129,6 +151,7 @@ func (sdb *SingleDB) SaveRDB(rdb *core.Encoder) error {
 }
 
 func (sdb *SingleDB) PutData(key string, val interface{}) int {
+	base.OnKeyModified(sdb.index, key)
 	luck := 0
 	switch sdb.status {
 	case base.WorldNormal:
@@ -160,7 +183,15 @@ func (sdb *SingleDB) PutData(key string, val interface{}) int {
 	return sdb.db.data.Put(key, val)
 }
 
+// GetData 获取key的值，key已经过期的话，删掉它并返回false
 func (sdb *SingleDB) GetData(key string) (interface{}, bool) {
+	if sdb.expireIfNeeded(key) {
+		return nil, false
+	}
+	return sdb.getData(key)
+}
+
+func (sdb *SingleDB) getData(key string) (interface{}, bool) {
 	switch sdb.status {
 	case base.WorldNormal:
 		return sdb.db.data.Get(key)
@@ -194,10 +225,40 @@ func (sdb *SingleDB) GetData(key string) (interface{}, bool) {
 	return sdb.db.data.Get(key)
 }
 
+// GetDataForWrite 获取一个可以原地修改的值，用于 sadd 这类直接修改容器的写命令
+// status = base.WorldFrozen 时，db 中的值正在被存盘，不能原地修改，
+// 所以对于 base.Cloner，复制一份放进 bgDB 中再返回，之后的读写都会落在这份复制上
+func (sdb *SingleDB) GetDataForWrite(key string) (interface{}, bool) {
+	if sdb.status != base.WorldFrozen {
+		return sdb.GetData(key)
+	}
+	if sdb.expireIfNeeded(key) {
+		return nil, false
+	}
+	v, exists2 := sdb.bgDB.data.Get(key)
+	if exists2 {
+		if _, valNull := v.(base.Null); valNull {
+			return nil, false
+		}
+		return v, true
+	}
+	w, exists1 := sdb.db.data.Get(key)
+	if !exists1 {
+		return nil, false
+	}
+	if c, ok := w.(base.Cloner); ok {
+		w = c.Clone()
+		sdb.bgDB.data.Put(key, w)
+	}
+	return w, true
+}
+
 // RemoveData 删除指定keys的值，返回更改的数量
 func (sdb *SingleDB) RemoveData(keys ...string) int {
 	luck := 0
 	for _, key := range keys {
+		sdb.Persist(key)
+		before := luck
 		switch sdb.status {
 		case base.WorldNormal:
 			luck += sdb.db.data.Del(key)
@@ -221,6 +282,9 @@ func (sdb *SingleDB) RemoveData(keys ...string) int {
 		case base.WorldStopped:
 			luck += sdb.bgDB.data.Put(key, base.Null{})
 		}
+		if luck > before {
+			base.OnKeyModified(sdb.index, key)
+		}
 	}
 	switch sdb.status {
 	case base.WorldNormal:
@@ -236,8 +300,161 @@ func (sdb *SingleDB) RemoveData(keys ...string) int {
 	return luck
 }
 
+// RandomKey 随机返回一个存在的key，抽到的过期key会顺便删掉
+// status 不是 base.WorldNormal 时，新写入的key可能只在 bgDB 中，db 中的key也可能已经在 bgDB 中被删掉了，
+// 所以两边都要抽样，再用 GetData 确认key确实存在
+func (sdb *SingleDB) RandomKey() (string, bool) {
+	for i := 0; i < randomKeyTries && sdb.Size() > 0; i++ {
+		keys := sdb.db.data.RandomKey(randomKeySample)
+		if sdb.status != base.WorldNormal {
+			keys = append(keys, sdb.bgDB.data.RandomKey(randomKeySample)...)
+		}
+		rand.Shuffle(len(keys), func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+		for _, key := range keys {
+			if _, ok := sdb.GetData(key); ok {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Scan 从游标cursor开始遍历，返回大约count个存在的key和下一次的游标，游标为0表示遍历结束
+// 游标的最低位表示正在遍历哪张表，0 是 bgDB，1 是 db，其余的位是 ds.Dict.Scan 的游标
+// 先遍历 bgDB 再遍历 db：status = base.WorldMoving 时key只会从 bgDB 搬到 db，
+// 在 bgDB 中还没遍历到就被搬走的key，之后遍历 db 时一定能遍历到
+// status = base.WorldNormal 时 bgDB 是空的，直接跳到 db
+func (sdb *SingleDB) Scan(cursor uint64, count int) ([]string, uint64) {
+	var keys []string
+	collect := func(key string, _ interface{}) {
+		keys = append(keys, key)
+	}
+	inDB, v := cursor&1 == 1, cursor>>1
+	done := false
+	// 和redis一样限制遍历的桶数，避免大部分桶为空时阻塞太久，count 很大时不能让 count*10 溢出
+	maxIterations := math.MaxInt
+	if count < math.MaxInt/10 {
+		maxIterations = count * 10
+	}
+	for ; maxIterations > 0 && len(keys) < count; maxIterations-- {
+		if !inDB {
+			if v = sdb.bgDB.data.Scan(v, collect); v == 0 {
+				inDB = true
+			}
+			continue
+		}
+		if v = sdb.db.data.Scan(v, collect); v == 0 {
+			done = true
+			break
+		}
+	}
+	// 遍历结束之后再确认key是否存在，GetData 可能会删除过期的key或者把key从 bgDB 搬到 db 中
+	// bgsave期间同一个key可能同时在 db 和 bgDB 中，去掉重复的
+	seen := make(map[string]struct{}, len(keys))
+	ret := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		if _, ok := sdb.GetData(key); ok {
+			ret = append(ret, key)
+		}
+	}
+	if done {
+		return ret, 0
+	}
+	next := v << 1
+	if inDB {
+		next |= 1
+	}
+	return ret, next
+}
+
+// SetExpire 设置key的过期时间
+func (sdb *SingleDB) SetExpire(key string, when time.Time) {
+	base.OnKeyModified(sdb.index, key)
+	switch sdb.status {
+	case base.WorldNormal:
+		sdb.db.expire.Put(key, when)
+	case base.WorldMoving:
+		sdb.db.expire.Put(key, when)
+		sdb.bgDB.expire.Del(key)
+	default:
+		sdb.bgDB.expire.Put(key, when)
+	}
+}
+
+// GetExpire 获取key的过期时间，没有设置过期时间时返回false
+// status 不是 base.WorldNormal 时，bgDB 中的过期时间覆盖 db 中的
+func (sdb *SingleDB) GetExpire(key string) (time.Time, bool) {
+	var v interface{}
+	var ok bool
+	if sdb.status != base.WorldNormal {
+		v, ok = sdb.bgDB.expire.Get(key)
+	}
+	if !ok {
+		v, ok = sdb.db.expire.Get(key)
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+	when, ok := v.(time.Time)
+	return when, ok
+}
+
+// Persist 删除key的过期时间，返回删除的数量
+func (sdb *SingleDB) Persist(key string) int {
+	if _, ok := sdb.GetExpire(key); !ok {
+		return 0
+	}
+	base.OnKeyModified(sdb.index, key)
+	switch sdb.status {
+	case base.WorldNormal:
+		sdb.db.expire.Del(key)
+	case base.WorldMoving:
+		sdb.db.expire.Del(key)
+		sdb.bgDB.expire.Del(key)
+	default:
+		sdb.bgDB.expire.Put(key, base.Null{})
+	}
+	return 1
+}
+
+// expireIfNeeded key已经过期的话，删掉它并返回true，slave 上不删除，只返回true
+// slave 执行 master 传播过来的命令时，key 是否过期以 master 为准，见 base.FromMaster
+func (sdb *SingleDB) expireIfNeeded(key string) bool {
+	when, ok := sdb.GetExpire(key)
+	if !ok || when.After(time.Now()) {
+		return false
+	}
+	if base.IsSlave() {
+		return !base.FromMaster()
+	}
+	sdb.RemoveData(key)
+	base.OnKeyExpired(sdb.index, key)
+	return true
+}
+
+// activeExpire 随机抽取最多num个设置了过期时间的key，删掉其中已经过期的，返回抽取和删除的数量
+func (sdb *SingleDB) activeExpire(num int) (sampled, expired int) {
+	keys := sdb.db.expire.RandomKey(num)
+	if sdb.status != base.WorldNormal {
+		keys = append(keys, sdb.bgDB.expire.RandomKey(num)...)
+	}
+	for _, key := range keys {
+		sampled++
+		if sdb.expireIfNeeded(key) {
+			expired++
+		}
+	}
+	return sampled, expired
+}
+
 func (sdb *SingleDB) NotifyMoving(i int) {
-	for sdb.bgDB.data.Len() > 0 {
+	for sdb.bgDB.data.Len() > 0 || sdb.bgDB.expire.Len() > 0 {
 		base.NeedMoving <- i
 	}
 	sdb.status = base.WorldNormal
@@ -258,12 +475,21 @@ func (sdb *SingleDB) Flush() {
 
 // MoveData 在bgsave存储完成之后，将 sdb.bgDB 的数据转移到 sdb.db中
 func (sdb *SingleDB) MoveData() {
-	if sdb.bgDB.data.Len() == 0 {
+	if sdb.bgDB.data.Len() == 0 && sdb.bgDB.expire.Len() == 0 {
 		sdb.status = base.WorldNormal
 		return
 	}
 	// 每次转移两个Key
 	batch := 2
+	for _, key := range sdb.bgDB.expire.RandomKey(batch) {
+		v, _ := sdb.bgDB.expire.Get(key)
+		if _, valNull := v.(base.Null); valNull {
+			sdb.db.expire.Del(key)
+		} else {
+			sdb.db.expire.Put(key, v)
+		}
+		sdb.bgDB.expire.Del(key)
+	}
 	for _, key := range sdb.bgDB.data.RandomKey(batch) {
 		_, exists1 := sdb.db.data.Get(key)
 		v, _ := sdb.bgDB.data.Get(key)
@@ -306,7 +532,7 @@ func (sdb *SingleDB) TTLSize() int {
 	return sdb.db.expire.Len()
 }
 
-func newSDB() *SingleDB {
+func newSDB(index int) *SingleDB {
 	db := &carrier{
 		data:   ds.NewDict(dataDictSize, false),
 		expire: ds.NewDict(expireDictSize, false),
@@ -319,6 +545,7 @@ func newSDB() *SingleDB {
 		status: base.WorldNormal,
 		db:     db,
 		bgDB:   bgDB,
+		index:  index,
 	}
 	return sdb
 }
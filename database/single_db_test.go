@@ -0,0 +1,113 @@
+package database
+
+import (
+	"code/regis/base"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSingleDB_ScanHugeCount(t *testing.T) {
+	sdb := newSDB(0)
+	for i := 0; i < 100; i++ {
+		sdb.PutData(fmt.Sprintf("k%v", i), base.RString("v"))
+	}
+	// count*10 溢出时不能一个key都不返回
+	keys, cursor := sdb.Scan(0, math.MaxInt)
+	if len(keys) != 100 || cursor != 0 {
+		t.Errorf("want 100 keys and cursor 0, get %v keys and cursor %v", len(keys), cursor)
+	}
+}
+
+func TestSingleDB_ExpireOnSlave(t *testing.T) {
+	sdb := newSDB(0)
+	sdb.PutData("k", base.RString("v"))
+	sdb.SetExpire("k", time.Now().Add(-time.Second))
+
+	// slave 上过期的key当作不存在，但要等 master 传播 del 才删除
+	base.IsSlave = func() bool { return true }
+	defer func() { base.IsSlave = func() bool { return false } }()
+	if _, ok := sdb.GetData("k"); ok {
+		t.Errorf("expired key should be missing on slave")
+	}
+	if _, ok := sdb.db.data.Get("k"); !ok {
+		t.Errorf("slave should not delete expired key")
+	}
+
+	base.IsSlave = func() bool { return false }
+	if _, ok := sdb.GetData("k"); ok {
+		t.Errorf("expired key should be missing on master")
+	}
+	if _, ok := sdb.db.data.Get("k"); ok {
+		t.Errorf("master should delete expired key")
+	}
+}
+
+func TestSingleDB_ActiveExpire(t *testing.T) {
+	sdb := newSDB(0)
+	expired := 0
+	base.OnKeyExpired = func(dbIndex int, key string) { expired++ }
+	defer func() { base.OnKeyExpired = func(dbIndex int, key string) {} }()
+	for i := 0; i < 10; i++ {
+		sdb.PutData(fmt.Sprintf("old%v", i), base.RString("v"))
+		sdb.SetExpire(fmt.Sprintf("old%v", i), time.Now().Add(-time.Second))
+		sdb.PutData(fmt.Sprintf("new%v", i), base.RString("v"))
+		sdb.SetExpire(fmt.Sprintf("new%v", i), time.Now().Add(time.Hour))
+		sdb.PutData(fmt.Sprintf("persist%v", i), base.RString("v"))
+	}
+	for i := 0; i < 100 && expired < 10; i++ {
+		sdb.activeExpire(20)
+	}
+	if expired != 10 || sdb.Size() != 20 || sdb.TTLSize() != 10 {
+		t.Errorf("want 10 expired keys removed, get %v expired, size %v, ttl size %v", expired, sdb.Size(), sdb.TTLSize())
+	}
+	// 只抽样设置了过期时间的key
+	if sampled, n := sdb.activeExpire(20); sampled != 10 || n != 0 {
+		t.Errorf("want 10 sampled and 0 expired, get %v %v", sampled, n)
+	}
+}
+
+func TestSingleDB_RandomKey(t *testing.T) {
+	sdb := newSDB(0)
+	if _, ok := sdb.RandomKey(); ok {
+		t.Errorf("empty db should have no random key")
+	}
+	sdb.PutData("old", base.RString("v"))
+	sdb.SetExpire("old", time.Now().Add(-time.Second))
+	if key, ok := sdb.RandomKey(); ok {
+		t.Errorf("expired key should not be returned, get %v", key)
+	}
+
+	// bgsave 期间，新写入的key只在 bgDB 中，被删掉的key在 bgDB 中标记为 base.Null
+	sdb.PutData("k1", base.RString("v"))
+	sdb.SetStatus(base.WorldFrozen)
+	sdb.RemoveData("k1")
+	sdb.PutData("k2", base.RString("v"))
+	for i := 0; i < 20; i++ {
+		if key, ok := sdb.RandomKey(); !ok || key != "k2" {
+			t.Fatalf("want k2, get %v %v", key, ok)
+		}
+	}
+}
+
+func TestSingleDB_ExpireOnSlaveFromMaster(t *testing.T) {
+	sdb := newSDB(0)
+	sdb.PutData("k", base.RString("v"))
+	sdb.SetExpire("k", time.Now().Add(-time.Second))
+	base.IsSlave = func() bool { return true }
+	base.FromMaster = func() bool { return true }
+	defer func() {
+		base.IsSlave = func() bool { return false }
+		base.FromMaster = func() bool { return false }
+	}()
+
+	// master 传播过来的命令按 master 的视角访问key
+	if v, ok := sdb.GetDataForWrite("k"); !ok || v != base.RString("v") {
+		t.Errorf("master command should see the key, get %v %v", v, ok)
+	}
+	base.FromMaster = func() bool { return false }
+	if _, ok := sdb.GetData("k"); ok {
+		t.Errorf("expired key should be missing for other clients")
+	}
+}
@@ -2,9 +2,57 @@ package ds
 
 import (
 	"code/regis/base"
+	"hash/maphash"
+	"math/bits"
+	"math/rand"
 	"sync"
 )
 
+const (
+	// dictInitSize 哈希表最少的桶数
+	dictInitSize = 4
+	// dictRehashEmptyVisits 每搬一个桶最多跳过的空桶数，避免一次rehash耗时过长
+	dictRehashEmptyVisits = 10
+)
+
+var dictSeed = maphash.MakeSeed()
+
+func dictHash(key string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(dictSeed)
+	_, _ = h.WriteString(key)
+	return h.Sum64()
+}
+
+type dictEntry struct {
+	key  string
+	val  interface{}
+	hash uint64
+	next *dictEntry
+}
+
+// dictTable 拉链法的哈希表，桶数总是2的幂，所以可以用 hash & mask 定位桶
+type dictTable struct {
+	buckets []*dictEntry
+	mask    uint64
+	used    int
+}
+
+func newDictTable(size uint64) *dictTable {
+	n := uint64(dictInitSize)
+	for n < size {
+		n <<= 1
+	}
+	return &dictTable{
+		buckets: make([]*dictEntry, n),
+		mask:    n - 1,
+	}
+}
+
+// Dict 和redis的dict一样用两张哈希表实现，扩容或缩容时新建 ht[1]，
+// 之后每次写操作顺带把 ht[0] 的一个桶搬到 ht[1]，搬完后 ht[1] 变成 ht[0]
+// 这样 Scan 可以用无状态的游标遍历，即使两次调用之间发生了扩容缩容，也不会漏掉一直存在的key
+// 除了 Put, Del, Clear 以外的操作都不会修改字典，bgsave时存盘协程遍历字典的同时，主协程仍然可以读
 type Dict struct {
 	// enableLock 是否启用锁，如果不启用，下面的锁都不会执行
 	enableLock bool
@@ -19,16 +67,32 @@ type Dict struct {
 	// 就手动调用 Lock, UnLock 函数来完成
 	serialLock sync.Mutex
 
-	m map[string]interface{}
+	ht [2]*dictTable
+	// used 两张表中key的总数，单独记录而不是每次相加，
+	// 这样 NotifyMoving 这类在别的协程里读 Len 的地方，不会在两张表交换时读到错误的值
+	used int
+	// rehashIdx ht[0] 中下一个要搬的桶，-1 表示没有在rehash
+	rehashIdx int64
+	// initSize 第一次写入时 ht[0] 的桶数，写入前不分配内存
+	initSize uint64
 }
 
 func NewDict(size int64, enableLock bool) *Dict {
+	if size < 0 {
+		size = 0
+	}
 	return &Dict{
 		enableLock: enableLock,
-		m:          make(map[string]interface{}, size),
+		rehashIdx:  -1,
+		initSize:   uint64(size),
 	}
 }
 
+// NewRHash 返回一个作为 base.RHash 使用的字典，value 统一存 []byte，与 SaveRDB 保持一致
+func NewRHash() base.RHash {
+	return NewDict(0, false)
+}
+
 func (dict *Dict) Lock() {
 	if dict.enableLock {
 		dict.serialLock.Lock()
@@ -41,27 +105,168 @@ func (dict *Dict) UnLock() {
 	}
 }
 
+func (dict *Dict) isRehashing() bool {
+	return dict.rehashIdx >= 0
+}
+
+// resize 开始把数据搬到一张能放下size个key的新表中，正在rehash时什么都不做
+func (dict *Dict) resize(size uint64) {
+	if dict.isRehashing() {
+		return
+	}
+	t := newDictTable(size)
+	if dict.ht[0] == nil {
+		dict.ht[0] = t
+		return
+	}
+	if len(t.buckets) == len(dict.ht[0].buckets) {
+		return
+	}
+	dict.ht[1] = t
+	dict.rehashIdx = 0
+}
+
+// rehash 最多搬n个桶，ht[0] 搬空之后结束rehash
+func (dict *Dict) rehash(n int) {
+	if !dict.isRehashing() {
+		return
+	}
+	t0, t1 := dict.ht[0], dict.ht[1]
+	emptyVisits := n * dictRehashEmptyVisits
+	for ; n > 0 && t0.used > 0; n-- {
+		for t0.buckets[dict.rehashIdx] == nil {
+			dict.rehashIdx++
+			emptyVisits--
+			if emptyVisits == 0 {
+				return
+			}
+		}
+		for e := t0.buckets[dict.rehashIdx]; e != nil; {
+			next := e.next
+			idx := e.hash & t1.mask
+			e.next = t1.buckets[idx]
+			t1.buckets[idx] = e
+			t0.used--
+			t1.used++
+			e = next
+		}
+		t0.buckets[dict.rehashIdx] = nil
+		dict.rehashIdx++
+	}
+	if t0.used == 0 {
+		dict.ht[0], dict.ht[1] = t1, nil
+		dict.rehashIdx = -1
+	}
+}
+
+// find 查找key所在的节点，不会触发rehash
+func (dict *Dict) find(key string, hash uint64) *dictEntry {
+	for _, t := range dict.ht {
+		if t == nil {
+			continue
+		}
+		for e := t.buckets[hash&t.mask]; e != nil; e = e.next {
+			if e.hash == hash && e.key == key {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// forEach 按桶的顺序遍历所有节点，fn 返回false时停止
+func (dict *Dict) forEach(fn func(e *dictEntry) bool) {
+	for _, t := range dict.ht {
+		if t == nil {
+			continue
+		}
+		for _, e := range t.buckets {
+			for ; e != nil; e = e.next {
+				if !fn(e) {
+					return
+				}
+			}
+		}
+	}
+}
+
 func (dict *Dict) Get(key string) (val interface{}, exists bool) {
 	if dict.enableLock {
 		dict.singleLock.Lock()
 		defer dict.singleLock.Unlock()
 	}
-	val, exists = dict.m[key]
-	return val, exists
+	if e := dict.find(key, dictHash(key)); e != nil {
+		return e.val, true
+	}
+	return nil, false
+}
+
+// PickRandomKey 随机取一个key，和redis的 dictGetRandomKey 一样先随机选一个非空的桶，再在桶的链表里随机选一个
+// 装载因子低于0.1时会缩容，所以一般试几次就能选到非空的桶
+func (dict *Dict) PickRandomKey() (string, bool) {
+	if dict.enableLock {
+		dict.singleLock.Lock()
+		defer dict.singleLock.Unlock()
+	}
+	if dict.len() == 0 {
+		return "", false
+	}
+	var e *dictEntry
+	for e == nil {
+		if dict.isRehashing() {
+			// ht[0] 中 rehashIdx 之前的桶已经搬空了，不用再选
+			n0 := int64(len(dict.ht[0].buckets))
+			i := dict.rehashIdx + rand.Int63n(n0+int64(len(dict.ht[1].buckets))-dict.rehashIdx)
+			if i < n0 {
+				e = dict.ht[0].buckets[i]
+			} else {
+				e = dict.ht[1].buckets[i-n0]
+			}
+		} else {
+			e = dict.ht[0].buckets[rand.Intn(len(dict.ht[0].buckets))]
+		}
+	}
+	n := 0
+	for p := e; p != nil; p = p.next {
+		n++
+	}
+	for i := rand.Intn(n); i > 0; i-- {
+		e = e.next
+	}
+	return e.key, true
 }
 
+// RandomKey 从随机的一个桶开始，顺着桶取最多num个key，和redis的 dictGetSomeKeys 一样，取到的key并不是均匀随机的
 func (dict *Dict) RandomKey(num int) []string {
 	if dict.enableLock {
 		dict.singleLock.Lock()
 		defer dict.singleLock.Unlock()
 	}
+	if num > dict.len() {
+		num = dict.len()
+	}
+	if num <= 0 || dict.ht[0] == nil {
+		return []string{}
+	}
 	keys := make([]string, 0, num)
-	for k := range dict.m {
-		if num == 0 {
-			break
+	tables := make([]*dictTable, 0, 2)
+	total := 0
+	for _, t := range dict.ht {
+		if t != nil {
+			tables = append(tables, t)
+			total += len(t.buckets)
 		}
-		keys = append(keys, k)
-		num--
+	}
+	i := rand.Intn(total)
+	for visits := 0; visits < total && len(keys) < num; visits++ {
+		idx, t := i, tables[0]
+		if idx >= len(t.buckets) {
+			idx, t = idx-len(t.buckets), tables[1]
+		}
+		for e := t.buckets[idx]; e != nil && len(keys) < num; e = e.next {
+			keys = append(keys, e.key)
+		}
+		i = (i + 1) % total
 	}
 	return keys
 }
@@ -72,12 +277,27 @@ func (dict *Dict) Put(key string, val interface{}) int {
 		dict.singleLock.Lock()
 		defer dict.singleLock.Unlock()
 	}
-	_, ok := dict.m[key]
-	dict.m[key] = val
-	if !ok {
-		return 1
+	dict.rehash(1)
+	hash := dictHash(key)
+	if e := dict.find(key, hash); e != nil {
+		e.val = val
+		return 0
 	}
-	return 0
+	// 装载因子达到1时扩容一倍
+	if dict.ht[0] == nil {
+		dict.resize(dict.initSize)
+	} else if !dict.isRehashing() && dict.ht[0].used >= len(dict.ht[0].buckets) {
+		dict.resize(uint64(dict.ht[0].used) * 2)
+	}
+	t := dict.ht[0]
+	if dict.isRehashing() {
+		t = dict.ht[1]
+	}
+	idx := hash & t.mask
+	t.buckets[idx] = &dictEntry{key: key, val: val, hash: hash, next: t.buckets[idx]}
+	t.used++
+	dict.used++
+	return 1
 }
 
 // Del 删除，返回删除后更改的数量
@@ -86,12 +306,32 @@ func (dict *Dict) Del(key string) int {
 		dict.singleLock.Lock()
 		defer dict.singleLock.Unlock()
 	}
-	_, ok := dict.m[key]
-	if !ok {
-		return 0
+	dict.rehash(1)
+	hash := dictHash(key)
+	for _, t := range dict.ht {
+		if t == nil {
+			continue
+		}
+		idx := hash & t.mask
+		for prev, e := (*dictEntry)(nil), t.buckets[idx]; e != nil; prev, e = e, e.next {
+			if e.hash != hash || e.key != key {
+				continue
+			}
+			if prev == nil {
+				t.buckets[idx] = e.next
+			} else {
+				prev.next = e.next
+			}
+			t.used--
+			dict.used--
+			// 装载因子低于0.1时缩容
+			if !dict.isRehashing() && len(t.buckets) > dictInitSize && t.used*10 < len(t.buckets) {
+				dict.resize(uint64(t.used))
+			}
+			return 1
+		}
 	}
-	delete(dict.m, key)
-	return 1
+	return 0
 }
 
 /*RangeKey
@@ -123,13 +363,14 @@ func (dict *Dict) RangeKey(ch <-chan struct{}) chan string {
 				dict.singleLock.Unlock()
 			}
 		}()
-		for k := range dict.m {
+		dict.forEach(func(e *dictEntry) bool {
 			select {
 			case <-ch: // c被close或者传入信号时，都会触发，此时就要结束该协程
-				return
-			case keys <- k:
+				return false
+			case keys <- e.key:
+				return true
 			}
-		}
+		})
 	}()
 	return keys
 }
@@ -146,35 +387,83 @@ func (dict *Dict) RangeKV(ch <-chan struct{}) chan base.DictKV {
 				dict.singleLock.Unlock()
 			}
 		}()
-		for k, v := range dict.m {
+		dict.forEach(func(e *dictEntry) bool {
 			select {
 			case <-ch:
-				return
-			case keys <- base.DictKV{Key: k, Val: v}:
+				return false
+			case keys <- base.DictKV{Key: e.key, Val: e.val}:
+				return true
 			}
-		}
+		})
 	}()
 	return keys
 }
 
-func (dict *Dict) GetAllKeys() []string {
+// Scan 从游标cursor开始遍历一个桶（rehash期间是小表的一个桶和大表中对应的几个桶），
+// 对其中的每个key调用fn，返回下一次的游标，返回0表示遍历结束
+// 游标按反向二进制递增，高位先变，所以两次调用之间表扩容或缩容后，已经遍历过的桶仍然对应新表中已经遍历过的桶，
+// 遍历开始前就存在、并且一直没有被删除的key一定会被返回，但可能返回不止一次
+// fn 中不能修改字典
+func (dict *Dict) Scan(cursor uint64, fn func(key string, val interface{})) uint64 {
 	if dict.enableLock {
 		dict.singleLock.Lock()
 		defer dict.singleLock.Unlock()
 	}
-	ret := make([]string, 0, len(dict.m))
-	for k := range dict.m {
-		ret = append(ret, k)
+	if dict.len() == 0 {
+		return 0
+	}
+	emit := func(t *dictTable, idx uint64) {
+		for e := t.buckets[idx]; e != nil; e = e.next {
+			fn(e.key, e.val)
+		}
+	}
+	v := cursor
+	if !dict.isRehashing() {
+		t := dict.ht[0]
+		emit(t, v&t.mask)
+		v |= ^t.mask
+		return bits.Reverse64(bits.Reverse64(v) + 1)
+	}
+	small, large := dict.ht[0], dict.ht[1]
+	if len(small.buckets) > len(large.buckets) {
+		small, large = large, small
+	}
+	emit(small, v&small.mask)
+	// 小表的一个桶对应大表中低位相同的几个桶，把它们都遍历完
+	for {
+		emit(large, v&large.mask)
+		v |= ^large.mask
+		v = bits.Reverse64(bits.Reverse64(v) + 1)
+		if v&(small.mask^large.mask) == 0 {
+			break
+		}
+	}
+	return v
+}
+
+func (dict *Dict) GetAllKeys() []string {
+	if dict.enableLock {
+		dict.singleLock.Lock()
+		defer dict.singleLock.Unlock()
 	}
+	ret := make([]string, 0, dict.len())
+	dict.forEach(func(e *dictEntry) bool {
+		ret = append(ret, e.key)
+		return true
+	})
 	return ret
 }
 
+func (dict *Dict) len() int {
+	return dict.used
+}
+
 func (dict *Dict) Len() int {
 	if dict.enableLock {
 		dict.singleLock.Lock()
 		defer dict.singleLock.Unlock()
 	}
-	return len(dict.m)
+	return dict.len()
 }
 
 func (dict *Dict) Clear() {
@@ -182,5 +471,30 @@ func (dict *Dict) Clear() {
 		dict.singleLock.Lock()
 		defer dict.singleLock.Unlock()
 	}
-	dict.m = map[string]interface{}{}
+	dict.ht = [2]*dictTable{}
+	dict.used = 0
+	dict.rehashIdx = -1
+}
+
+// Clone 复制一份字典，value 是 []byte，写命令总是整体替换而不是原地修改，所以可以共享
+func (dict *Dict) Clone() interface{} {
+	if dict.enableLock {
+		dict.singleLock.Lock()
+		defer dict.singleLock.Unlock()
+	}
+	ret := NewDict(int64(dict.initSize), dict.enableLock)
+	n := dict.len()
+	if n == 0 {
+		return ret
+	}
+	t := newDictTable(uint64(n))
+	dict.forEach(func(e *dictEntry) bool {
+		idx := e.hash & t.mask
+		t.buckets[idx] = &dictEntry{key: e.key, val: e.val, hash: e.hash, next: t.buckets[idx]}
+		return true
+	})
+	t.used = n
+	ret.ht[0] = t
+	ret.used = n
+	return ret
 }
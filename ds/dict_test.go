@@ -46,3 +46,108 @@ func TestDict_RangeKV(t *testing.T) {
 	time.Sleep(1 * time.Second)
 	//log.Info("AAA")
 }
+
+func TestDict_Clone(t *testing.T) {
+	dict := NewDict(16, false)
+	dict.Put("a", []byte("1"))
+	cp := dict.Clone().(*Dict)
+	cp.Put("b", []byte("2"))
+	cp.Del("a")
+	if _, ok := dict.Get("a"); !ok {
+		t.Errorf("clone should not share keys")
+	}
+	if _, ok := dict.Get("b"); ok {
+		t.Errorf("clone should not share keys")
+	}
+}
+
+func TestDict_PutDelRehash(t *testing.T) {
+	dict := NewDict(0, false)
+	for i := 0; i < 1000; i++ {
+		if dict.Put(fmt.Sprintf("k%v", i), i) != 1 {
+			t.Fatalf("put k%v should add a key", i)
+		}
+	}
+	if dict.Put("k1", -1) != 0 || dict.Len() != 1000 {
+		t.Fatalf("update should not add a key, len %v", dict.Len())
+	}
+	for i := 0; i < 1000; i += 2 {
+		dict.Del(fmt.Sprintf("k%v", i))
+	}
+	for i := 0; i < 1000; i++ {
+		v, ok := dict.Get(fmt.Sprintf("k%v", i))
+		if ok != (i%2 == 1) {
+			t.Fatalf("get k%v = %v, %v", i, v, ok)
+		}
+	}
+	if dict.Len() != 500 || len(dict.GetAllKeys()) != 500 || len(dict.RandomKey(10)) != 10 {
+		t.Errorf("len = %v", dict.Len())
+	}
+}
+
+func TestDict_PickRandomKey(t *testing.T) {
+	dict := NewDict(0, false)
+	if _, ok := dict.PickRandomKey(); ok {
+		t.Fatalf("empty dict should not return a key")
+	}
+	// 扩容的rehash过程中选出的key也都要存在
+	rehashing := false
+	for i := 0; i < 200; i++ {
+		dict.Put(fmt.Sprintf("k%v", i), i)
+		rehashing = rehashing || dict.isRehashing()
+		key, ok := dict.PickRandomKey()
+		if _, exists := dict.Get(key); !ok || !exists {
+			t.Fatalf("pick %v, %v not in dict", key, ok)
+		}
+	}
+	if !rehashing {
+		t.Errorf("dict should have rehashed")
+	}
+
+	small := NewDict(0, false)
+	for i := 0; i < 5; i++ {
+		small.Put(fmt.Sprintf("k%v", i), i)
+	}
+	seen := make(map[string]struct{})
+	for i := 0; i < 1000; i++ {
+		key, _ := small.PickRandomKey()
+		seen[key] = struct{}{}
+	}
+	if len(seen) != 5 {
+		t.Errorf("want all 5 keys picked, get %v", seen)
+	}
+}
+
+// 遍历期间字典扩容、缩容，遍历开始前就存在且没有被删除的key都要被返回
+func TestDict_Scan(t *testing.T) {
+	dict := NewDict(0, false)
+	for i := 0; i < 100; i++ {
+		dict.Put(fmt.Sprintf("old%v", i), i)
+	}
+	seen := make(map[string]bool)
+	collect := func(key string, _ interface{}) {
+		seen[key] = true
+	}
+	cursor, round := dict.Scan(0, collect), 0
+	for cursor != 0 {
+		round++
+		switch {
+		case round < 20:
+			// 扩容
+			for i := 0; i < 50; i++ {
+				dict.Put(fmt.Sprintf("new%v-%v", round, i), i)
+			}
+		case round < 40:
+			// 缩容
+			for i := 0; i < 50; i++ {
+				dict.Del(fmt.Sprintf("new%v-%v", round-19, i))
+			}
+		}
+		cursor = dict.Scan(cursor, collect)
+	}
+	for i := 0; i < 100; i++ {
+		if !seen[fmt.Sprintf("old%v", i)] {
+			t.Errorf("old%v is not returned by scan", i)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package ds
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// HyperLogLog 与redis兼容的 HyperLogLog，以redis的字符串格式存储，可以直接通过 RDB 和主从复制传输
+// 格式：
+// +------+---+-----+----------+-----------+
+// | HYLL | E | N/U | Cardin.  | registers |
+// +------+---+-----+----------+-----------+
+// E 是编码方式，0 为 dense，1 为 sparse；N/U 是3个保留字节；Cardin. 是8字节小端的基数缓存，最高位为1时表示缓存失效
+//
+// dense 编码：16384个6位的寄存器，从低位开始连续存放
+// sparse 编码，对连续相同的寄存器做游程编码，有三种操作码：
+// ZERO:  00xxxxxx           连续 xxxxxx+1 个寄存器为0，最多64个
+// XZERO: 01xxxxxx yyyyyyyy  连续 xxxxxxyyyyyyyy+1 个寄存器为0，最多16384个
+// VAL:   1vvvvvxx           连续 xx+1 个寄存器的值都是 vvvvv+1，最多4个，值最大32
+
+const (
+	HLLP         = 14 // 用哈希值的低14位选择寄存器
+	HLLQ         = 64 - HLLP
+	HLLRegisters = 1 << HLLP
+	hllPMask     = HLLRegisters - 1
+	hllBits      = 6
+	hllRegMax    = 1<<hllBits - 1
+	hllHdrSize   = 16
+	hllDenseSize = hllHdrSize + (HLLRegisters*hllBits+7)/8
+	hllDense     = 0
+	hllSparse    = 1
+
+	hllSparseValMax     = 32
+	hllSparseValMaxLen  = 4
+	hllSparseZeroMaxLen = 64
+	hllSparseXZeroMax   = 16384
+	// hllSparseMaxBytes sparse 编码超过这个长度时转换成 dense 编码，与redis的 hll-sparse-max-bytes 默认值相同
+	hllSparseMaxBytes = 3000
+
+	hllAlphaInf = 0.721347520444481703680 // 0.5/ln(2)
+)
+
+var (
+	// ErrHLLInvalid 不是 HyperLogLog 格式的字符串
+	ErrHLLInvalid = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	// ErrHLLCorrupted 头部正确，但寄存器的数据损坏了
+	ErrHLLCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// HyperLogLog 解码后的 HyperLogLog，寄存器统一展开成数组，写回时再按原来的编码方式编码
+type HyperLogLog struct {
+	regs       [HLLRegisters]uint8
+	dense      bool
+	card       uint64
+	cacheValid bool
+}
+
+// NewHLL 新建一个空的 HyperLogLog，使用 sparse 编码
+func NewHLL() *HyperLogLog {
+	return &HyperLogLog{cacheValid: true}
+}
+
+// IsHLL 判断字符串是不是 HyperLogLog 的格式，只检查头部和 dense 编码的长度
+func IsHLL(buf []byte) bool {
+	if len(buf) < hllHdrSize || string(buf[:4]) != "HYLL" || buf[4] > hllSparse {
+		return false
+	}
+	return buf[4] != hllDense || len(buf) == hllDenseSize
+}
+
+// ParseHLL 从字符串解码 HyperLogLog
+func ParseHLL(buf []byte) (*HyperLogLog, error) {
+	if !IsHLL(buf) {
+		return nil, ErrHLLInvalid
+	}
+	h := &HyperLogLog{
+		dense:      buf[4] == hllDense,
+		cacheValid: buf[15]&(1<<7) == 0,
+		card:       binary.LittleEndian.Uint64(buf[8:16]),
+	}
+	if h.dense {
+		for i := 0; i < HLLRegisters; i++ {
+			h.regs[i] = denseGetRegister(buf[hllHdrSize:], i)
+		}
+		return h, nil
+	}
+
+	idx := 0
+	p := buf[hllHdrSize:]
+	for i := 0; i < len(p); i++ {
+		op := p[i]
+		var run, val int
+		switch {
+		case op&0xc0 == 0x00: // ZERO
+			run = int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(p) {
+				return nil, ErrHLLCorrupted
+			}
+			run = (int(op&0x3f)<<8 | int(p[i+1])) + 1
+			i++
+		default: // VAL
+			val = int(op>>2&0x1f) + 1
+			run = int(op&0x3) + 1
+		}
+		if idx+run > HLLRegisters {
+			return nil, ErrHLLCorrupted
+		}
+		for j := 0; j < run; j++ {
+			h.regs[idx+j] = uint8(val)
+		}
+		idx += run
+	}
+	if idx != HLLRegisters {
+		return nil, ErrHLLCorrupted
+	}
+	return h, nil
+}
+
+// denseGetRegister 读取 dense 编码中第i个寄存器
+func denseGetRegister(p []byte, i int) uint8 {
+	pos := i * hllBits
+	b, fb := pos/8, uint(pos&7)
+	v := p[b] >> fb
+	if b+1 < len(p) {
+		v |= p[b+1] << (8 - fb)
+	}
+	return v & hllRegMax
+}
+
+// denseSetRegister 设置 dense 编码中第i个寄存器
+func denseSetRegister(p []byte, i int, val uint8) {
+	pos := i * hllBits
+	b, fb := pos/8, uint(pos&7)
+	p[b] &^= hllRegMax << fb
+	p[b] |= val << fb
+	if b+1 < len(p) {
+		p[b+1] &^= hllRegMax >> (8 - fb)
+		p[b+1] |= val >> (8 - fb)
+	}
+}
+
+// murmurHash64A redis 中使用的 64 位 MurmurHash2
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+	n := len(key) / 8 * 8
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	tail := key[n:]
+	switch len(tail) {
+	case 7:
+		h ^= uint64(tail[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(tail[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(tail[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(tail[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(tail[0])
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllPatLen 返回元素对应的寄存器下标，以及哈希值剩余部分中第一个1出现的位置
+func hllPatLen(elem []byte) (int, uint8) {
+	hash := murmurHash64A(elem, 0xadc83b19)
+	index := int(hash & hllPMask)
+	hash >>= HLLP
+	hash |= 1 << HLLQ // 保证循环一定会结束
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// Add 添加元素，有寄存器被更新时返回true
+func (h *HyperLogLog) Add(elem []byte) bool {
+	index, count := hllPatLen(elem)
+	if h.regs[index] >= count {
+		return false
+	}
+	h.regs[index] = count
+	h.cacheValid = false
+	return true
+}
+
+// Merge 把o合并进来，每个寄存器取两者中的最大值，o是 dense 编码时结果也使用 dense 编码
+func (h *HyperLogLog) Merge(o *HyperLogLog) {
+	for i := range h.regs {
+		if o.regs[i] > h.regs[i] {
+			h.regs[i] = o.regs[i]
+			h.cacheValid = false
+		}
+	}
+	if o.dense {
+		h.dense = true
+	}
+}
+
+// hllSigma, hllTau 见 Otmar Ertl 的论文 "New cardinality estimation algorithms for HyperLogLog sketches"
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// Count 估算基数，缓存有效时直接返回缓存的值
+func (h *HyperLogLog) Count() uint64 {
+	if h.cacheValid {
+		return h.card
+	}
+	var histo [64]int
+	for _, v := range h.regs {
+		histo[v]++
+	}
+	m := float64(HLLRegisters)
+	z := m * hllTau((m-float64(histo[HLLQ+1]))/m)
+	for j := HLLQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histo[0])/m)
+	h.card = uint64(math.Round(hllAlphaInf * m * m / z))
+	h.cacheValid = true
+	return h.card
+}
+
+// CacheValid 基数缓存是否有效
+func (h *HyperLogLog) CacheValid() bool {
+	return h.cacheValid
+}
+
+// IsDense 是否是 dense 编码
+func (h *HyperLogLog) IsDense() bool {
+	return h.dense
+}
+
+// Bytes 编码成redis格式的字符串，sparse 编码放不下时自动转换成 dense 编码
+func (h *HyperLogLog) Bytes() []byte {
+	if !h.dense {
+		if buf, ok := h.encodeSparse(); ok {
+			return buf
+		}
+		h.dense = true
+	}
+	buf := h.header(hllDense, hllDenseSize)
+	for i := 0; i < HLLRegisters; i++ {
+		denseSetRegister(buf[hllHdrSize:], i, h.regs[i])
+	}
+	return buf
+}
+
+func (h *HyperLogLog) header(encoding byte, size int) []byte {
+	buf := make([]byte, hllHdrSize, size)
+	copy(buf, "HYLL")
+	buf[4] = encoding
+	if h.cacheValid {
+		binary.LittleEndian.PutUint64(buf[8:16], h.card)
+	} else {
+		buf[15] |= 1 << 7
+	}
+	if encoding == hllDense {
+		buf = buf[:size]
+	}
+	return buf
+}
+
+// encodeSparse 按 sparse 编码，寄存器的值超过32或者长度超过 hllSparseMaxBytes 时返回false
+func (h *HyperLogLog) encodeSparse() ([]byte, bool) {
+	buf := h.header(hllSparse, hllHdrSize+2)
+	for i := 0; i < HLLRegisters; {
+		v := h.regs[i]
+		j := i + 1
+		for j < HLLRegisters && h.regs[j] == v {
+			j++
+		}
+		run := j - i
+		i = j
+		if v > hllSparseValMax {
+			return nil, false
+		}
+		for run > 0 {
+			switch {
+			case v != 0:
+				n := run
+				if n > hllSparseValMaxLen {
+					n = hllSparseValMaxLen
+				}
+				buf = append(buf, 0x80|(v-1)<<2|byte(n-1))
+				run -= n
+			case run > hllSparseZeroMaxLen:
+				n := run
+				if n > hllSparseXZeroMax {
+					n = hllSparseXZeroMax
+				}
+				buf = append(buf, 0x40|byte((n-1)>>8), byte((n-1)&0xff))
+				run -= n
+			default:
+				buf = append(buf, byte(run-1))
+				run = 0
+			}
+		}
+		if len(buf) > hllSparseMaxBytes {
+			return nil, false
+		}
+	}
+	return buf, true
+}
@@ -0,0 +1,85 @@
+package ds
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestNewHLL_Bytes(t *testing.T) {
+	// 和redis中 pfadd 新建的空 HyperLogLog 完全一样
+	want := []byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff")
+	if got := NewHLL().Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("empty hll = %q, want %q", got, want)
+	}
+}
+
+func TestHyperLogLog_Count(t *testing.T) {
+	h := NewHLL()
+	for _, e := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		h.Add([]byte(e))
+	}
+	if n := h.Count(); n != 7 {
+		t.Errorf("count = %v, want 7", n)
+	}
+
+	h = NewHLL()
+	total := 100000
+	for i := 0; i < total; i++ {
+		h.Add([]byte(fmt.Sprintf("elem:%v", i)))
+	}
+	n := h.Count()
+	if math.Abs(float64(n)-float64(total))/float64(total) > 0.02 {
+		t.Errorf("count = %v, too far from %v", n, total)
+	}
+	if !h.IsDense() {
+		buf := h.Bytes()
+		if !h.IsDense() || len(buf) != hllDenseSize {
+			t.Errorf("large hll should be promoted to dense")
+		}
+	}
+}
+
+func TestParseHLL(t *testing.T) {
+	h := NewHLL()
+	for i := 0; i < 500; i++ {
+		h.Add([]byte(fmt.Sprintf("%v", i)))
+	}
+	want := h.Count()
+	for _, dense := range []bool{false, true} {
+		h.dense = dense
+		p, err := ParseHLL(h.Bytes())
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		if p.regs != h.regs {
+			t.Errorf("dense=%v registers mismatch after round trip", dense)
+		}
+		if !p.CacheValid() || p.Count() != want {
+			t.Errorf("dense=%v cached count = %v, want %v", dense, p.Count(), want)
+		}
+	}
+
+	if _, err := ParseHLL([]byte("not a hll")); err != ErrHLLInvalid {
+		t.Errorf("want ErrHLLInvalid, got %v", err)
+	}
+	bad := NewHLL().Bytes()
+	bad = append(bad, 0x00)
+	if _, err := ParseHLL(bad); err != ErrHLLCorrupted {
+		t.Errorf("want ErrHLLCorrupted, got %v", err)
+	}
+}
+
+func TestHyperLogLog_Merge(t *testing.T) {
+	a, b := NewHLL(), NewHLL()
+	for i := 0; i < 1000; i++ {
+		a.Add([]byte(fmt.Sprintf("a%v", i)))
+		b.Add([]byte(fmt.Sprintf("b%v", i)))
+	}
+	a.Merge(b)
+	n := a.Count()
+	if math.Abs(float64(n)-2000)/2000 > 0.02 {
+		t.Errorf("merged count = %v, want about 2000", n)
+	}
+}
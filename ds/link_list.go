@@ -138,23 +138,17 @@ func (list *LinkedList) index(pos int64) *node {
 		return list.tail
 	}
 
+	var cur *node
 	if pos <= list.Len()/2 { // 从head遍历
-		for cur := list.head; cur != list.tail; cur = cur.next {
-			if pos == 0 {
-				return cur
-			}
-			pos--
+		for cur = list.head; pos > 0; pos-- {
+			cur = cur.next
 		}
 	} else { // 从tail遍历
-		pos = list.Len() - pos - 1
-		for cur := list.tail; cur != list.head; cur = cur.prev {
-			if pos == 0 {
-				return cur
-			}
-			pos--
+		for cur, pos = list.tail, list.Len()-pos-1; pos > 0; pos-- {
+			cur = cur.prev
 		}
 	}
-	return nil
+	return cur
 }
 
 // find 找出符合的所有节点
@@ -305,23 +299,32 @@ func (list *LinkedList) Range(ch <-chan struct{}) chan interface{} {
 	return vals
 }
 
-func (list *LinkedList) LRange(from, to int64) []interface{} {
-	if from < -list.len {
-		from = 0
-	}
+// normRange 按redis的规则处理 [from, to] 区间，负数表示从尾部开始数，越界时截断，区间为空时返回false
+func (list *LinkedList) normRange(from, to int64) (int64, int64, bool) {
 	if from < 0 {
 		from += list.len
 	}
-	if to < -list.len {
-		to = 0
-	}
 	if to < 0 {
 		to += list.len
 	}
-	num := int(to - from + 1)
-	if num <= 0 {
+	if from < 0 {
+		from = 0
+	}
+	if from > to || from >= list.len {
+		return 0, 0, false
+	}
+	if to >= list.len {
+		to = list.len - 1
+	}
+	return from, to, true
+}
+
+func (list *LinkedList) LRange(from, to int64) []interface{} {
+	from, to, ok := list.normRange(from, to)
+	if !ok {
 		return nil
 	}
+	num := int(to - from + 1)
 	ret := make([]interface{}, num)
 	n := list.index(from)
 	for i := 0; i < num; i++ {
@@ -331,6 +334,95 @@ func (list *LinkedList) LRange(from, to int64) []interface{} {
 	return ret
 }
 
+// Walk 从头部或尾部开始依次访问元素，fn 的参数是元素的下标和值，fn 返回false时停止
+// 在主协程中同步访问，不像 Range 那样开协程，适合只需要看一部分元素就停下的命令，比如 LPOS
+func (list *LinkedList) Walk(fromTail bool, fn func(pos int64, val interface{}) bool) {
+	if fromTail {
+		n := list.tail
+		for i := list.len - 1; i >= 0; i-- {
+			if !fn(i, n.val) {
+				return
+			}
+			n = n.prev
+		}
+		return
+	}
+	n := list.head
+	for i := int64(0); i < list.len; i++ {
+		if !fn(i, n.val) {
+			return
+		}
+		n = n.next
+	}
+}
+
+// Index 返回下标为pos的元素，pos < 0 时从尾部开始数，越界时返回false
+func (list *LinkedList) Index(pos int64) (interface{}, bool) {
+	if pos < 0 {
+		pos += list.len
+	}
+	if pos < 0 || pos >= list.len {
+		return nil, false
+	}
+	return list.index(pos).val, true
+}
+
+// Set 修改下标为pos的元素，下标规则同 Index，越界时返回false
+func (list *LinkedList) Set(pos int64, val interface{}) bool {
+	if pos < 0 {
+		pos += list.len
+	}
+	if pos < 0 || pos >= list.len {
+		return false
+	}
+	list.index(pos).val = val
+	return true
+}
+
+// PopHead 弹出头部元素，list为空时返回nil
+func (list *LinkedList) PopHead() interface{} {
+	if list.len == 0 {
+		return nil
+	}
+	n := list.head
+	list.remove(n)
+	return n.val
+}
+
+// PopTail 弹出尾部元素，list为空时返回nil
+func (list *LinkedList) PopTail() interface{} {
+	if list.len == 0 {
+		return nil
+	}
+	n := list.tail
+	list.remove(n)
+	return n.val
+}
+
+// Trim 只保留 [from, to] 中的元素，下标规则同 LRange，区间为空时清空list
+func (list *LinkedList) Trim(from, to int64) {
+	from, to, ok := list.normRange(from, to)
+	if !ok {
+		list.Clear()
+		return
+	}
+	for list.len > to+1 {
+		list.remove(list.tail)
+	}
+	for ; from > 0; from-- {
+		list.remove(list.head)
+	}
+}
+
+// Clone 复制一份list，元素是不可变的字符串，所以可以共享
+func (list *LinkedList) Clone() interface{} {
+	ret := &LinkedList{}
+	for i, cur := int64(0), list.head; i < list.len; i, cur = i+1, cur.next {
+		ret.PushTail(cur.val)
+	}
+	return ret
+}
+
 // insert 插入链表成为下标为pos的node，如果pos为负数或0，则成为头部，如果pos>=len，则成为尾部
 func (list *LinkedList) insert(n *node, pos int64) {
 	defer func() { list.len++ }()
@@ -129,3 +129,84 @@ func TestLinkedList_Range(t *testing.T) {
 	list.Print()
 	time.Sleep(time.Second)
 }
+
+func TestLinkedList_Index(t *testing.T) {
+	list := NewLinkedList("a", "b", "c", "d", "e")
+	for i, want := range []string{"a", "b", "c", "d", "e"} {
+		if v, ok := list.Index(int64(i)); !ok || v != want {
+			t.Errorf("index %v want %v, get %v", i, want, v)
+		}
+		if v, ok := list.Index(int64(i - 5)); !ok || v != want {
+			t.Errorf("index %v want %v, get %v", i-5, want, v)
+		}
+	}
+	if _, ok := list.Index(5); ok {
+		t.Errorf("index 5 should be out of range")
+	}
+	if !list.Set(-1, "z") || list.Set(10, "z") {
+		t.Errorf("set wrong")
+	}
+	if v, _ := list.Index(4); v != "z" {
+		t.Errorf("want z, get %v", v)
+	}
+}
+
+func TestLinkedList_LRange(t *testing.T) {
+	list := NewLinkedList("a", "b", "c", "d", "e")
+	cases := []struct {
+		from, to int64
+		want     int
+	}{
+		{0, -1, 5}, {1, 1, 1}, {-100, 100, 5}, {3, 1, 0}, {5, 10, 0}, {-2, -1, 2},
+	}
+	for _, c := range cases {
+		if ret := list.LRange(c.from, c.to); len(ret) != c.want {
+			t.Errorf("lrange %v %v want %v, get %v", c.from, c.to, c.want, ret)
+		}
+	}
+}
+
+func TestLinkedList_Trim(t *testing.T) {
+	list := NewLinkedList("a", "b", "c", "d", "e")
+	list.Trim(1, -2)
+	if ret := list.LRange(0, -1); fmt.Sprint(ret) != "[b c d]" {
+		t.Errorf("want [b c d], get %v", ret)
+	}
+	if list.PopHead() != "b" || list.PopTail() != "d" || list.Len() != 1 {
+		t.Errorf("pop wrong")
+	}
+	list.Trim(5, 10)
+	if list.Len() != 0 || list.PopHead() != nil {
+		t.Errorf("want empty list")
+	}
+}
+
+func TestLinkedList_Walk(t *testing.T) {
+	list := NewLinkedList("a", "b", "c", "d")
+	tests := []struct {
+		fromTail bool
+		stop     int
+		want     string
+	}{
+		{false, 10, "0a1b2c3d"},
+		{true, 10, "3d2c1b0a"},
+		{false, 2, "0a1b"},
+		{true, 1, "3d"},
+	}
+	for _, tt := range tests {
+		get := ""
+		n := 0
+		list.Walk(tt.fromTail, func(pos int64, val interface{}) bool {
+			get += fmt.Sprintf("%v%v", pos, val)
+			n++
+			return n < tt.stop
+		})
+		if get != tt.want {
+			t.Errorf("want %v, get %v", tt.want, get)
+		}
+	}
+	NewLinkedList().Walk(false, func(pos int64, val interface{}) bool {
+		t.Errorf("empty list should not be walked")
+		return true
+	})
+}
@@ -0,0 +1,112 @@
+package ds
+
+import (
+	"code/regis/base"
+	"math/rand"
+)
+
+// Set 集合，作为 base.RSet 提供出去，成员都是字符串
+// 用 Dict 存储成员，value 为nil，以便 sscan 按游标遍历
+type Set struct {
+	m *Dict
+}
+
+// Add 添加成员，返回新增的数量
+func (set *Set) Add(member string) int {
+	return set.m.Put(member, nil)
+}
+
+// Remove 删除成员，返回删除的数量
+func (set *Set) Remove(member string) int {
+	return set.m.Del(member)
+}
+
+func (set *Set) Has(member string) bool {
+	_, ok := set.m.Get(member)
+	return ok
+}
+
+func (set *Set) Len() int {
+	return set.m.Len()
+}
+
+func (set *Set) Members() []string {
+	return set.m.GetAllKeys()
+}
+
+// RandomMembers 随机返回num个成员，成员可能重复
+func (set *Set) RandomMembers(num int) []string {
+	if num <= 0 || set.m.Len() == 0 {
+		return nil
+	}
+	ret := make([]string, 0, num)
+	for i := 0; i < num; i++ {
+		m, _ := set.m.PickRandomKey()
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+// RandomDistinctMembers 随机返回num个不重复的成员，num大于集合大小时，返回全部成员
+// 和redis一样，num比集合小很多时逐个随机选取并去重，否则复制全部成员再洗牌
+func (set *Set) RandomDistinctMembers(num int) []string {
+	if num <= 0 {
+		return nil
+	}
+	size := set.m.Len()
+	if num*3 <= size {
+		ret := make([]string, 0, num)
+		picked := make(map[string]struct{}, num)
+		for len(ret) < num {
+			m, _ := set.m.PickRandomKey()
+			if _, ok := picked[m]; ok {
+				continue
+			}
+			picked[m] = struct{}{}
+			ret = append(ret, m)
+		}
+		return ret
+	}
+	members := set.Members()
+	if num >= len(members) {
+		return members
+	}
+	// 只洗前num个就够了
+	for i := 0; i < num; i++ {
+		j := i + rand.Intn(len(members)-i)
+		members[i], members[j] = members[j], members[i]
+	}
+	return members[:num]
+}
+
+// Range 返回一个传输成员的chan，用法同 Dict.RangeKey
+func (set *Set) Range(ch <-chan struct{}) chan string {
+	return set.m.RangeKey(ch)
+}
+
+// Scan 按游标遍历成员，用法同 Dict.Scan
+func (set *Set) Scan(cursor uint64, fn func(member string)) uint64 {
+	return set.m.Scan(cursor, func(key string, _ interface{}) {
+		fn(key)
+	})
+}
+
+func (set *Set) Clone() interface{} {
+	return &Set{m: set.m.Clone().(*Dict)}
+}
+
+func (set *Set) Clear() {
+	set.m.Clear()
+}
+
+func NewSet(members ...string) *Set {
+	set := &Set{m: NewDict(int64(len(members)), false)}
+	for i := range members {
+		set.m.Put(members[i], nil)
+	}
+	return set
+}
+
+func NewRSet(members ...string) base.RSet {
+	return NewSet(members...)
+}
@@ -0,0 +1,87 @@
+package ds
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	set := NewSet("a", "b", "b", "c")
+	if set.Len() != 3 {
+		t.Errorf("want len 3, get %v", set.Len())
+	}
+	if set.Add("d") != 1 || set.Add("a") != 0 {
+		t.Errorf("add wrong")
+	}
+	if set.Remove("b") != 1 || set.Remove("b") != 0 {
+		t.Errorf("remove wrong")
+	}
+	if !set.Has("a") || set.Has("b") {
+		t.Errorf("has wrong")
+	}
+
+	cp := set.Clone().(*Set)
+	cp.Add("e")
+	if set.Has("e") {
+		t.Errorf("clone should not share members")
+	}
+}
+
+func TestSet_Random(t *testing.T) {
+	set := NewSet()
+	for i := 0; i < 20; i++ {
+		set.Add(fmt.Sprintf("m%v", i))
+	}
+	ms := set.RandomDistinctMembers(10)
+	seen := map[string]struct{}{}
+	for _, m := range ms {
+		if _, ok := seen[m]; ok {
+			t.Errorf("member %v repeated", m)
+		}
+		seen[m] = struct{}{}
+	}
+	if len(ms) != 10 {
+		t.Errorf("want 10 members, get %v", len(ms))
+	}
+	// num 远小于集合大小时逐个选取去重
+	seen = map[string]struct{}{}
+	for _, m := range set.RandomDistinctMembers(5) {
+		if _, ok := seen[m]; ok || !set.Has(m) {
+			t.Errorf("member %v repeated or missing", m)
+		}
+		seen[m] = struct{}{}
+	}
+	if len(seen) != 5 {
+		t.Errorf("want 5 members, get %v", len(seen))
+	}
+	if len(set.RandomDistinctMembers(100)) != 20 {
+		t.Errorf("want all members")
+	}
+	if len(set.RandomMembers(100)) != 100 {
+		t.Errorf("want 100 members")
+	}
+}
+
+func TestSet_Range(t *testing.T) {
+	set := NewSet("a", "b", "c")
+	ch := make(chan struct{})
+	defer close(ch)
+	n := 0
+	for range set.Range(ch) {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("want 3, get %v", n)
+	}
+}
+
+func TestSet_Scan(t *testing.T) {
+	set := NewSet("a", "b", "c")
+	seen := make(map[string]bool)
+	for cursor := set.Scan(0, func(m string) { seen[m] = true }); cursor != 0; {
+		cursor = set.Scan(cursor, func(m string) { seen[m] = true })
+	}
+	if len(seen) != 3 {
+		t.Errorf("scan = %v", seen)
+	}
+}
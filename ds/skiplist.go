@@ -0,0 +1,428 @@
+package ds
+
+import (
+	"code/regis/base"
+	"math/rand"
+)
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+)
+
+type skipListLevel struct {
+	forward *skipListNode
+	// span 到 forward 之间跨过了多少个节点，用于计算排名
+	span int64
+}
+
+type skipListNode struct {
+	base.ZEntry
+	backward *skipListNode
+	level    []skipListLevel
+}
+
+// SkipList 跳表，按 (score, member) 升序排列，与redis的zskiplist一致
+// 排名 rank 从1开始，header不计入排名
+type SkipList struct {
+	header *skipListNode
+	tail   *skipListNode
+	length int64
+	level  int
+}
+
+func newSkipListNode(level int, member string, score float64) *skipListNode {
+	return &skipListNode{
+		ZEntry: base.ZEntry{Member: member, Score: score},
+		level:  make([]skipListLevel, level),
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListP {
+		level++
+	}
+	return level
+}
+
+// nodeBefore n 是否排在 (score, member) 之前
+func nodeBefore(n *skipListNode, score float64, member string) bool {
+	return n.Score < score || (n.Score == score && n.Member < member)
+}
+
+func (sl *SkipList) Len() int64 {
+	return sl.length
+}
+
+// Insert 插入一个新节点，调用方保证member不在跳表中
+func (sl *SkipList) Insert(member string, score float64) *skipListNode {
+	update := make([]*skipListNode, skipListMaxLevel)
+	rank := make([]int64, skipListMaxLevel)
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i != sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && nodeBefore(x.level[i].forward, score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	x = newSkipListNode(level, member, score)
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	// 更高层的节点跨过了新节点
+	for i := level; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != sl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+	return x
+}
+
+// deleteNode 删除x，update 是每一层中x的前驱
+func (sl *SkipList) deleteNode(x *skipListNode, update []*skipListNode) {
+	for i := 0; i < sl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.header.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// findUpdate 找出每一层中最后一个排在 (score, member) 之前的节点
+func (sl *SkipList) findUpdate(member string, score float64) []*skipListNode {
+	update := make([]*skipListNode, skipListMaxLevel)
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && nodeBefore(x.level[i].forward, score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return update
+}
+
+// Delete 删除 (score, member) 对应的节点，返回是否删除成功
+func (sl *SkipList) Delete(member string, score float64) bool {
+	update := sl.findUpdate(member, score)
+	x := update[0].level[0].forward
+	if x != nil && x.Score == score && x.Member == member {
+		sl.deleteNode(x, update)
+		return true
+	}
+	return false
+}
+
+// UpdateScore 修改member的分数，调用方保证 (curScore, member) 在跳表中
+func (sl *SkipList) UpdateScore(member string, curScore, newScore float64) *skipListNode {
+	update := sl.findUpdate(member, curScore)
+	x := update[0].level[0].forward
+
+	// 修改分数后位置不变的话，直接原地修改
+	if (x.backward == nil || nodeBefore(x.backward, newScore, member)) &&
+		(x.level[0].forward == nil || !nodeBefore(x.level[0].forward, newScore, member)) {
+		x.Score = newScore
+		return x
+	}
+
+	sl.deleteNode(x, update)
+	return sl.Insert(member, newScore)
+}
+
+// GetRank 返回 (score, member) 的排名，从1开始，不存在时返回0
+func (sl *SkipList) GetRank(member string, score float64) int64 {
+	var rank int64 = 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && (x.level[i].forward.Score < score ||
+			(x.level[i].forward.Score == score && x.level[i].forward.Member <= member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != sl.header && x.Member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// GetByRank 返回排名为rank的节点，rank从1开始
+func (sl *SkipList) GetByRank(rank int64) *skipListNode {
+	var traversed int64 = 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+func scoreGteMin(v float64, min base.ScoreBorder) bool {
+	if min.Exclude {
+		return v > min.Value
+	}
+	return v >= min.Value
+}
+
+func scoreLteMax(v float64, max base.ScoreBorder) bool {
+	if max.Exclude {
+		return v < max.Value
+	}
+	return v <= max.Value
+}
+
+// isInScoreRange 跳表中是否有节点在 [min, max] 区间内
+func (sl *SkipList) isInScoreRange(min, max base.ScoreBorder) bool {
+	if min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude)) {
+		return false
+	}
+	if sl.tail == nil || !scoreGteMin(sl.tail.Score, min) {
+		return false
+	}
+	first := sl.header.level[0].forward
+	if first == nil || !scoreLteMax(first.Score, max) {
+		return false
+	}
+	return true
+}
+
+// FirstInScoreRange 返回分数区间内的第一个节点，没有时返回nil
+func (sl *SkipList) FirstInScoreRange(min, max base.ScoreBorder) *skipListNode {
+	if !sl.isInScoreRange(min, max) {
+		return nil
+	}
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !scoreGteMin(x.level[i].forward.Score, min) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !scoreLteMax(x.Score, max) {
+		return nil
+	}
+	return x
+}
+
+// LastInScoreRange 返回分数区间内的最后一个节点，没有时返回nil
+func (sl *SkipList) LastInScoreRange(min, max base.ScoreBorder) *skipListNode {
+	if !sl.isInScoreRange(min, max) {
+		return nil
+	}
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && scoreLteMax(x.level[i].forward.Score, max) {
+			x = x.level[i].forward
+		}
+	}
+	if !scoreGteMin(x.Score, min) {
+		return nil
+	}
+	return x
+}
+
+func lexGteMin(v string, min base.LexBorder) bool {
+	if min.Inf < 0 {
+		return true
+	}
+	if min.Inf > 0 {
+		return false
+	}
+	if min.Exclude {
+		return v > min.Value
+	}
+	return v >= min.Value
+}
+
+func lexLteMax(v string, max base.LexBorder) bool {
+	if max.Inf > 0 {
+		return true
+	}
+	if max.Inf < 0 {
+		return false
+	}
+	if max.Exclude {
+		return v < max.Value
+	}
+	return v <= max.Value
+}
+
+// lexRangeEmpty 字典序区间本身是否为空
+func lexRangeEmpty(min, max base.LexBorder) bool {
+	if min.Inf > 0 || max.Inf < 0 {
+		return true
+	}
+	if min.Inf < 0 || max.Inf > 0 {
+		return false
+	}
+	return min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude))
+}
+
+// isInLexRange 跳表中是否有节点在字典序区间内，只在所有成员分数都相同时有意义
+func (sl *SkipList) isInLexRange(min, max base.LexBorder) bool {
+	if lexRangeEmpty(min, max) {
+		return false
+	}
+	if sl.tail == nil || !lexGteMin(sl.tail.Member, min) {
+		return false
+	}
+	first := sl.header.level[0].forward
+	if first == nil || !lexLteMax(first.Member, max) {
+		return false
+	}
+	return true
+}
+
+// FirstInLexRange 返回字典序区间内的第一个节点，没有时返回nil
+func (sl *SkipList) FirstInLexRange(min, max base.LexBorder) *skipListNode {
+	if !sl.isInLexRange(min, max) {
+		return nil
+	}
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !lexGteMin(x.level[i].forward.Member, min) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !lexLteMax(x.Member, max) {
+		return nil
+	}
+	return x
+}
+
+// LastInLexRange 返回字典序区间内的最后一个节点，没有时返回nil
+func (sl *SkipList) LastInLexRange(min, max base.LexBorder) *skipListNode {
+	if !sl.isInLexRange(min, max) {
+		return nil
+	}
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && lexLteMax(x.level[i].forward.Member, max) {
+			x = x.level[i].forward
+		}
+	}
+	if !lexGteMin(x.Member, min) {
+		return nil
+	}
+	return x
+}
+
+// DeleteRangeByScore 删除分数在区间内的所有节点，返回被删除的节点，复杂度 O(log(N) + M)
+func (sl *SkipList) DeleteRangeByScore(min, max base.ScoreBorder) []base.ZEntry {
+	update := make([]*skipListNode, skipListMaxLevel)
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !scoreGteMin(x.level[i].forward.Score, min) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	removed := make([]base.ZEntry, 0)
+	x = x.level[0].forward
+	for x != nil && scoreLteMax(x.Score, max) {
+		next := x.level[0].forward
+		sl.deleteNode(x, update)
+		removed = append(removed, x.ZEntry)
+		x = next
+	}
+	return removed
+}
+
+// DeleteRangeByLex 删除字典序在区间内的所有节点，返回被删除的节点，复杂度 O(log(N) + M)
+func (sl *SkipList) DeleteRangeByLex(min, max base.LexBorder) []base.ZEntry {
+	removed := make([]base.ZEntry, 0)
+	if lexRangeEmpty(min, max) {
+		return removed
+	}
+	update := make([]*skipListNode, skipListMaxLevel)
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !lexGteMin(x.level[i].forward.Member, min) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+	for x != nil && lexLteMax(x.Member, max) {
+		next := x.level[0].forward
+		sl.deleteNode(x, update)
+		removed = append(removed, x.ZEntry)
+		x = next
+	}
+	return removed
+}
+
+// DeleteRangeByRank 删除排名在 [start, stop] 内的所有节点，排名从1开始，返回被删除的节点，复杂度 O(log(N) + M)
+func (sl *SkipList) DeleteRangeByRank(start, stop int64) []base.ZEntry {
+	update := make([]*skipListNode, skipListMaxLevel)
+	var traversed int64 = 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span < start {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	removed := make([]base.ZEntry, 0)
+	traversed++
+	x = x.level[0].forward
+	for x != nil && traversed <= stop {
+		next := x.level[0].forward
+		sl.deleteNode(x, update)
+		removed = append(removed, x.ZEntry)
+		traversed++
+		x = next
+	}
+	return removed
+}
+
+func NewSkipList() *SkipList {
+	return &SkipList{
+		header: newSkipListNode(skipListMaxLevel, "", 0),
+		level:  1,
+	}
+}
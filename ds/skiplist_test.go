@@ -0,0 +1,109 @@
+package ds
+
+import (
+	"code/regis/base"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// checkSkipList 按层0遍历，检查顺序、backward指针以及每个节点的排名
+func checkSkipList(t *testing.T, sl *SkipList, want map[string]float64) {
+	members := make([]string, 0, len(want))
+	for m := range want {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if want[members[i]] != want[members[j]] {
+			return want[members[i]] < want[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	if sl.Len() != int64(len(members)) {
+		t.Fatalf("want len %v, get %v", len(members), sl.Len())
+	}
+	var prev *skipListNode
+	n := sl.header.level[0].forward
+	for i, m := range members {
+		if n == nil || n.Member != m || n.Score != want[m] {
+			t.Fatalf("pos %v want %v", i, m)
+		}
+		if n.backward != prev {
+			t.Fatalf("backward of %v is wrong", m)
+		}
+		if r := sl.GetRank(m, want[m]); r != int64(i+1) {
+			t.Fatalf("rank of %v want %v, get %v", m, i+1, r)
+		}
+		if sl.GetByRank(int64(i+1)) != n {
+			t.Fatalf("get by rank %v wrong", i+1)
+		}
+		prev = n
+		n = n.level[0].forward
+	}
+	if sl.tail != prev {
+		t.Fatalf("tail is wrong")
+	}
+}
+
+func TestSkipList(t *testing.T) {
+	sl := NewSkipList()
+	want := map[string]float64{}
+	for i := 0; i < 2000; i++ {
+		m := fmt.Sprintf("m%v", rand.Intn(300))
+		score := float64(rand.Intn(50))
+		cur, ok := want[m]
+		switch {
+		case !ok:
+			sl.Insert(m, score)
+			want[m] = score
+		case rand.Intn(2) == 0:
+			sl.UpdateScore(m, cur, score)
+			want[m] = score
+		default:
+			if !sl.Delete(m, cur) {
+				t.Fatalf("delete %v fail", m)
+			}
+			delete(want, m)
+		}
+	}
+	checkSkipList(t, sl, want)
+}
+
+func TestSkipList_DeleteRange(t *testing.T) {
+	sl := NewSkipList()
+	want := map[string]float64{}
+	for i := 0; i < 100; i++ {
+		m := fmt.Sprintf("m%02d", i)
+		sl.Insert(m, float64(i))
+		want[m] = float64(i)
+	}
+
+	removed := sl.DeleteRangeByScore(base.ScoreBorder{Value: 10, Exclude: true}, base.ScoreBorder{Value: 20})
+	if len(removed) != 10 {
+		t.Fatalf("want remove 10, get %v", len(removed))
+	}
+	for _, e := range removed {
+		delete(want, e.Member)
+	}
+	checkSkipList(t, sl, want)
+
+	// 剩下 m00..m10, m21..m99，排名 [1, 5] 是 m00..m04
+	removed = sl.DeleteRangeByRank(1, 5)
+	if len(removed) != 5 || removed[0].Member != "m00" || removed[4].Member != "m04" {
+		t.Fatalf("delete by rank wrong %v", removed)
+	}
+	for _, e := range removed {
+		delete(want, e.Member)
+	}
+	checkSkipList(t, sl, want)
+
+	removed = sl.DeleteRangeByLex(base.LexBorder{Value: "m90"}, base.LexBorder{Inf: 1})
+	if len(removed) != 10 {
+		t.Fatalf("want remove 10, get %v", len(removed))
+	}
+	for _, e := range removed {
+		delete(want, e.Member)
+	}
+	checkSkipList(t, sl, want)
+}
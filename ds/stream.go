@@ -0,0 +1,481 @@
+package ds
+
+import (
+	"code/regis/base"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	// streamNodeMaxEntries redis中 stream 的每个节点最多存放的消息数，近似裁剪时以它为单位删除
+	streamNodeMaxEntries = 100
+	// StreamDefaultTrimLimit 近似裁剪默认最多删除的消息数，和redis一样是 100 * stream-node-max-entries
+	StreamDefaultTrimLimit = 100 * streamNodeMaxEntries
+	// streamDumpMagic 存盘时 stream 编码成list，第一个元素是这个魔数，用来和普通的list区分
+	streamDumpMagic = "\x00regis-stream"
+	// listDumpMagic 普通list的第一个元素恰好是魔数时，存盘时在前面加上这个元素转义，见 EscapeListDump
+	listDumpMagic = "\x00regis-list"
+)
+
+// Stream 消息流，作为 base.RStream 提供出去
+// 消息按ID从小到大存放在数组中，ID只会递增，所以新增消息只需要追加到末尾，查找时用二分
+type Stream struct {
+	entries []base.StreamEntry
+	// lastID 最后一次添加的消息ID，消息被删除后也不会变小
+	lastID base.StreamID
+	// entriesAdded 一共添加过的消息数，包括已经被删除的
+	entriesAdded uint64
+	// maxDeletedID 被 xdel 删除的最大的消息ID
+	maxDeletedID base.StreamID
+	// groups 消费者组，组名 -> 消费者组
+	groups map[string]*StreamGroup
+}
+
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+func (s *Stream) Clone() interface{} {
+	ret := *s
+	ret.entries = make([]base.StreamEntry, len(s.entries))
+	copy(ret.entries, s.entries)
+	if s.groups != nil {
+		ret.groups = make(map[string]*StreamGroup, len(s.groups))
+		for name, g := range s.groups {
+			ret.groups[name] = g.clone()
+		}
+	}
+	return &ret
+}
+
+func (s *Stream) Len() int64 {
+	return int64(len(s.entries))
+}
+
+// FirstID 第一条消息的ID，stream为空时返回 0-0
+func (s *Stream) FirstID() base.StreamID {
+	if len(s.entries) == 0 {
+		return base.StreamID{}
+	}
+	return s.entries[0].ID
+}
+
+func (s *Stream) LastID() base.StreamID {
+	return s.lastID
+}
+
+func (s *Stream) EntriesAdded() uint64 {
+	return s.entriesAdded
+}
+
+func (s *Stream) MaxDeletedID() base.StreamID {
+	return s.maxDeletedID
+}
+
+// SetID 直接设置 stream 的元信息，用于 xsetid 和从rdb恢复
+func (s *Stream) SetID(last base.StreamID, entriesAdded uint64, maxDeleted base.StreamID) {
+	s.lastID = last
+	s.entriesAdded = entriesAdded
+	s.maxDeletedID = maxDeleted
+}
+
+// NextID 自动生成比 lastID 大的ID，ms 是当前时间，时钟回拨时沿用 lastID 的毫秒数，ID用尽时返回false
+func (s *Stream) NextID(ms uint64) (base.StreamID, bool) {
+	if ms > s.lastID.Ms {
+		return base.StreamID{Ms: ms}, true
+	}
+	return NextStreamID(s.lastID)
+}
+
+// Add 在末尾追加消息，id 必须比 lastID 大，否则返回false
+func (s *Stream) Add(id base.StreamID, fields []string) bool {
+	if id.Compare(s.lastID) <= 0 {
+		return false
+	}
+	s.entries = append(s.entries, base.StreamEntry{ID: id, Fields: fields})
+	s.lastID = id
+	s.entriesAdded++
+	return true
+}
+
+// search 返回第一个ID不小于id的消息的下标
+func (s *Stream) search(id base.StreamID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].ID.Compare(id) >= 0
+	})
+}
+
+// Delete 删除指定ID的消息，返回删除的数量
+func (s *Stream) Delete(id base.StreamID) int {
+	i := s.search(id)
+	if i == len(s.entries) || s.entries[i].ID != id {
+		return 0
+	}
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	if id.Compare(s.maxDeletedID) > 0 {
+		s.maxDeletedID = id
+	}
+	return 1
+}
+
+// Range 返回ID在 [start, end] 之间的消息，最多count个，count < 0 表示不限，reverse 为true时从大到小返回
+func (s *Stream) Range(start, end base.StreamID, count int64, reverse bool) []base.StreamEntry {
+	ret := make([]base.StreamEntry, 0)
+	if start.Compare(end) > 0 {
+		return ret
+	}
+	from := s.search(start)
+	to := s.search(end)
+	if to < len(s.entries) && s.entries[to].ID == end {
+		to++
+	}
+	if reverse {
+		for i := to - 1; i >= from && count != 0; i-- {
+			ret = append(ret, s.entries[i])
+			count--
+		}
+		return ret
+	}
+	for i := from; i < to && count != 0; i++ {
+		ret = append(ret, s.entries[i])
+		count--
+	}
+	return ret
+}
+
+// trimHead 从头部删除n条消息
+// approx 为true时和redis一样，只删除完整的节点，所以实际删除的数量是 streamNodeMaxEntries 的整数倍，并且不超过limit
+func (s *Stream) trimHead(n int64, approx bool, limit int64) int64 {
+	if approx {
+		if limit > 0 && n > limit {
+			n = limit
+		}
+		n = n / streamNodeMaxEntries * streamNodeMaxEntries
+	}
+	if n <= 0 {
+		return 0
+	}
+	s.entries = s.entries[n:]
+	return n
+}
+
+// TrimByLen 从头部删除消息，直到只剩下 maxLen 条，返回删除的数量
+func (s *Stream) TrimByLen(maxLen int64, approx bool, limit int64) int64 {
+	return s.trimHead(s.Len()-maxLen, approx, limit)
+}
+
+// TrimByMinID 删除ID比 minID 小的消息，返回删除的数量
+func (s *Stream) TrimByMinID(minID base.StreamID, approx bool, limit int64) int64 {
+	return s.trimHead(int64(s.search(minID)), approx, limit)
+}
+
+func (s *Stream) Clear() {
+	s.entries = nil
+}
+
+// CreateGroup 新建消费者组，已经存在时返回false
+func (s *Stream) CreateGroup(name string, lastID base.StreamID, entriesRead int64) bool {
+	if _, ok := s.groups[name]; ok {
+		return false
+	}
+	if s.groups == nil {
+		s.groups = make(map[string]*StreamGroup)
+	}
+	s.groups[name] = newStreamGroup(name, lastID, entriesRead)
+	return true
+}
+
+// DestroyGroup 删除消费者组，返回删除的数量
+func (s *Stream) DestroyGroup(name string) int {
+	if _, ok := s.groups[name]; !ok {
+		return 0
+	}
+	delete(s.groups, name)
+	return 1
+}
+
+func (s *Stream) Group(name string) (base.StreamGroup, bool) {
+	g, ok := s.groups[name]
+	if !ok {
+		return nil, false
+	}
+	return g, true
+}
+
+// Groups 按名字排序返回所有消费者组
+func (s *Stream) Groups() []base.StreamGroup {
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := make([]base.StreamGroup, len(names))
+	for i, name := range names {
+		ret[i] = s.groups[name]
+	}
+	return ret
+}
+
+// hasTombstones ID不小于start的消息中，是否有被 xdel 删除过的
+func (s *Stream) hasTombstones(start base.StreamID) bool {
+	if len(s.entries) == 0 || s.maxDeletedID == (base.StreamID{}) {
+		return false
+	}
+	return start.Compare(s.maxDeletedID) <= 0
+}
+
+// estimateEntriesRead 估算读到id为止一共读了多少条消息，和redis的 streamEstimateDistanceFromFirstEverEntry 一样
+// 中间有被删除的消息时无法估算，返回-1
+func (s *Stream) estimateEntriesRead(id base.StreamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	if len(s.entries) == 0 && id.Compare(s.lastID) <= 0 {
+		return int64(s.entriesAdded)
+	}
+	switch id.Compare(s.lastID) {
+	case 0:
+		return int64(s.entriesAdded)
+	case 1:
+		return -1
+	}
+	first := s.FirstID()
+	if s.maxDeletedID == (base.StreamID{}) || s.maxDeletedID.Compare(first) < 0 {
+		switch id.Compare(first) {
+		case -1:
+			return int64(s.entriesAdded) - s.Len()
+		case 0:
+			return int64(s.entriesAdded) - s.Len() + 1
+		}
+	}
+	return -1
+}
+
+// Lag 消费者组还有多少条消息没有读，无法计算时返回false
+func (s *Stream) Lag(group string) (int64, bool) {
+	g, ok := s.groups[group]
+	if !ok {
+		return 0, false
+	}
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	read := g.entriesRead
+	if read < 0 || s.hasTombstones(g.lastID) {
+		read = s.estimateEntriesRead(g.lastID)
+	}
+	if read < 0 {
+		return 0, false
+	}
+	return int64(s.entriesAdded) - read, true
+}
+
+// ReadGroup 给消费者组中的consumer投递新消息，也就是 lastID 之后的消息，最多count条，count < 0 表示不限
+// noAck 为false时，投递的消息加入待确认列表
+func (s *Stream) ReadGroup(group, consumer string, count int64, noAck bool, now int64) []base.StreamEntry {
+	g, ok := s.groups[group]
+	if !ok {
+		return nil
+	}
+	start, ok := NextStreamID(g.lastID)
+	if !ok {
+		return make([]base.StreamEntry, 0)
+	}
+	c, _ := g.consumer(consumer, now)
+	entries := s.Range(start, base.StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}, count, false)
+	for _, e := range entries {
+		if g.entriesRead >= 0 && !s.hasTombstones(e.ID) {
+			g.entriesRead++
+		} else {
+			g.entriesRead = s.estimateEntriesRead(e.ID)
+		}
+		g.lastID = e.ID
+		if noAck {
+			continue
+		}
+		// 组的 lastID 被 xgroup setid 调小之后，消息可能已经在待确认列表中了，这时候重新投递给当前消费者
+		g.Claim(e.ID, c.name, now, 1, now)
+	}
+	if len(entries) > 0 {
+		c.activeTime = now
+	}
+	return entries
+}
+
+// NextStreamID 返回比id大的下一个ID，id已经是最大值时返回false
+func NextStreamID(id base.StreamID) (base.StreamID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return base.StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return base.StreamID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Dump 把 stream 编码成list的各个元素，用于存盘
+// 格式：魔数, lastID, entriesAdded, maxDeletedID, 消息数, 每条消息依次是 ID, field value 的个数, field, value ...
+// 之后是消费者组的数量，每个组依次是 组名, lastID, entriesRead, 消费者数, 每个消费者的 名字, seenTime, activeTime,
+// 待确认消息数, 每条待确认消息的 ID, 消费者, deliveryTime, deliveryCount
+func (s *Stream) Dump() [][]byte {
+	ret := make([][]byte, 0, 6+len(s.entries)*4)
+	add := func(vals ...string) {
+		for _, v := range vals {
+			ret = append(ret, []byte(v))
+		}
+	}
+	itoa := func(n int64) string {
+		return strconv.FormatInt(n, 10)
+	}
+	add(streamDumpMagic, s.lastID.String(), strconv.FormatUint(s.entriesAdded, 10), s.maxDeletedID.String(), itoa(s.Len()))
+	for _, e := range s.entries {
+		add(e.ID.String(), strconv.Itoa(len(e.Fields)))
+		add(e.Fields...)
+	}
+	add(strconv.Itoa(len(s.groups)))
+	for _, group := range s.Groups() {
+		g := group.(*StreamGroup)
+		add(g.name, g.lastID.String(), itoa(g.entriesRead), strconv.Itoa(len(g.consumers)))
+		for _, c := range g.Consumers() {
+			add(c.Name, itoa(c.SeenTime), itoa(c.ActiveTime))
+		}
+		add(itoa(g.pel.len()))
+		for _, id := range g.pel.ids {
+			n := g.pel.m[id]
+			add(n.ID.String(), n.Consumer, itoa(n.DeliveryTime), itoa(n.DeliveryCount))
+		}
+	}
+	return ret
+}
+
+// streamDumpReader 按顺序读取 Dump 的结果，出错之后的读取都返回零值
+type streamDumpReader struct {
+	values [][]byte
+	pos    int
+	ok     bool
+}
+
+func (r *streamDumpReader) next() string {
+	if !r.ok || r.pos >= len(r.values) {
+		r.ok = false
+		return ""
+	}
+	r.pos++
+	return string(r.values[r.pos-1])
+}
+
+func (r *streamDumpReader) nextInt() int64 {
+	n, err := strconv.ParseInt(r.next(), 10, 64)
+	if err != nil {
+		r.ok = false
+	}
+	return n
+}
+
+func (r *streamDumpReader) nextID() base.StreamID {
+	id, ok := ParseStreamID(r.next(), 0)
+	if !ok {
+		r.ok = false
+	}
+	return id
+}
+
+// EscapeListDump 普通list存盘前调用，第一个元素和魔数相同时在前面加上 listDumpMagic，
+// 这样加载时不会被当成 stream，见 UnescapeListDump
+func EscapeListDump(values [][]byte) [][]byte {
+	if len(values) == 0 || (string(values[0]) != streamDumpMagic && string(values[0]) != listDumpMagic) {
+		return values
+	}
+	return append([][]byte{[]byte(listDumpMagic)}, values...)
+}
+
+// UnescapeListDump 去掉 EscapeListDump 加上的转义，返回list原本的元素
+func UnescapeListDump(values [][]byte) [][]byte {
+	if len(values) > 0 && string(values[0]) == listDumpMagic {
+		return values[1:]
+	}
+	return values
+}
+
+// ParseStreamDump 从 Dump 的结果中恢复 stream，不是 stream 或者格式不对时返回false
+func ParseStreamDump(values [][]byte) (*Stream, bool) {
+	if len(values) == 0 || string(values[0]) != streamDumpMagic {
+		return nil, false
+	}
+	r := &streamDumpReader{values: values, pos: 1, ok: true}
+	s := NewStream()
+	lastID := r.nextID()
+	entriesAdded, err := strconv.ParseUint(r.next(), 10, 64)
+	maxDeleted := r.nextID()
+	if err != nil {
+		return nil, false
+	}
+	for i := r.nextInt(); i > 0 && r.ok; i-- {
+		id := r.nextID()
+		n := r.nextInt()
+		if n < 0 || n%2 != 0 || int64(len(values)-r.pos) < n {
+			return nil, false
+		}
+		fields := make([]string, n)
+		for j := range fields {
+			fields[j] = r.next()
+		}
+		if !s.Add(id, fields) {
+			return nil, false
+		}
+	}
+	s.SetID(lastID, entriesAdded, maxDeleted)
+	for i := r.nextInt(); i > 0 && r.ok; i-- {
+		name := r.next()
+		s.CreateGroup(name, r.nextID(), r.nextInt())
+		g := s.groups[name]
+		for j := r.nextInt(); j > 0 && r.ok; j-- {
+			c, _ := g.consumer(r.next(), 0)
+			c.seenTime, c.activeTime = r.nextInt(), r.nextInt()
+		}
+		for j := r.nextInt(); j > 0 && r.ok; j-- {
+			id, consumer := r.nextID(), r.next()
+			deliveryTime, deliveryCount := r.nextInt(), r.nextInt()
+			c, ok := g.consumers[consumer]
+			if !ok {
+				return nil, false
+			}
+			g.Claim(id, consumer, deliveryTime, deliveryCount, c.activeTime)
+		}
+	}
+	if !r.ok || r.pos != len(values) {
+		return nil, false
+	}
+	return s, true
+}
+
+// ParseStreamID 解析 ms-seq 格式的ID，只有 ms 时 seq 取 missingSeq
+func ParseStreamID(s string, missingSeq uint64) (base.StreamID, bool) {
+	id := base.StreamID{Seq: missingSeq}
+	ms, seq := s, ""
+	for i := 0; i < len(s); i++ {
+		if s[i] == '-' {
+			ms, seq = s[:i], s[i+1:]
+			break
+		}
+	}
+	var err error
+	if id.Ms, err = parseUint64(ms); err != nil {
+		return id, false
+	}
+	if len(ms) < len(s) {
+		if id.Seq, err = parseUint64(seq); err != nil {
+			return id, false
+		}
+	}
+	return id, true
+}
+
+// parseUint64 只接受纯数字，不接受 "+1" 这种写法
+func parseUint64(s string) (uint64, error) {
+	if len(s) == 0 || s[0] < '0' || s[0] > '9' {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
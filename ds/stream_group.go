@@ -0,0 +1,238 @@
+package ds
+
+import (
+	"code/regis/base"
+	"sort"
+)
+
+// streamPEL 待确认消息列表（pending entries list），按ID排序
+// 消费者组和组里的每个消费者各有一个，同一条消息在两边指向同一个 base.StreamNACK
+type streamPEL struct {
+	ids []base.StreamID
+	m   map[base.StreamID]*base.StreamNACK
+}
+
+func newStreamPEL() *streamPEL {
+	return &streamPEL{m: make(map[base.StreamID]*base.StreamNACK)}
+}
+
+func (pel *streamPEL) len() int64 {
+	return int64(len(pel.ids))
+}
+
+// search 返回第一个不小于id的下标
+func (pel *streamPEL) search(id base.StreamID) int {
+	return sort.Search(len(pel.ids), func(i int) bool {
+		return pel.ids[i].Compare(id) >= 0
+	})
+}
+
+func (pel *streamPEL) add(n *base.StreamNACK) {
+	if _, ok := pel.m[n.ID]; ok {
+		pel.m[n.ID] = n
+		return
+	}
+	pel.m[n.ID] = n
+	// 新投递的消息ID通常都是最大的，直接追加
+	if len(pel.ids) == 0 || pel.ids[len(pel.ids)-1].Compare(n.ID) < 0 {
+		pel.ids = append(pel.ids, n.ID)
+		return
+	}
+	i := pel.search(n.ID)
+	pel.ids = append(pel.ids, base.StreamID{})
+	copy(pel.ids[i+1:], pel.ids[i:])
+	pel.ids[i] = n.ID
+}
+
+func (pel *streamPEL) remove(id base.StreamID) *base.StreamNACK {
+	n, ok := pel.m[id]
+	if !ok {
+		return nil
+	}
+	delete(pel.m, id)
+	i := pel.search(id)
+	pel.ids = append(pel.ids[:i], pel.ids[i+1:]...)
+	return n
+}
+
+// rangeNACK 返回ID在 [start, end] 之间、并且 filter 返回true的消息，最多count个，count < 0 表示不限
+func (pel *streamPEL) rangeNACK(start, end base.StreamID, count int64, filter func(base.StreamNACK) bool) []base.StreamNACK {
+	ret := make([]base.StreamNACK, 0)
+	for i := pel.search(start); i < len(pel.ids) && count != 0; i++ {
+		if pel.ids[i].Compare(end) > 0 {
+			break
+		}
+		n := *pel.m[pel.ids[i]]
+		if filter != nil && !filter(n) {
+			continue
+		}
+		ret = append(ret, n)
+		count--
+	}
+	return ret
+}
+
+type streamConsumer struct {
+	name       string
+	seenTime   int64
+	activeTime int64
+	pel        *streamPEL
+}
+
+// StreamGroup 消费者组，作为 base.StreamGroup 提供出去
+type StreamGroup struct {
+	name string
+	// lastID 最后一条投递给组内消费者的消息ID
+	lastID base.StreamID
+	// entriesRead 组内已经读取过的消息数，用来计算 lag，-1 表示未知
+	entriesRead int64
+	pel         *streamPEL
+	consumers   map[string]*streamConsumer
+}
+
+func newStreamGroup(name string, lastID base.StreamID, entriesRead int64) *StreamGroup {
+	return &StreamGroup{
+		name:        name,
+		lastID:      lastID,
+		entriesRead: entriesRead,
+		pel:         newStreamPEL(),
+		consumers:   make(map[string]*streamConsumer),
+	}
+}
+
+// clone 深复制，复制后的 NACK 在组和消费者之间仍然是共享的
+func (g *StreamGroup) clone() *StreamGroup {
+	ret := newStreamGroup(g.name, g.lastID, g.entriesRead)
+	for _, c := range g.consumers {
+		ret.consumers[c.name] = &streamConsumer{
+			name:       c.name,
+			seenTime:   c.seenTime,
+			activeTime: c.activeTime,
+			pel:        newStreamPEL(),
+		}
+	}
+	for _, id := range g.pel.ids {
+		n := *g.pel.m[id]
+		ret.pel.add(&n)
+		ret.consumers[n.Consumer].pel.add(&n)
+	}
+	return ret
+}
+
+func (g *StreamGroup) Name() string {
+	return g.name
+}
+
+func (g *StreamGroup) LastID() base.StreamID {
+	return g.lastID
+}
+
+func (g *StreamGroup) EntriesRead() int64 {
+	return g.entriesRead
+}
+
+func (g *StreamGroup) SetLastID(id base.StreamID, entriesRead int64) {
+	g.lastID = id
+	g.entriesRead = entriesRead
+}
+
+// consumer 返回消费者，不存在时新建
+func (g *StreamGroup) consumer(name string, now int64) (*streamConsumer, bool) {
+	c, ok := g.consumers[name]
+	if ok {
+		return c, false
+	}
+	c = &streamConsumer{name: name, seenTime: now, activeTime: -1, pel: newStreamPEL()}
+	g.consumers[name] = c
+	return c, true
+}
+
+// TouchConsumer 更新消费者最后一次出现的时间，消费者不存在时新建，新建时返回true
+func (g *StreamGroup) TouchConsumer(name string, now int64) bool {
+	c, created := g.consumer(name, now)
+	c.seenTime = now
+	return created
+}
+
+// DeleteConsumer 删除消费者和它的待确认消息，返回删除的待确认消息数，消费者不存在时返回false
+func (g *StreamGroup) DeleteConsumer(name string) (int64, bool) {
+	c, ok := g.consumers[name]
+	if !ok {
+		return 0, false
+	}
+	for _, id := range c.pel.ids {
+		g.pel.remove(id)
+	}
+	delete(g.consumers, name)
+	return c.pel.len(), true
+}
+
+// Consumers 按名字排序返回所有消费者
+func (g *StreamGroup) Consumers() []base.StreamConsumer {
+	ret := make([]base.StreamConsumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		ret = append(ret, base.StreamConsumer{
+			Name:       c.name,
+			SeenTime:   c.seenTime,
+			ActiveTime: c.activeTime,
+			Pending:    c.pel.len(),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func (g *StreamGroup) PendingLen() int64 {
+	return g.pel.len()
+}
+
+func (g *StreamGroup) NACK(id base.StreamID) (base.StreamNACK, bool) {
+	n, ok := g.pel.m[id]
+	if !ok {
+		return base.StreamNACK{}, false
+	}
+	return *n, true
+}
+
+// Pending 按ID顺序返回待确认消息，consumer 不为空时只返回该消费者的
+func (g *StreamGroup) Pending(start, end base.StreamID, count int64, consumer string, filter func(base.StreamNACK) bool) []base.StreamNACK {
+	if consumer == "" {
+		return g.pel.rangeNACK(start, end, count, filter)
+	}
+	c, ok := g.consumers[consumer]
+	if !ok {
+		return make([]base.StreamNACK, 0)
+	}
+	return c.pel.rangeNACK(start, end, count, filter)
+}
+
+// Ack 确认消息，把它从组和消费者的待确认列表中删掉
+func (g *StreamGroup) Ack(id base.StreamID) int {
+	n := g.pel.remove(id)
+	if n == nil {
+		return 0
+	}
+	if c, ok := g.consumers[n.Consumer]; ok {
+		c.pel.remove(id)
+	}
+	return 1
+}
+
+// Claim 把消息转移给consumer，消息不在待确认列表中时新建，consumer 不存在时新建
+func (g *StreamGroup) Claim(id base.StreamID, consumer string, deliveryTime, deliveryCount, now int64) {
+	c, _ := g.consumer(consumer, now)
+	n, ok := g.pel.m[id]
+	if !ok {
+		n = &base.StreamNACK{ID: id}
+		g.pel.add(n)
+	} else if old, ok := g.consumers[n.Consumer]; ok && old != c {
+		old.pel.remove(id)
+	}
+	n.Consumer = consumer
+	n.DeliveryTime = deliveryTime
+	n.DeliveryCount = deliveryCount
+	c.pel.add(n)
+	c.activeTime = now
+}
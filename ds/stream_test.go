@@ -0,0 +1,188 @@
+package ds
+
+import (
+	"code/regis/base"
+	"math"
+	"testing"
+)
+
+func newTestStream(n int) *Stream {
+	s := NewStream()
+	for i := 1; i <= n; i++ {
+		s.Add(base.StreamID{Ms: uint64(i)}, []string{"f", "v"})
+	}
+	return s
+}
+
+func TestStream_AddNextID(t *testing.T) {
+	s := NewStream()
+	id, _ := s.NextID(5)
+	if !s.Add(id, []string{"a", "1"}) || id != (base.StreamID{Ms: 5}) {
+		t.Errorf("add %v failed", id)
+	}
+	// 时钟回拨时沿用上一个ID的毫秒数
+	id, _ = s.NextID(3)
+	if id != (base.StreamID{Ms: 5, Seq: 1}) {
+		t.Errorf("next id = %v, want 5-1", id)
+	}
+	if s.Add(base.StreamID{Ms: 5}, nil) {
+		t.Errorf("add id equal to last id should fail")
+	}
+	if s.Len() != 1 || s.EntriesAdded() != 1 {
+		t.Errorf("len = %v, entries added = %v", s.Len(), s.EntriesAdded())
+	}
+}
+
+func TestStream_Range(t *testing.T) {
+	s := newTestStream(10)
+	ret := s.Range(base.StreamID{Ms: 3}, base.StreamID{Ms: 6}, -1, false)
+	if len(ret) != 4 || ret[0].ID.Ms != 3 || ret[3].ID.Ms != 6 {
+		t.Errorf("range 3~6 = %v", ret)
+	}
+	ret = s.Range(base.StreamID{Ms: 3}, base.StreamID{Ms: 6}, 2, true)
+	if len(ret) != 2 || ret[0].ID.Ms != 6 || ret[1].ID.Ms != 5 {
+		t.Errorf("reverse range 3~6 count 2 = %v", ret)
+	}
+	if ret = s.Range(base.StreamID{Ms: 6}, base.StreamID{Ms: 3}, -1, false); len(ret) != 0 {
+		t.Errorf("start > end should be empty, got %v", ret)
+	}
+}
+
+func TestStream_DeleteTrim(t *testing.T) {
+	s := newTestStream(10)
+	if s.Delete(base.StreamID{Ms: 4}) != 1 || s.Delete(base.StreamID{Ms: 4}) != 0 {
+		t.Errorf("delete 4 failed")
+	}
+	if s.MaxDeletedID() != (base.StreamID{Ms: 4}) {
+		t.Errorf("max deleted id = %v", s.MaxDeletedID())
+	}
+	if n := s.TrimByMinID(base.StreamID{Ms: 6}, false, 0); n != 4 || s.Len() != 5 {
+		t.Errorf("trim by min id removed %v, len %v", n, s.Len())
+	}
+	if n := s.TrimByLen(2, false, 0); n != 3 || s.Len() != 2 {
+		t.Errorf("trim by len removed %v, len %v", n, s.Len())
+	}
+
+	// 近似裁剪只删除完整的节点
+	s = newTestStream(250)
+	if n := s.TrimByLen(10, true, 0); n != 200 || s.Len() != 50 {
+		t.Errorf("approx trim removed %v, len %v", n, s.Len())
+	}
+	if n := s.TrimByLen(10, true, 0); n != 0 {
+		t.Errorf("approx trim removed %v, want 0", n)
+	}
+}
+
+func TestStream_Dump(t *testing.T) {
+	s := newTestStream(3)
+	s.Delete(base.StreamID{Ms: 3})
+	p, ok := ParseStreamDump(s.Dump())
+	if !ok {
+		t.Fatalf("parse dump failed")
+	}
+	if p.Len() != 2 || p.LastID() != s.LastID() || p.EntriesAdded() != 3 || p.MaxDeletedID() != s.MaxDeletedID() {
+		t.Errorf("dump round trip mismatch: %+v", p)
+	}
+	if _, ok := ParseStreamDump([][]byte{[]byte("a"), []byte("b")}); ok {
+		t.Errorf("plain list should not be parsed as stream")
+	}
+}
+
+func TestStream_ListDumpEscape(t *testing.T) {
+	for _, first := range []string{streamDumpMagic, listDumpMagic, "a"} {
+		values := [][]byte{[]byte(first), []byte("b")}
+		dump := EscapeListDump(values)
+		if _, ok := ParseStreamDump(dump); ok {
+			t.Errorf("list starts with %q should not be parsed as stream", first)
+		}
+		if got := UnescapeListDump(dump); len(got) != 2 || string(got[0]) != first || string(got[1]) != "b" {
+			t.Errorf("list starts with %q round trip get %q", first, got)
+		}
+	}
+	if got := EscapeListDump(nil); len(got) != 0 {
+		t.Errorf("empty list escaped to %q", got)
+	}
+}
+
+func TestStream_Groups(t *testing.T) {
+	s := newTestStream(5)
+	if !s.CreateGroup("g", base.StreamID{}, 0) || s.CreateGroup("g", base.StreamID{}, 0) {
+		t.Fatalf("create group failed")
+	}
+	ret := s.ReadGroup("g", "alice", 2, false, 100)
+	if len(ret) != 2 || ret[1].ID.Ms != 2 {
+		t.Fatalf("read group = %v", ret)
+	}
+	g, _ := s.Group("g")
+	if g.LastID() != (base.StreamID{Ms: 2}) || g.EntriesRead() != 2 || g.PendingLen() != 2 {
+		t.Errorf("last id %v, entries read %v, pending %v", g.LastID(), g.EntriesRead(), g.PendingLen())
+	}
+	if lag, ok := s.Lag("g"); !ok || lag != 3 {
+		t.Errorf("lag = %v", lag)
+	}
+	// NOACK 不进入 pending 列表
+	s.ReadGroup("g", "bob", 1, true, 200)
+	if g.PendingLen() != 2 {
+		t.Errorf("noack read should not add pending, got %v", g.PendingLen())
+	}
+	if g.Ack(base.StreamID{Ms: 1}) != 1 || g.Ack(base.StreamID{Ms: 1}) != 0 {
+		t.Errorf("ack failed")
+	}
+	g.Claim(base.StreamID{Ms: 2}, "bob", 300, 2, 300)
+	n, ok := g.NACK(base.StreamID{Ms: 2})
+	if !ok || n.Consumer != "bob" || n.DeliveryCount != 2 {
+		t.Errorf("claim nack = %+v", n)
+	}
+	if ret := g.Pending(base.StreamID{}, s.LastID(), -1, "alice", nil); len(ret) != 0 {
+		t.Errorf("alice pending = %v", ret)
+	}
+
+	p, ok := ParseStreamDump(s.Dump())
+	if !ok {
+		t.Fatalf("parse dump with groups failed")
+	}
+	pg, ok := p.Group("g")
+	if !ok || pg.LastID() != g.LastID() || pg.PendingLen() != 1 || len(pg.Consumers()) != 2 {
+		t.Errorf("group dump round trip mismatch")
+	}
+	if s.DestroyGroup("g") != 1 || len(s.Groups()) != 0 {
+		t.Errorf("destroy group failed")
+	}
+}
+
+func TestParseStreamID(t *testing.T) {
+	tests := []struct {
+		s    string
+		want base.StreamID
+		ok   bool
+	}{
+		{"1-2", base.StreamID{Ms: 1, Seq: 2}, true},
+		{"5", base.StreamID{Ms: 5, Seq: 7}, true},
+		{"+1-2", base.StreamID{}, false},
+		{"1-", base.StreamID{}, false},
+		{"abc", base.StreamID{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseStreamID(tt.s, 7)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("ParseStreamID(%q) = %v, %v", tt.s, got, ok)
+		}
+	}
+}
+
+func TestNextStreamID(t *testing.T) {
+	cases := []struct {
+		id   base.StreamID
+		next base.StreamID
+		ok   bool
+	}{
+		{base.StreamID{Ms: 1, Seq: 1}, base.StreamID{Ms: 1, Seq: 2}, true},
+		{base.StreamID{Ms: 1, Seq: math.MaxUint64}, base.StreamID{Ms: 2}, true},
+		{base.StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}, base.StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}, false},
+	}
+	for _, cs := range cases {
+		if next, ok := NextStreamID(cs.id); next != cs.next || ok != cs.ok {
+			t.Errorf("next of %v want %v %v, get %v %v", cs.id, cs.next, cs.ok, next, ok)
+		}
+	}
+}
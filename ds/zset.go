@@ -0,0 +1,269 @@
+package ds
+
+import (
+	"code/regis/base"
+	"math/rand"
+)
+
+// SortedSet 有序集合，作为 base.RZSet 提供出去
+// dict 用于O(1)地查找成员的分数，value 是 float64，也用于 zscan 按游标遍历
+// skipList 用于按分数、排名、字典序进行范围查找
+type SortedSet struct {
+	dict     *Dict
+	skipList *SkipList
+}
+
+func (zs *SortedSet) score(member string) (float64, bool) {
+	v, ok := zs.dict.Get(member)
+	if !ok {
+		return 0, false
+	}
+	return v.(float64), true
+}
+
+// Add 添加成员或修改已有成员的分数，返回新增的数量
+func (zs *SortedSet) Add(member string, score float64) int {
+	cur, ok := zs.score(member)
+	if ok {
+		if cur != score {
+			zs.skipList.UpdateScore(member, cur, score)
+			zs.dict.Put(member, score)
+		}
+		return 0
+	}
+	zs.skipList.Insert(member, score)
+	zs.dict.Put(member, score)
+	return 1
+}
+
+// Remove 删除成员，返回删除的数量
+func (zs *SortedSet) Remove(member string) int {
+	score, ok := zs.score(member)
+	if !ok {
+		return 0
+	}
+	zs.skipList.Delete(member, score)
+	zs.dict.Del(member)
+	return 1
+}
+
+func (zs *SortedSet) Score(member string) (float64, bool) {
+	return zs.score(member)
+}
+
+// Rank 返回成员的排名，从0开始，reverse 为true时按分数从大到小排
+func (zs *SortedSet) Rank(member string, reverse bool) (int64, bool) {
+	score, ok := zs.score(member)
+	if !ok {
+		return 0, false
+	}
+	rank := zs.skipList.GetRank(member, score)
+	if reverse {
+		return zs.skipList.Len() - rank, true
+	}
+	return rank - 1, true
+}
+
+func (zs *SortedSet) Len() int64 {
+	return zs.skipList.Len()
+}
+
+// collect 从n开始，向后（reverse时向前）收集最多count个节点，count < 0 表示不限
+// stop 返回true时停止收集
+func collect(n *skipListNode, count int64, reverse bool, stop func(n *skipListNode) bool) []base.ZEntry {
+	ret := make([]base.ZEntry, 0)
+	for n != nil && count != 0 {
+		if stop != nil && stop(n) {
+			break
+		}
+		ret = append(ret, n.ZEntry)
+		count--
+		if reverse {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+	return ret
+}
+
+// skip 从n开始，按排名向后（reverse时向前）跳过offset个节点
+func (zs *SortedSet) skip(n *skipListNode, offset int64, reverse bool) *skipListNode {
+	if n == nil || offset <= 0 {
+		return n
+	}
+	rank := zs.skipList.GetRank(n.Member, n.Score)
+	if reverse {
+		rank -= offset
+	} else {
+		rank += offset
+	}
+	if rank <= 0 || rank > zs.skipList.Len() {
+		return nil
+	}
+	return zs.skipList.GetByRank(rank)
+}
+
+// RangeByRank 返回排名在 [start, stop] 中的成员，start, stop 都是从0开始的合法下标，由调用方保证
+func (zs *SortedSet) RangeByRank(start, stop int64, reverse bool) []base.ZEntry {
+	if start > stop || start >= zs.Len() {
+		return []base.ZEntry{}
+	}
+	var n *skipListNode
+	if reverse {
+		n = zs.skipList.GetByRank(zs.Len() - start)
+	} else {
+		n = zs.skipList.GetByRank(start + 1)
+	}
+	return collect(n, stop-start+1, reverse, nil)
+}
+
+// RangeByScore 返回分数在区间中的成员，跳过前offset个，最多返回count个，count < 0 表示不限
+func (zs *SortedSet) RangeByScore(min, max base.ScoreBorder, offset, count int64, reverse bool) []base.ZEntry {
+	var n *skipListNode
+	var stop func(n *skipListNode) bool
+	if reverse {
+		n = zs.skipList.LastInScoreRange(min, max)
+		stop = func(n *skipListNode) bool { return !scoreGteMin(n.Score, min) }
+	} else {
+		n = zs.skipList.FirstInScoreRange(min, max)
+		stop = func(n *skipListNode) bool { return !scoreLteMax(n.Score, max) }
+	}
+	return collect(zs.skip(n, offset, reverse), count, reverse, stop)
+}
+
+// RangeByLex 返回字典序在区间中的成员，只在所有成员分数都相同时有意义
+func (zs *SortedSet) RangeByLex(min, max base.LexBorder, offset, count int64, reverse bool) []base.ZEntry {
+	var n *skipListNode
+	var stop func(n *skipListNode) bool
+	if reverse {
+		n = zs.skipList.LastInLexRange(min, max)
+		stop = func(n *skipListNode) bool { return !lexGteMin(n.Member, min) }
+	} else {
+		n = zs.skipList.FirstInLexRange(min, max)
+		stop = func(n *skipListNode) bool { return !lexLteMax(n.Member, max) }
+	}
+	return collect(zs.skip(n, offset, reverse), count, reverse, stop)
+}
+
+// Count 返回分数在区间内的成员数量，复杂度 O(log(N))
+func (zs *SortedSet) Count(min, max base.ScoreBorder) int64 {
+	first := zs.skipList.FirstInScoreRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := zs.skipList.LastInScoreRange(min, max)
+	return zs.skipList.GetRank(last.Member, last.Score) - zs.skipList.GetRank(first.Member, first.Score) + 1
+}
+
+// LexCount 返回字典序在区间内的成员数量，复杂度 O(log(N))
+func (zs *SortedSet) LexCount(min, max base.LexBorder) int64 {
+	first := zs.skipList.FirstInLexRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := zs.skipList.LastInLexRange(min, max)
+	return zs.skipList.GetRank(last.Member, last.Score) - zs.skipList.GetRank(first.Member, first.Score) + 1
+}
+
+// removeEntries 从dict中删除已经从跳表中删掉的成员
+func (zs *SortedSet) removeEntries(removed []base.ZEntry) int64 {
+	for i := range removed {
+		zs.dict.Del(removed[i].Member)
+	}
+	return int64(len(removed))
+}
+
+// RemoveRangeByScore 删除分数在区间内的成员，返回删除的数量
+func (zs *SortedSet) RemoveRangeByScore(min, max base.ScoreBorder) int64 {
+	return zs.removeEntries(zs.skipList.DeleteRangeByScore(min, max))
+}
+
+// RemoveRangeByLex 删除字典序在区间内的成员，返回删除的数量
+func (zs *SortedSet) RemoveRangeByLex(min, max base.LexBorder) int64 {
+	return zs.removeEntries(zs.skipList.DeleteRangeByLex(min, max))
+}
+
+// RemoveRangeByRank 删除排名在 [start, stop] 中的成员，start, stop 都是从0开始的合法下标，由调用方保证
+func (zs *SortedSet) RemoveRangeByRank(start, stop int64) int64 {
+	return zs.removeEntries(zs.skipList.DeleteRangeByRank(start+1, stop+1))
+}
+
+// RandomMembers 随机返回num个成员，成员可能重复
+func (zs *SortedSet) RandomMembers(num int64) []base.ZEntry {
+	if num <= 0 || zs.Len() == 0 {
+		return []base.ZEntry{}
+	}
+	ret := make([]base.ZEntry, 0, num)
+	for i := int64(0); i < num; i++ {
+		ret = append(ret, zs.skipList.GetByRank(rand.Int63n(zs.Len())+1).ZEntry)
+	}
+	return ret
+}
+
+// RandomDistinctMembers 随机返回num个不重复的成员，num大于集合大小时，返回全部成员
+func (zs *SortedSet) RandomDistinctMembers(num int64) []base.ZEntry {
+	if num >= zs.Len() {
+		return zs.RangeByRank(0, zs.Len()-1, false)
+	}
+	ret := make([]base.ZEntry, 0, num)
+	picked := make(map[int64]struct{}, num)
+	for int64(len(ret)) < num {
+		rank := rand.Int63n(zs.Len()) + 1
+		if _, ok := picked[rank]; ok {
+			continue
+		}
+		picked[rank] = struct{}{}
+		ret = append(ret, zs.skipList.GetByRank(rank).ZEntry)
+	}
+	return ret
+}
+
+// Range 按分数从小到大返回一个传输成员的chan，用法同 Dict.RangeKey
+func (zs *SortedSet) Range(ch <-chan struct{}) chan base.ZEntry {
+	entries := make(chan base.ZEntry)
+	go func() {
+		defer func() {
+			close(entries)
+		}()
+		for n := zs.skipList.header.level[0].forward; n != nil; n = n.level[0].forward {
+			select {
+			case <-ch:
+				return
+			case entries <- n.ZEntry:
+			}
+		}
+	}()
+	return entries
+}
+
+// Scan 按游标遍历成员，顺序和分数无关，用法同 Dict.Scan
+func (zs *SortedSet) Scan(cursor uint64, fn func(entry base.ZEntry)) uint64 {
+	return zs.dict.Scan(cursor, func(key string, val interface{}) {
+		fn(base.ZEntry{Member: key, Score: val.(float64)})
+	})
+}
+
+func (zs *SortedSet) Clone() interface{} {
+	ret := NewSortedSet()
+	for n := zs.skipList.header.level[0].forward; n != nil; n = n.level[0].forward {
+		ret.Add(n.Member, n.Score)
+	}
+	return ret
+}
+
+func (zs *SortedSet) Clear() {
+	zs.dict.Clear()
+	zs.skipList = NewSkipList()
+}
+
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		dict:     NewDict(0, false),
+		skipList: NewSkipList(),
+	}
+}
+
+func NewRZSet() base.RZSet {
+	return NewSortedSet()
+}
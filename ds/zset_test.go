@@ -0,0 +1,100 @@
+package ds
+
+import (
+	"code/regis/base"
+	"math"
+	"testing"
+)
+
+func zEntryMembers(entries []base.ZEntry) []string {
+	ret := make([]string, len(entries))
+	for i := range entries {
+		ret[i] = entries[i].Member
+	}
+	return ret
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSortedSet_Range(t *testing.T) {
+	zs := NewSortedSet()
+	for i, m := range []string{"a", "b", "c", "d", "e"} {
+		zs.Add(m, float64(i))
+	}
+	zs.Add("c", 10)
+
+	if r, _ := zs.Rank("c", false); r != 4 {
+		t.Errorf("want rank 4, get %v", r)
+	}
+	if r, _ := zs.Rank("c", true); r != 0 {
+		t.Errorf("want rev rank 0, get %v", r)
+	}
+
+	cases := []struct {
+		get  []base.ZEntry
+		want []string
+	}{
+		{zs.RangeByRank(1, 3, false), []string{"b", "d", "e"}},
+		{zs.RangeByRank(0, 1, true), []string{"c", "e"}},
+		{zs.RangeByScore(base.ScoreBorder{Value: 1}, base.ScoreBorder{Value: 4, Exclude: true}, 0, -1, false), []string{"b", "d"}},
+		{zs.RangeByScore(base.ScoreBorder{Value: math.Inf(-1)}, base.ScoreBorder{Value: math.Inf(1)}, 1, 2, true), []string{"e", "d"}},
+		{zs.RangeByScore(base.ScoreBorder{Value: 5}, base.ScoreBorder{Value: 1}, 0, -1, false), []string{}},
+	}
+	for i := range cases {
+		if get := zEntryMembers(cases[i].get); !equalStrings(get, cases[i].want) {
+			t.Errorf("case %v want %v, get %v", i, cases[i].want, get)
+		}
+	}
+}
+
+func TestSortedSet_RangeByLex(t *testing.T) {
+	zs := NewSortedSet()
+	for _, m := range []string{"a", "b", "c", "d", "e"} {
+		zs.Add(m, 0)
+	}
+	cases := []struct {
+		get  []base.ZEntry
+		want []string
+	}{
+		{zs.RangeByLex(base.LexBorder{Inf: -1}, base.LexBorder{Value: "c"}, 0, -1, false), []string{"a", "b", "c"}},
+		{zs.RangeByLex(base.LexBorder{Value: "b", Exclude: true}, base.LexBorder{Inf: 1}, 0, 2, false), []string{"c", "d"}},
+		{zs.RangeByLex(base.LexBorder{Value: "aa"}, base.LexBorder{Value: "d", Exclude: true}, 0, -1, true), []string{"c", "b"}},
+	}
+	for i := range cases {
+		if get := zEntryMembers(cases[i].get); !equalStrings(get, cases[i].want) {
+			t.Errorf("case %v want %v, get %v", i, cases[i].want, get)
+		}
+	}
+}
+
+func TestSortedSet_Count(t *testing.T) {
+	zs := NewSortedSet()
+	for i, m := range []string{"a", "b", "c", "d", "e"} {
+		zs.Add(m, float64(i))
+	}
+	if n := zs.Count(base.ScoreBorder{Value: 1}, base.ScoreBorder{Value: 3}); n != 3 {
+		t.Errorf("want 3, get %v", n)
+	}
+	if n := zs.Count(base.ScoreBorder{Value: 3, Exclude: true}, base.ScoreBorder{Value: 3}); n != 0 {
+		t.Errorf("want 0, get %v", n)
+	}
+	if n := zs.RemoveRangeByRank(0, 1); n != 2 || zs.Len() != 3 {
+		t.Errorf("remove by rank wrong")
+	}
+	if _, ok := zs.Score("a"); ok {
+		t.Errorf("a should be removed")
+	}
+	if n := len(zs.RandomDistinctMembers(2)); n != 2 {
+		t.Errorf("want 2, get %v", n)
+	}
+}
@@ -1,8 +1,11 @@
 package file
 
 import (
+	"code/regis/base"
 	"code/regis/conf"
+	"code/regis/ds"
 	log "code/regis/lib"
+	"code/regis/lib/utils"
 	"code/regis/redis"
 	"fmt"
 	"io"
@@ -43,17 +46,41 @@ func LoadRDB(fn string) (query [][]interface{}) {
 		case *parser.StringObject:
 			query = append(query, []interface{}{"set", val.Key, string(val.Value)})
 		case *parser.SetObject:
-
+			q := make([]interface{}, 0, len(val.Members)+2)
+			q = append(q, "sadd", val.Key)
+			for i := range val.Members {
+				q = append(q, string(val.Members[i]))
+			}
+			query = append(query, q)
 		case *parser.ListObject:
-		//	for i := range val.Values {
-		//		println(o.GetType(), val.Key, i, string(val.Values[i]))
-		//	}
+			if stream, ok := ds.ParseStreamDump(val.Values); ok {
+				query = append(query, streamQueries(val.Key, stream)...)
+				break
+			}
+			values := ds.UnescapeListDump(val.Values)
+			q := make([]interface{}, 0, len(values)+2)
+			q = append(q, "rpush", val.Key)
+			for i := range values {
+				q = append(q, string(values[i]))
+			}
+			query = append(query, q)
 		case *parser.HashObject:
-		//	for k, v := range val.Hash {
-		//		println(o.GetType(), val.Key, k, string(v))
-		//	}
+			q := make([]interface{}, 0, len(val.Hash)*2+2)
+			q = append(q, "hset", val.Key)
+			for k, v := range val.Hash {
+				q = append(q, k, string(v))
+			}
+			query = append(query, q)
 		case *parser.ZSetObject:
-			//	println(o.GetType(), val.Key, val.Entries)
+			q := make([]interface{}, 0, len(val.Entries)*2+2)
+			q = append(q, "zadd", val.Key)
+			for _, entry := range val.Entries {
+				q = append(q, utils.FormatFloat(entry.Score), entry.Member)
+			}
+			query = append(query, q)
+		}
+		if exp := o.GetExpiration(); exp != nil {
+			query = append(query, []interface{}{"pexpireat", o.GetKey(), exp.UnixMilli()})
 		}
 		return true
 	})
@@ -63,6 +90,44 @@ func LoadRDB(fn string) (query [][]interface{}) {
 	return query
 }
 
+// streamRestoreGroup 还原空的 stream 时临时用的消费者组名，建好 stream 之后马上删掉，不会和真正的组冲突
+const streamRestoreGroup = "regis-restore"
+
+// streamQueries 还原 stream 的命令，逐条 xadd 之后再用 xsetid 恢复元信息，最后恢复消费者组
+func streamQueries(key string, stream *ds.Stream) [][]interface{} {
+	query := make([][]interface{}, 0, stream.Len()+1)
+	for _, e := range stream.Range(base.StreamID{}, stream.LastID(), -1, false) {
+		q := make([]interface{}, 0, len(e.Fields)+3)
+		q = append(q, "xadd", key, e.ID.String())
+		for _, f := range e.Fields {
+			q = append(q, f)
+		}
+		query = append(query, q)
+	}
+	if stream.Len() == 0 {
+		// 空的 stream 没法用 xadd 新建，lastID 可能是 0-0，xadd 也加不进去
+		// 用 xgroup create MKSTREAM 建一个临时的组把 stream 建出来，再删掉这个组
+		query = append(query,
+			[]interface{}{"xgroup", "create", key, streamRestoreGroup, "0", "mkstream"},
+			[]interface{}{"xgroup", "destroy", key, streamRestoreGroup},
+		)
+	}
+	query = append(query, []interface{}{"xsetid", key, stream.LastID().String(),
+		"entriesadded", stream.EntriesAdded(), "maxdeletedid", stream.MaxDeletedID().String()})
+	// 消费者组，待确认消息用 xclaim FORCE 恢复，所以消息已经被删除的待确认消息不会恢复，消费者的时间也会重置
+	for _, g := range stream.Groups() {
+		query = append(query, []interface{}{"xgroup", "create", key, g.Name(), g.LastID().String(), "entriesread", g.EntriesRead()})
+		for _, c := range g.Consumers() {
+			query = append(query, []interface{}{"xgroup", "createconsumer", key, g.Name(), c.Name})
+		}
+		for _, n := range g.Pending(base.StreamID{}, stream.LastID(), -1, "", nil) {
+			query = append(query, []interface{}{"xclaim", key, g.Name(), n.Consumer, 0, n.ID.String(),
+				"time", n.DeliveryTime, "retrycount", n.DeliveryCount, "force", "justid"})
+		}
+	}
+	return query
+}
+
 func SaveRDB(WriteMDB func(rdb *core.Encoder) error) error {
 	fn := conf.Conf.RDBName
 	log.Debug("save RDB error %v", fn)
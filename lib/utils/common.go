@@ -4,6 +4,7 @@ import (
 	"code/regis/base"
 	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
 	"net"
 	"reflect"
@@ -49,6 +50,25 @@ func IF(cond bool, v1 interface{}, v2 interface{}) interface{} {
 	return v2
 }
 
+// FormatFloat 按redis的格式输出浮点数，比如 zset 的分数，
+// 与 %.17g 类似，但是使用能精确还原的最短表示，比如 1.5, 100, 1e+20, inf
+func FormatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "inf"
+	}
+	if math.IsInf(f, -1) {
+		return "-inf"
+	}
+	if f == 0 {
+		return "0"
+	}
+	exp := math.Floor(math.Log10(math.Abs(f)))
+	if exp < -4 || exp >= 17 {
+		return strconv.FormatFloat(f, 'e', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
 func InterfaceToBytes(val interface{}) []byte {
 	return []byte(InterfaceToString(val))
 }
@@ -2,6 +2,7 @@ package utils
 
 import (
 	log "code/regis/lib"
+	"math"
 	"strconv"
 	"testing"
 )
@@ -41,3 +42,23 @@ func BenchmarkMapInt(b *testing.B) {
 		mapInt[i] = a
 	}
 }
+
+func TestFormatFloat(t *testing.T) {
+	cases := map[float64]string{
+		0:            "0",
+		1.5:          "1.5",
+		1234567:      "1234567",
+		-3.25:        "-3.25",
+		1e20:         "1e+20",
+		0.0001:       "0.0001",
+		0.00001:      "1e-05",
+		math.Inf(1):  "inf",
+		math.Inf(-1): "-inf",
+		123.456:      "123.456",
+	}
+	for f, want := range cases {
+		if get := FormatFloat(f); get != want {
+			t.Errorf("want %v, get %v", want, get)
+		}
+	}
+}
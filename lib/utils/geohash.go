@@ -0,0 +1,314 @@
+package utils
+
+import "math"
+
+// geohash 的实现与redis相同，经纬度各26位交错成52位的整数，作为有序集合的分数
+// 纬度的范围是 EPSG:900913 / EPSG:3785 / OSGEO:41001 的有效范围 [-85.05112878, 85.05112878]，而不是 [-90, 90]
+
+const (
+	GeoLongMin = -180
+	GeoLongMax = 180
+	GeoLatMin  = -85.05112878
+	GeoLatMax  = 85.05112878
+	GeoStepMax = 26 // 52位的精度
+
+	earthRadiusInMeters = 6372797.560856
+	mercatorMax         = 20037726.37
+	geoAlphabet         = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// GeoHashBits geohash 的值，Step 是经纬度各用了多少位
+type GeoHashBits struct {
+	Bits uint64
+	Step uint8
+}
+
+// IsZero 被排除掉的区域
+func (h GeoHashBits) IsZero() bool {
+	return h.Bits == 0 && h.Step == 0
+}
+
+// ScoreRange 返回这个区域中的点在有序集合中的分数范围，左闭右开
+func (h GeoHashBits) ScoreRange() (uint64, uint64) {
+	shift := uint(GeoStepMax*2 - h.Step*2)
+	return h.Bits << shift, (h.Bits + 1) << shift
+}
+
+type geoRange struct {
+	min, max float64
+}
+
+// GeoArea geohash 对应的经纬度范围
+type GeoArea struct {
+	lon, lat geoRange
+}
+
+var (
+	geoLongRange = geoRange{min: GeoLongMin, max: GeoLongMax}
+	geoLatRange  = geoRange{min: GeoLatMin, max: GeoLatMax}
+)
+
+// interleave64 x 放在偶数位，y 放在奇数位
+func interleave64(x, y uint32) uint64 {
+	spread := func(v uint64) uint64 {
+		v = (v | v<<16) & 0x0000FFFF0000FFFF
+		v = (v | v<<8) & 0x00FF00FF00FF00FF
+		v = (v | v<<4) & 0x0F0F0F0F0F0F0F0F
+		v = (v | v<<2) & 0x3333333333333333
+		v = (v | v<<1) & 0x5555555555555555
+		return v
+	}
+	return spread(uint64(x)) | spread(uint64(y))<<1
+}
+
+// deinterleave64 interleave64 的逆运算，返回 x, y
+func deinterleave64(v uint64) (uint32, uint32) {
+	squash := func(v uint64) uint64 {
+		v &= 0x5555555555555555
+		v = (v | v>>1) & 0x3333333333333333
+		v = (v | v>>2) & 0x0F0F0F0F0F0F0F0F
+		v = (v | v>>4) & 0x00FF00FF00FF00FF
+		v = (v | v>>8) & 0x0000FFFF0000FFFF
+		v = (v | v>>16) & 0x00000000FFFFFFFF
+		return v
+	}
+	return uint32(squash(v)), uint32(squash(v >> 1))
+}
+
+func geoEncode(lonRange, latRange geoRange, lon, lat float64, step uint8) (GeoHashBits, bool) {
+	if lon > GeoLongMax || lon < GeoLongMin || lat > GeoLatMax || lat < GeoLatMin {
+		return GeoHashBits{}, false
+	}
+	if lat < latRange.min || lat > latRange.max || lon < lonRange.min || lon > lonRange.max {
+		return GeoHashBits{}, false
+	}
+	latOffset := (lat - latRange.min) / (latRange.max - latRange.min)
+	lonOffset := (lon - lonRange.min) / (lonRange.max - lonRange.min)
+	latOffset *= float64(uint64(1) << step)
+	lonOffset *= float64(uint64(1) << step)
+	return GeoHashBits{Bits: interleave64(uint32(latOffset), uint32(lonOffset)), Step: step}, true
+}
+
+func geoDecode(lonRange, latRange geoRange, h GeoHashBits) GeoArea {
+	ilat, ilon := deinterleave64(h.Bits)
+	scale := float64(uint64(1) << h.Step)
+	latScale := latRange.max - latRange.min
+	lonScale := lonRange.max - lonRange.min
+	return GeoArea{
+		lat: geoRange{
+			min: latRange.min + float64(ilat)/scale*latScale,
+			max: latRange.min + float64(ilat+1)/scale*latScale,
+		},
+		lon: geoRange{
+			min: lonRange.min + float64(ilon)/scale*lonScale,
+			max: lonRange.min + float64(ilon+1)/scale*lonScale,
+		},
+	}
+}
+
+// GeoEncode 把经纬度编码成52位的 geohash，经纬度超出范围时返回false
+func GeoEncode(lon, lat float64) (uint64, bool) {
+	h, ok := geoEncode(geoLongRange, geoLatRange, lon, lat, GeoStepMax)
+	return h.Bits, ok
+}
+
+// GeoDecode 把52位的 geohash 解码成所在区域的中心点
+func GeoDecode(bits uint64) (float64, float64) {
+	area := geoDecode(geoLongRange, geoLatRange, GeoHashBits{Bits: bits, Step: GeoStepMax})
+	lon := (area.lon.min + area.lon.max) / 2
+	lat := (area.lat.min + area.lat.max) / 2
+	lon = math.Max(math.Min(lon, GeoLongMax), GeoLongMin)
+	lat = math.Max(math.Min(lat, GeoLatMax), GeoLatMin)
+	return lon, lat
+}
+
+// GeoHashString 返回标准的11位 geohash 字符串
+// 内部编码的纬度范围是 [-85, 85]，标准的 geohash 是 [-90, 90]，所以要按标准的范围重新编码
+func GeoHashString(bits uint64) string {
+	lon, lat := GeoDecode(bits)
+	h, _ := geoEncode(geoRange{min: -180, max: 180}, geoRange{min: -90, max: 90}, lon, lat, GeoStepMax)
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		// 只有52位，第11个字符按0处理，和redis保持一致
+		if i != 10 {
+			idx = int(h.Bits>>(52-(i+1)*5)) & 0x1f
+		}
+		buf[i] = geoAlphabet[idx]
+	}
+	return string(buf)
+}
+
+func degRad(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func radDeg(r float64) float64 {
+	return r / (math.Pi / 180)
+}
+
+func geoLatDistance(lat1, lat2 float64) float64 {
+	return earthRadiusInMeters * math.Abs(degRad(lat2)-degRad(lat1))
+}
+
+// GeoDistance 用 haversine 公式计算两点之间的距离，单位是米
+func GeoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lon1r, lon2r := degRad(lon1), degRad(lon2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	// 经度相同时只需要计算纬度的距离
+	if v == 0 {
+		return geoLatDistance(lat1, lat2)
+	}
+	lat1r, lat2r := degRad(lat1), degRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadiusInMeters * math.Asin(math.Sqrt(a))
+}
+
+// GeoShape 搜索的范围，Box 为true时是宽 Width 高 Height 的矩形，否则是半径为 Radius 的圆，单位都是米
+type GeoShape struct {
+	Lon, Lat      float64
+	Box           bool
+	Radius        float64
+	Width, Height float64
+}
+
+// Contains 判断点是否在范围内，在的话同时返回到中心点的距离
+func (s *GeoShape) Contains(lon, lat float64) (float64, bool) {
+	if !s.Box {
+		d := GeoDistance(s.Lon, s.Lat, lon, lat)
+		return d, d <= s.Radius
+	}
+	// 纬度的距离计算起来比较快，先判断纬度
+	if geoLatDistance(lat, s.Lat) > s.Height/2 {
+		return 0, false
+	}
+	if GeoDistance(lon, lat, s.Lon, lat) > s.Width/2 {
+		return 0, false
+	}
+	return GeoDistance(s.Lon, s.Lat, lon, lat), true
+}
+
+// boundingBox 返回范围的外接矩形，min lon, min lat, max lon, max lat
+func (s *GeoShape) boundingBox() (float64, float64, float64, float64) {
+	height, width := s.Radius, s.Radius
+	if s.Box {
+		height, width = s.Height/2, s.Width/2
+	}
+	latDelta := radDeg(height / earthRadiusInMeters)
+	lonDeltaTop := radDeg(width / earthRadiusInMeters / math.Cos(degRad(s.Lat+latDelta)))
+	lonDeltaBottom := radDeg(width / earthRadiusInMeters / math.Cos(degRad(s.Lat-latDelta)))
+	lonDelta := lonDeltaTop
+	if s.Lat < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	return s.Lon - lonDelta, s.Lat - latDelta, s.Lon + lonDelta, s.Lat + latDelta
+}
+
+// geoEstimateSteps 根据搜索半径估算 geohash 的精度，越靠近两极，同样的精度对应的区域越小
+func geoEstimateSteps(rangeMeters, lat float64) uint8 {
+	if rangeMeters == 0 {
+		return GeoStepMax
+	}
+	step := 1
+	for rangeMeters < mercatorMax {
+		rangeMeters *= 2
+		step++
+	}
+	step -= 2
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > GeoStepMax {
+		step = GeoStepMax
+	}
+	return uint8(step)
+}
+
+// geoMove 向经度(x)或纬度(y)方向移动一格，d 为正数时向东/北，负数时向西/南
+func geoMove(h GeoHashBits, dx, dy int) GeoHashBits {
+	x := h.Bits & 0xaaaaaaaaaaaaaaaa
+	y := h.Bits & 0x5555555555555555
+	shift := uint(64 - h.Step*2)
+	if dx != 0 {
+		zz := uint64(0x5555555555555555) >> shift
+		if dx > 0 {
+			x += zz + 1
+		} else {
+			x |= zz
+			x -= zz + 1
+		}
+		x &= 0xaaaaaaaaaaaaaaaa >> shift
+	}
+	if dy != 0 {
+		zz := uint64(0xaaaaaaaaaaaaaaaa) >> shift
+		if dy > 0 {
+			y += zz + 1
+		} else {
+			y |= zz
+			y -= zz + 1
+		}
+		y &= 0x5555555555555555 >> shift
+	}
+	return GeoHashBits{Bits: x | y, Step: h.Step}
+}
+
+// GeoSearchAreas 返回覆盖搜索范围的9个区域，中心点所在的区域和它周围的8个，用不到的区域 IsZero 为true
+func GeoSearchAreas(s *GeoShape) []GeoHashBits {
+	minLon, minLat, maxLon, maxLat := s.boundingBox()
+	radius := s.Radius
+	if s.Box {
+		radius = math.Sqrt((s.Width/2)*(s.Width/2) + (s.Height/2)*(s.Height/2))
+	}
+	steps := geoEstimateSteps(radius, s.Lat)
+
+	// 顺序：中心, 北, 南, 东, 西, 东北, 西北, 东南, 西南
+	dirs := [9][2]int{{0, 0}, {0, 1}, {0, -1}, {1, 0}, {-1, 0}, {1, 1}, {-1, 1}, {1, -1}, {-1, -1}}
+	areas := make([]GeoHashBits, 9)
+	calc := func() {
+		center, _ := geoEncode(geoLongRange, geoLatRange, s.Lon, s.Lat, steps)
+		for i, d := range dirs {
+			areas[i] = geoMove(center, d[0], d[1])
+		}
+	}
+	calc()
+
+	// 周围的区域不能完全覆盖外接矩形时，降低精度，扩大区域
+	north := geoDecode(geoLongRange, geoLatRange, areas[1])
+	south := geoDecode(geoLongRange, geoLatRange, areas[2])
+	east := geoDecode(geoLongRange, geoLatRange, areas[3])
+	west := geoDecode(geoLongRange, geoLatRange, areas[4])
+	if steps > 1 && (north.lat.max < maxLat || south.lat.min > minLat || east.lon.max < maxLon || west.lon.min > minLon) {
+		steps--
+		calc()
+	}
+
+	// 排除掉与外接矩形不相交的区域
+	if steps >= 2 {
+		area := geoDecode(geoLongRange, geoLatRange, areas[0])
+		exclude := func(idx ...int) {
+			for _, i := range idx {
+				areas[i] = GeoHashBits{}
+			}
+		}
+		if area.lat.min < minLat {
+			exclude(2, 7, 8)
+		}
+		if area.lat.max > maxLat {
+			exclude(1, 5, 6)
+		}
+		if area.lon.min < minLon {
+			exclude(4, 8, 6)
+		}
+		if area.lon.max > maxLon {
+			exclude(3, 7, 5)
+		}
+	}
+	return areas
+}
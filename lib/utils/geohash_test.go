@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// 期望值来自redis文档中 Sicily 的例子
+func TestGeoEncode(t *testing.T) {
+	cases := []struct {
+		lon, lat float64
+		score    uint64
+		hash     string
+	}{
+		{13.361389, 38.115556, 3479099956230698, "sqc8b49rny0"},
+		{15.087269, 37.502669, 3479447370796909, "sqdtr74hyu0"},
+	}
+	for _, c := range cases {
+		bits, ok := GeoEncode(c.lon, c.lat)
+		if !ok || bits != c.score {
+			t.Errorf("GeoEncode(%v, %v) = %v, want %v", c.lon, c.lat, bits, c.score)
+		}
+		if h := GeoHashString(bits); h != c.hash {
+			t.Errorf("GeoHashString(%v) = %v, want %v", bits, h, c.hash)
+		}
+		lon, lat := GeoDecode(bits)
+		if math.Abs(lon-c.lon) > 1e-5 || math.Abs(lat-c.lat) > 1e-5 {
+			t.Errorf("GeoDecode(%v) = %v, %v", bits, lon, lat)
+		}
+	}
+	if _, ok := GeoEncode(0, 86); ok {
+		t.Errorf("latitude out of range should fail")
+	}
+}
+
+func TestGeoDistance(t *testing.T) {
+	lon1, lat1 := GeoDecode(3479099956230698)
+	lon2, lat2 := GeoDecode(3479447370796909)
+	if d := fmt.Sprintf("%.4f", GeoDistance(lon1, lat1, lon2, lat2)); d != "166274.1516" {
+		t.Errorf("distance = %v, want 166274.1516", d)
+	}
+}
+
+func TestGeoSearchAreas(t *testing.T) {
+	shape := &GeoShape{Lon: 15, Lat: 37, Radius: 200 * 1000}
+	for _, bits := range []uint64{3479099956230698, 3479447370796909} {
+		lon, lat := GeoDecode(bits)
+		if _, ok := shape.Contains(lon, lat); !ok {
+			t.Fatalf("point %v should be in shape", bits)
+		}
+		found := false
+		for _, area := range GeoSearchAreas(shape) {
+			if area.IsZero() {
+				continue
+			}
+			min, max := area.ScoreRange()
+			if bits >= min && bits < max {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("point %v not covered by search areas", bits)
+		}
+	}
+}
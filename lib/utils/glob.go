@@ -0,0 +1,105 @@
+package utils
+
+// GlobMatch 判断str是否匹配glob风格的pattern，规则和redis的 stringmatchlen 一致
+// 支持 * ? [abc] [^abc] [a-z] 以及用 \ 转义，nocase 为true时忽略大小写
+func GlobMatch(pattern, str string, nocase bool) bool {
+	skipLonger := false
+	return globMatch(pattern, str, nocase, &skipLonger)
+}
+
+func lowerByte(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+func equalByte(a, b byte, nocase bool) bool {
+	if nocase {
+		return lowerByte(a) == lowerByte(b)
+	}
+	return a == b
+}
+
+// globMatch skipLonger 为true表示 * 之后的部分已经在更短的后缀上匹配失败了，
+// 更长的后缀也不可能匹配，直接返回，避免 a*a*a*a*b 这类模式指数级回溯
+func globMatch(p, s string, nocase bool, skipLonger *bool) bool {
+	for len(p) > 0 && len(s) > 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 1 && p[1] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 1 {
+				return true
+			}
+			for len(s) > 0 {
+				if globMatch(p[1:], s, nocase, skipLonger) {
+					return true
+				}
+				if *skipLonger {
+					return false
+				}
+				s = s[1:]
+			}
+			*skipLonger = true
+			return false
+		case '?':
+			s = s[1:]
+		case '[':
+			p = p[1:]
+			not := len(p) > 0 && p[0] == '^'
+			if not {
+				p = p[1:]
+			}
+			match := false
+			// 结束时p指向 ]，没有 ] 时一直匹配到模式末尾
+			for len(p) > 0 && p[0] != ']' {
+				switch {
+				case p[0] == '\\' && len(p) >= 2:
+					p = p[1:]
+					match = match || p[0] == s[0]
+				case len(p) >= 3 && p[1] == '-':
+					start, end, c := p[0], p[2], s[0]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = lowerByte(start), lowerByte(end), lowerByte(c)
+					}
+					p = p[2:]
+					match = match || (c >= start && c <= end)
+				default:
+					match = match || equalByte(p[0], s[0], nocase)
+				}
+				p = p[1:]
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(p) >= 2 {
+				p = p[1:]
+			}
+			fallthrough
+		default:
+			if !equalByte(p[0], s[0], nocase) {
+				return false
+			}
+			s = s[1:]
+		}
+		if len(p) > 0 {
+			p = p[1:]
+		}
+	}
+	if len(s) == 0 {
+		for len(p) > 0 && p[0] == '*' {
+			p = p[1:]
+		}
+	}
+	return len(p) == 0 && len(s) == 0
+}
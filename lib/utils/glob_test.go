@@ -0,0 +1,40 @@
+package utils
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, str string
+		nocase       bool
+		want         bool
+	}{
+		{"*", "", false, true},
+		{"*", "abc", false, true},
+		{"h?llo", "hello", false, true},
+		{"h?llo", "hllo", false, false},
+		{"h*llo", "heeeello", false, true},
+		{"h[ae]llo", "hallo", false, true},
+		{"h[ae]llo", "hillo", false, false},
+		{"h[^e]llo", "hallo", false, true},
+		{"h[^e]llo", "hello", false, false},
+		{"h[a-b]llo", "hbllo", false, true},
+		{"h[b-a]llo", "hallo", false, true},
+		{"h[a-b]llo", "hcllo", false, false},
+		{`h\*llo`, "h*llo", false, true},
+		{`h\*llo`, "hello", false, false},
+		{"user:*:name", "user:1000:name", false, true},
+		{"user:*:name", "user:1000:age", false, false},
+		{"HELLO", "hello", true, true},
+		{"HELLO", "hello", false, false},
+		{"[A-C]x", "bx", true, true},
+		{"a*a*a*a*a*a*a*a*b", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", false, false},
+		{"abc*", "ab", false, false},
+		{"ab[", "abc", false, false},
+		{"ab[c", "abc", false, true},
+	}
+	for _, c := range cases {
+		if got := GlobMatch(c.pattern, c.str, c.nocase); got != c.want {
+			t.Errorf("GlobMatch(%q, %q, %v) = %v, want %v", c.pattern, c.str, c.nocase, got, c.want)
+		}
+	}
+}
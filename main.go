@@ -5,13 +5,20 @@ import (
 	"code/regis/command"
 	"code/regis/conf"
 	log "code/regis/lib"
-	"code/regis/redis"
 	"code/regis/tcp"
 	"time"
 )
 
 var tick = time.NewTimer(time.Second)
 
+const (
+	// activeExpireHz 每秒主动过期的次数，每次最多占用主协程 1/4 的时间
+	activeExpireHz        = 10
+	activeExpireTimeLimit = time.Second / activeExpireHz / 4
+)
+
+var expireTick = time.NewTicker(time.Second / activeExpireHz)
+
 func TimeTicker() {
 	for {
 		select {
@@ -32,7 +39,13 @@ func Executor() {
 		select {
 		case cmd := <-tcp.Server.GetWorkChan():
 			func() {
-				defer cmd.Conn.CmdDone(cmd)
+				defer func() {
+					// BLPOP 这类命令阻塞时不回复客户端，等被唤醒或者超时的时候再回复
+					if !cmd.Conn.IsBlocked() {
+						cmd.Conn.CmdDone(cmd)
+					}
+					command.ServeClientsBlockedOnKeys()
+				}()
 				cmd.Conn.LastBeat = time.Now()
 				log.Info("get %v %v", cmd.Query, cmd.Conn.RemoteAddr())
 				if !tcp.Server.PassExec(cmd.Conn) {
@@ -40,49 +53,17 @@ func Executor() {
 					return
 				}
 
-				// 空命令，忽略
-				if len(cmd.Query) == 0 {
-					cmd.Reply = redis.NilReply
-					return
-				}
-
-				cmdInfo, ok := command.GetCmdInfo(cmd.Query[0])
-
-				// 未知命令，报错
-				if !ok {
-					log.Error("command not found %v", cmd.Query)
-					cmd.Reply = redis.UnknownCmdErrReply(cmd.Query[0])
-					return
-				}
-
-				// 命令参数数量不对，报错
-				if !cmdInfo.Validate(cmd.Query) {
-					cmd.Reply = redis.ArgNumErrReply(cmd.Query[0])
-					return
-				}
-
-				// 如果自己是slave，只接收master的write命令
-				// 而master的write命令又全部由 tcp.Client 来转发
-				// 所以，当自己是slave时，写命令只接收 tcp.Client 的
-				if tcp.Server.Master != nil &&
-					cmdInfo.HasAttr(base.CmdWrite) &&
-					cmd.Conn.RemoteAddr() != tcp.Client.LocalAddr() {
-					log.Error("I'm slave, %v call me write! 😡 I only accept %v write!😤",
-						cmd.Conn.RemoteAddr(), tcp.Client.LocalAddr())
-					cmd.Reply = redis.ErrReply("ERR not write when slave")
-					return
-				}
-
-				cmd.Reply = cmdInfo.Exec(cmd.Conn, cmd.Query)
-
-				if cmdInfo.HasAttr(base.CmdPropagate) {
-					//tcp.ReplicationFeedSlavesFromMasterStream()
-					cmdBs := redis.CmdSReply(cmd.Query...).Bytes()
-					tcp.ReplicationFeedSlaves(cmdBs, cmd.Conn.DBIndex)
-				}
+				cmd.Reply = command.ExecCommand(cmd.Conn, cmd.Query)
 			}()
 
 			//time.Sleep(100 * time.Millisecond)
+		case <-expireTick.C:
+			// 自己是slave时，过期的key由master通过del同步过来
+			if tcp.Server.Master == nil && tcp.Server.DB.ActiveExpireCycle(activeExpireTimeLimit) {
+				tcp.Server.StatExpiredTimeCapReached++
+			}
+		case req := <-tcp.Server.GetUnblockChan():
+			tcp.Server.HandleUnblock(req)
 		case index := <-base.NeedMoving:
 			log.Info("moving %v", index)
 			if tcp.Server.DB.GetSDB(index).GetStatus() == base.WorldMoving {
@@ -124,7 +124,11 @@ func Parse2Payload(conn io.Reader) chan Payload {
 }
 
 func Parse2Reply(conn io.Reader) base.Reply {
-	r := bufio.NewReader(conn)
+	return parseReply(bufio.NewReader(conn))
+}
+
+// parseReply 数组元素需要共用同一个 bufio.Reader，否则已缓冲的后续元素会丢失
+func parseReply(r *bufio.Reader) base.Reply {
 	msg, err := r.ReadBytes('\n')
 	if err != nil {
 		return NilReply
@@ -142,7 +146,7 @@ func Parse2Reply(conn io.Reader) base.Reply {
 		}
 		query := make([]base.Reply, argsNum)
 		for i := 0; i < int(argsNum); i++ {
-			query[i] = Parse2Reply(conn)
+			query[i] = parseReply(r)
 		}
 		return MultiReply(query)
 	case PrefixBulk[0]:
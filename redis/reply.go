@@ -65,7 +65,7 @@ func BulkReply(Arg []byte) *bulkReply {
 }
 
 func (r *bulkReply) Bytes() []byte {
-	if len(r.Arg) == 0 {
+	if r.Arg == nil {
 		return []byte("$-1\r\n")
 	}
 	return []byte(string(PrefixBulk) + strconv.Itoa(len(r.Arg)) + CRLF + string(r.Arg) + CRLF)
@@ -143,6 +143,26 @@ func (r *interfacesReply) Bytes() []byte {
 	return []byte(ret)
 }
 
+// stringsReply 用于返回多个字符串，空数组时返回 *0
+type stringsReply struct {
+	msg []string
+}
+
+func StringsReply(q []string) *stringsReply {
+	return &stringsReply{msg: q}
+}
+
+func (r *stringsReply) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%v%v%v", PrefixArray, len(r.msg), CRLF))
+	for i := range r.msg {
+		buf.WriteString(fmt.Sprintf("%v%v%v", PrefixBulk, len(r.msg[i]), CRLF))
+		buf.WriteString(r.msg[i])
+		buf.WriteString(CRLF)
+	}
+	return buf.Bytes()
+}
+
 // mulReply 用于返回多行reply信息
 type multiReply struct {
 	r []base.Reply
@@ -163,6 +183,23 @@ func (r *multiReply) Bytes() []byte {
 	return []byte(ret)
 }
 
+// seqReply 用于一条命令依次回复多条消息，比如 SUBSCRIBE 多个频道时每个频道回复一条
+type seqReply struct {
+	r []base.Reply
+}
+
+func SeqReply(q []base.Reply) *seqReply {
+	return &seqReply{r: q}
+}
+
+func (r *seqReply) Bytes() []byte {
+	var buf bytes.Buffer
+	for i := range r.r {
+		buf.Write(r.r[i].Bytes())
+	}
+	return buf.Bytes()
+}
+
 // cmdReply 用于返回一行客户端执行的cmd，也是fake client的命令请求信息
 type cmdReply struct {
 	cmd []interface{}
@@ -261,6 +298,24 @@ func (r *nilReply) Bytes() []byte {
 	return []byte("$-1\r\n")
 }
 
+// NilArrayReply is (nil)，用于需要返回数组的命令
+type nilArrayReply struct{}
+
+var NilArrayReply = &nilArrayReply{}
+
+func (r *nilArrayReply) Bytes() []byte {
+	return []byte("*-1\r\n")
+}
+
+// EmptyArrayReply is (empty array)
+type emptyArrayReply struct{}
+
+var EmptyArrayReply = &emptyArrayReply{}
+
+func (r *emptyArrayReply) Bytes() []byte {
+	return []byte("*0\r\n")
+}
+
 // IntReply 返回一个数字
 type intReply struct {
 	num int
@@ -389,3 +444,12 @@ var IntErrReply = &intErrReply{}
 func (r *intErrReply) Bytes() []byte {
 	return []byte("-ERR value is not an integer or out of range\r\n")
 }
+
+// floatErrReply 当输入一个值，它应当转化为float，但是无法转化或者是NaN时报错
+type floatErrReply struct{}
+
+var FloatErrReply = &floatErrReply{}
+
+func (r *floatErrReply) Bytes() []byte {
+	return []byte("-ERR value is not a valid float\r\n")
+}
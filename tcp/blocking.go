@@ -0,0 +1,168 @@
+package tcp
+
+import (
+	"code/regis/base"
+	log "code/regis/lib"
+	"time"
+)
+
+// 阻塞命令，比如 BLPOP, BRPOP, BLMOVE
+// 主协程只有一个，所以阻塞的客户端不能真的阻塞主协程，做法和redis一样：
+// 1. 命令发现所有key都没有数据时，调用 RegisConn.Block 把客户端挂到 blockingKeys 上，主协程不回复它，直接处理下一条命令
+// 2. 写命令往有客户端阻塞的key中写入数据时，调用 RegisServer.SignalKeyAsReady 记下这个key
+// 3. 主协程每执行完一条命令，按阻塞的先后顺序，重新执行阻塞在ready key上的客户端的命令，再回复它们
+// 4. 超时或者客户端断开时，通过 unblockChan 通知主协程，由主协程把客户端移出 blockingKeys
+
+// blockState 客户端阻塞时的状态
+type blockState struct {
+	query        []string   // 阻塞的命令，被唤醒时重新执行
+	keys         []string   // 阻塞在哪些key上
+	dbIndex      int        // 阻塞时所在的db
+	timeoutReply base.Reply // 超时的时候回复给客户端的内容
+	timer        *time.Timer
+}
+
+// UnblockReq 通知主协程解除客户端的阻塞
+type UnblockReq struct {
+	conn *RegisConn
+	// state 为nil时表示客户端断开连接，否则表示 state 对应的那次阻塞超时了
+	state *blockState
+	err   error
+}
+
+// ReadyKey 有客户端阻塞、且被写入了数据的key
+type ReadyKey struct {
+	DBIndex int
+	Key     string
+}
+
+// Block 让客户端阻塞在keys上，timeout 为0表示永不超时
+func (c *RegisConn) Block(query, keys []string, timeout time.Duration, timeoutReply base.Reply) {
+	// 和redis一样，事务中的阻塞命令当作立即超时
+	if c.ExecutingMulti() {
+		c.multi.timeoutReply = timeoutReply
+		return
+	}
+	state := &blockState{
+		query:        query,
+		keys:         keys,
+		dbIndex:      c.DBIndex,
+		timeoutReply: timeoutReply,
+	}
+	c.blocked = state
+	dbKeys, ok := Server.blockingKeys[c.DBIndex]
+	if !ok {
+		dbKeys = make(map[string][]*RegisConn)
+		Server.blockingKeys[c.DBIndex] = dbKeys
+	}
+	for _, key := range keys {
+		dbKeys[key] = append(dbKeys[key], c)
+	}
+	if timeout > 0 {
+		state.timer = time.AfterFunc(timeout, func() {
+			Server.unblockChan <- &UnblockReq{conn: c, state: state}
+		})
+	}
+}
+
+// IsBlocked 客户端是否正阻塞着
+func (c *RegisConn) IsBlocked() bool {
+	return c.blocked != nil
+}
+
+// BlockedQuery 返回客户端阻塞的命令
+func (c *RegisConn) BlockedQuery() []string {
+	if c.blocked == nil {
+		return nil
+	}
+	return c.blocked.query
+}
+
+// Unblock 将客户端移出 blockingKeys，并停止超时定时器
+func (c *RegisConn) Unblock() {
+	state := c.blocked
+	if state == nil {
+		return
+	}
+	c.blocked = nil
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	dbKeys := Server.blockingKeys[state.dbIndex]
+	for _, key := range state.keys {
+		conns := dbKeys[key]
+		for i := range conns {
+			if conns[i] == c {
+				conns = append(conns[:i], conns[i+1:]...)
+				break
+			}
+		}
+		if len(conns) == 0 {
+			delete(dbKeys, key)
+		} else {
+			dbKeys[key] = conns
+		}
+	}
+}
+
+// SignalKeyAsReady 有数据写入key时调用，key上没有阻塞的客户端时什么都不做
+func (s *RegisServer) SignalKeyAsReady(dbIndex int, key string) {
+	if len(s.blockingKeys[dbIndex][key]) == 0 {
+		return
+	}
+	for _, rk := range s.readyKeys {
+		if rk.DBIndex == dbIndex && rk.Key == key {
+			return
+		}
+	}
+	s.readyKeys = append(s.readyKeys, ReadyKey{DBIndex: dbIndex, Key: key})
+}
+
+// TakeReadyKeys 取出并清空当前所有的ready key
+func (s *RegisServer) TakeReadyKeys() []ReadyKey {
+	ret := s.readyKeys
+	s.readyKeys = nil
+	return ret
+}
+
+// BlockedClients 按阻塞的先后顺序返回阻塞在key上的客户端
+func (s *RegisServer) BlockedClients(dbIndex int, key string) []*RegisConn {
+	conns := s.blockingKeys[dbIndex][key]
+	ret := make([]*RegisConn, len(conns))
+	copy(ret, conns)
+	return ret
+}
+
+// BlockedClientsNum 当前阻塞的客户端数量
+func (s *RegisServer) BlockedClientsNum() int {
+	conns := make(map[*RegisConn]struct{})
+	for _, dbKeys := range s.blockingKeys {
+		for _, cs := range dbKeys {
+			for _, c := range cs {
+				conns[c] = struct{}{}
+			}
+		}
+	}
+	return len(conns)
+}
+
+func (s *RegisServer) GetUnblockChan() <-chan *UnblockReq {
+	return s.unblockChan
+}
+
+// HandleUnblock 由主协程调用，处理超时或断开的阻塞客户端
+func (s *RegisServer) HandleUnblock(req *UnblockReq) {
+	c := req.conn
+	// 客户端已经被唤醒了，或者这是上一次阻塞的定时器
+	if c.blocked == nil || (req.state != nil && req.state != c.blocked) {
+		return
+	}
+	state := c.blocked
+	c.Unblock()
+	if req.state == nil {
+		log.Info("blocked client %v closed", c.RemoteAddr())
+		c.CmdDone(&Command{Conn: c, Err: req.err})
+		return
+	}
+	c.CmdDone(&Command{Conn: c, Reply: state.timeoutReply})
+}
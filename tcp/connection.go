@@ -41,7 +41,24 @@ type RegisConn struct {
 
 	// 存储客户端订阅的频道 channel -> struct{}
 	PubsubList map[string]struct{}
-	//PubsubPattern *ds.LinkedList
+	// 存储客户端订阅的模式 pattern -> struct{}
+	PubsubPattern map[string]struct{}
+
+	// rewrite 不为nil时，向slave传播的是 rewrite 而不是客户端发来的原命令
+	// 用于 spop 这类在slave上重放时结果不确定的命令，比如 spop 要改写成 srem
+	rewrite [][]string
+
+	// blocked 不为nil时，表示客户端正阻塞在 BLPOP 这类命令上
+	blocked *blockState
+
+	// multi 不为nil时，表示客户端在 MULTI 之后、EXEC 之前，见 multi.go
+	multi *multiState
+	// watchedKeys 客户端 watch 的key，dirtyCAS 为true表示其中有key被修改了
+	watchedKeys []watchedKey
+	dirtyCAS    bool
+
+	// closeAfterReply 为true时，回复完本次命令就关闭连接，用于 QUIT
+	closeAfterReply bool
 
 	replicaForRegisConn
 }
@@ -53,20 +70,158 @@ func (c *RegisConn) RemoteAddr() string {
 func (c *RegisConn) Close() {
 	log.Info("connection close")
 	c.UnSubscribeAll()
+	c.UnWatchAll()
 	Server.CloseConn(c.ID)
 }
 
+// UnSubscribeAll 取消所有订阅，客户端断开时可能在自己的协程里调用
 func (c *RegisConn) UnSubscribeAll() {
+	Server.pubsubLock.Lock()
+	defer Server.pubsubLock.Unlock()
 	for key := range c.PubsubList {
-		// 获取server的订阅dict
-		if subs, ok := Server.PubsubDict[key]; ok {
-			// 将conn从server的订阅list中删除
-			delete(subs, c.ID)
+		c.unSubscribeChannel(key)
+	}
+	for pattern := range c.PubsubPattern {
+		c.unSubscribePattern(pattern)
+	}
+}
+
+// SubscribeChannel 订阅频道，返回之前是否没有订阅
+func (c *RegisConn) SubscribeChannel(channel string) bool {
+	Server.pubsubLock.Lock()
+	defer Server.pubsubLock.Unlock()
+	if _, ok := c.PubsubList[channel]; ok {
+		return false
+	}
+	// 获取server的订阅dict
+	subs, ok := Server.PubsubDict[channel]
+	if !ok {
+		subs = make(map[int64]*RegisConn, 16)
+		Server.PubsubDict[channel] = subs
+	}
+	// 将conn加入server的订阅dict
+	subs[c.ID] = c
+
+	// conn自己更新自己的订阅dict
+	c.PubsubList[channel] = struct{}{}
+	return true
+}
+
+// SubscribePattern 订阅模式，同 SubscribeChannel
+func (c *RegisConn) SubscribePattern(pattern string) bool {
+	Server.pubsubLock.Lock()
+	defer Server.pubsubLock.Unlock()
+	if _, ok := c.PubsubPattern[pattern]; ok {
+		return false
+	}
+	subs, ok := Server.PubsubPattern[pattern]
+	if !ok {
+		subs = make(map[int64]*RegisConn, 16)
+		Server.PubsubPattern[pattern] = subs
+	}
+	subs[c.ID] = c
+	c.PubsubPattern[pattern] = struct{}{}
+	return true
+}
+
+// UnSubscribeChannel 取消订阅频道，频道没人订阅了就从server的订阅dict中删掉，返回之前是否订阅了
+func (c *RegisConn) UnSubscribeChannel(channel string) bool {
+	Server.pubsubLock.Lock()
+	defer Server.pubsubLock.Unlock()
+	return c.unSubscribeChannel(channel)
+}
+
+func (c *RegisConn) unSubscribeChannel(channel string) bool {
+	// 获取server的订阅dict
+	if subs, ok := Server.PubsubDict[channel]; ok {
+		// 将conn从server的订阅list中删除
+		delete(subs, c.ID)
+		if len(subs) == 0 {
+			delete(Server.PubsubDict, channel)
 		}
+	}
 
-		// conn自己更新自己的订阅list，取消订阅该频道
-		delete(c.PubsubList, key)
+	// conn自己更新自己的订阅list，取消订阅该频道
+	_, ok := c.PubsubList[channel]
+	delete(c.PubsubList, channel)
+	return ok
+}
+
+// UnSubscribePattern 取消订阅模式，同 UnSubscribeChannel
+func (c *RegisConn) UnSubscribePattern(pattern string) bool {
+	Server.pubsubLock.Lock()
+	defer Server.pubsubLock.Unlock()
+	return c.unSubscribePattern(pattern)
+}
+
+func (c *RegisConn) unSubscribePattern(pattern string) bool {
+	if subs, ok := Server.PubsubPattern[pattern]; ok {
+		delete(subs, c.ID)
+		if len(subs) == 0 {
+			delete(Server.PubsubPattern, pattern)
+		}
 	}
+
+	_, ok := c.PubsubPattern[pattern]
+	delete(c.PubsubPattern, pattern)
+	return ok
+}
+
+// SubscriptionCount 客户端订阅的频道数加上模式数
+func (c *RegisConn) SubscriptionCount() int {
+	Server.pubsubLock.Lock()
+	defer Server.pubsubLock.Unlock()
+	return len(c.PubsubList) + len(c.PubsubPattern)
+}
+
+// SubscribedChannels 客户端订阅的所有频道
+func (c *RegisConn) SubscribedChannels() []string {
+	Server.pubsubLock.Lock()
+	defer Server.pubsubLock.Unlock()
+	ret := make([]string, 0, len(c.PubsubList))
+	for channel := range c.PubsubList {
+		ret = append(ret, channel)
+	}
+	return ret
+}
+
+// SubscribedPatterns 客户端订阅的所有模式
+func (c *RegisConn) SubscribedPatterns() []string {
+	Server.pubsubLock.Lock()
+	defer Server.pubsubLock.Unlock()
+	ret := make([]string, 0, len(c.PubsubPattern))
+	for pattern := range c.PubsubPattern {
+		ret = append(ret, pattern)
+	}
+	return ret
+}
+
+// InPubSub 客户端是否处于订阅状态，订阅了至少一个频道或模式就进入，全部取消后退出
+// 订阅状态下只能执行 SUBSCRIBE 这类命令，见 command.cmdInfo.AllowedInPubSub
+func (c *RegisConn) InPubSub() bool {
+	return c.SubscriptionCount() > 0
+}
+
+// CloseAfterReply 回复完本次命令后关闭连接
+func (c *RegisConn) CloseAfterReply() {
+	c.closeAfterReply = true
+}
+
+// Rewrite 改写本次命令传播给slave的内容，可以多次调用，一个都不传表示本次不传播
+func (c *RegisConn) Rewrite(query ...[]string) {
+	if c.rewrite == nil {
+		c.rewrite = make([][]string, 0, len(query))
+	}
+	c.rewrite = append(c.rewrite, query...)
+}
+
+// PropagateQuery 返回本次命令真正要传播给slave的命令，并清掉改写
+func (c *RegisConn) PropagateQuery(query []string) [][]string {
+	defer func() { c.rewrite = nil }()
+	if c.rewrite == nil {
+		return [][]string{query}
+	}
+	return c.rewrite
 }
 
 func (c *RegisConn) Write(b []byte) error {
@@ -95,9 +250,17 @@ func (c *RegisConn) Handle() {
 
 	// 1. 2. 3. 解析客户端的命令并放入workChan中
 	pC := redis.Parse2Payload(c.Conn)
+	// pending 等待上一条命令完成时读到的payload
+	var pending *redis.Payload
 	for {
 		// 阻塞获取payload
-		pc := <-pC
+		var pc redis.Payload
+		if pending != nil {
+			pc = *pending
+			pending = nil
+		} else {
+			pc = <-pC
+		}
 		if pc.Err != nil {
 			log.Error("connection err %v %v %v", pc.Err, c.ID, c.RemoteAddr())
 			c.Close()
@@ -111,13 +274,35 @@ func (c *RegisConn) Handle() {
 		// 将Command放入工作队列中，等待主协程完成
 		Server.workChan <- cmd
 		// 4. 阻塞等待cmd完成
-		doneCMD := <-c.doneChan
+		doneCMD := c.waitDone(pC, &pending)
 		if doneCMD.Err != nil {
 			log.Error("connection err %v", doneCMD.Err)
 			c.Close()
 			return
 		}
 		c.Reply(doneCMD.Reply)
+		if c.closeAfterReply {
+			c.Close()
+			return
+		}
+	}
+}
+
+// waitDone 等待主协程完成命令，BLPOP 这类命令可能要等很久
+// 等待期间继续读取客户端，读到的下一条命令暂存在 pending 中，
+// 如果读到错误，说明客户端断开了，要通知主协程把它移出阻塞队列
+func (c *RegisConn) waitDone(pC chan redis.Payload, pending **redis.Payload) *Command {
+	for {
+		select {
+		case done := <-c.doneChan:
+			return done
+		case pc := <-pC:
+			*pending = &pc
+			pC = nil
+			if pc.Err != nil {
+				Server.unblockChan <- &UnblockReq{conn: c, err: pc.Err}
+			}
+		}
 	}
 }
 
@@ -127,11 +312,11 @@ func (c *RegisConn) CmdDone(cmd *Command) {
 
 func NewConnection(conn net.Conn) *RegisConn {
 	c := &RegisConn{
-		ID:         utils.GetConnFd(conn),
-		Conn:       conn,
-		doneChan:   make(chan *Command),
-		PubsubList: make(map[string]struct{}),
-		//PubsubPattern: ds.NewLinkedList(),
+		ID:            utils.GetConnFd(conn),
+		Conn:          conn,
+		doneChan:      make(chan *Command, 1),
+		PubsubList:    make(map[string]struct{}),
+		PubsubPattern: make(map[string]struct{}),
 	}
 	log.Debug("get Conn client %v", c.ID)
 	go c.Handle()
@@ -0,0 +1,178 @@
+package tcp
+
+import (
+	"code/regis/base"
+)
+
+// 事务 MULTI/EXEC/DISCARD/WATCH
+// 和redis一样，MULTI 之后客户端的命令只做检查、不执行，放进队列，EXEC 时由主协程一次执行完，
+// 主协程只有一个，执行期间不会插入别的客户端的命令，所以事务天然是原子的
+// WATCH 的key被修改时（见 base.OnKeyModified），watch它的客户端被标记为 dirtyCAS，EXEC 时发现 dirtyCAS 就放弃执行
+
+// multiState 客户端 MULTI 之后的状态
+type multiState struct {
+	queue [][]string
+	// dirtyExec 入队时有命令出错，EXEC 时直接返回 EXECABORT
+	dirtyExec bool
+	// executing 正在执行 EXEC，这时阻塞命令不能真的阻塞
+	executing bool
+	// timeoutReply 执行 EXEC 时阻塞命令被当作立即超时，这里暂存超时的回复
+	timeoutReply base.Reply
+	// propagated 是否已经向slave传播了 MULTI
+	propagated bool
+}
+
+// watchedKey 客户端 watch 的key
+type watchedKey struct {
+	dbIndex int
+	key     string
+}
+
+// InMulti 客户端是否在 MULTI 之后、EXEC 之前
+func (c *RegisConn) InMulti() bool {
+	return c.multi != nil
+}
+
+func (c *RegisConn) StartMulti() {
+	c.multi = &multiState{}
+}
+
+// QueueMulti 把命令放进事务的队列中
+func (c *RegisConn) QueueMulti(query []string) {
+	c.multi.queue = append(c.multi.queue, query)
+}
+
+// FlagExecAbort 入队前检查命令出错时调用，不在事务中时什么都不做
+func (c *RegisConn) FlagExecAbort() {
+	if c.multi != nil {
+		c.multi.dirtyExec = true
+	}
+}
+
+// ExecAborted 入队时是否有命令出错
+func (c *RegisConn) ExecAborted() bool {
+	return c.multi != nil && c.multi.dirtyExec
+}
+
+// DirtyCAS watch的key是否被修改过
+func (c *RegisConn) DirtyCAS() bool {
+	Server.watchLock.Lock()
+	defer Server.watchLock.Unlock()
+	return c.dirtyCAS
+}
+
+// MultiQueue 返回事务队列中的命令，并标记开始执行
+func (c *RegisConn) MultiQueue() [][]string {
+	c.multi.executing = true
+	return c.multi.queue
+}
+
+// ExecutingMulti 是否正在执行 EXEC
+func (c *RegisConn) ExecutingMulti() bool {
+	return c.multi != nil && c.multi.executing
+}
+
+// TakeTimeoutReply 取出 EXEC 中阻塞命令的超时回复，命令没有阻塞时返回nil
+func (c *RegisConn) TakeTimeoutReply() base.Reply {
+	if c.multi == nil {
+		return nil
+	}
+	ret := c.multi.timeoutReply
+	c.multi.timeoutReply = nil
+	return ret
+}
+
+// MultiPropagated EXEC 执行过程中是否已经向slave传播了 MULTI
+func (c *RegisConn) MultiPropagated() bool {
+	return c.multi != nil && c.multi.propagated
+}
+
+func (c *RegisConn) SetMultiPropagated() {
+	c.multi.propagated = true
+}
+
+// DiscardMulti 结束事务，清掉队列和所有watch的key
+func (c *RegisConn) DiscardMulti() {
+	c.multi = nil
+	c.UnWatchAll()
+}
+
+// Watch watch当前db中的key，重复watch同一个key什么都不做
+func (c *RegisConn) Watch(key string) {
+	Server.watchLock.Lock()
+	defer Server.watchLock.Unlock()
+	for _, wk := range c.watchedKeys {
+		if wk.dbIndex == c.DBIndex && wk.key == key {
+			return
+		}
+	}
+	c.watchedKeys = append(c.watchedKeys, watchedKey{dbIndex: c.DBIndex, key: key})
+	dbKeys, ok := Server.watchedKeys[c.DBIndex]
+	if !ok {
+		dbKeys = make(map[string][]*RegisConn)
+		Server.watchedKeys[c.DBIndex] = dbKeys
+	}
+	dbKeys[key] = append(dbKeys[key], c)
+}
+
+// UnWatchAll 取消watch所有的key，并清掉 dirtyCAS
+func (c *RegisConn) UnWatchAll() {
+	Server.watchLock.Lock()
+	defer Server.watchLock.Unlock()
+	for _, wk := range c.watchedKeys {
+		dbKeys := Server.watchedKeys[wk.dbIndex]
+		conns := dbKeys[wk.key]
+		for i := range conns {
+			if conns[i] == c {
+				conns = append(conns[:i], conns[i+1:]...)
+				break
+			}
+		}
+		if len(conns) == 0 {
+			delete(dbKeys, wk.key)
+		} else {
+			dbKeys[wk.key] = conns
+		}
+	}
+	c.watchedKeys = nil
+	c.dirtyCAS = false
+}
+
+// ExpireWatchedKeys 删掉watch的key中已经过期的，和redis一样，watch之后过期的key也算被修改了
+// 删除时会回调 TouchWatchedKey，所以不能持有锁
+func (c *RegisConn) ExpireWatchedKeys() {
+	Server.watchLock.Lock()
+	keys := make([]watchedKey, len(c.watchedKeys))
+	copy(keys, c.watchedKeys)
+	Server.watchLock.Unlock()
+	for _, wk := range keys {
+		Server.DB.GetSDB(wk.dbIndex).GetData(wk.key)
+	}
+}
+
+// TouchWatchedKey key被修改时调用，watch它的客户端的 EXEC 都会失败
+func (s *RegisServer) TouchWatchedKey(dbIndex int, key string) {
+	s.watchLock.Lock()
+	defer s.watchLock.Unlock()
+	for _, c := range s.watchedKeys[dbIndex][key] {
+		c.dirtyCAS = true
+	}
+}
+
+// TouchAllWatchedKeys 清空所有db之前调用，被watch并且存在的key都算被修改了
+// GetData 删除过期key时会回调 TouchWatchedKey，所以检查key是否存在时不能持有锁
+func (s *RegisServer) TouchAllWatchedKeys() {
+	s.watchLock.Lock()
+	keys := make([]watchedKey, 0)
+	for dbIndex, dbKeys := range s.watchedKeys {
+		for key := range dbKeys {
+			keys = append(keys, watchedKey{dbIndex: dbIndex, key: key})
+		}
+	}
+	s.watchLock.Unlock()
+	for _, wk := range keys {
+		if _, ok := s.DB.GetSDB(wk.dbIndex).GetData(wk.key); ok {
+			s.TouchWatchedKey(wk.dbIndex, wk.key)
+		}
+	}
+}
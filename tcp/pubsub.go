@@ -0,0 +1,67 @@
+package tcp
+
+import (
+	"code/regis/lib/utils"
+)
+
+// 发布订阅关系的查询
+// 订阅和取消订阅见 RegisConn.SubscribeChannel 这些方法，它们大多在主协程执行，
+// 但是客户端断开时会在自己的协程里调用 RegisConn.UnSubscribeAll，所以订阅关系都要在 pubsubLock 下读写，
+// 给订阅者发消息时先在锁里复制一份订阅者，发送失败时连接会关闭并取消订阅，不能在锁里发送
+
+// ChannelSubscribers 订阅了频道的客户端
+func (s *RegisServer) ChannelSubscribers(channel string) []*RegisConn {
+	s.pubsubLock.Lock()
+	defer s.pubsubLock.Unlock()
+	subs := s.PubsubDict[channel]
+	ret := make([]*RegisConn, 0, len(subs))
+	for _, c := range subs {
+		ret = append(ret, c)
+	}
+	return ret
+}
+
+// PubsubChannels 有客户端订阅、并且和pattern匹配的频道
+func (s *RegisServer) PubsubChannels(pattern string) []string {
+	s.pubsubLock.Lock()
+	defer s.pubsubLock.Unlock()
+	ret := make([]string, 0)
+	for channel := range s.PubsubDict {
+		if utils.GlobMatch(pattern, channel, false) {
+			ret = append(ret, channel)
+		}
+	}
+	return ret
+}
+
+// NumSub 订阅了频道的客户端数，不包括模式订阅
+func (s *RegisServer) NumSub(channel string) int {
+	s.pubsubLock.Lock()
+	defer s.pubsubLock.Unlock()
+	return len(s.PubsubDict[channel])
+}
+
+// PatternSubscribers 和频道匹配的模式，以及订阅了这些模式的客户端 pattern -> []*RegisConn
+func (s *RegisServer) PatternSubscribers(channel string) map[string][]*RegisConn {
+	s.pubsubLock.Lock()
+	defer s.pubsubLock.Unlock()
+	ret := make(map[string][]*RegisConn)
+	for pattern, subs := range s.PubsubPattern {
+		if !utils.GlobMatch(pattern, channel, false) {
+			continue
+		}
+		conns := make([]*RegisConn, 0, len(subs))
+		for _, c := range subs {
+			conns = append(conns, c)
+		}
+		ret[pattern] = conns
+	}
+	return ret
+}
+
+// NumPat 被订阅的模式数
+func (s *RegisServer) NumPat() int {
+	s.pubsubLock.Lock()
+	defer s.pubsubLock.Unlock()
+	return len(s.PubsubPattern)
+}
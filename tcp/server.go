@@ -113,6 +113,12 @@ type safety struct {
 	Who        map[int64]*RegisConn // 存储已连接的connection，RegisConn.ID -> *RegisConn
 }
 
+// stat 运行时的统计数据，在 INFO 中展示
+type stat struct {
+	StatExpiredKeys           int64 // 因为过期被删除的key的数量，包括惰性删除和主动删除
+	StatExpiredTimeCapReached int64 // 主动过期因为超时而提前停下的次数
+}
+
 type RegisServer struct {
 	Address    string
 	maxClients int64
@@ -120,6 +126,7 @@ type RegisServer struct {
 	replication
 	sentinel
 	safety
+	stat
 
 	// DB 是服务端的主数据库
 	DB base.DB
@@ -130,8 +137,25 @@ type RegisServer struct {
 	//LastBGSaveStatus int
 
 	// PubsubDict 保存所有频道的订阅关系 channel -> RegisConn.ID -> *RegisConn
+	// 客户端断开时在自己的协程里取消订阅，所以读写都要持有 pubsubLock，见 pubsub.go
 	PubsubDict map[string]map[int64]*RegisConn
-	//pubsubPattern *ds.LinkedList
+	// PubsubPattern 保存所有模式的订阅关系 pattern -> RegisConn.ID -> *RegisConn，同样要持有 pubsubLock
+	PubsubPattern map[string]map[int64]*RegisConn
+
+	// blockingKeys 保存阻塞在key上的客户端 dbIndex -> key -> []*RegisConn，按阻塞的先后排列
+	blockingKeys map[int]map[string][]*RegisConn
+	// readyKeys 有客户端阻塞、且被写入了数据的key，由主协程在命令执行完后统一处理
+	readyKeys []ReadyKey
+	// unblockChan 阻塞的客户端超时或者断开时，通过它通知主协程
+	unblockChan chan *UnblockReq
+
+	// watchedKeys 保存watch了key的客户端 dbIndex -> key -> []*RegisConn
+	// 客户端断开时在自己的协程里取消watch，所以要加锁
+	watchedKeys map[int]map[string][]*RegisConn
+	watchLock   sync.Mutex
+
+	// pubsubLock 保护订阅关系，包括每个客户端自己的订阅列表
+	pubsubLock sync.Mutex
 }
 
 func (s *RegisServer) PassExec(c *RegisConn) bool {
@@ -197,6 +221,9 @@ func (s *RegisServer) GetInfo() string {
 	serverInfo += fmt.Sprintf("master_offset:%v\n", s.MasterReplOffset)
 	serverInfo += fmt.Sprintf("replid2:%v\n", s.Replid2)
 	serverInfo += fmt.Sprintf("master_offset2:%v\n", s.MasterReplOffset2)
+	serverInfo += fmt.Sprintf("blocked_clients:%v\n", s.BlockedClientsNum())
+	serverInfo += fmt.Sprintf("expired_keys:%v\n", s.StatExpiredKeys)
+	serverInfo += fmt.Sprintf("expired_time_cap_reached_count:%v\n", s.StatExpiredTimeCapReached)
 	serverInfo += fmt.Sprintf("role:%v\n", utils.IF(s.Master == nil, "master", "slave"))
 	serverInfo += fmt.Sprintf("connected_slaves:%v\n", len(s.Slave))
 	if len(s.Slave) > 0 {
@@ -276,7 +303,11 @@ func InitServer(prop *conf.RegisConf) *RegisServer {
 	server.workChan = make(chan *Command)
 
 	server.PubsubDict = make(map[string]map[int64]*RegisConn, 128)
-	//server.pubsubPattern = ds.NewLinkedList()
+	server.PubsubPattern = make(map[string]map[int64]*RegisConn, 16)
+
+	server.blockingKeys = make(map[int]map[string][]*RegisConn)
+	server.unblockChan = make(chan *UnblockReq)
+	server.watchedKeys = make(map[int]map[string][]*RegisConn)
 
 	server.Slave = make(map[int64]*RegisConn, 8)
 